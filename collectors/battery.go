@@ -0,0 +1,58 @@
+package collectors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errNoBattery is what readBattery returns on systems without a battery.
+var errNoBattery = errors.New("no battery")
+
+// batteryStatus is the state of the batteries of a laptop: the charge, in
+// percent, and the power that flows into them, in watts. The power is
+// negative while the batteries discharge.
+type batteryStatus struct {
+	pct, watts float64
+}
+
+// BatteryMetrics returns the data functions for the battery of a laptop:
+//
+//   - battery.pct: charge, in percent
+//   - battery.watts: charge rate, in watts; negative while discharging
+//
+// With more than one battery, battery.pct is their average charge and
+// battery.watts the sum of their rates. A system without a battery, like
+// a desktop or a container, gets no metrics at all, rather than a flat 0.
+//
+// Each function waits for interval before it reads its value. A failed
+// reading, as when a battery gets swapped, is skipped.
+func BatteryMetrics(interval time.Duration) ([]Metric, error) {
+	_, err := readBattery()
+	if errors.Is(err, errNoBattery) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading the battery: %s", err)
+	}
+	read := func(value func(batteryStatus) float64) func() float64 {
+		return pollSkipping(interval, func() (float64, error) {
+			s, err := readBattery()
+			return value(s), err
+		})
+	}
+	return []Metric{
+		{
+			Name:        "battery.pct",
+			Unit:        "percent",
+			Description: "Battery charge, in percent",
+			Func:        read(func(s batteryStatus) float64 { return s.pct }),
+		},
+		{
+			Name:        "battery.watts",
+			Unit:        "watt",
+			Description: "Power into the battery, in watts; negative while discharging",
+			Func:        read(func(s batteryStatus) float64 { return s.watts }),
+		},
+	}, nil
+}
@@ -0,0 +1,79 @@
+package collectors
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// readBattery asks pmset for the charge and ioreg for the power. macOS
+// reports the battery's current and voltage, but not its power.
+func readBattery() (batteryStatus, error) {
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return batteryStatus{}, err
+	}
+	pct, err := parsePmset(out)
+	if err != nil {
+		return batteryStatus{}, err
+	}
+	out, err = exec.Command("ioreg", "-r", "-n", "AppleSmartBattery").Output()
+	if err != nil {
+		return batteryStatus{}, err
+	}
+	watts, err := parseSmartBattery(out)
+	if err != nil {
+		return batteryStatus{}, err
+	}
+	return batteryStatus{pct: pct, watts: watts}, nil
+}
+
+// pmsetBattery matches the battery lines of `pmset -g batt`, like
+//
+//	-InternalBattery-0 (id=4653155)	85%; discharging; 4:12 remaining present: true
+var pmsetBattery = regexp.MustCompile(`-InternalBattery-\d+.*?\t(\d+)%;`)
+
+// parsePmset returns the average charge of the batteries that pmset
+// lists. Without a battery, pmset lists only the power source, like
+// "Now drawing from 'AC Power'".
+func parsePmset(out []byte) (float64, error) {
+	matches := pmsetBattery.FindAllSubmatch(out, -1)
+	if len(matches) == 0 {
+		return 0, errNoBattery
+	}
+	var sum float64
+	for _, m := range matches {
+		pct, err := strconv.ParseFloat(string(m[1]), 64)
+		if err != nil {
+			return 0, err
+		}
+		sum += pct
+	}
+	return sum / float64(len(matches)), nil
+}
+
+// smartBatteryProperty matches a property of ioreg's AppleSmartBattery,
+// like `"Voltage" = 12591`.
+var smartBatteryProperty = regexp.MustCompile(`"(Voltage|Amperage)" = (\d+)`)
+
+// parseSmartBattery returns the power of the battery from its voltage and
+// current, in millivolts and milliamperes. ioreg prints the current as
+// an unsigned 64-bit number, so a negative current, while discharging,
+// shows up as a number close to 2^64.
+func parseSmartBattery(out []byte) (float64, error) {
+	values := map[string]float64{}
+	for _, m := range smartBatteryProperty.FindAllSubmatch(out, -1) {
+		v, err := strconv.ParseUint(string(m[2]), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		values[string(m[1])] = float64(int64(v))
+	}
+	mv, ok1 := values["Voltage"]
+	ma, ok2 := values["Amperage"]
+	if !ok1 || !ok2 {
+		return 0, fmt.Errorf("ioreg: no voltage or current for AppleSmartBattery")
+	}
+	return mv * ma / 1e6, nil
+}
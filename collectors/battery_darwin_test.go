@@ -0,0 +1,58 @@
+package collectors
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func readFixture(t *testing.T, path ...string) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join(append([]string{"testdata"}, path...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParsePmset(t *testing.T) {
+	tests := []struct {
+		file string
+		want float64
+		err  error
+	}{
+		{file: "discharging.txt", want: 85},
+		{file: "charged.txt", want: 100},
+		{file: "two_batteries.txt", want: 50},
+		// A Mac mini, and one on a UPS, which is no battery of its own.
+		{file: "desktop.txt", err: errNoBattery},
+		{file: "ups.txt", err: errNoBattery},
+	}
+	for _, tt := range tests {
+		got, err := parsePmset(readFixture(t, "pmset", tt.file))
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%s: %g, %v; want %g, %v", tt.file, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestParseSmartBattery(t *testing.T) {
+	tests := []struct {
+		file string
+		want float64
+		ok   bool
+	}{
+		// The current is -1441 mA, printed as 2^64-1441.
+		{file: "discharging.txt", want: -1441 * 12591 / 1e6, ok: true},
+		{file: "charging.txt", want: 30, ok: true},
+		{file: "desktop.txt"},
+	}
+	for _, tt := range tests {
+		got, err := parseSmartBattery(readFixture(t, "ioreg", tt.file))
+		if (err == nil) != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: %g, %v; want %g, ok %t", tt.file, got, err, tt.want, tt.ok)
+		}
+	}
+}
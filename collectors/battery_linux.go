@@ -0,0 +1,101 @@
+package collectors
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+)
+
+// powerSupplyDir is where Linux lists the power supplies, one directory
+// per supply. Laptop batteries are BAT0, BAT1, and so on; the batteries
+// of mice and keyboards have other names and are left out.
+const powerSupplyDir = "/sys/class/power_supply"
+
+// readBattery reads the attributes of all batteries.
+func readBattery() (batteryStatus, error) {
+	return readPowerSupplies(powerSupplyDir)
+}
+
+// readPowerSupplies reads the batteries in dir, a directory like
+// powerSupplyDir.
+func readPowerSupplies(dir string) (batteryStatus, error) {
+	dirs, err := filepath.Glob(filepath.Join(dir, "BAT*"))
+	if err != nil {
+		return batteryStatus{}, err
+	}
+	if len(dirs) == 0 {
+		return batteryStatus{}, errNoBattery
+	}
+	var total batteryStatus
+	for _, dir := range dirs {
+		s, err := parsePowerSupply(func(attr string) string {
+			return readLine(filepath.Join(dir, attr))
+		})
+		if err != nil {
+			return batteryStatus{}, fmt.Errorf("%s: %s", filepath.Base(dir), err)
+		}
+		total.pct += s.pct / float64(len(dirs))
+		total.watts += s.watts
+	}
+	return total, nil
+}
+
+// parsePowerSupply parses the attributes of a battery, which attr returns
+// by name, like "capacity". The charge is in capacity, in percent; drivers
+// without it report energy_now and energy_full, in microwatt hours, or
+// charge_now and charge_full, in microampere hours. The power is in
+// power_now, in microwatts, or, for batteries that report their current
+// instead, the product of current_now and voltage_now, in microamperes and
+// microvolts. Some drivers report a negative power while discharging,
+// others rely on the status; the status decides the sign.
+func parsePowerSupply(attr func(name string) string) (batteryStatus, error) {
+	pct, err := batteryPercent(attr)
+	if err != nil {
+		return batteryStatus{}, err
+	}
+	var watts float64
+	if p := attr("power_now"); p != "" {
+		uw, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return batteryStatus{}, fmt.Errorf("bad power_now %q", p)
+		}
+		watts = uw / 1e6
+	} else if c, v := attr("current_now"), attr("voltage_now"); c != "" && v != "" {
+		ua, err1 := strconv.ParseFloat(c, 64)
+		uv, err2 := strconv.ParseFloat(v, 64)
+		if err1 != nil || err2 != nil {
+			return batteryStatus{}, fmt.Errorf("bad current_now %q or voltage_now %q", c, v)
+		}
+		watts = ua * uv / 1e12
+	}
+	watts = math.Abs(watts)
+	if attr("status") == "Discharging" {
+		watts = -watts
+	}
+	return batteryStatus{pct: pct, watts: watts}, nil
+}
+
+// batteryPercent returns the charge of a battery in percent.
+func batteryPercent(attr func(name string) string) (float64, error) {
+	if c := attr("capacity"); c != "" {
+		pct, err := strconv.ParseFloat(c, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad capacity %q", c)
+		}
+		return pct, nil
+	}
+	for _, prefix := range []string{"energy", "charge"} {
+		now, full := attr(prefix+"_now"), attr(prefix+"_full")
+		if now == "" || full == "" {
+			continue
+		}
+		n, err1 := strconv.ParseFloat(now, 64)
+		f, err2 := strconv.ParseFloat(full, 64)
+		if err1 != nil || err2 != nil || f <= 0 {
+			return 0, fmt.Errorf("bad %s_now %q or %s_full %q", prefix, now, prefix, full)
+		}
+		return math.Min(n/f*100, 100), nil
+	}
+	return 0, fmt.Errorf("no capacity, energy_now, or charge_now")
+}
@@ -0,0 +1,84 @@
+package collectors
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPowerSupplies(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want batteryStatus
+		err  error
+	}{
+		// A desktop with a wireless mouse: the mouse battery does not count.
+		{dir: "desktop", err: errNoBattery},
+		// A container, where the directory is empty or missing.
+		{dir: "none", err: errNoBattery},
+		// A ThinkPad with two batteries, one of them idle.
+		{dir: "two_batteries", want: batteryStatus{pct: 70, watts: -8.5}},
+		// Drivers that report neither capacity nor current.
+		{dir: "energy_only", want: batteryStatus{pct: 75, watts: 12}},
+		// Drivers that report neither capacity nor power.
+		{dir: "charge_only", want: batteryStatus{pct: 50, watts: -18}},
+		{dir: "negative_power", want: batteryStatus{pct: 40, watts: -5}},
+		{dir: "full", want: batteryStatus{pct: 100, watts: 0}},
+	}
+	for _, tt := range tests {
+		got, err := readPowerSupplies(filepath.Join("testdata", "power_supply", tt.dir))
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: err = %v; want %v", tt.dir, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.dir, err)
+			continue
+		}
+		if math.Abs(got.pct-tt.want.pct) > 1e-9 || math.Abs(got.watts-tt.want.watts) > 1e-9 {
+			t.Errorf("%s: %+v; want %+v", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestParsePowerSupply(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs map[string]string
+		want  batteryStatus
+		ok    bool
+	}{
+		{
+			name:  "charge above full",
+			attrs: map[string]string{"charge_now": "4100000", "charge_full": "4000000", "status": "Full"},
+			want:  batteryStatus{pct: 100},
+			ok:    true,
+		},
+		{
+			name:  "energy before charge",
+			attrs: map[string]string{"energy_now": "1", "energy_full": "4", "charge_now": "3", "charge_full": "4"},
+			want:  batteryStatus{pct: 25},
+			ok:    true,
+		},
+		{
+			name:  "no power",
+			attrs: map[string]string{"capacity": "55", "status": "Discharging"},
+			want:  batteryStatus{pct: 55},
+			ok:    true,
+		},
+		{name: "bad capacity", attrs: map[string]string{"capacity": "many"}},
+		{name: "no charge", attrs: map[string]string{"power_now": "1000000"}},
+		{name: "full is 0", attrs: map[string]string{"energy_now": "1", "energy_full": "0"}},
+		{name: "bad power", attrs: map[string]string{"capacity": "50", "power_now": "x"}},
+		{name: "bad current", attrs: map[string]string{"capacity": "50", "current_now": "x", "voltage_now": "12000000"}},
+	}
+	for _, tt := range tests {
+		got, err := parsePowerSupply(func(name string) string { return tt.attrs[name] })
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%s: %+v, %v; want %+v, ok %t", tt.name, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package collectors
+
+// Windows and the BSDs report their batteries through APIs that the
+// collector does not use yet; they get no battery metrics.
+
+func readBattery() (batteryStatus, error) {
+	return batteryStatus{}, errNoBattery
+}
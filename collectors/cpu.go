@@ -0,0 +1,94 @@
+// Package collectors reads real system metrics, as data functions that
+// fit the article's trading loop:
+//
+//	trading(metric, collectors.NewCPULoadFunc(0, time.Second))
+//
+// Each data function blocks until its next value is due, like the fake
+// data functions of the article.
+package collectors
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// AllCores selects the load of all cores together in NewCPULoadFunc.
+const AllCores = -1
+
+// cpuTimes are the cumulative times of a core since boot, in the units of
+// the operating system (ticks or 100ns intervals). Only the ratio of the
+// deltas matters.
+type cpuTimes struct {
+	busy  uint64
+	total uint64
+}
+
+// CPUCores returns the number of CPU cores whose load can be read. It
+// fails if the system does not let the app read the CPU times, as in
+// containers on macOS or Windows, or on unsupported systems.
+func CPUCores() (int, error) {
+	times, err := readCPUTimes()
+	if err != nil {
+		return 0, fmt.Errorf("reading CPU times: %s", err)
+	}
+	return len(times), nil
+}
+
+// errUnsupported is what the collectors report on systems that they
+// cannot read.
+func errUnsupported() error {
+	if runtime.GOOS == "darwin" {
+		return fmt.Errorf("reading system metrics on macOS requires cgo")
+	}
+	return fmt.Errorf("not supported on %s", runtime.GOOS)
+}
+
+// NewCPULoadFunc returns a data function for the load of a core (from 0)
+// or AllCores, in percent. Each call waits for interval and returns the
+// load during the time since the previous call. With interval 0, it
+// returns right away, for callers that have a ticker of their own. If
+// reading the CPU times fails later on, the function keeps returning the
+// last value.
+func NewCPULoadFunc(core int, interval time.Duration) func() float64 {
+	var mu sync.Mutex
+	prev, _ := coreTimes(core)
+	var last float64
+	return func() float64 {
+		time.Sleep(interval)
+		mu.Lock()
+		defer mu.Unlock()
+		cur, err := coreTimes(core)
+		if err != nil {
+			return last
+		}
+		// Counters that went backwards (a 32-bit counter wrapped, say)
+		// just start over.
+		if cur.total > prev.total && cur.busy >= prev.busy {
+			last = 100 * float64(cur.busy-prev.busy) / float64(cur.total-prev.total)
+		}
+		prev = cur
+		return last
+	}
+}
+
+// coreTimes returns the times of a core, or the sum of all cores.
+func coreTimes(core int) (cpuTimes, error) {
+	times, err := readCPUTimes()
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	if core == AllCores {
+		var sum cpuTimes
+		for _, t := range times {
+			sum.busy += t.busy
+			sum.total += t.total
+		}
+		return sum, nil
+	}
+	if core < 0 || core >= len(times) {
+		return cpuTimes{}, fmt.Errorf("no CPU core %d", core)
+	}
+	return times[core], nil
+}
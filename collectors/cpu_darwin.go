@@ -0,0 +1,43 @@
+//go:build cgo
+// +build cgo
+
+package collectors
+
+/*
+#include <mach/mach_host.h>
+#include <mach/processor_info.h>
+#include <mach/mach_init.h>
+#include <mach/vm_map.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// readCPUTimes reads the ticks of each core with host_processor_info.
+// macOS has no per-core CPU times without the Mach API, so this takes cgo.
+func readCPUTimes() ([]cpuTimes, error) {
+	var count C.natural_t
+	var info C.processor_info_array_t
+	var infoCount C.mach_msg_type_number_t
+	kr := C.host_processor_info(C.mach_host_self(), C.PROCESSOR_CPU_LOAD_INFO, &count, &info, &infoCount)
+	if kr != C.KERN_SUCCESS {
+		return nil, fmt.Errorf("host_processor_info: error %d", kr)
+	}
+	defer C.vm_deallocate(C.mach_task_self_, C.vm_address_t(uintptr(unsafe.Pointer(info))), C.vm_size_t(uintptr(infoCount)*unsafe.Sizeof(C.integer_t(0))))
+
+	ticks := (*[1 << 20]C.integer_t)(unsafe.Pointer(info))[:infoCount:infoCount]
+	times := make([]cpuTimes, int(count))
+	for i := range times {
+		t := ticks[i*C.CPU_STATE_MAX : (i+1)*C.CPU_STATE_MAX]
+		// The tick counters are unsigned 32-bit values.
+		user := uint64(uint32(t[C.CPU_STATE_USER]))
+		system := uint64(uint32(t[C.CPU_STATE_SYSTEM]))
+		nice := uint64(uint32(t[C.CPU_STATE_NICE]))
+		idle := uint64(uint32(t[C.CPU_STATE_IDLE]))
+		times[i] = cpuTimes{busy: user + system + nice, total: user + system + nice + idle}
+	}
+	return times, nil
+}
@@ -0,0 +1,47 @@
+package collectors
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readCPUTimes reads the times of each core from the lines "cpu0",
+// "cpu1", ... of /proc/stat:
+//
+//	cpu0 user nice system idle iowait irq softirq steal guest guest_nice
+//
+// Waiting for I/O counts as idle. guest and guest_nice are already part of
+// user and nice.
+func readCPUTimes() ([]cpuTimes, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var times []cpuTimes
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		var t cpuTimes
+		for i, s := range fields[1:] {
+			if i == 8 {
+				break
+			}
+			v, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			t.total += v
+			if i != 3 && i != 4 { // idle, iowait
+				t.busy += v
+			}
+		}
+		times = append(times, t)
+	}
+	return times, sc.Err()
+}
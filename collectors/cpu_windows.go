@@ -0,0 +1,52 @@
+package collectors
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	ntdll                        = syscall.NewLazyDLL("ntdll.dll")
+	procNtQuerySystemInformation = ntdll.NewProc("NtQuerySystemInformation")
+)
+
+// systemProcessorPerformanceInformation is the information class of
+// NtQuerySystemInformation that returns the times of each core.
+// GetSystemTimes only knows the total of all cores.
+const systemProcessorPerformanceInformation = 8
+
+// processorPerformance is SYSTEM_PROCESSOR_PERFORMANCE_INFORMATION. The
+// times are in 100ns units, and the kernel time includes the idle time.
+type processorPerformance struct {
+	idleTime       int64
+	kernelTime     int64
+	userTime       int64
+	dpcTime        int64
+	interruptTime  int64
+	interruptCount uint32
+}
+
+// maxCores is the number of cores that readCPUTimes makes room for. A
+// processor group has at most 64.
+const maxCores = 64
+
+func readCPUTimes() ([]cpuTimes, error) {
+	var info [maxCores]processorPerformance
+	var n uint32
+	status, _, _ := procNtQuerySystemInformation.Call(
+		systemProcessorPerformanceInformation,
+		uintptr(unsafe.Pointer(&info[0])),
+		unsafe.Sizeof(info),
+		uintptr(unsafe.Pointer(&n)))
+	if status != 0 {
+		return nil, fmt.Errorf("NtQuerySystemInformation: status %#x", status)
+	}
+	count := int(n / uint32(unsafe.Sizeof(info[0])))
+	times := make([]cpuTimes, count)
+	for i, p := range info[:count] {
+		total := uint64(p.kernelTime + p.userTime)
+		times[i] = cpuTimes{busy: total - uint64(p.idleTime), total: total}
+	}
+	return times, nil
+}
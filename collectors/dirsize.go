@@ -0,0 +1,114 @@
+package collectors
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DirSizeProbes returns two probes per directory, named after the path,
+// like "dir.home_me_Downloads.size_mb" and
+// "dir.home_me_Downloads.walk_errors". The first one is the total size of
+// the files in the directory and below, in MB; the second one is the
+// number of entries that the walk could not read, like directories without
+// permission. Those are left out of the size, so a size that drops along
+// with errors that rise is no cleanup.
+//
+// The walk does not follow symbolic links, so a link that points back up
+// the tree cannot send it in circles, and files outside the tree do not
+// count. The two probes of a directory share one walk per interval. A
+// walk of a large tree can take minutes; it stops when ctx is done, and
+// adds no point then.
+func DirSizeProbes(dirs []string, interval time.Duration) []Probe {
+	var probes []Probe
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			abs = dir
+		}
+		name := "dir." + mountName(abs)
+		w := &dirWalk{dir: dir, maxAge: interval / 2}
+		probes = append(probes,
+			Probe{
+				Name:        name + ".size_mb",
+				Unit:        "mbytes",
+				Description: "Size of the files in " + dir,
+				Func: func(ctx context.Context) (float64, error) {
+					size, _, err := w.walk(ctx)
+					return float64(size) / (1 << 20), err
+				},
+			},
+			Probe{
+				Name:        name + ".walk_errors",
+				Unit:        "short",
+				Description: "Entries of " + dir + " that could not be read",
+				Func: func(ctx context.Context) (float64, error) {
+					_, errs, err := w.walk(ctx)
+					return float64(errs), err
+				},
+			},
+		)
+	}
+	return probes
+}
+
+// dirWalk sums up the sizes of the files in a directory. A result is good
+// for maxAge, so that the probes of the directory, which run at about the
+// same time, share one.
+type dirWalk struct {
+	dir    string
+	maxAge time.Duration
+
+	mu    sync.Mutex
+	size  int64
+	errs  int
+	err   error
+	since time.Time
+}
+
+// walk returns the size of the files in bytes, and the number of entries
+// that could not be read. err is not nil if the directory itself cannot be
+// read, or if ctx is done before the walk is.
+func (w *dirWalk) walk(ctx context.Context) (size int64, errs int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if time.Since(w.since) > w.maxAge {
+		w.size, w.errs, w.err = walkSize(ctx, w.dir)
+		w.since = time.Now()
+	}
+	return w.size, w.errs, w.err
+}
+
+func walkSize(ctx context.Context, dir string) (size int64, errs int, err error) {
+	if _, err := os.Stat(dir); err != nil {
+		return 0, 0, err
+	}
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			// A directory that cannot be read gets skipped, and the walk
+			// goes on with the next one.
+			errs++
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			// Files that got deleted during the walk are just gone.
+			if !os.IsNotExist(err) {
+				errs++
+			}
+			return nil
+		}
+		size += fi.Size()
+		return nil
+	})
+	return size, errs, err
+}
@@ -0,0 +1,142 @@
+package collectors
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// DefaultDiskExclude are the filesystem types that DiskMetrics leaves out
+// by default: filesystems in memory, kernel interfaces, and the layers of
+// containers and snaps.
+var DefaultDiskExclude = []string{"tmpfs", "devtmpfs", "ramfs", "proc", "sysfs", "overlay", "squashfs", "devfs", "autofs"}
+
+// A mount is a mounted filesystem, or a drive on Windows.
+type mount struct {
+	path   string
+	fsType string
+}
+
+// DiskMetrics returns a data function for each mounted filesystem whose
+// type is not in exclude, named "disk.used_pct.<mount point>", with the
+// space in use in percent. Filesystems without a size, as most
+// pseudo-filesystems are, are left out, too.
+//
+// Each function waits for interval before it reads its value. While a
+// filesystem is gone (a USB drive was pulled out, say), its function keeps
+// waiting, so the metric stops updating until the filesystem is back.
+func DiskMetrics(interval time.Duration, exclude []string) ([]Metric, error) {
+	return mountMetrics("disk.used_pct.", "Space in use", interval, exclude, openDisk)
+}
+
+// InodeMetrics is like DiskMetrics, but the metrics, named
+// "disk.inodes_used_pct.<mount point>", report the share of the inodes in
+// use. A filesystem can run out of inodes long before it runs out of
+// space, when it holds millions of small files. Filesystems that do not
+// count inodes, like btrfs, or Windows drives, are left out.
+func InodeMetrics(interval time.Duration, exclude []string) ([]Metric, error) {
+	return mountMetrics("disk.inodes_used_pct.", "Inodes in use", interval, exclude, openInodes)
+}
+
+// mountMetrics returns a data function named prefix plus the mount point
+// for each mounted filesystem whose type is not in exclude and that open
+// can read.
+func mountMetrics(prefix, what string, interval time.Duration, exclude []string, open func(path string) (func() (float64, error), error)) ([]Metric, error) {
+	mounts, err := listMounts()
+	if err != nil {
+		return nil, fmt.Errorf("listing the filesystems: %s", err)
+	}
+	skip := map[string]bool{}
+	for _, t := range exclude {
+		skip[strings.TrimSpace(t)] = true
+	}
+	var metrics []Metric
+	seen := map[string]bool{}
+	for _, m := range mounts {
+		if skip[m.fsType] {
+			continue
+		}
+		name := prefix + mountName(m.path)
+		if seen[name] {
+			continue
+		}
+		// Filesystems that the app may not read, or that have no size
+		// (or no inodes), fail here.
+		read, err := open(m.path)
+		if err != nil {
+			continue
+		}
+		seen[name] = true
+		metrics = append(metrics, Metric{
+			Name:        name,
+			Unit:        "percent",
+			Description: fmt.Sprintf("%s on %s (%s)", what, m.path, m.fsType),
+			Func:        pollPresent(interval, m.path, read),
+		})
+	}
+	return metrics, nil
+}
+
+// mountName turns a mount point into a part of a metric name: "/" becomes
+// "root", "/mnt/usb stick" becomes "mnt_usb_stick", and "C:\" becomes "C".
+func mountName(path string) string {
+	path = strings.Trim(path, `/\:`)
+	if path == "" {
+		return "root"
+	}
+	return nameSafe(path)
+}
+
+// nameSafe replaces the characters of s that could trip up Grafana's
+// queries or the dots of the metric hierarchy with underscores.
+func nameSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// usedPercent returns the space in use like df does: the blocks reserved
+// for root count as neither used nor available.
+func usedPercent(total, free, available uint64) (float64, error) {
+	used := total - free
+	if used+available == 0 {
+		return 0, fmt.Errorf("filesystem has no size")
+	}
+	return 100 * float64(used) / float64(used+available), nil
+}
+
+// inodesUsedPercent returns the share of the inodes in use.
+func inodesUsedPercent(total, free uint64) (float64, error) {
+	if total == 0 {
+		return 0, fmt.Errorf("filesystem does not count inodes")
+	}
+	return 100 * float64(total-free) / float64(total), nil
+}
+
+// pollPresent is like poll, but while read fails, the data function keeps
+// waiting instead of repeating the last value. what names the thing that
+// read reads, for the log.
+func pollPresent(interval time.Duration, what string, read func() (float64, error)) func() float64 {
+	return func() float64 {
+		gone := false
+		for {
+			time.Sleep(interval)
+			v, err := read()
+			if err == nil {
+				if gone {
+					log.Printf("%s is back", what)
+				}
+				return v
+			}
+			if !gone {
+				log.Printf("%s is gone (%s); waiting for it to come back", what, err)
+				gone = true
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package collectors
+
+import "syscall"
+
+// mntNoWait lets getfsstat return the cached statistics instead of asking
+// every filesystem, which could hang on a dead network share.
+const mntNoWait = 2
+
+// listMounts lists the mounted filesystems with getfsstat.
+func listMounts() ([]mount, error) {
+	n, err := syscall.Getfsstat(nil, mntNoWait)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]syscall.Statfs_t, n)
+	if n, err = syscall.Getfsstat(buf, mntNoWait); err != nil {
+		return nil, err
+	}
+	mounts := make([]mount, 0, n)
+	for _, st := range buf[:n] {
+		mounts = append(mounts, mount{path: cString(st.Mntonname[:]), fsType: cString(st.Fstypename[:])})
+	}
+	return mounts, nil
+}
+
+// cString converts a NUL-terminated C string to a Go string.
+func cString(s []int8) string {
+	b := make([]byte, 0, len(s))
+	for _, c := range s {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b)
+}
@@ -0,0 +1,52 @@
+package collectors
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listMounts reads the mounted filesystems from /proc/self/mounts, whose
+// lines look like
+//
+//	/dev/sda1 /mnt/usb\040stick vfat rw,relatime 0 0
+//
+// with spaces and other special characters in octal.
+func listMounts() ([]mount, error) {
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mounts []mount
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		mounts = append(mounts, mount{path: unescapeOctal(fields[1]), fsType: fields[2]})
+	}
+	return mounts, sc.Err()
+}
+
+// unescapeOctal replaces escapes like \040 with the characters they stand
+// for.
+func unescapeOctal(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,69 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package collectors
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// openDisk returns a function that reads the space in use on the
+// filesystem mounted at path.
+func openDisk(path string) (read func() (float64, error), err error) {
+	return openStatfs(path, func(st *syscall.Statfs_t) (float64, error) {
+		return usedPercent(st.Blocks, st.Bfree, st.Bavail)
+	})
+}
+
+// openInodes returns a function that reads the share of the inodes in use
+// on the filesystem mounted at path.
+func openInodes(path string) (read func() (float64, error), err error) {
+	return openStatfs(path, func(st *syscall.Statfs_t) (float64, error) {
+		return inodesUsedPercent(st.Files, st.Ffree)
+	})
+}
+
+// openStatfs returns a function that computes value from the statfs of
+// the filesystem mounted at path. Once the filesystem
+// is unmounted, statfs would report the filesystem of the parent
+// directory instead, so read checks that path is still on the same
+// device.
+func openStatfs(path string, value func(st *syscall.Statfs_t) (float64, error)) (read func() (float64, error), err error) {
+	dev, err := device(path)
+	if err != nil {
+		return nil, err
+	}
+	read = func() (float64, error) {
+		d, err := device(path)
+		if err != nil {
+			return 0, err
+		}
+		if d != dev {
+			return 0, fmt.Errorf("unmounted")
+		}
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(path, &st); err != nil {
+			return 0, err
+		}
+		return value(&st)
+	}
+	if _, err := read(); err != nil {
+		return nil, err
+	}
+	return read, nil
+}
+
+// device returns the ID of the device that path is on.
+func device(path string) (uint64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("no device ID")
+	}
+	return uint64(st.Dev), nil
+}
@@ -0,0 +1,82 @@
+package collectors
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procGetLogicalDriveStringsW = kernel32.NewProc("GetLogicalDriveStringsW")
+	procGetDriveTypeW           = kernel32.NewProc("GetDriveTypeW")
+	procGetDiskFreeSpaceExW     = kernel32.NewProc("GetDiskFreeSpaceExW")
+	procSetErrorMode            = kernel32.NewProc("SetErrorMode")
+)
+
+// driveTypes name the results of GetDriveTypeW, which serve as the
+// filesystem types that DiskMetrics can exclude.
+var driveTypes = map[uintptr]string{
+	2: "removable",
+	3: "fixed",
+	4: "remote",
+	5: "cdrom",
+	6: "ramdisk",
+}
+
+// semFailCriticalErrors keeps Windows from asking the user to insert a
+// disk when the app reads an empty card reader or DVD drive.
+const semFailCriticalErrors = 1
+
+func init() {
+	procSetErrorMode.Call(semFailCriticalErrors)
+}
+
+// listMounts lists the drives, like "C:\".
+func listMounts() ([]mount, error) {
+	buf := make([]uint16, 512)
+	n, _, err := procGetLogicalDriveStringsW.Call(uintptr(len(buf)), uintptr(unsafe.Pointer(&buf[0])))
+	if n == 0 {
+		return nil, err
+	}
+	var mounts []mount
+	// The drives are NUL-terminated strings, one after another.
+	start := 0
+	for i, c := range buf[:n] {
+		if c != 0 {
+			continue
+		}
+		if i > start {
+			path := syscall.UTF16ToString(buf[start:i])
+			t, _, _ := procGetDriveTypeW.Call(uintptr(unsafe.Pointer(&buf[start])))
+			mounts = append(mounts, mount{path: path, fsType: driveTypes[t]})
+		}
+		start = i + 1
+	}
+	return mounts, nil
+}
+
+// openDisk returns a function that reads the space in use on the drive at
+// path. Reading a drive that was removed fails.
+func openDisk(path string) (read func() (float64, error), err error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	read = func() (float64, error) {
+		var available, total, free uint64
+		r, _, err := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(p)),
+			uintptr(unsafe.Pointer(&available)), uintptr(unsafe.Pointer(&total)), uintptr(unsafe.Pointer(&free)))
+		if r == 0 {
+			return 0, err
+		}
+		return usedPercent(total, free, available)
+	}
+	if _, err := read(); err != nil {
+		return nil, err
+	}
+	return read, nil
+}
+
+// openInodes fails: Windows drives do not count inodes.
+func openInodes(path string) (read func() (float64, error), err error) {
+	return nil, errUnsupported()
+}
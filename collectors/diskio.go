@@ -0,0 +1,96 @@
+package collectors
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultDiskIOExclude are the block devices that DiskIOMetrics leaves out
+// unless asked for: loop devices and RAM disks, compressed or not.
+var DefaultDiskIOExclude = []string{"loop*", "ram*", "zram*"}
+
+// diskIOCounters are the operations and bytes that a block device has
+// read and written since boot.
+type diskIOCounters struct {
+	device                string
+	readOps, writeOps     uint64
+	readBytes, writeBytes uint64
+}
+
+// DiskIOMetrics returns four data functions per block device, named
+// "disk.io.<device>.read_ops", "write_ops", "read_bps", and "write_bps",
+// with the operations and bytes per second. devices selects the devices,
+// by name or by a prefix followed by "*", like "sd*"; without devices, all
+// whole disks except DefaultDiskIOExclude get metrics. Partitions are left
+// out then, since their I/O counts toward their disk already.
+//
+// Each function waits for interval, or longer: the rates are the deltas
+// between two readings, and while a device is gone (a USB drive was
+// pulled out, say), its functions keep waiting, so the metrics stop
+// updating instead of repeating the last rate.
+func DiskIOMetrics(interval time.Duration, devices []string) ([]Metric, error) {
+	all, err := readDiskIO()
+	if err != nil {
+		return nil, fmt.Errorf("reading the disk I/O counters: %s", err)
+	}
+	var metrics []Metric
+	for _, dev := range diskIODevices(all, devices, isPartition) {
+		dev := dev
+		rate := func(counter func(diskIOCounters) uint64) func() float64 {
+			return pollRate(interval, func() (uint64, error) {
+				all, err := readDiskIO()
+				if err != nil {
+					return 0, err
+				}
+				for _, c := range all {
+					if c.device == dev {
+						return counter(c), nil
+					}
+				}
+				return 0, fmt.Errorf("%s is gone", dev)
+			})
+		}
+		prefix := "disk.io." + nameSafe(dev)
+		metrics = append(metrics,
+			Metric{
+				Name:        prefix + ".read_ops",
+				Unit:        "iops",
+				Description: "Read operations per second on " + dev,
+				Func:        rate(func(c diskIOCounters) uint64 { return c.readOps }),
+			},
+			Metric{
+				Name:        prefix + ".write_ops",
+				Unit:        "iops",
+				Description: "Write operations per second on " + dev,
+				Func:        rate(func(c diskIOCounters) uint64 { return c.writeOps }),
+			},
+			Metric{
+				Name:        prefix + ".read_bps",
+				Unit:        "Bps",
+				Description: "Bytes read per second on " + dev,
+				Func:        rate(func(c diskIOCounters) uint64 { return c.readBytes }),
+			},
+			Metric{
+				Name:        prefix + ".write_bps",
+				Unit:        "Bps",
+				Description: "Bytes written per second on " + dev,
+				Func:        rate(func(c diskIOCounters) uint64 { return c.writeBytes }),
+			},
+		)
+	}
+	return metrics, nil
+}
+
+// diskIODevices returns the devices of all that DiskIOMetrics creates
+// metrics for.
+func diskIODevices(all []diskIOCounters, devices []string, isPartition func(string) bool) []string {
+	var selected []string
+	for _, d := range all {
+		if len(devices) > 0 && !matchAny(d.device, devices) ||
+			len(devices) == 0 && (matchAny(d.device, DefaultDiskIOExclude) || isPartition(d.device)) {
+			continue
+		}
+		selected = append(selected, d.device)
+	}
+	return selected
+}
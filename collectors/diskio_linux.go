@@ -0,0 +1,73 @@
+package collectors
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sectorSize is the unit of the sector counts in /proc/diskstats, no
+// matter what the sectors of the device really are.
+const sectorSize = 512
+
+// readDiskIO reads /proc/diskstats, whose lines look like
+//
+//	8       0 sda 5321 1204 402630 3120 8837 6390 398008 11604 0 9308 14724
+//
+// after major and minor number and the device name: reads completed,
+// reads merged, sectors read, time spent reading, writes completed,
+// writes merged, sectors written, and more that the collector ignores.
+func readDiskIO() ([]diskIOCounters, error) {
+	f, err := os.Open("/proc/diskstats")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readDiskStats(f)
+}
+
+// readDiskStats reads the lines of /proc/diskstats from r.
+func readDiskStats(r io.Reader) ([]diskIOCounters, error) {
+	var all []diskIOCounters
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if c, ok := parseDiskStats(sc.Text()); ok {
+			all = append(all, c)
+		}
+	}
+	return all, sc.Err()
+}
+
+// parseDiskStats parses one line of /proc/diskstats. Kernels before 2.6.25
+// list partitions with fewer counters; those lines are left out.
+func parseDiskStats(line string) (diskIOCounters, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 10 {
+		return diskIOCounters{}, false
+	}
+	var n [7]uint64
+	for i := range n {
+		v, err := strconv.ParseUint(fields[3+i], 10, 64)
+		if err != nil {
+			return diskIOCounters{}, false
+		}
+		n[i] = v
+	}
+	return diskIOCounters{
+		device:     fields[2],
+		readOps:    n[0],
+		readBytes:  n[2] * sectorSize,
+		writeOps:   n[4],
+		writeBytes: n[6] * sectorSize,
+	}, true
+}
+
+// isPartition reports whether the block device dev is a partition of a
+// disk, which sysfs tells by a "partition" file. Device names with a slash,
+// like "cciss/c0d0", have a "!" instead in sysfs.
+func isPartition(dev string) bool {
+	_, err := os.Stat("/sys/class/block/" + strings.Replace(dev, "/", "!", -1) + "/partition")
+	return err == nil
+}
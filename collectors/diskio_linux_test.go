@@ -0,0 +1,149 @@
+package collectors
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readDiskStatsFile(t *testing.T, path string) []diskIOCounters {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	all, err := readDiskStats(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return all
+}
+
+func TestParseDiskStats(t *testing.T) {
+	tests := []struct {
+		line string
+		want diskIOCounters
+		ok   bool
+	}{
+		{
+			line: " 259       0 nvme0n1 262919 68592 16484410 71540 553717 349393 30548272 683128 0 348488 826924 0 0 0 0 41623 72256",
+			want: diskIOCounters{device: "nvme0n1", readOps: 262919, readBytes: 16484410 * 512, writeOps: 553717, writeBytes: 30548272 * 512},
+			ok:   true,
+		},
+		{
+			// Kernels before 4.18 have no discard and flush counters.
+			line: "   8       0 sda 4528 1201 405674 6022 1023 2044 98760 3310 0 5216 9874",
+			want: diskIOCounters{device: "sda", readOps: 4528, readBytes: 405674 * 512, writeOps: 1023, writeBytes: 98760 * 512},
+			ok:   true,
+		},
+		{
+			// A partition of a kernel before 2.6.25.
+			line: "   3       1 hda1 35486 38030 38030 38030",
+		},
+		{
+			line: "   8       0 sda 4528 1201 x 6022 1023 2044 98760 3310 0 5216 9874",
+		},
+		{
+			line: "",
+		},
+	}
+	for _, tt := range tests {
+		got, ok := parseDiskStats(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseDiskStats(%q) = %+v, %t; want %+v, %t", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDiskIODevices(t *testing.T) {
+	all := readDiskStatsFile(t, "testdata/diskstats.1")
+	partitions := map[string]bool{"nvme0n1p1": true, "nvme0n1p2": true, "sda1": true}
+	isPartition := func(dev string) bool { return partitions[dev] }
+	tests := []struct {
+		devices []string
+		want    []string
+	}{
+		{nil, []string{"nvme0n1", "sda", "dm-0"}},
+		{[]string{"sd*"}, []string{"sda", "sda1"}},
+		{[]string{"loop*", "nvme0n1p2"}, []string{"nvme0n1p2", "loop0"}},
+		{[]string{"hda1"}, nil},
+	}
+	for _, tt := range tests {
+		if got := diskIODevices(all, tt.devices, isPartition); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("diskIODevices(%q) = %q; want %q", tt.devices, got, tt.want)
+		}
+	}
+}
+
+func TestDiskIORates(t *testing.T) {
+	before := readDiskStatsFile(t, "testdata/diskstats.1")
+	after := readDiskStatsFile(t, "testdata/diskstats.2")
+	if len(before) != len(after) {
+		t.Fatalf("%d devices before, %d after", len(before), len(after))
+	}
+	want := map[string][4]float64{
+		"nvme0n1": {100, 4096000, 240, 10485760},
+		"sda":     {0, 0, 0, 0},
+		"dm-0":    {100, 4096000, 240, 10485760},
+	}
+	for i, b := range before {
+		w, ok := want[b.device]
+		if !ok {
+			continue
+		}
+		a := after[i]
+		counters := [4][2]uint64{
+			{b.readOps, a.readOps},
+			{b.readBytes, a.readBytes},
+			{b.writeOps, a.writeOps},
+			{b.writeBytes, a.writeBytes},
+		}
+		for j, c := range counters {
+			rate, ok := counterRate(c[0], c[1], 5*time.Second)
+			if !ok || rate != w[j] {
+				t.Errorf("%s: rate %d = %g, %t; want %g, true", b.device, j, rate, ok, w[j])
+			}
+		}
+	}
+}
+
+func TestCounterRate(t *testing.T) {
+	tests := []struct {
+		prev, cur uint64
+		elapsed   time.Duration
+		want      float64
+		ok        bool
+	}{
+		{100, 600, 5 * time.Second, 100, true},
+		{100, 100, 5 * time.Second, 0, true},
+		// A 32-bit counter that wrapped around.
+		{4294967000, 200, 5 * time.Second, 0, false},
+		{100, 600, 0, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := counterRate(tt.prev, tt.cur, tt.elapsed)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("counterRate(%d, %d, %s) = %g, %t; want %g, %t", tt.prev, tt.cur, tt.elapsed, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPollRateSkipsWraparound(t *testing.T) {
+	readings := []uint64{1000, 2000, 5, 1005}
+	reads := 0
+	f := pollRate(time.Millisecond, func() (uint64, error) {
+		v := readings[reads]
+		reads++
+		return v, nil
+	})
+	if rate := f(); rate <= 0 || reads != 2 {
+		t.Fatalf("first rate = %g after %d readings; want a rate after 2", rate, reads)
+	}
+	// The wraparound from 2000 to 5 gives no rate, so the function goes on
+	// to the next reading.
+	if rate := f(); rate <= 0 || reads != 4 {
+		t.Fatalf("second rate = %g after %d readings; want a rate after 4", rate, reads)
+	}
+}
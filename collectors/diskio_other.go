@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package collectors
+
+// Only Linux tells the I/O counters of all block devices in a file; other
+// systems get no disk I/O metrics.
+
+func readDiskIO() ([]diskIOCounters, error) {
+	return nil, errUnsupported()
+}
+
+func isPartition(dev string) bool {
+	return false
+}
@@ -0,0 +1,116 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// DNSProbes returns two probes per hostname, like "dns.example_com.ms" and
+// "dns.example_com.error". The first one is the time in milliseconds that
+// it takes to resolve the hostname; the second one is 0 if the resolver
+// found addresses, and 1 if it answered with an error, like NXDOMAIN for a
+// name that does not exist, or SERVFAIL. A resolver that does not answer
+// within timeout adds no point to either one, so a gap means a timeout,
+// and a 1 means an answer that is no good.
+//
+// With server, like "192.168.1.1" or "1.1.1.1:53", the probes ask that
+// DNS server; otherwise, they ask the system's resolver, which may answer
+// from a cache. The two probes of a hostname share one lookup per
+// interval.
+func DNSProbes(hosts []string, server string, interval, timeout time.Duration) []Probe {
+	resolver := net.DefaultResolver
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	via := "the system's resolver"
+	if server != "" {
+		via = server
+	}
+	var probes []Probe
+	for _, host := range hosts {
+		name := "dns." + nameSafe(host)
+		check := &dnsCheck{host: host, resolver: resolver, timeout: timeout, maxAge: interval / 2}
+		probes = append(probes,
+			Probe{
+				Name:        name + ".ms",
+				Unit:        "ms",
+				Description: "Time to resolve " + host + " through " + via,
+				Func: func(ctx context.Context) (float64, error) {
+					ms, _, err := check.lookup(ctx)
+					return ms, err
+				},
+			},
+			Probe{
+				Name:        name + ".error",
+				Unit:        "bool",
+				Description: "Whether " + via + " answered the lookup of " + host + " with an error (1) or not (0)",
+				Func: func(ctx context.Context) (float64, error) {
+					_, failed, err := check.lookup(ctx)
+					if failed {
+						return 1, err
+					}
+					return 0, err
+				},
+			},
+		)
+	}
+	return probes
+}
+
+// dnsCheck resolves a hostname. A result is good for maxAge, so that the
+// probes of the hostname, which run at about the same time, share one.
+type dnsCheck struct {
+	host     string
+	resolver *net.Resolver
+	timeout  time.Duration
+	maxAge   time.Duration
+
+	mu     sync.Mutex
+	ms     float64
+	failed bool
+	err    error
+	since  time.Time
+}
+
+// lookup returns the time that resolving the hostname takes, in
+// milliseconds, and whether the resolver answered with an error. err is
+// not nil if there is no answer at all.
+func (c *dnsCheck) lookup(ctx context.Context) (ms float64, failed bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.since) > c.maxAge {
+		c.ms, c.failed, c.err = c.resolve(ctx)
+		c.since = time.Now()
+	}
+	return c.ms, c.failed, c.err
+}
+
+func (c *dnsCheck) resolve(ctx context.Context) (float64, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	_, err := c.resolver.LookupHost(ctx, c.host)
+	ms := float64(time.Since(start)) / float64(time.Millisecond)
+	if err == nil {
+		return ms, false, nil
+	}
+	var dnsErr *net.DNSError
+	if ctx.Err() != nil || !errors.As(err, &dnsErr) || dnsErr.IsTimeout {
+		return 0, false, err
+	}
+	// NXDOMAIN, SERVFAIL ("server misbehaving"), and the like: the
+	// resolver answered, just not with addresses.
+	return ms, true, nil
+}
@@ -0,0 +1,240 @@
+package collectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// dockerRescan is how often Docker.Watch looks for containers that
+// started.
+const dockerRescan = 5 * time.Second
+
+// DefaultDockerSocket returns the socket of the Docker Engine API: the one
+// in $DOCKER_HOST if that is a unix:// URL, as for rootless Docker, or
+// else /var/run/docker.sock.
+func DefaultDockerSocket() string {
+	if h := os.Getenv("DOCKER_HOST"); strings.HasPrefix(h, "unix://") {
+		return strings.TrimPrefix(h, "unix://")
+	}
+	return "/var/run/docker.sock"
+}
+
+// Docker reads the resource usage of the running containers from the
+// Docker Engine API.
+type Docker struct {
+	client *http.Client
+}
+
+// NewDocker connects to the Docker Engine API at socket, and checks that
+// it answers.
+func NewDocker(socket string) (*Docker, error) {
+	d := &Docker{client: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := d.containers(ctx); err != nil {
+		return nil, fmt.Errorf("docker at %s: %s", socket, err)
+	}
+	return d, nil
+}
+
+// A dockerContainer is an entry of the list of running containers.
+type dockerContainer struct {
+	ID    string   `json:"Id"`
+	Names []string `json:"Names"`
+}
+
+// name returns the name of the container in a form that works in metric
+// names, like "grafana" or "web_1".
+func (c dockerContainer) name() string {
+	if len(c.Names) == 0 {
+		return c.ID[:12]
+	}
+	return nameSafe(strings.TrimPrefix(c.Names[0], "/"))
+}
+
+func (d *Docker) containers(ctx context.Context) ([]dockerContainer, error) {
+	resp, err := d.get(ctx, "/containers/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var list []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (d *Docker) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return resp, nil
+}
+
+// Watch streams the CPU load (in percent of one core) and the memory
+// usage (in MB) of every running container, until ctx is done. For each
+// container that it sees for the first time, it calls container with the
+// container's name, and feeds the values to the functions that container
+// returns, about once a second. A container that stops goes quiet; when
+// it starts again, its values go to the same functions. Watch is not
+// bothered by Docker going away for a while; it just tries again.
+func (d *Docker) Watch(ctx context.Context, container func(name string) (cpu, mem func(float64))) {
+	type feed struct {
+		cpu, mem func(float64)
+	}
+	feeds := map[string]feed{}     // by container name
+	running := map[string]func(){} // cancels the stream, by container ID
+	ended := make(chan string)     // IDs of the streams that ended
+	var failed bool
+	for {
+		list, err := d.containers(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && !failed {
+			log.Println("docker:", err)
+		}
+		failed = err != nil
+		seen := map[string]bool{}
+		for _, c := range list {
+			seen[c.ID] = true
+			if running[c.ID] != nil {
+				continue
+			}
+			name := c.name()
+			f, ok := feeds[name]
+			if !ok {
+				f.cpu, f.mem = container(name)
+				feeds[name] = f
+			}
+			sctx, cancel := context.WithCancel(ctx)
+			running[c.ID] = cancel
+			go func(id string) {
+				d.stats(sctx, id, f.cpu, f.mem)
+				select {
+				case ended <- id:
+				case <-ctx.Done():
+				}
+			}(c.ID)
+		}
+		if err == nil {
+			for id, cancel := range running {
+				if !seen[id] {
+					cancel()
+				}
+			}
+		}
+	wait:
+		for {
+			select {
+			case id := <-ended:
+				running[id]()
+				delete(running, id)
+			case <-time.After(dockerRescan):
+				break wait
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// dockerStats is the part of a sample of the stats stream that the
+// collector needs.
+type dockerStats struct {
+	CPU    dockerCPUStats `json:"cpu_stats"`
+	PreCPU dockerCPUStats `json:"precpu_stats"`
+	Memory struct {
+		Usage uint64            `json:"usage"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+}
+
+type dockerCPUStats struct {
+	Usage struct {
+		Total  uint64   `json:"total_usage"`
+		PerCPU []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	System uint64 `json:"system_cpu_usage"`
+	Online int    `json:"online_cpus"`
+}
+
+// cpuPercent returns the CPU load since the previous sample, in percent
+// of one core, the way `docker stats` computes it.
+func (s dockerStats) cpuPercent() (float64, bool) {
+	total := float64(s.CPU.Usage.Total) - float64(s.PreCPU.Usage.Total)
+	system := float64(s.CPU.System) - float64(s.PreCPU.System)
+	if s.PreCPU.System == 0 || system <= 0 || total < 0 {
+		return 0, false
+	}
+	cpus := s.CPU.Online
+	if cpus == 0 {
+		cpus = len(s.CPU.Usage.PerCPU)
+	}
+	return total / system * float64(cpus) * 100, true
+}
+
+// memoryMB returns the memory in use, without the page cache that the
+// kernel can drop, the way `docker stats` computes it: cgroup v2 calls
+// that inactive_file, cgroup v1 calls it cache.
+func (s dockerStats) memoryMB() float64 {
+	used := s.Memory.Usage
+	cache, ok := s.Memory.Stats["inactive_file"]
+	if !ok {
+		cache = s.Memory.Stats["cache"]
+	}
+	if cache < used {
+		used -= cache
+	}
+	return float64(used) / (1 << 20)
+}
+
+// stats streams the resource usage of the container id to cpu and mem,
+// until the container stops or ctx is done.
+func (d *Docker) stats(ctx context.Context, id string, cpu, mem func(float64)) {
+	resp, err := d.get(ctx, "/containers/"+id+"/stats?stream=true")
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var s dockerStats
+		if err := dec.Decode(&s); err != nil {
+			return
+		}
+		// A stopped container sends empty samples before the stream
+		// ends.
+		if s.Memory.Usage == 0 {
+			continue
+		}
+		if pct, ok := s.cpuPercent(); ok {
+			cpu(pct)
+		}
+		mem(s.memoryMB())
+	}
+}
@@ -0,0 +1,45 @@
+package collectors
+
+import (
+	"fmt"
+	"time"
+)
+
+// FileDescriptorMetrics returns the data functions for the file
+// descriptors of the app itself:
+//
+//   - process.open_fds: the open file descriptors (on Windows, handles)
+//   - process.max_fds: the limit of open file descriptors (RLIMIT_NOFILE),
+//     so that a Grafana threshold can sit just below it; not on Windows,
+//     which has no such limit
+//
+// A service that leaks file descriptors, like HTTP response bodies that
+// nobody closes, shows a count that only goes up, until it hits the limit
+// and every new connection fails. Each function waits for interval before
+// it reads its value.
+func FileDescriptorMetrics(interval time.Duration) ([]Metric, error) {
+	if _, err := countOpenFDs(); err != nil {
+		return nil, fmt.Errorf("counting the open file descriptors: %s", err)
+	}
+	metrics := []Metric{{
+		Name:        "process.open_fds",
+		Unit:        "short",
+		Description: "Open file descriptors of the app",
+		Func: poll(interval, func() (float64, error) {
+			n, err := countOpenFDs()
+			return float64(n), err
+		}),
+	}}
+	if _, err := fdLimit(); err != nil {
+		return metrics, nil
+	}
+	return append(metrics, Metric{
+		Name:        "process.max_fds",
+		Unit:        "short",
+		Description: "Limit of open file descriptors of the app",
+		Func: poll(interval, func() (float64, error) {
+			n, err := fdLimit()
+			return float64(n), err
+		}),
+	}), nil
+}
@@ -0,0 +1,42 @@
+//go:build cgo
+// +build cgo
+
+package collectors
+
+/*
+#include <libproc.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+// open_fds lists the open file descriptors of the process with
+// proc_pidinfo. Without a buffer, proc_pidinfo returns the size of the
+// file table, which includes free slots; with one, it returns the size
+// of the entries that it filled in.
+static int open_fds(void) {
+	int size = proc_pidinfo(getpid(), PROC_PIDLISTFDS, 0, NULL, 0);
+	if (size <= 0) {
+		return -1;
+	}
+	struct proc_fdinfo *fds = malloc(size);
+	if (fds == NULL) {
+		return -1;
+	}
+	int n = proc_pidinfo(getpid(), PROC_PIDLISTFDS, 0, fds, size);
+	free(fds);
+	if (n <= 0) {
+		return -1;
+	}
+	return n / PROC_PIDLISTFD_SIZE;
+}
+*/
+import "C"
+
+import "fmt"
+
+func countOpenFDs() (int, error) {
+	n := C.open_fds()
+	if n < 0 {
+		return 0, fmt.Errorf("proc_pidinfo failed")
+	}
+	return int(n), nil
+}
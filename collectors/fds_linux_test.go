@@ -0,0 +1,50 @@
+package collectors
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCountOpenFDsDoesNotLeak(t *testing.T) {
+	metrics, err := FileDescriptorMetrics(time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	openFDs := metrics[0].Func
+	before, err := countOpenFDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if n := openFDs(); n != float64(before) {
+			t.Fatalf("iteration %d: %g open file descriptors; want %d", i, n, before)
+		}
+	}
+	after, err := countOpenFDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("%d open file descriptors after 100 iterations; want %d", after, before)
+	}
+}
+
+func TestCountOpenFDsCountsFiles(t *testing.T) {
+	before, err := countOpenFDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("testdata/diskstats.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := countOpenFDs()
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != before+1 {
+		t.Errorf("%d open file descriptors with one more file open; want %d", n, before+1)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package collectors
+
+func fdLimit() (uint64, error) {
+	return 0, errUnsupported()
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package collectors
+
+import "syscall"
+
+// fdLimit returns the soft limit of open file descriptors, the one that
+// makes open fail with "too many open files".
+func fdLimit() (uint64, error) {
+	var l syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &l); err != nil {
+		return 0, err
+	}
+	return l.Cur, nil
+}
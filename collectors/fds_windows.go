@@ -0,0 +1,27 @@
+package collectors
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+var procGetProcessHandleCount = kernel32.NewProc("GetProcessHandleCount")
+
+// countOpenFDs counts the open handles of the app: files, but also
+// sockets, events, threads, and the like. A leak of any of them shows up.
+func countOpenFDs() (int, error) {
+	var n uint32
+	// -1 is the pseudo handle for the current process, as returned by
+	// GetCurrentProcess.
+	r, _, err := procGetProcessHandleCount.Call(^uintptr(0), uintptr(unsafe.Pointer(&n)))
+	if r == 0 {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// fdLimit reports that Windows has no limit of open handles per process,
+// other than memory.
+func fdLimit() (uint64, error) {
+	return 0, fmt.Errorf("no limit of open handles on Windows")
+}
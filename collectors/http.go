@@ -0,0 +1,130 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpClient is the client of all HTTP probes. It keeps connections open
+// between probes, like a browser does, and does not follow redirects: a
+// probe is about the URL it was given, not about where that URL points.
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// HTTPProbes returns two probes per URL, named after the host and path of
+// the URL, like "http.example_com_health.ms" and
+// "http.example_com_health.up". The first one is the time in milliseconds
+// that a GET request takes, until the whole body is in; the second one is
+// 1 if the URL is up, and 0 if it is down. Only a 2xx response counts as
+// up. A redirect counts as down, as do a failed TLS handshake, an error
+// status, and no response within timeout; a URL that is down adds no
+// point to its .ms metric.
+//
+// The two probes of a URL share one request per interval.
+func HTTPProbes(urls []string, interval, timeout time.Duration) ([]Probe, error) {
+	var probes []Probe
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("probe %q: want a URL like https://example.com/health", raw)
+		}
+		name := "http." + strings.Trim(nameSafe(u.Host+u.Path), "_")
+		check := &httpCheck{url: raw, timeout: timeout, maxAge: interval / 2}
+		probes = append(probes,
+			Probe{
+				Name:        name + ".ms",
+				Unit:        "ms",
+				Description: "Response time of GET " + raw,
+				Func: func(ctx context.Context) (float64, error) {
+					return check.latency(ctx)
+				},
+			},
+			Probe{
+				Name:        name + ".up",
+				Unit:        "bool",
+				Description: "Whether GET " + raw + " succeeds (1) or not (0)",
+				Func: func(ctx context.Context) (float64, error) {
+					if _, err := check.latency(ctx); err != nil {
+						if ctx.Err() != nil {
+							return 0, err
+						}
+						return 0, nil
+					}
+					return 1, nil
+				},
+			},
+		)
+	}
+	return probes, nil
+}
+
+// httpCheck sends GET requests to a URL. A result is good for maxAge, so
+// that the probes of the URL, which run at about the same time, share
+// one.
+type httpCheck struct {
+	url     string
+	timeout time.Duration
+	maxAge  time.Duration
+
+	mu    sync.Mutex
+	ms    float64
+	err   error
+	since time.Time
+}
+
+// latency returns the time that a GET request to the URL takes, in
+// milliseconds, or an error if the URL is down.
+func (c *httpCheck) latency(ctx context.Context) (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.since) > c.maxAge {
+		c.ms, c.err = c.get(ctx)
+		c.since = time.Now()
+	}
+	return c.ms, c.err
+}
+
+func (c *httpCheck) get(ctx context.Context) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, c.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("GET %s: %s", c.url, resp.Status)
+	}
+	return float64(rtt) / float64(time.Millisecond), nil
+}
@@ -0,0 +1,139 @@
+package collectors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// probeURL returns the values of the .ms and .up probes of url, and the
+// error of the .ms probe.
+func probeURL(t *testing.T, url string, timeout time.Duration) (ms, up float64, err error) {
+	t.Helper()
+	probes, err := HTTPProbes([]string{url}, 0, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err = probes[0].Func(context.Background())
+	up, uperr := probes[1].Func(context.Background())
+	if uperr != nil {
+		t.Fatalf("up probe: %s", uperr)
+	}
+	return ms, up, err
+}
+
+func TestHTTPProbesUp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	ms, up, err := probeURL(t, srv.URL+"/health", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms < 50 || ms > 1000 {
+		t.Errorf("ms = %g; want 50 to 1000", ms)
+	}
+	if up != 1 {
+		t.Errorf("up = %g; want 1", up)
+	}
+}
+
+func TestHTTPProbesDown(t *testing.T) {
+	var redirected int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/target", http.StatusFound)
+	})
+	mux.HandleFunc("/target", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&redirected, 1)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	// The certificate of a TLS test server is not signed by a trusted
+	// authority, so the handshake fails.
+	tlsSrv := httptest.NewTLSServer(mux)
+	defer tlsSrv.Close()
+
+	for _, url := range []string{srv.URL + "/error", srv.URL + "/moved", srv.URL + "/slow", tlsSrv.URL + "/target", "http://127.0.0.1:1/"} {
+		start := time.Now()
+		ms, up, err := probeURL(t, url, 200*time.Millisecond)
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: took %s", url, elapsed)
+		}
+		if err == nil {
+			t.Errorf("%s: ms = %g; want no point", url, ms)
+		}
+		if up != 0 {
+			t.Errorf("%s: up = %g; want 0", url, up)
+		}
+	}
+	if n := atomic.LoadInt32(&redirected); n != 0 {
+		t.Errorf("the redirect was followed %d times; want 0", n)
+	}
+}
+
+func TestHTTPProbesShareRequests(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer srv.Close()
+	probes, err := HTTPProbes([]string{srv.URL}, time.Minute, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range probes {
+		if _, err := p.Func(context.Background()); err != nil {
+			t.Fatalf("%s: %s", p.Name, err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("%d requests for the two probes; want 1", n)
+	}
+}
+
+func TestHTTPProbesCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	probes, err := HTTPProbes([]string{srv.URL}, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// When the app shuts down, a URL is not down; the probe has no value.
+	if _, err := probes[1].Func(ctx); err == nil {
+		t.Error("up probe: no error after cancel")
+	}
+}
+
+func TestHTTPProbesNames(t *testing.T) {
+	probes, err := HTTPProbes([]string{"https://example.com/health"}, time.Minute, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probes[0].Name != "http.example_com_health.ms" || probes[1].Name != "http.example_com_health.up" {
+		t.Errorf("names %s, %s", probes[0].Name, probes[1].Name)
+	}
+	for _, url := range []string{"example.com", "ftp://example.com/", "http://"} {
+		if _, err := HTTPProbes([]string{url}, time.Minute, time.Second); err == nil {
+			t.Errorf("%s: no error", url)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package collectors
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// mb is the unit of the memory metrics. Grafana calls it "mbytes".
+const mb = 1 << 20
+
+// A Metric is a data function together with what a dashboard needs to
+// know about its values.
+type Metric struct {
+	Name        string
+	Unit        string // a Grafana unit, like "mbytes" or "percent"
+	Description string
+	Func        func() float64
+}
+
+// memoryStatus is the physical memory of the system, in bytes. available
+// is what programs can get without swapping, including caches that the
+// system would drop.
+type memoryStatus struct {
+	total     uint64
+	available uint64
+}
+
+// MemoryMetrics returns the data functions for the memory usage of the
+// app and of the system, in MB:
+//
+//   - mem.process.rss: memory of the app that is in RAM
+//   - mem.system.used: memory in use by all programs
+//   - mem.system.free: memory available to programs
+//   - mem.system.used_pct: memory in use, in percent
+//
+// Each function waits for interval before it reads its value. If the
+// system memory cannot be read, only mem.process.rss is returned, together
+// with an error that says why. Where the OS does not tell the resident
+// size of the app, mem.process.rss is the memory that the Go runtime has
+// obtained from the OS.
+func MemoryMetrics(interval time.Duration) ([]Metric, error) {
+	metrics := []Metric{{
+		Name:        "mem.process.rss",
+		Unit:        "mbytes",
+		Description: "Memory of the app in RAM (resident set size)",
+		Func: poll(interval, func() (float64, error) {
+			return float64(processRSS()) / mb, nil
+		}),
+	}}
+	if _, err := readSystemMemory(); err != nil {
+		return metrics, fmt.Errorf("reading the system memory: %s", err)
+	}
+	system := func(f func(m memoryStatus) float64) func() float64 {
+		return poll(interval, func() (float64, error) {
+			m, err := readSystemMemory()
+			if err != nil || m.total == 0 {
+				return 0, err
+			}
+			return f(m), nil
+		})
+	}
+	return append(metrics,
+		Metric{
+			Name:        "mem.system.used",
+			Unit:        "mbytes",
+			Description: "Memory in use by all programs",
+			Func:        system(func(m memoryStatus) float64 { return float64(m.total-m.available) / mb }),
+		},
+		Metric{
+			Name:        "mem.system.free",
+			Unit:        "mbytes",
+			Description: "Memory available to programs, including caches",
+			Func:        system(func(m memoryStatus) float64 { return float64(m.available) / mb }),
+		},
+		Metric{
+			Name:        "mem.system.used_pct",
+			Unit:        "percent",
+			Description: "Memory in use by all programs, in percent",
+			Func:        system(func(m memoryStatus) float64 { return 100 * float64(m.total-m.available) / float64(m.total) }),
+		},
+	), nil
+}
+
+// processRSS returns the resident set size of the app, or, if the OS does
+// not tell, the memory that the Go runtime has obtained from the OS.
+func processRSS() uint64 {
+	if rss, err := readProcessRSS(); err == nil {
+		return rss
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Sys
+}
+
+// poll turns read into a data function that waits for interval before
+// each reading. If a reading fails, the data function returns the last
+// value again.
+func poll(interval time.Duration, read func() (float64, error)) func() float64 {
+	var mu sync.Mutex
+	var last float64
+	return func() float64 {
+		time.Sleep(interval)
+		mu.Lock()
+		defer mu.Unlock()
+		if v, err := read(); err == nil {
+			last = v
+		}
+		return last
+	}
+}
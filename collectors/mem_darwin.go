@@ -0,0 +1,54 @@
+//go:build cgo
+// +build cgo
+
+package collectors
+
+/*
+#include <mach/mach.h>
+#include <sys/sysctl.h>
+
+// rss returns the resident size of the calling task.
+static kern_return_t rss(uint64_t *size) {
+	mach_task_basic_info_data_t info;
+	mach_msg_type_number_t count = MACH_TASK_BASIC_INFO_COUNT;
+	kern_return_t kr = task_info(mach_task_self(), MACH_TASK_BASIC_INFO, (task_info_t)&info, &count);
+	*size = info.resident_size;
+	return kr;
+}
+
+// sysmem returns the physical memory, and the pages that programs can get
+// without swapping: free, inactive, and speculative ones, like
+// Activity Monitor counts them.
+static int sysmem(uint64_t *total, uint64_t *available) {
+	size_t len = sizeof(*total);
+	if (sysctlbyname("hw.memsize", total, &len, NULL, 0) != 0) {
+		return -1;
+	}
+	vm_statistics64_data_t vm;
+	mach_msg_type_number_t count = HOST_VM_INFO64_COUNT;
+	if (host_statistics64(mach_host_self(), HOST_VM_INFO64, (host_info64_t)&vm, &count) != KERN_SUCCESS) {
+		return -1;
+	}
+	*available = ((uint64_t)vm.free_count + vm.inactive_count + vm.speculative_count) * vm_kernel_page_size;
+	return 0;
+}
+*/
+import "C"
+
+import "fmt"
+
+func readProcessRSS() (uint64, error) {
+	var size C.uint64_t
+	if kr := C.rss(&size); kr != C.KERN_SUCCESS {
+		return 0, fmt.Errorf("task_info: error %d", kr)
+	}
+	return uint64(size), nil
+}
+
+func readSystemMemory() (memoryStatus, error) {
+	var total, available C.uint64_t
+	if C.sysmem(&total, &available) != 0 {
+		return memoryStatus{}, fmt.Errorf("cannot read the VM statistics")
+	}
+	return memoryStatus{total: uint64(total), available: uint64(available)}, nil
+}
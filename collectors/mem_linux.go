@@ -0,0 +1,73 @@
+package collectors
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readProcessRSS reads the resident set size, in pages, from the second
+// field of /proc/self/statm.
+func readProcessRSS() (uint64, error) {
+	b, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	fields := bytes.Fields(b)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("/proc/self/statm: unexpected format")
+	}
+	pages, err := strconv.ParseUint(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}
+
+// readSystemMemory reads MemTotal and MemAvailable from /proc/meminfo.
+// Kernels before 3.14 have no MemAvailable; there, free memory plus the
+// page cache comes close.
+func readSystemMemory() (memoryStatus, error) {
+	kb, err := readProcTable("/proc/meminfo")
+	if err != nil {
+		return memoryStatus{}, err
+	}
+	total, ok := kb["MemTotal"]
+	if !ok {
+		return memoryStatus{}, fmt.Errorf("/proc/meminfo: no MemTotal")
+	}
+	available, ok := kb["MemAvailable"]
+	if !ok {
+		available = kb["MemFree"] + kb["Buffers"] + kb["Cached"]
+	}
+	return memoryStatus{total: total * 1024, available: available * 1024}, nil
+}
+
+// readProcTable reads a file of names and numbers, like /proc/meminfo
+// with lines like "MemTotal:       16314328 kB", or /proc/vmstat with
+// lines like "pswpin 1234". Units and lines that do not fit are ignored.
+func readProcTable(name string) (map[string]uint64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	table := map[string]uint64{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		table[strings.TrimSuffix(fields[0], ":")] = v
+	}
+	return table, sc.Err()
+}
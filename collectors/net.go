@@ -0,0 +1,121 @@
+package collectors
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// netCounters are the bytes that an interface has received and sent since
+// it came up.
+type netCounters struct {
+	rx, tx uint64
+}
+
+// NetworkMetrics returns two data functions per network interface, named
+// "net.<interface>.rx_bps" and "net.<interface>.tx_bps", with the bytes
+// received and sent per second. ifaces selects the interfaces, by name or
+// by a prefix followed by "*", like "eth*"; without ifaces, all interfaces
+// except loopback get metrics.
+//
+// Each function waits for interval, or longer: when a counter goes
+// backwards (it wrapped around, or the interface was recreated) or the
+// interface is gone, the function starts over from the next reading
+// instead of returning a bogus rate.
+func NetworkMetrics(interval time.Duration, ifaces []string) ([]Metric, error) {
+	list, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("listing the network interfaces: %s", err)
+	}
+	var metrics []Metric
+	for _, iface := range list {
+		if !selectInterface(iface, ifaces) {
+			continue
+		}
+		// Interfaces whose counters the app cannot read are left out.
+		if _, err := readNetCounters(iface.Name); err != nil {
+			continue
+		}
+		name := iface.Name
+		rate := func(counter func(netCounters) uint64) func() float64 {
+			return pollRate(interval, func() (uint64, error) {
+				c, err := readNetCounters(name)
+				return counter(c), err
+			})
+		}
+		prefix := "net." + nameSafe(name)
+		metrics = append(metrics,
+			Metric{
+				Name:        prefix + ".rx_bps",
+				Unit:        "Bps",
+				Description: "Bytes received per second on " + name,
+				Func:        rate(func(c netCounters) uint64 { return c.rx }),
+			},
+			Metric{
+				Name:        prefix + ".tx_bps",
+				Unit:        "Bps",
+				Description: "Bytes sent per second on " + name,
+				Func:        rate(func(c netCounters) uint64 { return c.tx }),
+			},
+		)
+	}
+	return metrics, nil
+}
+
+// selectInterface reports whether iface matches one of the patterns, or
+// is not the loopback interface if there are no patterns.
+func selectInterface(iface net.Interface, patterns []string) bool {
+	if len(patterns) == 0 {
+		return iface.Flags&net.FlagLoopback == 0
+	}
+	return matchAny(iface.Name, patterns)
+}
+
+// matchAny reports whether name matches one of the patterns: a name, or
+// a prefix followed by "*".
+func matchAny(name string, patterns []string) bool {
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == name || strings.HasSuffix(p, "*") && strings.HasPrefix(name, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// pollRate returns a data function for the rate of the counter that read
+// reads, per second. After a failed reading, or when the counter goes
+// backwards, the function starts over from the next reading.
+func pollRate(interval time.Duration, read func() (uint64, error)) func() float64 {
+	var prev uint64
+	var prevTime time.Time
+	return func() float64 {
+		for {
+			time.Sleep(interval)
+			cur, err := read()
+			now := time.Now()
+			if err != nil {
+				prevTime = time.Time{}
+				continue
+			}
+			rate, ok := counterRate(prev, cur, now.Sub(prevTime))
+			ok = ok && !prevTime.IsZero()
+			prev, prevTime = cur, now
+			if ok {
+				return rate
+			}
+		}
+	}
+}
+
+// counterRate returns the rate per second of a counter that went from prev
+// to cur in elapsed. A counter that went backwards has no rate: it wrapped
+// around, like the 32-bit counters of some kernels, or it got reset, and
+// the two cases look the same.
+func counterRate(prev, cur uint64, elapsed time.Duration) (float64, bool) {
+	if cur < prev || elapsed <= 0 {
+		return 0, false
+	}
+	return float64(cur-prev) / elapsed.Seconds(), true
+}
@@ -0,0 +1,44 @@
+package collectors
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// Offsets in struct if_msghdr2, which the NET_RT_IFLIST2 sysctl returns
+// for each interface, with 64-bit counters in its struct if_data64.
+const (
+	ifm2Index  = 12
+	ifm2IBytes = 32 + 64
+	ifm2OBytes = 32 + 72
+	ifm2Size   = 32 + 128
+)
+
+// readNetCounters reads the counters of the interface name from the
+// interface list of the routing sysctl.
+func readNetCounters(name string) (netCounters, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return netCounters{}, err
+	}
+	rib, err := syscall.RouteRIB(syscall.NET_RT_IFLIST2, 0)
+	if err != nil {
+		return netCounters{}, err
+	}
+	le := binary.LittleEndian
+	for len(rib) >= 4 {
+		n := int(le.Uint16(rib))
+		if n < 4 || n > len(rib) {
+			break
+		}
+		msg := rib[:n]
+		rib = rib[n:]
+		if msg[3] != syscall.RTM_IFINFO2 || n < ifm2Size || int(le.Uint16(msg[ifm2Index:])) != iface.Index {
+			continue
+		}
+		return netCounters{rx: le.Uint64(msg[ifm2IBytes:]), tx: le.Uint64(msg[ifm2OBytes:])}, nil
+	}
+	return netCounters{}, fmt.Errorf("no counters for interface %s", name)
+}
@@ -0,0 +1,48 @@
+package collectors
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readNetCounters reads the counters of the interface name from
+// /proc/net/dev, whose lines look like
+//
+//	eth0: 1234567 890 0 0 0 0 0 0 7654321 456 0 0 0 0 0 0
+//
+// with the received bytes first and the sent bytes ninth.
+func readNetCounters(name string) (netCounters, error) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return netCounters{}, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		i := strings.Index(line, ":")
+		if i < 0 || strings.TrimSpace(line[:i]) != name {
+			continue
+		}
+		fields := strings.Fields(line[i+1:])
+		if len(fields) < 9 {
+			return netCounters{}, fmt.Errorf("/proc/net/dev: unexpected format")
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return netCounters{}, err
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return netCounters{}, err
+		}
+		return netCounters{rx: rx, tx: tx}, nil
+	}
+	if err := sc.Err(); err != nil {
+		return netCounters{}, err
+	}
+	return netCounters{}, fmt.Errorf("no interface %s", name)
+}
@@ -0,0 +1,21 @@
+package collectors
+
+import (
+	"net"
+	"syscall"
+)
+
+// readNetCounters reads the counters of the interface name with
+// GetIfEntry. Its counters have 32 bits, so on a busy gigabit link they
+// wrap around every half minute or so; pollRate starts over then.
+func readNetCounters(name string) (netCounters, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return netCounters{}, err
+	}
+	row := syscall.MibIfRow{Index: uint32(iface.Index)}
+	if err := syscall.GetIfEntry(&row); err != nil {
+		return netCounters{}, err
+	}
+	return netCounters{rx: uint64(row.InOctets), tx: uint64(row.OutOctets)}, nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package collectors
+
+// The disk and network collectors use syscalls of Linux, macOS, and
+// Windows; other systems get no disk and network metrics.
+
+func listMounts() ([]mount, error) {
+	return nil, errUnsupported()
+}
+
+func openDisk(path string) (read func() (float64, error), err error) {
+	return nil, errUnsupported()
+}
+
+func openInodes(path string) (read func() (float64, error), err error) {
+	return nil, errUnsupported()
+}
+
+func readNetCounters(name string) (netCounters, error) {
+	return netCounters{}, errUnsupported()
+}
@@ -0,0 +1,214 @@
+package collectors
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// A Probe is like a Metric, but it does not pace itself: Func takes one
+// measurement whenever it is called, and returns an error instead of a
+// value when there is none, as on a timeout. Func returns as soon as ctx
+// is done, so that a probe does not keep the app from stopping.
+type Probe struct {
+	Name        string
+	Unit        string
+	Description string
+	Func        func(ctx context.Context) (float64, error)
+}
+
+// PingProbes returns one probe per host, named like "ping.8_8_8_8_ms" or
+// "ping.example_com_ms", with the round trip time to that host in
+// milliseconds. If the app may open ICMP sockets, the probes send ICMP
+// echo requests, like ping does; otherwise, they time how long it takes
+// to open a TCP connection to port 443, or to port 80 if 443 refuses the
+// connection. tcp is true in the latter case. A host that does not answer
+// within timeout makes the probe fail.
+func PingProbes(hosts []string, timeout time.Duration) (probes []Probe, tcp bool) {
+	tcp = !icmpAvailable()
+	for _, host := range hosts {
+		host := host
+		probe := Probe{
+			Name:        "ping." + nameSafe(host) + "_ms",
+			Unit:        "ms",
+			Description: "Round trip time to " + host + " (ICMP)",
+			Func: func(ctx context.Context) (float64, error) {
+				return icmpPing(ctx, host, timeout)
+			},
+		}
+		if tcp {
+			probe.Description = "Round trip time to " + host + " (TCP connect)"
+			probe.Func = func(ctx context.Context) (float64, error) {
+				return tcpPing(ctx, host, timeout)
+			}
+		}
+		probes = append(probes, probe)
+	}
+	return probes, tcp
+}
+
+// icmpAvailable tells whether listenICMP works, which depends on the
+// privileges of the app and, on Linux, on net.ipv4.ping_group_range.
+func icmpAvailable() bool {
+	c, err := listenICMP()
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
+// An icmpConn is a socket for ICMP over IPv4: a raw socket, which the
+// system hands the whole ICMP traffic of the host, or a datagram socket
+// that an unprivileged app may open on Linux and macOS. Both speak ICMP
+// messages, but they address hosts differently.
+type icmpConn struct {
+	net.PacketConn
+	datagram bool
+}
+
+func (c icmpConn) addr(ip net.IP) net.Addr {
+	if c.datagram {
+		return &net.UDPAddr{IP: ip}
+	}
+	return &net.IPAddr{IP: ip}
+}
+
+// icmpSeq numbers the echo requests of all probes, so that each probe
+// recognizes its own reply.
+var icmpSeq uint32
+
+// icmpPing sends an ICMP echo request to host and returns the time until
+// the reply arrives, in milliseconds.
+func icmpPing(ctx context.Context, host string, timeout time.Duration) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ip, err := resolve4(ctx, host)
+	if err != nil {
+		return 0, err
+	}
+	c, err := listenICMP()
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	go func() {
+		<-ctx.Done()
+		c.SetReadDeadline(time.Now())
+	}()
+
+	id := uint16(os.Getpid())
+	seq := uint16(atomic.AddUint32(&icmpSeq, 1))
+	start := time.Now()
+	if _, err := c.WriteTo(echoRequest(id, seq), c.addr(ip)); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := c.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, fmt.Errorf("ping %s: %w", host, ctx.Err())
+			}
+			return 0, err
+		}
+		// A raw socket gets the replies to every ping on the host, and
+		// so do those of the other probes.
+		if !sameIP(from, ip) || !isEchoReply(buf[:n], seq) {
+			continue
+		}
+		return float64(time.Since(start)) / float64(time.Millisecond), nil
+	}
+}
+
+// echoRequest returns an ICMP echo request message.
+func echoRequest(id, seq uint16) []byte {
+	m := make([]byte, 16)
+	m[0] = 8 // echo request; code 0
+	binary.BigEndian.PutUint16(m[4:], id)
+	binary.BigEndian.PutUint16(m[6:], seq)
+	copy(m[8:], "diydashb")
+	binary.BigEndian.PutUint16(m[2:], icmpChecksum(m))
+	return m
+}
+
+// isEchoReply tells whether m is the reply to the echo request with
+// sequence number seq. The identifier does not count: on Linux, datagram
+// sockets replace it with one of their own. Datagram sockets on macOS
+// pass on the IPv4 header, which starts with version 4 rather than the
+// reply's type 0.
+func isEchoReply(m []byte, seq uint16) bool {
+	if len(m) > 0 && m[0]>>4 == 4 {
+		hlen := int(m[0]&0x0f) * 4
+		if len(m) < hlen {
+			return false
+		}
+		m = m[hlen:]
+	}
+	return len(m) >= 8 && m[0] == 0 && binary.BigEndian.Uint16(m[6:]) == seq
+}
+
+func icmpChecksum(m []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(m); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(m[i:]))
+	}
+	if len(m)%2 == 1 {
+		sum += uint32(m[len(m)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func sameIP(a net.Addr, ip net.IP) bool {
+	switch a := a.(type) {
+	case *net.IPAddr:
+		return a.IP.Equal(ip)
+	case *net.UDPAddr:
+		return a.IP.Equal(ip)
+	}
+	return false
+}
+
+// resolve4 returns an IPv4 address of host. The probes resolve the host
+// every time, so that they follow DNS changes, but the lookup does not
+// count towards the round trip time.
+func resolve4(ctx context.Context, host string) (net.IP, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		return nil, err
+	}
+	return ips[0], nil
+}
+
+// tcpPing returns the time it takes to open a TCP connection to port 443
+// of host, or to port 80 if 443 is closed, in milliseconds. It closes the
+// connection right away.
+func tcpPing(ctx context.Context, host string, timeout time.Duration) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return 0, err
+	}
+	var d net.Dialer
+	for _, port := range []string{"443", "80"} {
+		start := time.Now()
+		c, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ips[0].String(), port))
+		if err == nil {
+			rtt := time.Since(start)
+			c.Close()
+			return float64(rtt) / float64(time.Millisecond), nil
+		}
+		if ctx.Err() != nil {
+			return 0, fmt.Errorf("ping %s: %w", host, ctx.Err())
+		}
+	}
+	return 0, fmt.Errorf("ping %s: ports 443 and 80 are closed", host)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package collectors
+
+import "net"
+
+// listenICMP opens a raw socket for ICMP, which needs administrator
+// rights.
+func listenICMP() (icmpConn, error) {
+	c, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	return icmpConn{PacketConn: c}, err
+}
@@ -0,0 +1,29 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package collectors
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenICMP opens a datagram socket for ICMP, which Linux allows the
+// groups in net.ipv4.ping_group_range to open, and macOS allows everyone.
+// Failing that, it opens a raw socket, which needs root or CAP_NET_RAW.
+func listenICMP() (icmpConn, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, syscall.IPPROTO_ICMP)
+	if err != nil {
+		c, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+		return icmpConn{PacketConn: c}, err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{}); err != nil {
+		syscall.Close(fd)
+		return icmpConn{}, err
+	}
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	c, err := net.FilePacketConn(f)
+	return icmpConn{PacketConn: c, datagram: true}, err
+}
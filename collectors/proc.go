@@ -0,0 +1,25 @@
+package collectors
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProcessMetrics returns the data function for system.process_count, the
+// number of processes running on the host. It waits for interval before
+// each count. The error says why the processes cannot be counted on this
+// system; then, there is no metric.
+func ProcessMetrics(interval time.Duration) ([]Metric, error) {
+	if _, err := countProcesses(); err != nil {
+		return nil, fmt.Errorf("counting the processes: %s", err)
+	}
+	return []Metric{{
+		Name:        "system.process_count",
+		Unit:        "short",
+		Description: "Processes running on the host",
+		Func: poll(interval, func() (float64, error) {
+			n, err := countProcesses()
+			return float64(n), err
+		}),
+	}}, nil
+}
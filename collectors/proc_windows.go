@@ -0,0 +1,26 @@
+package collectors
+
+import "unsafe"
+
+var procEnumProcesses = kernel32.NewProc("K32EnumProcesses")
+
+// countProcesses lists the process IDs with EnumProcesses. The function
+// does not tell how many IDs there are, only how many fit into the
+// buffer, so a full buffer means: try again with a bigger one.
+func countProcesses() (int, error) {
+	for size := 1024; ; size *= 2 {
+		ids := make([]uint32, size)
+		var written uint32
+		r, _, err := procEnumProcesses.Call(
+			uintptr(unsafe.Pointer(&ids[0])),
+			uintptr(len(ids)*4),
+			uintptr(unsafe.Pointer(&written)),
+		)
+		if r == 0 {
+			return 0, err
+		}
+		if n := int(written / 4); n < size {
+			return n, nil
+		}
+	}
+}
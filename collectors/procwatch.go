@@ -0,0 +1,126 @@
+package collectors
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A procSample is a reading of the resources that a process uses.
+type procSample struct {
+	cpu   float64 // seconds of CPU time, user and system, since the start
+	rss   uint64  // bytes
+	start uint64  // start time, which tells a process from a later one with the same PID
+}
+
+// errNoProcess is the error of findProcess if no process has the name.
+var errNoProcess = errors.New("no such process")
+
+// WatchProcess returns two data functions for the process target, a
+// process name like "nginx" or a PID: "proc.nginx.cpu_pct", the CPU load
+// of the process in percent of one core, and "proc.nginx.rss_mb", its
+// resident memory in MB. For a PID, the metrics are named after the
+// process that has the PID now.
+//
+// A process with that name need not run yet. When it exits, the functions
+// wait until a process with the same name shows up again, under any PID,
+// so a service that restarts leaves a gap rather than a flat line. If
+// several processes have the name, the functions watch the one that
+// started first, like the master process of nginx.
+func WatchProcess(target string, interval time.Duration) ([]Metric, error) {
+	w := &processWatch{name: target, maxAge: interval / 2}
+	if pid, err := strconv.Atoi(target); err == nil {
+		name, s, err := readProcess(pid)
+		if err != nil {
+			return nil, fmt.Errorf("watching process %d: %s", pid, err)
+		}
+		w.name, w.pid, w.sample, w.since = name, pid, s, time.Now()
+	} else if _, err := findProcess(target); err != nil && err != errNoProcess {
+		return nil, fmt.Errorf("watching process %s: %s", target, err)
+	}
+	prefix := "proc." + nameSafe(w.name)
+	return []Metric{
+		{
+			Name:        prefix + ".cpu_pct",
+			Unit:        "percent",
+			Description: "CPU load of the process " + w.name + ", in percent of one core",
+			Func: func() float64 {
+				for {
+					time.Sleep(interval)
+					if _, pct, ok, err := w.read(); err == nil && ok {
+						return pct
+					}
+				}
+			},
+		},
+		{
+			Name:        prefix + ".rss_mb",
+			Unit:        "mbytes",
+			Description: "Resident memory of the process " + w.name,
+			Func: pollPresent(interval, "process "+w.name, func() (float64, error) {
+				s, _, _, err := w.read()
+				return float64(s.rss) / (1 << 20), err
+			}),
+		},
+	}, nil
+}
+
+// processWatch follows the process with a name across restarts. A reading
+// is good for maxAge, so that the two data functions, which run at about
+// the same time, share one.
+type processWatch struct {
+	name   string
+	maxAge time.Duration
+
+	mu     sync.Mutex
+	pid    int // 0 while there is no process
+	sample procSample
+	since  time.Time // of sample
+	pct    float64   // CPU load between the last two readings
+	hasPct bool      // whether both readings are of the same process
+	err    error
+}
+
+// read returns the latest reading of the process, and the CPU load since
+// the reading before, if that was of the same process.
+func (w *processWatch) read() (s procSample, pct float64, hasPct bool, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if time.Since(w.since) <= w.maxAge {
+		return w.sample, w.pct, w.hasPct, w.err
+	}
+	now := time.Now()
+	prevPID, prev := w.pid, w.sample
+	s, err = w.readSame()
+	w.hasPct = err == nil && prevPID == w.pid && s.start == prev.start && s.cpu >= prev.cpu
+	if w.hasPct {
+		w.pct = (s.cpu - prev.cpu) / now.Sub(w.since).Seconds() * 100
+	}
+	if err != nil {
+		w.pid = 0
+	}
+	w.sample, w.since, w.err = s, now, err
+	return w.sample, w.pct, w.hasPct, w.err
+}
+
+// readSame reads the process that the watch follows, and looks it up
+// again by its name if it is gone.
+func (w *processWatch) readSame() (procSample, error) {
+	if w.pid != 0 {
+		if name, s, err := readProcess(w.pid); err == nil && isProcessName(w.name, name) {
+			return s, nil
+		}
+	}
+	pid, err := findProcess(w.name)
+	if err != nil {
+		return procSample{}, err
+	}
+	_, s, err := readProcess(pid)
+	if err != nil {
+		return procSample{}, err
+	}
+	w.pid = pid
+	return s, nil
+}
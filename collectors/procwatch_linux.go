@@ -0,0 +1,87 @@
+package collectors
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is the unit of the CPU times in /proc/<pid>/stat: USER_HZ,
+// which is 100 on every Linux system.
+const clockTicks = 100
+
+// readProcess reads the name (the "comm") and the resources of the
+// process pid from /proc/<pid>/stat, which looks like
+//
+//	1234 (nginx) S 1 1234 1234 0 -1 4194560 ...
+//
+// The name may contain spaces and parentheses itself, so the fields
+// count from the last ")".
+func readProcess(pid int) (string, procSample, error) {
+	b, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return "", procSample{}, err
+	}
+	open, end := bytes.IndexByte(b, '('), bytes.LastIndexByte(b, ')')
+	if open < 0 || end < open {
+		return "", procSample{}, fmt.Errorf("/proc/%d/stat: unexpected format", pid)
+	}
+	// The fields after the name start with the third one, the state.
+	fields := strings.Fields(string(b[end+1:]))
+	if len(fields) < 22 {
+		return "", procSample{}, fmt.Errorf("/proc/%d/stat: unexpected format", pid)
+	}
+	var n [4]uint64
+	for i, field := range []int{14, 15, 22, 24} { // utime, stime, starttime, rss
+		if n[i], err = strconv.ParseUint(fields[field-3], 10, 64); err != nil {
+			return "", procSample{}, fmt.Errorf("/proc/%d/stat: %s", pid, err)
+		}
+	}
+	return string(b[open+1 : end]), procSample{
+		cpu:   float64(n[0]+n[1]) / clockTicks,
+		start: n[2],
+		rss:   n[3] * uint64(os.Getpagesize()),
+	}, nil
+}
+
+// findProcess returns the process with the given name that started first.
+// It reads the stat file of every process, which is fine for a lookup now
+// and then.
+func findProcess(name string) (int, error) {
+	d, err := os.Open("/proc")
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+	found, first := 0, uint64(0)
+	for _, n := range names {
+		pid, err := strconv.Atoi(n)
+		if err != nil {
+			continue
+		}
+		comm, s, err := readProcess(pid)
+		if err != nil || !isProcessName(name, comm) {
+			continue
+		}
+		if found == 0 || s.start < first {
+			found, first = pid, s.start
+		}
+	}
+	if found == 0 {
+		return 0, errNoProcess
+	}
+	return found, nil
+}
+
+// isProcessName reports whether comm, the name of a process as the kernel
+// keeps it, is name. The kernel cuts names to 15 bytes.
+func isProcessName(name, comm string) bool {
+	return comm == name || len(comm) == 15 && strings.HasPrefix(name, comm)
+}
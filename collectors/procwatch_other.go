@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package collectors
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Watching a process reads /proc, which only Linux has.
+
+func readProcess(pid int) (string, procSample, error) {
+	return "", procSample{}, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
+
+func findProcess(name string) (int, error) {
+	return 0, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
+
+func isProcessName(name, comm string) bool {
+	return name == comm
+}
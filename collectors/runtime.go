@@ -0,0 +1,125 @@
+package collectors
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"time"
+)
+
+// gcPauses is the runtime/metrics histogram of the stop-the-world pauses
+// of the garbage collector.
+const gcPauses = "/gc/pauses:seconds"
+
+// RuntimeMetrics returns data functions for the Go runtime of the app:
+//
+//   - go.goroutines: the number of goroutines
+//   - go.heap_alloc_mb: the heap in use, in MB
+//   - go.gc_count: the garbage collections since the previous value
+//   - go.gc_pause_ms: the longest GC pause since the previous value, in
+//     milliseconds, or 0 if there was none
+//
+// Each function waits for interval before it reads its value.
+// runtime.ReadMemStats stops the world for a moment, so the interval
+// should be a few seconds rather than milliseconds.
+func RuntimeMetrics(interval time.Duration) []Metric {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	prevGC := m.NumGC
+	list := []Metric{
+		{
+			Name:        "go.goroutines",
+			Unit:        "short",
+			Description: "Goroutines",
+			Func: poll(interval, func() (float64, error) {
+				return float64(runtime.NumGoroutine()), nil
+			}),
+		},
+		{
+			Name:        "go.heap_alloc_mb",
+			Unit:        "mbytes",
+			Description: "Heap in use",
+			Func: poll(interval, func() (float64, error) {
+				var m runtime.MemStats
+				runtime.ReadMemStats(&m)
+				return float64(m.HeapAlloc) / mb, nil
+			}),
+		},
+		{
+			Name:        "go.gc_count",
+			Unit:        "short",
+			Description: "Garbage collections per interval",
+			Func: poll(interval, func() (float64, error) {
+				var m runtime.MemStats
+				runtime.ReadMemStats(&m)
+				n := m.NumGC - prevGC
+				prevGC = m.NumGC
+				return float64(n), nil
+			}),
+		},
+	}
+	if pauses := newGCPauseFunc(interval); pauses != nil {
+		list = append(list, Metric{
+			Name:        "go.gc_pause_ms",
+			Unit:        "ms",
+			Description: "Longest garbage collection pause per interval",
+			Func:        pauses,
+		})
+	}
+	return list
+}
+
+// newGCPauseFunc returns a data function for the longest GC pause since
+// the previous call, in milliseconds, or nil if the runtime has no pause
+// histogram. The histogram counts all pauses since the start of the app,
+// in buckets of pause times. The buckets whose counts went up since the
+// previous call hold the new pauses, so each pause is reported once. The
+// value of a bucket is its upper bound, so the reported pause is a little
+// longer than the actual one.
+func newGCPauseFunc(interval time.Duration) func() float64 {
+	sample := []metrics.Sample{{Name: gcPauses}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindFloat64Histogram {
+		return nil
+	}
+	prev := append([]uint64(nil), sample[0].Value.Float64Histogram().Counts...)
+	return poll(interval, func() (float64, error) {
+		metrics.Read(sample)
+		h := sample[0].Value.Float64Histogram()
+		var longest float64
+		for i, c := range h.Counts {
+			if i < len(prev) && c > prev[i] || i >= len(prev) && c > 0 {
+				longest = h.Buckets[i+1]
+				if math.IsInf(longest, 1) {
+					longest = h.Buckets[i]
+				}
+			}
+		}
+		prev = append(prev[:0], h.Counts...)
+		return longest * 1000, nil
+	})
+}
+
+// MakeGarbage allocates about mbPerSecond MB per second that nobody keeps,
+// which makes the garbage collector run, so that go.gc_count and
+// go.gc_pause_ms have something to show. It returns when ctx is done.
+func MakeGarbage(ctx context.Context, mbPerSecond int) {
+	const chunk = 64 << 10
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+		for n := 0; n < mbPerSecond*mb/10; n += chunk {
+			garbage = make([]byte, chunk)
+		}
+	}
+}
+
+// garbage keeps the compiler from putting the allocations of MakeGarbage
+// on the stack.
+var garbage []byte
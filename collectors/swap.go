@@ -0,0 +1,65 @@
+package collectors
+
+import (
+	"fmt"
+	"time"
+)
+
+// swapStatus is the swap space of the system, in bytes, and the bytes
+// swapped in and out since boot.
+type swapStatus struct {
+	total, free uint64
+	in, out     uint64
+}
+
+// SwapMetrics returns the data functions for the swap space of the system:
+//
+//   - swap.used_pct: swap space in use, in percent
+//   - swap.in_kbps: KB per second swapped in from disk
+//   - swap.out_kbps: KB per second swapped out to disk
+//
+// Each function waits for interval before it reads its value. The rates
+// are the deltas between two readings, so they start one interval later.
+// A system without swap space gets only swap.used_pct, which stays 0.
+func SwapMetrics(interval time.Duration) ([]Metric, error) {
+	s, err := readSwap()
+	if err != nil {
+		return nil, fmt.Errorf("reading the swap space: %s", err)
+	}
+	metrics := []Metric{{
+		Name:        "swap.used_pct",
+		Unit:        "percent",
+		Description: "Swap space in use, in percent",
+		Func: poll(interval, func() (float64, error) {
+			s, err := readSwap()
+			if err != nil || s.total == 0 {
+				return 0, err
+			}
+			return 100 * float64(s.total-s.free) / float64(s.total), nil
+		}),
+	}}
+	if s.total == 0 {
+		return metrics, nil
+	}
+	rate := func(counter func(swapStatus) uint64) func() float64 {
+		f := pollRate(interval, func() (uint64, error) {
+			s, err := readSwap()
+			return counter(s), err
+		})
+		return func() float64 { return f() / 1024 }
+	}
+	return append(metrics,
+		Metric{
+			Name:        "swap.in_kbps",
+			Unit:        "KBs",
+			Description: "KB per second swapped in from disk",
+			Func:        rate(func(s swapStatus) uint64 { return s.in }),
+		},
+		Metric{
+			Name:        "swap.out_kbps",
+			Unit:        "KBs",
+			Description: "KB per second swapped out to disk",
+			Func:        rate(func(s swapStatus) uint64 { return s.out }),
+		},
+	), nil
+}
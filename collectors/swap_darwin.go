@@ -0,0 +1,42 @@
+//go:build cgo
+// +build cgo
+
+package collectors
+
+/*
+#include <mach/mach.h>
+#include <sys/sysctl.h>
+
+// swap returns the size and the use of the swap files, and the pages
+// swapped in and out since boot.
+static int swap(uint64_t *total, uint64_t *used, uint64_t *in, uint64_t *out) {
+	struct xsw_usage usage;
+	size_t len = sizeof(usage);
+	if (sysctlbyname("vm.swapusage", &usage, &len, NULL, 0) != 0) {
+		return -1;
+	}
+	vm_statistics64_data_t vm;
+	mach_msg_type_number_t count = HOST_VM_INFO64_COUNT;
+	if (host_statistics64(mach_host_self(), HOST_VM_INFO64, (host_info64_t)&vm, &count) != KERN_SUCCESS) {
+		return -1;
+	}
+	*total = usage.xsu_total;
+	*used = usage.xsu_used;
+	*in = vm.swapins * vm_kernel_page_size;
+	*out = vm.swapouts * vm_kernel_page_size;
+	return 0;
+}
+*/
+import "C"
+
+import "fmt"
+
+// readSwap reads the swap files that macOS creates and removes as needed.
+// With no swap file at the moment, the total is 0.
+func readSwap() (swapStatus, error) {
+	var total, used, in, out C.uint64_t
+	if C.swap(&total, &used, &in, &out) != 0 {
+		return swapStatus{}, fmt.Errorf("cannot read the swap usage")
+	}
+	return swapStatus{total: uint64(total), free: uint64(total - used), in: uint64(in), out: uint64(out)}, nil
+}
@@ -0,0 +1,30 @@
+package collectors
+
+import (
+	"fmt"
+	"os"
+)
+
+// readSwap reads SwapTotal and SwapFree from /proc/meminfo, and the pages
+// swapped in and out since boot, pswpin and pswpout, from /proc/vmstat.
+func readSwap() (swapStatus, error) {
+	kb, err := readProcTable("/proc/meminfo")
+	if err != nil {
+		return swapStatus{}, err
+	}
+	total, ok := kb["SwapTotal"]
+	if !ok {
+		return swapStatus{}, fmt.Errorf("/proc/meminfo: no SwapTotal")
+	}
+	vm, err := readProcTable("/proc/vmstat")
+	if err != nil {
+		return swapStatus{}, err
+	}
+	page := uint64(os.Getpagesize())
+	return swapStatus{
+		total: total * 1024,
+		free:  kb["SwapFree"] * 1024,
+		in:    vm["pswpin"] * page,
+		out:   vm["pswpout"] * page,
+	}, nil
+}
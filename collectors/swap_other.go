@@ -0,0 +1,12 @@
+//go:build !linux && !(darwin && cgo)
+// +build !linux
+// +build !darwin !cgo
+
+package collectors
+
+// Windows has a page file instead of swap space, and counts its use in
+// other ways; there are no swap metrics there.
+
+func readSwap() (swapStatus, error) {
+	return swapStatus{}, errUnsupported()
+}
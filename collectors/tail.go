@@ -0,0 +1,168 @@
+package collectors
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// maxPartialLine is how much of a line without a newline yet TailMetric
+// keeps for matching. The rest of a longer line still counts as a line,
+// but only its start is matched.
+const maxPartialLine = 64 << 10
+
+// TailMetric returns a data function named "log.<file name>.lines_per_s",
+// like "log.app_log.lines_per_s" for /var/log/app.log, with the lines per
+// second that get appended to the file at path. With match, only the
+// lines that match count, like those with "ERROR" in them.
+//
+// The function follows the file like `tail -F`: it starts at the end of
+// the file, and when the file gets rotated (renamed, and a new one
+// created in its place), it reads the rest of the old file and goes on
+// with the new one. A file that gets truncated is read from the start
+// again. While the file does not exist, the function waits for it, so the
+// metric has no points until the file shows up.
+func TailMetric(path string, match *regexp.Regexp, interval time.Duration) Metric {
+	t := &logTail{path: path, match: match, since: time.Now()}
+	if err := t.open(); err == nil {
+		t.f.Seek(0, io.SeekEnd)
+	}
+	desc := "Lines per second appended to " + path
+	if match != nil {
+		desc = "Lines per second appended to " + path + " that match " + match.String()
+	}
+	return Metric{
+		Name:        "log." + nameSafe(filepath.Base(path)) + ".lines_per_s",
+		Unit:        "cps",
+		Description: desc,
+		Func: func() float64 {
+			for {
+				time.Sleep(interval)
+				if rate, ok := t.rate(); ok {
+					return rate
+				}
+			}
+		},
+	}
+}
+
+// logTail follows a file and counts its new lines.
+type logTail struct {
+	path  string
+	match *regexp.Regexp
+
+	f       *os.File // nil while the file does not exist
+	fi      os.FileInfo
+	since   time.Time // of the last rate
+	partial []byte    // the start of a line without a newline yet
+	waiting bool      // whether the log says that the file is missing
+	buf     []byte
+}
+
+// open opens the file at path, from the start.
+func (t *logTail) open() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	t.f, t.fi, t.partial = f, fi, t.partial[:0]
+	return nil
+}
+
+// rate returns the lines per second since the last call. There is no rate
+// while the file does not exist, nor right after it showed up.
+func (t *logTail) rate() (float64, bool) {
+	if t.f == nil {
+		if err := t.open(); err != nil {
+			if !t.waiting {
+				log.Printf("%s: waiting for the file (%s)", t.path, err)
+				t.waiting = true
+			}
+			return 0, false
+		}
+		if t.waiting {
+			log.Printf("%s is there", t.path)
+			t.waiting = false
+		}
+		t.since = time.Now()
+		return 0, false
+	}
+	n := t.readLines()
+	fi, err := os.Stat(t.path)
+	switch {
+	case err != nil:
+		// Rotated, and the new file is not there yet. The old one may
+		// still get lines until then.
+	case !os.SameFile(fi, t.fi):
+		t.f.Close()
+		if t.open() == nil {
+			n += t.readLines()
+		} else {
+			t.f = nil
+		}
+	default:
+		if pos, err := t.f.Seek(0, io.SeekCurrent); err == nil && fi.Size() < pos {
+			t.f.Seek(0, io.SeekStart)
+			t.partial = t.partial[:0]
+			n += t.readLines()
+		}
+	}
+	now := time.Now()
+	rate := float64(n) / now.Sub(t.since).Seconds()
+	t.since = now
+	return rate, true
+}
+
+// readLines reads the file to its end and counts the complete lines that
+// match.
+func (t *logTail) readLines() int {
+	if t.buf == nil {
+		t.buf = make([]byte, 32<<10)
+	}
+	n := 0
+	for {
+		k, err := t.f.Read(t.buf)
+		data := t.buf[:k]
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				t.keep(data)
+				break
+			}
+			if t.match == nil {
+				n++
+			} else {
+				t.keep(data[:i])
+				if t.match.Match(t.partial) {
+					n++
+				}
+			}
+			t.partial = t.partial[:0]
+			data = data[i+1:]
+		}
+		if err != nil || k == 0 {
+			return n
+		}
+	}
+}
+
+// keep adds b to the partial line, up to maxPartialLine. Without a regular
+// expression, the content of the lines does not matter.
+func (t *logTail) keep(b []byte) {
+	if t.match == nil {
+		return
+	}
+	if room := maxPartialLine - len(t.partial); len(b) > room {
+		b = b[:room]
+	}
+	t.partial = append(t.partial, b...)
+}
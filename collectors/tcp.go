@@ -0,0 +1,71 @@
+package collectors
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// tcpStates are the states of TCP connections, by the names of their
+// metrics, in the order of the TCP state machine.
+var tcpStates = []string{
+	"listen", "syn_sent", "syn_recv", "established",
+	"fin_wait1", "fin_wait2", "close_wait", "closing", "last_ack", "time_wait", "close",
+}
+
+// TCPMetrics returns one data function per TCP state, named like
+// "tcp.established" or "tcp.time_wait", with the number of connections
+// in that state, over IPv4 and IPv6. States without connections count 0,
+// so that every state has a line in Grafana. With a port other than 0,
+// only the connections with that local port count: the connections of a
+// web server on :8080, say, and not those it makes to its database.
+//
+// Each function waits for interval before it reads its value. The
+// functions share one reading of the connection table per interval.
+func TCPMetrics(interval time.Duration, port int) ([]Metric, error) {
+	table := &tcpTable{port: port, maxAge: interval / 2}
+	if _, err := table.counts(); err != nil {
+		return nil, fmt.Errorf("reading the TCP connections: %s", err)
+	}
+	of := ""
+	if port != 0 {
+		of = fmt.Sprintf(" on local port %d", port)
+	}
+	var metrics []Metric
+	for _, state := range tcpStates {
+		state := state
+		metrics = append(metrics, Metric{
+			Name:        "tcp." + state,
+			Unit:        "short",
+			Description: "TCP connections in state " + state + of,
+			Func: poll(interval, func() (float64, error) {
+				counts, err := table.counts()
+				return float64(counts[state]), err
+			}),
+		})
+	}
+	return metrics, nil
+}
+
+// tcpTable counts the TCP connections by state. A reading is good for
+// maxAge, so that the data functions of all states, which wake up at
+// about the same time, share one.
+type tcpTable struct {
+	port   int
+	maxAge time.Duration
+
+	mu    sync.Mutex
+	last  map[string]int
+	err   error
+	since time.Time
+}
+
+func (t *tcpTable) counts() (map[string]int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Since(t.since) > t.maxAge {
+		t.last, t.err = countTCPStates(t.port)
+		t.since = time.Now()
+	}
+	return t.last, t.err
+}
@@ -0,0 +1,83 @@
+package collectors
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// procTCPStates are the states of the st column of /proc/net/tcp, in
+// hex, as in the kernel's include/net/tcp_states.h.
+var procTCPStates = map[string]string{
+	"01": "established",
+	"02": "syn_sent",
+	"03": "syn_recv",
+	"04": "fin_wait1",
+	"05": "fin_wait2",
+	"06": "time_wait",
+	"07": "close",
+	"08": "close_wait",
+	"09": "last_ack",
+	"0A": "listen",
+	"0B": "closing",
+}
+
+// countTCPStates counts the connections in /proc/net/tcp and
+// /proc/net/tcp6. A system without IPv6 has no tcp6 table.
+func countTCPStates(port int) (map[string]int, error) {
+	counts := map[string]int{}
+	for _, name := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) && name == "/proc/net/tcp6" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = parseProcNetTCP(f, port, counts)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return counts, nil
+}
+
+// parseProcNetTCP adds the connections of a /proc/net/tcp table to counts,
+// by state. The table has a header line and then one line per connection:
+//
+//	sl  local_address rem_address   st tx_queue rx_queue ...
+//	 0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 ...
+//
+// The addresses end in the port, and the state is a hex number; both are
+// in hex. With a port other than 0, only connections with that local
+// port count.
+func parseProcNetTCP(r io.Reader, port int, counts map[string]int) error {
+	sc := bufio.NewScanner(r)
+	sc.Scan() // the header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		if port != 0 {
+			local := fields[1]
+			p, err := strconv.ParseUint(local[strings.LastIndex(local, ":")+1:], 16, 16)
+			if err != nil {
+				return fmt.Errorf("bad local address %q", local)
+			}
+			if int(p) != port {
+				continue
+			}
+		}
+		state, ok := procTCPStates[strings.ToUpper(fields[3])]
+		if !ok {
+			return fmt.Errorf("bad state %q", fields[3])
+		}
+		counts[state]++
+	}
+	return sc.Err()
+}
@@ -0,0 +1,82 @@
+package collectors
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProcNetTCP(t *testing.T) {
+	tests := []struct {
+		port int
+		want map[string]int
+	}{
+		{0, map[string]int{"listen": 5, "established": 5, "time_wait": 2, "close_wait": 2, "closing": 1}},
+		// 1F90
+		{8080, map[string]int{"listen": 2, "established": 3, "time_wait": 1, "close_wait": 1}},
+		// 1538; the client side of the connection has another local port.
+		{5432, map[string]int{"listen": 1, "established": 1}},
+		{9999, map[string]int{}},
+	}
+	for _, tt := range tests {
+		counts := map[string]int{}
+		for _, name := range []string{"testdata/proc_net_tcp", "testdata/proc_net_tcp6"} {
+			f, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = parseProcNetTCP(f, tt.port, counts)
+			f.Close()
+			if err != nil {
+				t.Fatalf("port %d: %s: %s", tt.port, name, err)
+			}
+		}
+		if !reflect.DeepEqual(counts, tt.want) {
+			t.Errorf("port %d: %v; want %v", tt.port, counts, tt.want)
+		}
+	}
+}
+
+func TestParseProcNetTCPStates(t *testing.T) {
+	header := "  sl  local_address rem_address   st tx_queue rx_queue\n"
+	for hex, want := range map[string]string{
+		"01": "established",
+		"06": "time_wait",
+		"08": "close_wait",
+		"0A": "listen",
+		"0a": "listen",
+		"0B": "closing",
+	} {
+		counts := map[string]int{}
+		line := "   0: 0100007F:1F90 00000000:0000 " + hex + " 00000000:00000000\n"
+		if err := parseProcNetTCP(strings.NewReader(header+line), 8080, counts); err != nil {
+			t.Errorf("state %s: %s", hex, err)
+			continue
+		}
+		if counts[want] != 1 || len(counts) != 1 {
+			t.Errorf("state %s: %v; want %s", hex, counts, want)
+		}
+	}
+}
+
+func TestParseProcNetTCPErrors(t *testing.T) {
+	tests := []struct {
+		file string
+		port int
+	}{
+		{"testdata/proc_net_tcp_bad_state", 0},
+		{"testdata/proc_net_tcp_bad_port", 8080},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = parseProcNetTCP(f, tt.port, map[string]int{})
+		f.Close()
+		if err == nil {
+			t.Errorf("%s: no error", tt.file)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+//go:build !linux
+// +build !linux
+
+package collectors
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// netstatStates maps the states that netstat prints on macOS, the BSDs,
+// and Windows to the names of the metrics.
+var netstatStates = map[string]string{
+	"ESTABLISHED":  "established",
+	"SYN_SENT":     "syn_sent",
+	"SYN_RCVD":     "syn_recv",
+	"SYN_RECEIVED": "syn_recv",
+	"FIN_WAIT_1":   "fin_wait1",
+	"FIN_WAIT_2":   "fin_wait2",
+	"TIME_WAIT":    "time_wait",
+	"CLOSED":       "close",
+	"CLOSE_WAIT":   "close_wait",
+	"LAST_ACK":     "last_ack",
+	"LISTEN":       "listen",
+	"LISTENING":    "listen",
+	"CLOSING":      "closing",
+}
+
+// countTCPStates asks netstat for the connections. That is a new process
+// every time, but it works the same on macOS, the BSDs, and Windows.
+func countTCPStates(port int) (map[string]int, error) {
+	out, err := exec.Command("netstat", "-an").Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseNetstat(out, port), nil
+}
+
+// parseNetstat counts the TCP connections in the output of `netstat -an`
+// by state. The lines differ between systems, but in both, the state
+// comes last and the local address third from last:
+//
+//	tcp4       0      0  127.0.0.1.8080         *.*                    LISTEN
+//	  TCP    0.0.0.0:8080           0.0.0.0:0              LISTENING
+//
+// The port follows the last dot (BSD) or colon (Windows) of the address.
+// With a port other than 0, only connections with that local port count.
+// Lines of other protocols, and headers, are skipped.
+func parseNetstat(out []byte, port int) map[string]int {
+	counts := map[string]int{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 || !strings.HasPrefix(strings.ToLower(fields[0]), "tcp") {
+			continue
+		}
+		state, ok := netstatStates[fields[len(fields)-1]]
+		if !ok {
+			continue
+		}
+		if port != 0 {
+			local := fields[len(fields)-3]
+			i := strings.LastIndexAny(local, ".:")
+			if p, err := strconv.Atoi(local[i+1:]); err != nil || p != port {
+				continue
+			}
+		}
+		counts[state]++
+	}
+	return counts
+}
@@ -0,0 +1,55 @@
+package collectors
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// A sensor is a temperature sensor with the name of its metric.
+type sensor struct {
+	name  string // like "temp.coretemp.Package_id_0"
+	label string // for people, like "coretemp Package id 0"
+	read  func() (float64, error)
+}
+
+// TemperatureMetrics returns a data function per temperature sensor,
+// named "temp.<chip>.<label>", like "temp.coretemp.Core_0", with the
+// temperature in degrees Celsius. Only sensors whose metric name matches
+// filter get metrics; a nil filter selects all.
+//
+// Each function waits for interval before it reads its value. Sensors on
+// cheap boards fail now and then; a failed reading is skipped, and the
+// function waits for the next one.
+func TemperatureMetrics(interval time.Duration, filter *regexp.Regexp) ([]Metric, error) {
+	sensors, err := listSensors()
+	if err != nil {
+		return nil, fmt.Errorf("listing the temperature sensors: %s", err)
+	}
+	var metrics []Metric
+	for _, s := range sensors {
+		if filter != nil && !filter.MatchString(s.name) {
+			continue
+		}
+		metrics = append(metrics, Metric{
+			Name:        s.name,
+			Unit:        "celsius",
+			Description: "Temperature of " + s.label,
+			Func:        pollSkipping(interval, s.read),
+		})
+	}
+	return metrics, nil
+}
+
+// pollSkipping is like poll, but a failed reading gets skipped: the data
+// function waits for another interval instead of repeating the last value.
+func pollSkipping(interval time.Duration, read func() (float64, error)) func() float64 {
+	return func() float64 {
+		for {
+			time.Sleep(interval)
+			if v, err := read(); err == nil {
+				return v
+			}
+		}
+	}
+}
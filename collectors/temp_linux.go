@@ -0,0 +1,72 @@
+package collectors
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hwmonDir is where Linux lists the hardware monitoring chips, one
+// directory per chip, like hwmon0.
+const hwmonDir = "/sys/class/hwmon"
+
+// listSensors finds the temperature inputs of the hardware monitoring
+// chips, like /sys/class/hwmon/hwmon2/temp1_input. A chip has a name,
+// like "coretemp" or "nvme", and a sensor may have a label, like "Core 0";
+// without one, the sensor is named after its input, like "temp1".
+func listSensors() ([]sensor, error) {
+	inputs, err := filepath.Glob(filepath.Join(hwmonDir, "hwmon*", "temp*_input"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(inputs)
+	var sensors []sensor
+	seen := map[string]bool{}
+	for _, input := range inputs {
+		dir := filepath.Dir(input)
+		chip := readLine(filepath.Join(dir, "name"))
+		if chip == "" {
+			chip = filepath.Base(dir)
+		}
+		base := strings.TrimSuffix(filepath.Base(input), "_input")
+		label := readLine(filepath.Join(dir, base+"_label"))
+		if label == "" {
+			label = base
+		}
+		name := "temp." + nameSafe(chip) + "." + nameSafe(label)
+		// Two chips of the same kind, like the sensors of two DIMMs,
+		// get numbered.
+		for i := 2; seen[name]; i++ {
+			name = "temp." + nameSafe(chip) + strconv.Itoa(i) + "." + nameSafe(label)
+		}
+		seen[name] = true
+		input := input
+		sensors = append(sensors, sensor{
+			name:  name,
+			label: chip + " " + label,
+			read: func() (float64, error) {
+				b, err := ioutil.ReadFile(input)
+				if err != nil {
+					return 0, err
+				}
+				milli, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+				if err != nil {
+					return 0, err
+				}
+				return float64(milli) / 1000, nil
+			},
+		})
+	}
+	return sensors, nil
+}
+
+// readLine returns the first line of a file, or "" if it cannot be read.
+func readLine(name string) string {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0])
+}
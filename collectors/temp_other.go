@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package collectors
+
+// Only Linux lists its temperature sensors in files; other systems need
+// vendor tools or drivers, and get no temperature metrics.
+
+func listSensors() ([]sensor, error) {
+	return nil, errUnsupported()
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !windows && !(darwin && cgo)
+// +build !linux
+// +build !windows
+// +build !darwin !cgo
+
+package collectors
+
+func readCPUTimes() ([]cpuTimes, error) {
+	return nil, errUnsupported()
+}
+
+func readProcessRSS() (uint64, error) {
+	return 0, errUnsupported()
+}
+
+func readSystemMemory() (memoryStatus, error) {
+	return memoryStatus{}, errUnsupported()
+}
+
+func countOpenFDs() (int, error) {
+	return 0, errUnsupported()
+}
@@ -0,0 +1,72 @@
+package dashboard
+
+import (
+	"log"
+	"time"
+)
+
+// Limits of adaptive buffer resizing. A buffer gets resized when the rate
+// that a metric actually receives is off by more than adaptiveFactor from
+// the rate its buffer was made for, and the new buffer holds the
+// registry's time range at the observed rate, plus some headroom.
+const (
+	adaptiveInterval = 10 * time.Second
+	adaptiveFactor   = 2.0
+	adaptiveHeadroom = 1.1
+	adaptiveMinSize  = 60
+	// The rate is only trusted after this many samples.
+	adaptiveMinSamples = 30
+)
+
+// adaptBuffers resizes the buffers of metrics whose sample rate does not
+// match their buffer: a buffer that is too small does not cover the time
+// range of the dashboard, one that is too large wastes memory. No buffer
+// grows beyond maxSize points. It runs until the registry's group stops.
+//
+// grada cannot resize a Metric, so resizing replaces it with a new one of
+// the same name. The data in the old buffer is lost, so the rate must be
+// off by a wide margin before that happens, and the rate measurement
+// starts over after each resize.
+func (r *registry) adaptBuffers(maxSize int) {
+	r.group.loop(r.clock.Tick(adaptiveInterval), func(time.Time) {
+		for _, s := range r.list() {
+			u := s.usage()
+			if u.Rate == 0 || s.samples() < adaptiveMinSamples {
+				continue
+			}
+			want := int(r.timeRange.Seconds() * u.Rate * adaptiveHeadroom)
+			if want < adaptiveMinSize {
+				want = adaptiveMinSize
+			}
+			if want > maxSize {
+				want = maxSize
+			}
+			if float64(want) < adaptiveFactor*float64(u.Capacity) && float64(want)*adaptiveFactor > float64(u.Capacity) {
+				continue
+			}
+			if err := r.resize(s, want); err != nil {
+				log.Printf("resizing the buffer of %s: %s", s.name, err)
+				continue
+			}
+			log.Printf("%s receives %.3g samples/s; resized its buffer from %d to %d points", s.name, u.Rate, u.Capacity, want)
+		}
+	})
+}
+
+// resize replaces the grada Metric of s with one that holds size points.
+// The samples so far still count, as for the catalog; only those in the
+// buffer start over.
+func (r *registry) resize(s *series, size int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := r.dash.DeleteMetric(s.name); err != nil {
+		return err
+	}
+	m, err := r.dash.CreateMetricWithBufSize(s.name, size)
+	if err != nil {
+		return err
+	}
+	s.Metric, s.capacity = m, size
+	s.buffered = 0
+	return nil
+}
@@ -0,0 +1,209 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// When a /query request asks for fewer points than a series has in the
+// time range (Grafana's maxDataPoints, about the panel's width in pixels),
+// grada averages neighboring points. Averages hide spikes, so for a
+// target that asks for another aggregation, the proxy fetches all points
+// and aggregates them itself.
+
+// rawMaxDataPoints is the maxDataPoints that makes grada return all points.
+const rawMaxDataPoints = math.MaxInt32
+
+// An aggregator reduces the values of one bucket to one value. values is
+// not empty, and the aggregator may reorder it.
+type aggregator func(values []float64) float64
+
+// aggregators are the aggregations that targets can choose from.
+var aggregators = map[string]aggregator{
+	"avg": func(values []float64) float64 {
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	},
+	"sum": func(values []float64) float64 {
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	},
+	"min": func(values []float64) float64 {
+		m := values[0]
+		for _, v := range values[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	},
+	"max": func(values []float64) float64 {
+		m := values[0]
+		for _, v := range values[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	},
+	"last": func(values []float64) float64 {
+		return values[len(values)-1]
+	},
+	"p95": func(values []float64) float64 {
+		sort.Float64s(values)
+		return values[int(math.Ceil(0.95*float64(len(values))))-1]
+	},
+}
+
+// aggregatorNames returns the names of the aggregators, for messages.
+func aggregatorNames() string {
+	names := make([]string, 0, len(aggregators))
+	for name := range aggregators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// aggregateSpec is what the -aggregate flag describes, as in "CPU*:max":
+// the aggregation for the metrics that match the pattern, unless the
+// panel's target asks for another one.
+type aggregateSpec struct {
+	pattern string
+	how     string
+}
+
+func parseAggregateSpec(s string) (aggregateSpec, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return aggregateSpec{}, fmt.Errorf("aggregate %q: want <metric>:<aggregation>", s)
+	}
+	spec := aggregateSpec{pattern: s[:i], how: s[i+1:]}
+	if aggregators[spec.how] == nil {
+		return spec, fmt.Errorf("aggregate %q: unknown aggregation %q (%s)", s, spec.how, aggregatorNames())
+	}
+	return spec, nil
+}
+
+// A queryAggregation aggregates the series of a /query response that was
+// fetched with rawMaxDataPoints down to the maxDataPoints of the original
+// request.
+type queryAggregation struct {
+	by        map[string]aggregator // by target; others get "avg", like grada does
+	maxPoints int
+	values    []float64 // scratch space for a bucket
+}
+
+// newQueryAggregation finds the aggregation of each target of a /query
+// request: from the target's payload, as in {"target": "CPU1", "data":
+// {"agg": "max"}}, or from specs. It returns nil if grada's averages
+// will do for all targets.
+func newQueryAggregation(body []byte, specs []aggregateSpec) (*queryAggregation, error) {
+	var q struct {
+		MaxDataPoints int `json:"maxDataPoints"`
+		Targets       []struct {
+			Target  string          `json:"target"`
+			Data    json.RawMessage `json:"data"`
+			Payload json.RawMessage `json:"payload"`
+		} `json:"targets"`
+	}
+	if err := json.Unmarshal(body, &q); err != nil || q.MaxDataPoints <= 0 {
+		return nil, nil
+	}
+	a := &queryAggregation{by: map[string]aggregator{}, maxPoints: q.MaxDataPoints}
+	for _, t := range q.Targets {
+		how := targetOption(t.Data, "agg")
+		if how == "" {
+			how = targetOption(t.Payload, "agg")
+		}
+		for _, spec := range specs {
+			if how != "" {
+				break
+			}
+			if matchPattern(spec.pattern, t.Target) {
+				how = spec.how
+			}
+		}
+		if how == "" || how == "avg" {
+			continue
+		}
+		agg := aggregators[how]
+		if agg == nil {
+			return nil, fmt.Errorf("target %s: unknown aggregation %q (%s)", t.Target, how, aggregatorNames())
+		}
+		a.by[t.Target] = agg
+	}
+	if len(a.by) == 0 {
+		return nil, nil
+	}
+	return a, nil
+}
+
+// targetOption returns a string field of a target's payload, like "agg".
+// The SimpleJSON datasource sends the panel's "Additional JSON Data" as an
+// object; as a string, it gets parsed, too.
+func targetOption(payload json.RawMessage, key string) string {
+	var s string
+	if json.Unmarshal(payload, &s) == nil {
+		payload = json.RawMessage(s)
+	}
+	var p map[string]json.RawMessage
+	json.Unmarshal(payload, &p)
+	var v string
+	json.Unmarshal(p[key], &v)
+	return v
+}
+
+// apply aggregates the points of r in buckets of equal size, so that at
+// most maxPoints remain. Each bucket gets the timestamp of its last
+// point. Null values (NaN) are left out; a bucket of nulls stays null.
+func (a *queryAggregation) apply(r *queryResult) {
+	n := len(r.Datapoints)
+	if n <= a.maxPoints {
+		return
+	}
+	agg := a.by[r.Target]
+	if agg == nil {
+		agg = aggregators["avg"]
+	}
+	size := (n + a.maxPoints - 1) / a.maxPoints
+	out := 0
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		a.values = a.values[:0]
+		for _, p := range r.Datapoints[start:end] {
+			if !math.IsNaN(p[0]) {
+				a.values = append(a.values, p[0])
+			}
+		}
+		v := math.NaN()
+		if len(a.values) > 0 {
+			v = agg(a.values)
+		}
+		r.Datapoints[out] = datapoint{v, r.Datapoints[end-1][1]}
+		out++
+	}
+	r.Datapoints = r.Datapoints[:out]
+}
+
+// setMaxDataPoints sets the maxDataPoints of a /query request to n.
+func setMaxDataPoints(body []byte, n int) []byte {
+	var q map[string]json.RawMessage
+	if err := json.Unmarshal(body, &q); err != nil {
+		return body
+	}
+	q["maxDataPoints"] = json.RawMessage(fmt.Sprint(n))
+	b, err := json.Marshal(q)
+	if err != nil {
+		return body
+	}
+	return b
+}
@@ -0,0 +1,593 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertRule describes a condition on a metric, like "CPU1 > 90 for 30s".
+// The alert fires when the condition holds for every sample received
+// during the For duration.
+//
+// Clear is an optional second threshold for hysteresis: once firing, the
+// alert resolves only when the value moves past Clear (for example, below
+// 80 for "CPU1 > 90 clear 80"). Without Clear, the alert resolves as soon
+// as the condition no longer holds, which lets noisy signals flap.
+//
+// The special operator "absent" turns the rule into a dead man's switch:
+// "sensor absent for 2m" fires if the metric receives no samples for two
+// minutes, which catches dead collectors and broken sensors.
+//
+// Instead of a metric, the rule may check an expression (see expr), like
+// "avg(CPU1, 5m) > 80" or "mem.system.used - mem.process.rss > 4096". The
+// value of the expression gets evaluated every second into the series
+// "alert.<rule id>.value", which the rule then watches like a metric.
+type alertRule struct {
+	Name      string        `json:"name"`
+	Metric    string        `json:"metric"` // or an expression
+	Op        string        `json:"op"`
+	Threshold float64       `json:"threshold"`
+	Clear     *float64      `json:"clear,omitempty"`
+	For       time.Duration `json:"for"`
+	Notify    []string      `json:"notify,omitempty"` // notifier names; empty means all
+}
+
+// String returns the rule in the same syntax that parseAlertRule accepts.
+func (r alertRule) String() string {
+	if r.Op == opAbsent {
+		return fmt.Sprintf("%s %s for %s", r.Metric, opAbsent, r.For)
+	}
+	s := fmt.Sprintf("%s %s %g", r.Metric, r.Op, r.Threshold)
+	if r.Clear != nil {
+		s += fmt.Sprintf(" clear %g", *r.Clear)
+	}
+	if r.For > 0 {
+		s += " for " + r.For.String()
+	}
+	return s
+}
+
+// validate checks the operator and the expression, if any, and that the
+// clear threshold, if any, lies on the "good" side of the trigger
+// threshold.
+func (r alertRule) validate() error {
+	if isExpr(r.Metric) {
+		if r.Op == opAbsent {
+			return fmt.Errorf("alert rule %q: %s needs a metric name, not an expression", r.id(), opAbsent)
+		}
+		if _, err := parseExpr(r.Metric); err != nil {
+			return fmt.Errorf("alert rule %q: %s", r.id(), err)
+		}
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=":
+	case opAbsent:
+		if r.For <= 0 {
+			return fmt.Errorf("alert rule %q: %s needs a duration, as in \"%s %s for 5m\"", r.id(), opAbsent, r.Metric, opAbsent)
+		}
+		if r.Clear != nil {
+			return fmt.Errorf("alert rule %q: %s does not take a clear threshold", r.id(), opAbsent)
+		}
+		return nil
+	default:
+		return fmt.Errorf("alert rule %q: invalid operator %q", r.id(), r.Op)
+	}
+	if r.Clear == nil {
+		return nil
+	}
+	if (r.Op[0] == '>' && *r.Clear > r.Threshold) || (r.Op[0] == '<' && *r.Clear < r.Threshold) {
+		return fmt.Errorf("alert rule %q: clear threshold lies beyond the trigger threshold", r)
+	}
+	return nil
+}
+
+// id returns the rule's name, or a name derived from the rule if it has
+// none, like "CPU1_gt_90", or "avg_CPU1_5m_gt_80" for an expression.
+func (r alertRule) id() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	metric := r.Metric
+	if isExpr(metric) {
+		metric = strings.Join(strings.FieldsFunc(metric, func(c rune) bool { return !isNameRune(c) || c == '-' }), "_")
+	}
+	if r.Op == opAbsent {
+		return metric + "_" + opAbsent
+	}
+	op := map[string]string{">": "gt", ">=": "ge", "<": "lt", "<=": "le"}[r.Op]
+	return fmt.Sprintf("%s_%s_%g", metric, op, r.Threshold)
+}
+
+// series returns the name of the series that the rule watches: the
+// metric, or the series with the value of the expression.
+func (r alertRule) series() string {
+	if isExpr(r.Metric) {
+		return "alert." + r.id() + ".value"
+	}
+	return r.Metric
+}
+
+// derived returns the derived metric that evaluates the expression of
+// the rule.
+func (r alertRule) derived() derivedConfig {
+	return derivedConfig{
+		Name:        r.series(),
+		Expr:        r.Metric,
+		Description: fmt.Sprintf("Value of %s, for alert %q", r.Metric, r.String()),
+	}
+}
+
+// breached reports whether v violates the rule's threshold.
+func (r alertRule) breached(v float64) bool {
+	switch r.Op {
+	case ">":
+		return v > r.Threshold
+	case ">=":
+		return v >= r.Threshold
+	case "<":
+		return v < r.Threshold
+	case "<=":
+		return v <= r.Threshold
+	}
+	return false
+}
+
+// cleared reports whether v is far enough on the good side of the
+// threshold to resolve a firing alert.
+func (r alertRule) cleared(v float64) bool {
+	if r.Clear == nil {
+		return !r.breached(v)
+	}
+	if r.Op[0] == '>' {
+		return v < *r.Clear
+	}
+	return v > *r.Clear
+}
+
+// opAbsent is the operator of dead man's switch rules.
+const opAbsent = "absent"
+
+// parseAlertRule parses a rule like "CPU1 > 90 clear 80 for 30s". The
+// "clear" and "for" parts are optional; without "for", a single breaching
+// sample fires the alert. Dead man's switch rules look like
+// "CPU1 absent for 1m".
+func parseAlertRule(s string) (alertRule, error) {
+	var r alertRule
+	rest := strings.TrimSpace(s)
+	if i := strings.Index(rest, " for "); i >= 0 {
+		d, err := parseDuration(strings.TrimSpace(rest[i+len(" for "):]))
+		if err != nil {
+			return r, fmt.Errorf("alert rule %q: %s", s, err)
+		}
+		r.For = d
+		rest = strings.TrimSpace(rest[:i])
+	}
+	if i := strings.Index(rest, " clear "); i >= 0 {
+		c, err := strconv.ParseFloat(strings.TrimSpace(rest[i+len(" clear "):]), 64)
+		if err != nil {
+			return r, fmt.Errorf("alert rule %q: invalid clear threshold: %s", s, err)
+		}
+		r.Clear = &c
+		rest = strings.TrimSpace(rest[:i])
+	}
+	if strings.HasSuffix(rest, " "+opAbsent) {
+		r.Metric = strings.TrimSpace(strings.TrimSuffix(rest, opAbsent))
+		r.Op = opAbsent
+		return r, r.validate()
+	}
+	// Try the two-character operators first, so that ">=" does not parse as ">".
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		i := strings.Index(rest, op)
+		if i < 0 {
+			continue
+		}
+		r.Metric = strings.TrimSpace(rest[:i])
+		r.Op = op
+		t, err := strconv.ParseFloat(strings.TrimSpace(rest[i+len(op):]), 64)
+		if err != nil {
+			return r, fmt.Errorf("alert rule %q: invalid threshold: %s", s, err)
+		}
+		r.Threshold = t
+		if r.Metric == "" {
+			return r, fmt.Errorf("alert rule %q: missing metric name", s)
+		}
+		return r, r.validate()
+	}
+	return r, fmt.Errorf("alert rule %q: missing operator (one of > >= < <=)", s)
+}
+
+// alertState is the state of a single alert rule.
+type alertState int
+
+const (
+	alertOK alertState = iota
+	alertPending
+	alertFiring
+)
+
+func (s alertState) String() string {
+	switch s {
+	case alertPending:
+		return "pending"
+	case alertFiring:
+		return "firing"
+	}
+	return "ok"
+}
+
+// alertEvent is what notifiers receive when an alert fires or resolves.
+// State is either "firing" or "resolved".
+type alertEvent struct {
+	Rule   string    `json:"rule"`
+	Metric string    `json:"metric"`
+	State  string    `json:"state"`
+	Value  float64   `json:"value"`
+	Time   time.Time `json:"time"`
+}
+
+// notifier delivers alert events to the outside world.
+type notifier interface {
+	notify(e alertEvent) error
+}
+
+// closeNotifiers stops the background work of the notifiers that have
+// some, like the batches of emails, when the notifiers get replaced.
+func closeNotifiers(notifiers map[string]notifier) {
+	for _, n := range notifiers {
+		if c, ok := n.(interface{ close() }); ok {
+			c.close()
+		}
+	}
+}
+
+// webhookNotifier POSTs each event as JSON to a URL.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookNotifier(url string) *webhookNotifier {
+	return &webhookNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *webhookNotifier) notify(e alertEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: %s", w.url, resp.Status)
+	}
+	return nil
+}
+
+// alert tracks the state of one rule.
+type alert struct {
+	rule    alertRule
+	src     *series   // the rule's metric
+	state   *series   // records the alert state for graphing
+	created time.Time // reference time for "absent" if src has no samples at all
+
+	mu     sync.Mutex
+	status alertState
+	since  time.Time // start of the current breach
+}
+
+// eval updates the alert state with a new sample. It returns the new state
+// and whether the alert has just started or stopped firing.
+func (a *alert) eval(v float64, t time.Time) (alertState, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	old := a.status
+	if a.rule.Op == opAbsent {
+		// Any sample brings a dead man's switch back to normal.
+		a.status = alertOK
+		return a.status, old == alertFiring
+	}
+	switch a.status {
+	case alertOK:
+		if a.rule.breached(v) {
+			a.since = t
+			a.status = alertPending
+		}
+		if a.status == alertPending && a.rule.For == 0 {
+			a.status = alertFiring
+		}
+	case alertPending:
+		// The breach must last for the whole For duration. A single good
+		// sample restarts the clock.
+		if !a.rule.breached(v) {
+			a.status = alertOK
+		} else if t.Sub(a.since) >= a.rule.For {
+			a.status = alertFiring
+		}
+	case alertFiring:
+		if a.rule.cleared(v) {
+			a.status = alertOK
+		}
+	}
+	changed := (old == alertFiring) != (a.status == alertFiring)
+	return a.status, changed
+}
+
+// checkAbsent evaluates a dead man's switch at time t. It returns whether
+// the alert has just started firing, and how long the metric has been silent.
+func (a *alert) checkAbsent(t time.Time) (bool, time.Duration) {
+	_, last := a.src.latest()
+	if last.IsZero() {
+		last = a.created
+	}
+	silent := t.Sub(last)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.status == alertFiring || silent < a.rule.For {
+		return false, silent
+	}
+	a.status = alertFiring
+	return true, silent
+}
+
+// alerter evaluates alert rules against incoming samples and sends
+// notifications whenever an alert fires or resolves. The set of rules can
+// be replaced at runtime (see set), for example when the config file changes.
+type alerter struct {
+	reg       *registry
+	notifiers map[string]notifier
+	silences  *silencer
+	notes     *annotationStore
+	grafana   *grafanaClient // if set, annotations also go to Grafana
+	exprs     *deriver       // evaluates the expressions of rules
+
+	mu      sync.Mutex
+	alerts  map[string][]*alert // by metric name
+	watched map[string]bool     // metrics that have an observer
+}
+
+func newAlerter(reg *registry, silences *silencer, notes *annotationStore) *alerter {
+	al := &alerter{
+		reg:       reg,
+		silences:  silences,
+		notes:     notes,
+		notifiers: map[string]notifier{},
+		exprs:     newDeriver(reg),
+		alerts:    map[string][]*alert{},
+		watched:   map[string]bool{},
+	}
+	reg.group.Go(al.watchAbsent)
+	return al
+}
+
+// setNotifiers replaces the notifiers, by name ("slack", "email", ...),
+// and returns the previous ones. Rules select notifiers by these names.
+func (al *alerter) setNotifiers(notifiers map[string]notifier) map[string]notifier {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	prev := al.notifiers
+	al.notifiers = notifiers
+	return prev
+}
+
+// add starts evaluating rule against every new sample of the rule's metric.
+// The metric gets created if it does not exist yet.
+//
+// Every rule also gets a series "alert.<rule id>" that records the alert
+// state (0 = ok, 1 = pending, 2 = firing) at each evaluation, so that the
+// alert history can be graphed next to the metric itself.
+func (al *alerter) add(rule alertRule) error {
+	a, err := al.newAlert(rule)
+	if err != nil {
+		return err
+	}
+	if isExpr(rule.Metric) {
+		if err := al.exprs.set(append(al.exprs.configs(), rule.derived())); err != nil {
+			return err
+		}
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.alerts[rule.series()] = append(al.alerts[rule.series()], a)
+	return nil
+}
+
+// set replaces all rules. Rules that did not change keep their state, so
+// that reloading the config does not re-send notifications for alerts that
+// are already firing. If any rule is invalid, the old rules stay in place.
+func (al *alerter) set(rules []alertRule) error {
+	al.mu.Lock()
+	old := map[string]*alert{}
+	for _, as := range al.alerts {
+		for _, a := range as {
+			old[a.rule.id()+"|"+a.rule.String()] = a
+		}
+	}
+	al.mu.Unlock()
+
+	alerts := map[string][]*alert{}
+	var exprs []derivedConfig
+	for _, rule := range rules {
+		a, err := al.newAlert(rule)
+		if err != nil {
+			return err
+		}
+		if prev, ok := old[rule.id()+"|"+rule.String()]; ok {
+			prev.mu.Lock()
+			a.status, a.since = prev.status, prev.since
+			prev.mu.Unlock()
+		}
+		alerts[rule.series()] = append(alerts[rule.series()], a)
+		if isExpr(rule.Metric) {
+			exprs = append(exprs, rule.derived())
+		}
+	}
+	if err := al.exprs.set(exprs); err != nil {
+		return err
+	}
+	al.mu.Lock()
+	al.alerts = alerts
+	al.mu.Unlock()
+	return nil
+}
+
+// newAlert prepares the evaluation of a rule: it validates the rule,
+// creates the state series, and makes sure the rule's metric is observed.
+func (al *alerter) newAlert(rule alertRule) (*alert, error) {
+	if err := rule.validate(); err != nil {
+		return nil, err
+	}
+	al.mu.Lock()
+	notifiers := al.notifiers
+	al.mu.Unlock()
+	for _, name := range rule.Notify {
+		if _, ok := notifiers[name]; !ok {
+			return nil, fmt.Errorf("alert rule %q: unknown notifier %q", rule.id(), name)
+		}
+	}
+	s, err := al.reg.getOrCreate(rule.series())
+	if err != nil {
+		return nil, err
+	}
+	stateSeries, err := al.reg.getOrCreate("alert." + rule.id())
+	if err != nil {
+		return nil, err
+	}
+	stateSeries.describe("none", fmt.Sprintf("State of alert %q: 0 = ok, 1 = pending, 2 = firing", rule.String()))
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if !al.watched[rule.series()] {
+		al.watched[rule.series()] = true
+		metric := rule.series()
+		s.observe(func(v float64, t time.Time) {
+			al.eval(metric, v, t)
+		})
+	}
+	return &alert{rule: rule, src: s, state: stateSeries, created: al.reg.clock.Now()}, nil
+}
+
+// eval evaluates all rules for a metric against a new sample.
+func (al *alerter) eval(metric string, v float64, t time.Time) {
+	al.mu.Lock()
+	alerts := al.alerts[metric]
+	al.mu.Unlock()
+	for _, a := range alerts {
+		status, changed := a.eval(v, t)
+		a.state.Add(float64(status))
+		if changed {
+			al.transition(a.rule, status, v, t)
+		}
+	}
+}
+
+// absentCheckInterval is how often dead man's switches get checked.
+const absentCheckInterval = time.Second
+
+// watchAbsent checks the dead man's switches periodically, because missing
+// samples obviously cannot trigger an evaluation. The event value is the
+// number of seconds since the last sample. It returns when ctx is done.
+func (al *alerter) watchAbsent(ctx context.Context) error {
+	tick := al.reg.clock.Tick(absentCheckInterval)
+	for {
+		var t time.Time
+		select {
+		case t = <-tick:
+		case <-ctx.Done():
+			return nil
+		}
+		al.mu.Lock()
+		var absent []*alert
+		for _, as := range al.alerts {
+			for _, a := range as {
+				if a.rule.Op == opAbsent {
+					absent = append(absent, a)
+				}
+			}
+		}
+		al.mu.Unlock()
+		for _, a := range absent {
+			if fired, silent := a.checkAbsent(t); fired {
+				a.state.Add(float64(alertFiring))
+				al.transition(a.rule, alertFiring, silent.Seconds(), t)
+			}
+		}
+	}
+}
+
+// transition records an alert that started or stopped firing as an
+// annotation, and notifies about it.
+func (al *alerter) transition(rule alertRule, status alertState, v float64, t time.Time) {
+	e := alertEvent{
+		Rule:   rule.String(),
+		Metric: rule.Metric,
+		State:  "resolved",
+		Value:  v,
+		Time:   inDisplayZone(t),
+	}
+	if status == alertFiring {
+		e.State = "firing"
+	}
+	al.annotate(rule, e)
+	al.send(rule, e)
+}
+
+// annotate stores the event as an annotation and, if configured, pushes
+// it to Grafana, so that incidents show up as markers on the panels.
+func (al *alerter) annotate(rule alertRule, e alertEvent) {
+	a := annotation{
+		Time:  e.Time,
+		Title: fmt.Sprintf("%s: %s", e.State, e.Rule),
+		Text:  fmt.Sprintf("%s = %g", e.Metric, e.Value),
+		Tags:  []string{"alert", e.State, rule.id()},
+	}
+	al.notes.add(a)
+	if al.grafana == nil {
+		return
+	}
+	go func() {
+		if err := al.grafana.postAnnotation(a); err != nil {
+			log.Println("alert annotation:", err)
+		}
+	}()
+}
+
+// send passes an event to the rule's notifiers, or to all notifiers if the
+// rule does not name any, unless the rule is silenced. It does not wait
+// for delivery, as it is called from within series.Add.
+func (al *alerter) send(rule alertRule, e alertEvent) {
+	if al.silences.silenced(rule, e.Time) {
+		log.Printf("alert %s (silenced): %s (value %g)", e.State, e.Rule, e.Value)
+		return
+	}
+	log.Printf("alert %s: %s (value %g)", e.State, e.Rule, e.Value)
+	al.mu.Lock()
+	notifiers := al.notifiers
+	al.mu.Unlock()
+	names := rule.Notify
+	if len(names) == 0 {
+		for name := range notifiers {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		n, ok := notifiers[name]
+		if !ok {
+			continue
+		}
+		go func(n notifier) {
+			if err := n.notify(e); err != nil {
+				log.Println("alert notification failed:", err)
+			}
+		}(n)
+	}
+}
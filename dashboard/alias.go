@@ -0,0 +1,99 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Grafana names each series of a panel after its target, which makes for
+// legends full of "fleet.host-03.cpu". An alias template like
+// "{{host}} / core {{core}}" names the series after the labels of the
+// metric instead. The proxy renames the series of /query responses; the
+// targets stay as they are.
+
+// aliasPlaceholder matches the placeholders of alias templates, like
+// "{{host}}". "{{name}}" is the name of the metric.
+var aliasPlaceholder = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// aliasSpec is what the -alias flag describes, as in "CPU*:core {{core}}":
+// the alias template for the metrics that match the pattern, unless the
+// metric has an alias of its own or the panel's target asks for another
+// one. The pattern ends at the first colon, so the template may contain
+// colons.
+type aliasSpec struct {
+	pattern  string
+	template string
+}
+
+func parseAliasSpec(s string) (aliasSpec, error) {
+	i := strings.Index(s, ":")
+	if i <= 0 || i == len(s)-1 {
+		return aliasSpec{}, fmt.Errorf("alias %q: want <metric>:<template>", s)
+	}
+	return aliasSpec{pattern: s[:i], template: s[i+1:]}, nil
+}
+
+// renderAlias fills in the placeholders of template with the name and the
+// labels of the metric name. Placeholders for labels that the metric does
+// not have stay as they are, so that typos show up in the legend.
+func renderAlias(template, name string, s *series) string {
+	return aliasPlaceholder.ReplaceAllStringFunc(template, func(p string) string {
+		key := aliasPlaceholder.FindStringSubmatch(p)[1]
+		if key == "name" {
+			return name
+		}
+		if s != nil {
+			if v := s.labelValue(key); v != "" {
+				return v
+			}
+		}
+		return p
+	})
+}
+
+// queryAliases finds the alias of each target of a /query request: from
+// the target's payload, as in {"target": "CPU1", "data": {"alias": "core
+// {{core}}"}}, from the metric itself (see Metric.Alias), or from specs.
+// It returns the display names by target, or nil if no target has an
+// alias.
+func queryAliases(body []byte, specs []aliasSpec, reg *registry) map[string]string {
+	var q struct {
+		Targets []struct {
+			Target  string          `json:"target"`
+			Data    json.RawMessage `json:"data"`
+			Payload json.RawMessage `json:"payload"`
+		} `json:"targets"`
+	}
+	if err := json.Unmarshal(body, &q); err != nil {
+		return nil
+	}
+	var aliases map[string]string
+	for _, t := range q.Targets {
+		s, _ := reg.get(t.Target)
+		template := targetOption(t.Data, "alias")
+		if template == "" {
+			template = targetOption(t.Payload, "alias")
+		}
+		if template == "" && s != nil {
+			template = s.aliasTemplate()
+		}
+		for _, spec := range specs {
+			if template != "" {
+				break
+			}
+			if matchPattern(spec.pattern, t.Target) {
+				template = spec.template
+			}
+		}
+		if template == "" {
+			continue
+		}
+		if aliases == nil {
+			aliases = map[string]string{}
+		}
+		aliases[t.Target] = renderAlias(template, t.Target, s)
+	}
+	return aliases
+}
@@ -0,0 +1,114 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// annotation is an event that Grafana draws as a marker (or, with an end
+// time, as a region) on the graph panels.
+type annotation struct {
+	Time    time.Time
+	TimeEnd time.Time // zero for point events
+	Title   string
+	Text    string
+	Tags    []string
+}
+
+// maxAnnotations limits the number of stored annotations. The oldest ones
+// get dropped first.
+const maxAnnotations = 1000
+
+// annotationStore collects annotations and serves them to Grafana through
+// the SimpleJSON /annotations endpoint.
+type annotationStore struct {
+	mu   sync.Mutex
+	list []annotation
+}
+
+func newAnnotationStore() *annotationStore {
+	return &annotationStore{}
+}
+
+// add stores an annotation.
+func (s *annotationStore) add(a annotation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = append(s.list, a)
+	if len(s.list) > maxAnnotations {
+		s.list = append(s.list[:0:0], s.list[len(s.list)-maxAnnotations:]...)
+	}
+}
+
+// between returns all annotations that overlap the range from...to,
+// ordered by time.
+func (s *annotationStore) between(from, to time.Time) []annotation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []annotation
+	for _, a := range s.list {
+		end := a.TimeEnd
+		if end.IsZero() {
+			end = a.Time
+		}
+		if !a.Time.After(to) && !end.Before(from) {
+			res = append(res, a)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Time.Before(res[j].Time) })
+	return res
+}
+
+// annotationRequest is the request body that the SimpleJSON datasource
+// sends to /annotations.
+type annotationRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Annotation json.RawMessage `json:"annotation"`
+}
+
+// annotationResponse is one element of the /annotations response.
+// Grafana expects the request's annotation object to be echoed back.
+type annotationResponse struct {
+	Annotation json.RawMessage `json:"annotation"`
+	Time       int64           `json:"time"`
+	TimeEnd    int64           `json:"timeEnd,omitempty"`
+	IsRegion   bool            `json:"isRegion,omitempty"`
+	Title      string          `json:"title"`
+	Text       string          `json:"text"`
+	Tags       []string        `json:"tags"`
+}
+
+// serveHTTP answers the SimpleJSON /annotations request.
+func (s *annotationStore) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		// Grafana's browser mode sends CORS preflight requests.
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	var req annotationRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	res := []annotationResponse{}
+	for _, a := range s.between(req.Range.From, req.Range.To) {
+		ar := annotationResponse{
+			Annotation: req.Annotation,
+			Time:       a.Time.UnixNano() / int64(time.Millisecond),
+			Title:      a.Title,
+			Text:       a.Text,
+			Tags:       a.Tags,
+		}
+		if !a.TimeEnd.IsZero() {
+			ar.TimeEnd = a.TimeEnd.UnixNano() / int64(time.Millisecond)
+			ar.IsRegion = true
+		}
+		res = append(res, ar)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,101 @@
+package dashboard
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// zscore computes how unusual a value is compared to the recent past:
+// the distance from the rolling mean, in units of the rolling standard
+// deviation.
+//
+// The mean and the sum of squared deviations from it get updated with
+// each value, as in Welford's algorithm, extended to values that leave the
+// window. Unlike a sum of squares, this does not cancel out for large
+// values that vary little, like a counter at 1e9 that moves by 1. Rounding
+// errors still add up over millions of values, so whenever the window
+// wraps around, the two get recomputed from the values in it.
+type zscore struct {
+	mu     sync.Mutex
+	window []float64
+	next   int
+	n      int     // values in the window
+	mean   float64 // of the values in the window
+	m2     float64 // sum of squared deviations from the mean
+}
+
+func newZscore(size int) *zscore {
+	return &zscore{window: make([]float64, size)}
+}
+
+// score returns the z-score of v relative to the values seen before, and
+// then adds v to the rolling window. Until the window has filled up, or if
+// all values in the window are equal, the score is 0.
+func (z *zscore) score(v float64) float64 {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	var score float64
+	if z.n == len(z.window) {
+		variance := z.m2 / float64(z.n)
+		// What is left of the variance of equal values is rounding error,
+		// relative to the mean; it must not make a tiny change look huge.
+		if variance > 1e-24*z.mean*z.mean {
+			score = (v - z.mean) / math.Sqrt(variance)
+		}
+	}
+	if z.n < len(z.window) {
+		z.n++
+		delta := v - z.mean
+		z.mean += delta / float64(z.n)
+		z.m2 += delta * (v - z.mean)
+	} else {
+		old := z.window[z.next]
+		mean := z.mean + (v-old)/float64(z.n)
+		z.m2 += (v - old) * (v - mean + old - z.mean)
+		z.mean = mean
+	}
+	if z.m2 < 0 {
+		z.m2 = 0
+	}
+	z.window[z.next] = v
+	z.next++
+	if z.next == len(z.window) {
+		z.next = 0
+		z.recompute()
+	}
+	return score
+}
+
+// recompute sets the mean and the sum of squared deviations from the
+// values in the full window.
+func (z *zscore) recompute() {
+	var sum float64
+	for _, v := range z.window {
+		sum += v
+	}
+	z.mean = sum / float64(len(z.window))
+	z.m2 = 0
+	for _, v := range z.window {
+		z.m2 += (v - z.mean) * (v - z.mean)
+	}
+}
+
+// addAnomalySeries creates the series "<name>.anomaly" that receives the
+// z-score of every new sample of src, computed over the last `window` samples.
+func addAnomalySeries(reg *registry, src *series, window int) (*series, error) {
+	if window < 2 {
+		return nil, fmt.Errorf("anomaly series for %s: window must have at least 2 samples", src.name)
+	}
+	dst, err := reg.getOrCreate(src.name + ".anomaly")
+	if err != nil {
+		return nil, err
+	}
+	dst.describe("none", fmt.Sprintf("How unusual %s is: distance from its rolling mean over %d samples, in standard deviations", src.name, window))
+	z := newZscore(window)
+	src.observe(func(v float64, _ time.Time) {
+		dst.Add(z.score(v))
+	})
+	return dst, nil
+}
@@ -0,0 +1,88 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+)
+
+// apiServer is the app's own HTTP server. grada's server answers Grafana's
+// /search and /query requests for the metrics; everything that grada does
+// not know about (annotations, silences, ...) is served here.
+//
+// The API server also answers "/" with 200 OK, so it can be added to
+// Grafana as a second SimpleJSON datasource, for annotations.
+type apiServer struct {
+	mux        *http.ServeMux
+	middleware []func(http.Handler) http.Handler
+}
+
+func newAPIServer() *apiServer {
+	a := &apiServer{mux: http.NewServeMux()}
+	a.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	return a
+}
+
+// handle registers a handler for a path.
+func (a *apiServer) handle(pattern string, h http.HandlerFunc) {
+	a.mux.HandleFunc(pattern, h)
+}
+
+// use wraps all handlers in m. The first middleware added is the
+// outermost.
+func (a *apiServer) use(m func(http.Handler) http.Handler) {
+	a.middleware = append(a.middleware, m)
+}
+
+// endpoint returns the name of the endpoint that handles r, for the
+// self-metrics.
+func (a *apiServer) endpoint(r *http.Request) string {
+	_, pattern := a.mux.Handler(r)
+	return endpointName(pattern)
+}
+
+// handler returns the handlers wrapped in the middleware.
+func (a *apiServer) handler() http.Handler {
+	var h http.Handler = a.mux
+	for i := len(a.middleware) - 1; i >= 0; i-- {
+		h = a.middleware[i](h)
+	}
+	return h
+}
+
+// listen starts serving on addr in the background, until g stops.
+func (a *apiServer) listen(addr string, g *group) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Println("API server listening on", l.Addr())
+	g.serve(l, a.handler())
+	return nil
+}
+
+// readJSON decodes the request body into v. On error, it replies with
+// 400 Bad Request and returns false.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeJSON replies with v as JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("api: writing response:", err)
+	}
+}
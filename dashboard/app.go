@@ -0,0 +1,195 @@
+// Package dashboard is the DIY dashboard as a library: a registry of
+// metrics on top of grada, and everything the diydashboard command offers
+// around it (alerts, annotations, Grafana provisioning, simulated data,
+// ...). To embed the dashboard in a service of your own:
+//
+//	opts, err := dashboard.ParseOptions(os.Args[1:])
+//	if err != nil {
+//		log.Fatalln(err)
+//	}
+//	app, err := dashboard.New(grada.GetDashboard(), opts)
+//	if err != nil {
+//		log.Fatalln(err)
+//	}
+//	requests, err := app.Metric("requests")
+//	...
+//	go serveRequests(requests) // calls requests.Add(...)
+//	if err := app.Run(); err != nil {
+//		log.Fatalln(err)
+//	}
+//
+// The features are switched on through the same flags as for the
+// diydashboard command. A service with flags of its own defines the app's
+// flags next to them with DefineFlags, and parses them itself.
+package dashboard
+
+import (
+	"context"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+// App is a DIY dashboard. Create it with New.
+type App struct {
+	reg     *registry
+	opts    *options
+	derived *deriver  // for Derive
+	counts  *counters // for Count
+}
+
+// New creates an app on dash with the settings of opts. Nil options are
+// those of a command line without flags.
+func New(dash *grada.Dashboard, opts *Options) (*App, error) {
+	if opts == nil {
+		var err error
+		if opts, err = ParseOptions(nil); err != nil {
+			return nil, err
+		}
+	}
+	reg, err := newRegistryFromOptions(dash, &opts.o)
+	if err != nil {
+		return nil, err
+	}
+	return &App{reg: reg, opts: &opts.o, derived: newDeriver(reg), counts: newCounters(reg)}, nil
+}
+
+// Start starts everything that the flags and the config file ask for:
+// alerts, the API server, data sources, and so on. Metrics can be added
+// before and after Start.
+func (a *App) Start() error {
+	return setup(a.reg, a.opts)
+}
+
+// Run starts the app like Start and blocks until it stops, either on
+// Ctrl-C or SIGTERM (or the Windows service manager's stop request) or
+// because some background work failed. The HTTP
+// servers get a few seconds to finish the requests in flight. Run returns
+// the error that stopped the app, or nil after a signal.
+func (a *App) Run() error {
+	if err := a.Start(); err != nil {
+		a.reg.group.stop(err)
+		a.reg.group.Wait()
+		return err
+	}
+	return waitForStop(a.reg.group, a.opts)
+}
+
+// Go runs f alongside the app's own background work. f must return when
+// ctx is done; if f returns an error, the app stops and Run returns that
+// error.
+func (a *App) Go(f func(ctx context.Context) error) {
+	a.reg.group.Go(f)
+}
+
+// Metric returns the metric with the given name, creating it with the
+// app's retention (-retention) at one value per second if it does not
+// exist yet.
+func (a *App) Metric(name string) (*Metric, error) {
+	s, err := a.reg.getOrCreate(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Metric{s}, nil
+}
+
+// Derive returns a metric whose values come from an expression over
+// other metrics, like "server.temp - weather.outside", evaluated once per
+// second. The expressions are those of -derive and of alert rules. An
+// instant where a metric of the expression has no samples yet adds no
+// value. Deriving a metric again with the same name fails unless the
+// expression is the same.
+func (a *App) Derive(name, expression string) (*Metric, error) {
+	c := derivedConfig{Name: name, Expr: expression}
+	if err := a.derived.set(append(a.derived.configs(), c)); err != nil {
+		return nil, err
+	}
+	return a.Metric(name)
+}
+
+// Count records an event, like a login or a failed payment, of the event
+// counter name. The metric name gets the number of events per 10 seconds,
+// including the 0 of 10 seconds without any. Count creates the metric
+// with the first event; after that, it is cheap enough to call on every
+// request.
+func (a *App) Count(name string) error {
+	return a.counts.count(name)
+}
+
+// Register adds a metric that was created directly on the grada
+// Dashboard, with a buffer of capacity points, to the app, so that alerts,
+// generated dashboards, and the other features see it.
+func (a *App) Register(name string, m *grada.Metric, capacity int) *Metric {
+	return &Metric{a.reg.register(name, m, capacity)}
+}
+
+// A Metric is a time series of the app.
+type Metric struct {
+	s *series
+}
+
+// Add adds a value to the metric.
+func (m *Metric) Add(v float64) {
+	m.s.Add(v)
+}
+
+// Describe sets the unit and the description of the metric, for generated
+// Grafana dashboards. unit is a Grafana unit ID like "percent", "bytes",
+// "ms", or "s".
+func (m *Metric) Describe(unit, description string) *Metric {
+	m.s.describe(unit, description)
+	return m
+}
+
+// Label attaches a label like core=1 to the metric, for alias templates
+// and for template variable queries like label_values(core).
+func (m *Metric) Label(key, value string) *Metric {
+	m.s.label(key, value)
+	return m
+}
+
+// Alias sets the display name of the metric in Grafana's legends, as a
+// template like "{{host}} / core {{core}}" that gets filled in with the
+// labels of the metric and its name ("{{name}}"). Like the -alias flag,
+// it applies to queries through the datasource proxy.
+func (m *Metric) Alias(template string) *Metric {
+	m.s.setAlias(template)
+	return m
+}
+
+// StartTimer starts measuring a duration, like the latency of a request,
+// that Stop adds to the metric in milliseconds. Every duration is a value
+// of its own, so the metric holds the distribution of the durations, for
+// Grafana's histogram panel, or for a target with {"agg": "p95"}. To
+// time a function:
+//
+//	defer latency.StartTimer().Stop()
+//
+// A metric without a unit gets "ms". The timer runs on the app's clock,
+// like the timestamps of the samples.
+func (m *Metric) StartTimer() Timer {
+	if unit, description := m.s.meta(); unit == "" {
+		m.s.describe("ms", description)
+	}
+	return Timer{m: m, start: m.s.reg.clock.Now()}
+}
+
+// A Timer is a duration that is being measured. Create it with
+// Metric.StartTimer.
+type Timer struct {
+	m     *Metric
+	start time.Time
+}
+
+// Stop adds the time since StartTimer to the metric, and returns it.
+func (t Timer) Stop() time.Duration {
+	d := t.m.s.reg.clock.Now().Sub(t.start)
+	t.m.Add(float64(d) / float64(time.Millisecond))
+	return d
+}
+
+// RunCommand runs the diydashboard subcommand name, like "gen-dashboard"
+// or "demo", with args. It returns false if name is not a subcommand.
+func RunCommand(name string, args []string) (bool, error) {
+	return runCommand(name, args)
+}
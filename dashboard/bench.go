@@ -0,0 +1,26 @@
+package dashboard
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// benchPackage is the package with the benchmarks of the buffer layer, in
+// bench_test.go.
+const benchPackage = "github.com/appliedgo/diydashboard/dashboard"
+
+// bench runs the benchmarks of the buffer layer with `go test -bench`. Like
+// `go run .`, it needs the source code and the Go toolchain.
+func bench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	pattern := fs.String("bench", ".", "run only the benchmarks that match this regular expression, like \"Add\" or \"Query/points=3600\"")
+	fs.Parse(args)
+	cmd := exec.Command("go", "test", "-run", "^$", "-bench", *pattern, "-benchmem", benchPackage)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go test -bench %s: %s (run the command in the directory of the source code)", *pattern, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The benchmarks measure the buffer layer in-process, with a grada server
+// of their own, so the app must not be running at the same time. Run them
+// with `go test -run '^$' -bench . ./dashboard`, or `diydashboard bench`.
+
+var (
+	benchOnce             sync.Once
+	benchReg, benchShards *registry
+)
+
+// benchRegistries returns a registry, and one with 8 shards, for the
+// benchmarks.
+func benchRegistries(b *testing.B) (reg, sharded *registry) {
+	dash := testDashboard(b)
+	benchOnce.Do(func() {
+		benchReg = newRegistry(dash)
+		benchShards = newRegistry(dash)
+		benchShards.shards = 8
+		benchShards.flush(flushInterval)
+	})
+	return benchReg, benchShards
+}
+
+// BenchmarkAdd measures Add with several goroutines adding to the same
+// metric. parallelism=N runs N goroutines per GOMAXPROCS, as with
+// b.SetParallelism.
+func BenchmarkAdd(b *testing.B) {
+	reg, sharded := benchRegistries(b)
+	for _, r := range []struct {
+		name string
+		reg  *registry
+	}{{"", reg}, {"sharded/", sharded}} {
+		for _, g := range []int{1, 4, 16} {
+			b.Run(fmt.Sprintf("%sparallelism=%d", r.name, g), func(b *testing.B) {
+				s, err := r.reg.getOrCreate(fmt.Sprintf("bench.add.%d.%d.%d", r.reg.shards, g, b.N))
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportAllocs()
+				b.SetParallelism(g)
+				b.RunParallel(func(pb *testing.PB) {
+					v := 0.0
+					for pb.Next() {
+						s.Add(v)
+						v++
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkQuery measures /query requests for a metric with a full buffer
+// of several sizes.
+func BenchmarkQuery(b *testing.B) {
+	reg, _ := benchRegistries(b)
+	for _, size := range []int{300, 3600, 86400} {
+		b.Run(fmt.Sprintf("points=%d", size), func(b *testing.B) {
+			name := fmt.Sprintf("bench.query.%d", size)
+			if _, ok := reg.get(name); !ok {
+				m, err := reg.dash.CreateMetricWithBufSize(name, size)
+				if err != nil {
+					b.Fatal(err)
+				}
+				s := reg.register(name, m, size)
+				for i := 0; i < size; i++ {
+					s.Add(float64(i))
+				}
+			}
+			body, err := json.Marshal(newQuery([]string{name}, time.Hour, 1000))
+			if err != nil {
+				b.Fatal(err)
+			}
+			client := &http.Client{Timeout: 10 * time.Second}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resp, err := client.Post(gradaAddr()+"/query", "application/json", bytes.NewReader(body))
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					b.Fatal(resp.Status)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEncode measures the query encoders with a response of 100000
+// points.
+func BenchmarkEncode(b *testing.B) {
+	results := []queryResult{{Target: "bench.encode", Datapoints: make([]datapoint, 100000)}}
+	for i := range results[0].Datapoints {
+		results[0].Datapoints[i] = datapoint{rand.Float64() * 100, 1.6e12 + float64(i)*1000}
+	}
+	for _, name := range []string{"std", "fast"} {
+		encode := queryEncoders[name]
+		b.Run(fmt.Sprintf("%s/points=100000", name), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := encode(ioutil.Discard, results); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
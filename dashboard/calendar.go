@@ -0,0 +1,132 @@
+package dashboard
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultBusinessHours is the calendar of the "business" demo shape if
+// -business-hours is not set.
+const defaultBusinessHours = "Mon-Fri 9:00-17:00"
+
+// A businessCalendar tells when an office is busy: on some days of the
+// week, between opening and closing time, except on holidays. Times are
+// in displayZone, the zone of the dashboards.
+type businessCalendar struct {
+	days        [7]bool       // indexed by time.Weekday
+	open, close time.Duration // since midnight
+	holidays    map[string]bool
+}
+
+// businessHours is the calendar of the "business" demo shape, from
+// -business-hours.
+var businessHours = mustParseCalendar(defaultBusinessHours)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseCalendar parses a calendar like
+//
+//	Mon-Fri 9:00-17:00 holidays=2026-12-24,2026-12-25
+//
+// The days are a range, or a comma-separated list like "Mon,Wed,Fri".
+// Hours may leave out the minutes, as in "8-18".
+func parseCalendar(s string) (*businessCalendar, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("business hours %q: want days, hours, and optional holidays, like %q", s, defaultBusinessHours+" holidays=2026-12-25")
+	}
+	c := &businessCalendar{holidays: map[string]bool{}}
+	for _, d := range strings.Split(fields[0], ",") {
+		from, to := d, d
+		if i := strings.Index(d, "-"); i >= 0 {
+			from, to = d[:i], d[i+1:]
+		}
+		first, ok1 := weekdays[strings.ToLower(from)]
+		last, ok2 := weekdays[strings.ToLower(to)]
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("business hours %q: bad days %q", s, d)
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			c.days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	i := strings.Index(fields[1], "-")
+	if i < 0 {
+		return nil, fmt.Errorf("business hours %q: bad hours %q", s, fields[1])
+	}
+	var err error
+	if c.open, err = parseTimeOfDay(fields[1][:i]); err != nil {
+		return nil, fmt.Errorf("business hours %q: %s", s, err)
+	}
+	if c.close, err = parseTimeOfDay(fields[1][i+1:]); err != nil {
+		return nil, fmt.Errorf("business hours %q: %s", s, err)
+	}
+	if c.close <= c.open {
+		return nil, fmt.Errorf("business hours %q: closing time before opening time", s)
+	}
+	if len(fields) == 3 {
+		list := strings.TrimPrefix(fields[2], "holidays=")
+		if list == fields[2] {
+			return nil, fmt.Errorf("business hours %q: want holidays=..., got %q", s, fields[2])
+		}
+		for _, h := range splitList(list) {
+			if _, err := time.Parse("2006-01-02", h); err != nil {
+				return nil, fmt.Errorf("business hours %q: bad holiday %q, want YYYY-MM-DD", s, h)
+			}
+			c.holidays[h] = true
+		}
+	}
+	return c, nil
+}
+
+func mustParseCalendar(s string) *businessCalendar {
+	c, err := parseCalendar(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// parseTimeOfDay parses "9", "9:30", or "17:00" into the time since
+// midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	h, m := s, "0"
+	if i := strings.Index(s, ":"); i >= 0 {
+		h, m = s[:i], s[i+1:]
+	}
+	hours, err1 := strconv.Atoi(h)
+	minutes, err2 := strconv.Atoi(m)
+	if err1 != nil || err2 != nil || hours < 0 || hours > 24 || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("bad time of day %q", s)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// busy returns how busy the office is at t, from 0 (closed) to 1 (full
+// swing). Business does not start and stop at once: it ramps up and down
+// over an hour around opening and closing time, and dips over lunch.
+// holiday reports whether t falls on a holiday.
+func (c *businessCalendar) busy(t time.Time) (busy float64, holiday bool) {
+	t = t.In(displayZone)
+	if c.holidays[t.Format("2006-01-02")] {
+		return 0, true
+	}
+	if !c.days[t.Weekday()] {
+		return 0, false
+	}
+	y, m, d := t.Date()
+	day := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location())).Hours()
+	open, close := c.open.Hours(), c.close.Hours()
+	busy = math.Max(0, math.Min(1, math.Min(day-open+0.5, close+0.5-day)))
+	lunch := (open + close) / 2
+	return busy * (1 - 0.2*math.Exp(-math.Pow((day-lunch)/0.75, 2))), false
+}
@@ -0,0 +1,107 @@
+package dashboard
+
+import (
+	"net/http"
+	"time"
+)
+
+// catalogSamples is the number of recent samples that each entry of the
+// catalog shows as examples.
+const catalogSamples = 5
+
+// A catalogEntry describes a metric: what it is, how a dashboard should
+// show it, and what its values look like.
+type catalogEntry struct {
+	Name string `json:"name"`
+	// Kind is the collector the metric belongs to, like "CPU" or "Fleet",
+	// which is also its row in generated dashboards.
+	Kind        string            `json:"kind"`
+	Source      string            `json:"source"` // "push", or the source set through /api/source
+	Panel       string            `json:"panel"`  // Grafana panel plugin ID
+	Unit        string            `json:"unit,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Samples     []catalogSample   `json:"samples"` // oldest first
+}
+
+// A catalogSample is a recent value of a metric.
+type catalogSample sample
+
+// MarshalJSON writes the sample as {"time": ..., "value": ...}. JSON has
+// no NaN or infinity, so these values become null.
+func (s catalogSample) MarshalJSON() ([]byte, error) {
+	b := append([]byte(`{"time":"`), inDisplayZone(s.t).Format(time.RFC3339Nano)...)
+	b = append(b, `","value":`...)
+	b = appendJSONFloat(b, s.v)
+	return append(b, '}'), nil
+}
+
+// recentSamples returns the last samples of s, oldest first.
+func (s *series) recentSamples() []catalogSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.count
+	if n > catalogSamples {
+		n = catalogSamples
+	}
+	samples := make([]catalogSample, 0, n)
+	for i := s.count - n; i < s.count; i++ {
+		samples = append(samples, catalogSample(s.recent[i%catalogSamples]))
+	}
+	return samples
+}
+
+// catalogEntryFor describes s. Units and panel types that s does not set
+// itself come from the template of its collector.
+func catalogEntryFor(s *series) catalogEntry {
+	c := collectorFor(s.name)
+	t := c.panelFor(s.name)
+	unit, description := s.meta()
+	if unit == "" {
+		unit = t.unit
+	}
+	e := catalogEntry{
+		Name:        s.name,
+		Kind:        c.row,
+		Source:      s.source(),
+		Panel:       t.panelType,
+		Unit:        unit,
+		Description: description,
+		Samples:     s.recentSamples(),
+	}
+	if e.Panel == "" {
+		e.Panel = "timeseries"
+	}
+	s.mu.Lock()
+	if len(s.labels) > 0 {
+		e.Labels = make(map[string]string, len(s.labels))
+		for k, v := range s.labels {
+			e.Labels[k] = v
+		}
+	}
+	s.mu.Unlock()
+	return e
+}
+
+// catalog describes all metrics of the registry, sorted by name.
+func catalog(reg *registry) []catalogEntry {
+	entries := []catalogEntry{}
+	for _, s := range reg.list() {
+		entries = append(entries, catalogEntryFor(s))
+	}
+	return entries
+}
+
+// serveCatalog handles GET /api/catalog, which lists every metric with
+// its kind, unit, labels, description, and a few recent samples. The
+// dashboard generator works from the same entries, so the catalog shows
+// what a generated dashboard would contain.
+func serveCatalog(reg *registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, catalog(reg))
+	}
+}
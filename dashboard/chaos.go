@@ -0,0 +1,80 @@
+package dashboard
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chaos degrades the app on purpose, to show how panels and alerts behave
+// when things go wrong: samples get lost or arrive late, and HTTP
+// responses are slow.
+type chaos struct {
+	drop  float64       // probability that a sample gets lost
+	delay time.Duration // samples arrive up to this much later
+	slow  time.Duration // HTTP responses take up to this much longer
+}
+
+// parseChaosSpec parses the -chaos flag, as in "drop=5% delay=3s slow=2s".
+// Missing keys are off.
+func parseChaosSpec(s string) (*chaos, error) {
+	c := &chaos{}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("chaos %q: expected key=value, got %q", s, f)
+		}
+		var err error
+		switch kv[0] {
+		case "drop":
+			v := strings.TrimSuffix(kv[1], "%")
+			c.drop, err = strconv.ParseFloat(v, 64)
+			if v != kv[1] {
+				c.drop /= 100
+			}
+			if err == nil && (c.drop < 0 || c.drop > 1) {
+				err = fmt.Errorf("drop must be between 0 and 1 (or 0%% and 100%%)")
+			}
+		case "delay":
+			c.delay, err = time.ParseDuration(kv[1])
+		case "slow":
+			c.slow, err = time.ParseDuration(kv[1])
+		default:
+			err = fmt.Errorf("unknown key %q", kv[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("chaos %q: %s", s, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *chaos) String() string {
+	return fmt.Sprintf("dropping %g%% of the samples, delaying samples by up to %s, slowing down HTTP responses by up to %s", c.drop*100, c.delay, c.slow)
+}
+
+// sample lets add run now, later, or never.
+func (c *chaos) sample(add func()) {
+	if rand.Float64() < c.drop {
+		return
+	}
+	if c.delay > 0 {
+		time.AfterFunc(time.Duration(rand.Int63n(int64(c.delay))), add)
+		return
+	}
+	add()
+}
+
+// handler delays the responses of h.
+func (c *chaos) handler(h http.Handler) http.Handler {
+	if c.slow <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(rand.Int63n(int64(c.slow))))
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,81 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// defaultChatTemplate renders an alert event as a one-line chat message.
+const defaultChatTemplate = `[{{.State}}] {{.Rule}}: {{.Metric}} is {{printf "%.2f" .Value}}{{if .Link}} ({{.Link}}){{end}}`
+
+// chatMessage is the data passed to the message template.
+type chatMessage struct {
+	alertEvent
+	Link string
+}
+
+// chatNotifier posts alert messages to a chat service's incoming webhook.
+// Slack and Discord differ only in the name of the JSON field that carries
+// the message text.
+type chatNotifier struct {
+	url    string
+	field  string
+	link   string
+	tmpl   *template.Template
+	client *http.Client
+}
+
+// newChatNotifier creates a notifier for a chat service. tmpl is a
+// text/template that receives the alert event plus a Link field; an empty
+// tmpl selects defaultChatTemplate. link is typically the URL of the
+// Grafana dashboard.
+func newChatNotifier(url, field, tmpl, link string) (*chatNotifier, error) {
+	if tmpl == "" {
+		tmpl = defaultChatTemplate
+	}
+	t, err := template.New(field).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("message template: %s", err)
+	}
+	return &chatNotifier{
+		url:    url,
+		field:  field,
+		link:   link,
+		tmpl:   t,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// newSlackNotifier posts to a Slack incoming webhook.
+func newSlackNotifier(url, tmpl, link string) (*chatNotifier, error) {
+	return newChatNotifier(url, "text", tmpl, link)
+}
+
+// newDiscordNotifier posts to a Discord webhook.
+func newDiscordNotifier(url, tmpl, link string) (*chatNotifier, error) {
+	return newChatNotifier(url, "content", tmpl, link)
+}
+
+func (c *chatNotifier) notify(e alertEvent) error {
+	var msg bytes.Buffer
+	if err := c.tmpl.Execute(&msg, chatMessage{alertEvent: e, Link: c.link}); err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{c.field: msg.String()})
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("chat webhook: %s", resp.Status)
+	}
+	return nil
+}
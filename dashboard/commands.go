@@ -0,0 +1,213 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A command is a subcommand like `diydashboard gen-dashboard`. Running the
+// binary without a subcommand starts the app.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"annotate":       {"add an annotation to Grafana, like \"Deployed v1.2\"", annotate},
+	"defaults":       {"write the built-in config, demo metrics, and dashboards to a directory, to start a config of one's own", defaults},
+	"bench":          {"benchmark Add and /query throughput of the buffer layer", bench},
+	"discover":       {"list the apps on the LAN that announce themselves with -mdns", discoverCommand},
+	"demo":           {"run the app with a set of example metrics instead of the two CPU metrics", demo},
+	"replay":         {"send recorded datasource requests to a running app and compare the responses", replay},
+	"simulate":       {"send Grafana-like requests to a running app and check the responses", simulate},
+	"import":         {"load the history of a metric from a CSV file into a running app", importCommand},
+	"gen-dashboard":  {"write a Grafana dashboard with one panel per metric of a running app", genDashboard},
+	"provision":      {"write Grafana provisioning files for the datasource and the dashboard", provision},
+	"pull-dashboard": {"download a dashboard from Grafana, for keeping it in version control", pullDashboard},
+	"service":        {"install or uninstall the app as a systemd unit or a Windows service", service},
+}
+
+// runCommand runs the subcommand name, if there is one. It returns false
+// if name is not a subcommand.
+func runCommand(name string, args []string) (bool, error) {
+	if name == "help" {
+		printCommands(os.Stdout)
+		return true, nil
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		return false, nil
+	}
+	return true, cmd.run(args)
+}
+
+func printCommands(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "Usage: diydashboard [flags]            run the app")
+	fmt.Fprintln(w, "       diydashboard <command> [flags]  run a command")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-16s %s\n", name, commands[name].usage)
+	}
+}
+
+// baseURL turns an address like ":3002" into a URL like
+// "http://localhost:3002". Full URLs are returned as they are, minus a
+// trailing slash.
+func baseURL(addr string) string {
+	if !strings.Contains(addr, "://") {
+		if strings.HasPrefix(addr, ":") {
+			addr = "localhost" + addr
+		}
+		addr = "http://" + addr
+	}
+	return strings.TrimSuffix(addr, "/")
+}
+
+// apiGet fetches path from the API server of a running app.
+func apiGet(apiAddr, path string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(baseURL(apiAddr) + path)
+	if err != nil {
+		return nil, fmt.Errorf("is the app running? %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// grafanaFlags adds the flags for reaching Grafana to a command's flag
+// set. The returned function creates the client after the flags have been
+// parsed, with the same precedence as the app: flags, then environment
+// variables, then the config file.
+func grafanaFlags(fs *flag.FlagSet) func() (*grafanaClient, error) {
+	opts := &options{}
+	fs.StringVar(&opts.config, "config", "", "config file with Grafana settings")
+	fs.StringVar(&opts.grafanaURL, "grafana-url", "", "base URL of Grafana's HTTP API (default $DIYDASHBOARD_GRAFANA_URL)")
+	fs.IntVar(&opts.grafanaOrgID, "grafana-org", 0, "Grafana organization ID (default $DIYDASHBOARD_GRAFANA_ORG_ID)")
+	return func() (*grafanaClient, error) {
+		cfg, err := loadConfig(opts.config)
+		if err != nil {
+			return nil, err
+		}
+		g, err := newGrafanaFromOptions(opts, cfg.Grafana)
+		if err == nil && g == nil {
+			err = fmt.Errorf("no Grafana URL configured (-grafana-url, $%s, or the config file)", envGrafanaURL)
+		}
+		return g, err
+	}
+}
+
+// writeOutput writes b to the named file, or to stdout if name is "" or "-".
+func writeOutput(name string, b []byte) error {
+	if name == "" || name == "-" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(name, b, 0644)
+}
+
+// genDashboard asks a running app for a generated dashboard. The app knows
+// all its metrics, including those that appeared at runtime (via UDP, say).
+func genDashboard(args []string) error {
+	fs := flag.NewFlagSet("gen-dashboard", flag.ExitOnError)
+	api := fs.String("api", "localhost:3002", "address of the app's API server")
+	title := fs.String("title", "DIY Dashboard", "dashboard title")
+	out := fs.String("o", "-", "output file")
+	fs.Parse(args)
+	b, err := apiGet(*api, "/api/dashboard?title="+url.QueryEscape(*title))
+	if err != nil {
+		return err
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, b, "", "  "); err != nil {
+		return err
+	}
+	return writeOutput(*out, pretty.Bytes())
+}
+
+// pullDashboard downloads a dashboard from Grafana and writes it to a file,
+// so that hand-tuned dashboards can live in git next to the config.
+func pullDashboard(args []string) error {
+	fs := flag.NewFlagSet("pull-dashboard", flag.ExitOnError)
+	newGrafana := grafanaFlags(fs)
+	out := fs.String("o", "", "output file (default <uid>.json)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: diydashboard pull-dashboard [flags] <uid>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	uid := fs.Arg(0)
+	g, err := newGrafana()
+	if err != nil {
+		return err
+	}
+	d, err := g.getDashboard(uid)
+	if err != nil {
+		return err
+	}
+	// The numeric ID is specific to the Grafana instance. Without it, the
+	// file can be imported or provisioned anywhere; the UID identifies the
+	// dashboard.
+	delete(d, "id")
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = uid + ".json"
+	}
+	if err := writeOutput(*out, append(b, '\n')); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "wrote", *out)
+	return nil
+}
+
+// annotate posts an annotation straight to Grafana. Deploy scripts can
+// call it to mark a deployment on all graphs:
+//
+//	diydashboard annotate -tags deploy,backend "Deployed v1.2"
+func annotate(args []string) error {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	newGrafana := grafanaFlags(fs)
+	tags := fs.String("tags", "", "comma-separated tags")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: diydashboard annotate [flags] <text>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	g, err := newGrafana()
+	if err != nil {
+		return err
+	}
+	return g.Annotate(strings.Join(fs.Args(), " "), splitList(*tags)...)
+}
@@ -0,0 +1,337 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// config is the content of the config file. The file is YAML, or JSON,
+// which is valid YAML, too:
+//
+//	grafana:
+//	  url: http://localhost:3000
+//	  token: ${GRAFANA_TOKEN}
+//	  orgId: 1
+//	  folder: Home
+//	derived:
+//	  - name: cpu.avg
+//	    expr: avg(CPU1, CPU2)
+//	    unit: percent
+//	alerts:
+//	  - expr: CPU1 > 90
+//	    clear: 75
+//	    for: 30s
+//	    notify: [slack]
+//	  - expr: avg(cpu.avg, 5m) > 80
+//	    notify: [discord]
+//	notifiers:
+//	  slack: ${SLACK_WEBHOOK_URL}
+//	  discord: file:/run/secrets/discord_webhook_url
+//	  email:
+//	    smtp: mail.example.com:587
+//	    user: alerts
+//	    password: ${SMTP_PASSWORD}
+//	    from: alerts@example.com
+//	    to: [ops@example.com]
+//	namespaces:
+//	  - name: home
+//	    token: file:/run/secrets/home_token
+//	servers:
+//	  - {name: public, addr: ":4001", metrics: ["CPU*"]}
+//	agents:
+//	  - {name: nas, url: "http://nas.local:3001"}
+//
+// The YAML gets converted to JSON before it is parsed, so the keys are
+// those of the json tags.
+//
+// Tokens and other credentials need not be in the file; see secret.
+type config struct {
+	Grafana    grafanaConfig     `json:"grafana"`
+	Derived    []derivedConfig   `json:"derived"`
+	Alerts     []alertConfig     `json:"alerts"`
+	Notifiers  notifiersConfig   `json:"notifiers"`
+	Namespaces []namespaceConfig `json:"namespaces"`
+	Servers    []serverConfig    `json:"servers"`
+	Agents     []agentConfig     `json:"agents"`
+}
+
+// grafanaConfig tells the app how to reach Grafana's HTTP API, for
+// provisioning the datasource and pushing annotations. The datasource URL
+// is the address of this app as seen from Grafana, which differs from
+// "localhost" if Grafana runs in a container.
+//
+// Unlike the alert rules, these settings are read only at startup.
+//
+// Token is a service account token or a (legacy) API key; "apiKey" is
+// accepted as an alias. OrgID selects the organization if the token can
+// access more than one; zero means the token's default organization.
+type grafanaConfig struct {
+	URL           string `json:"url"`
+	Token         secret `json:"token"`
+	APIKey        secret `json:"apiKey"`
+	OrgID         int    `json:"orgId"`
+	Datasource    string `json:"datasource"`    // name, default "diydashboard"
+	DatasourceURL string `json:"datasourceUrl"` // default "http://localhost:3001", or the port in $GRADA_PORT
+	Folder        string `json:"folder"`        // for generated dashboards, default "DIY Dashboard"
+}
+
+// alertConfig declares an alert rule. Expr uses the same syntax as the
+// -alert flag, so `"expr": "CPU1 > 90 for 30s"` works, too.
+type alertConfig struct {
+	Name   string   `json:"name"`
+	Expr   string   `json:"expr"`
+	Clear  *float64 `json:"clear"`
+	For    duration `json:"for"`
+	Notify []string `json:"notify"`
+}
+
+// notifiersConfig holds the notifiers that alert rules send their
+// notifications to, under the names "webhook", "slack", "discord", and
+// "email". The webhook URLs carry their credentials, so they are secrets,
+// like the SMTP password. The command line flags override the settings.
+// Like the alert rules, they change with the config file.
+type notifiersConfig struct {
+	Webhook secret      `json:"webhook"` // POST the events as JSON
+	Slack   secret      `json:"slack"`
+	Discord secret      `json:"discord"`
+	Email   emailConfig `json:"email"`
+}
+
+// emailConfig holds the settings for alert emails. Without a user, the
+// app sends without authentication.
+type emailConfig struct {
+	SMTP     string   `json:"smtp"` // host:port
+	User     string   `json:"user"`
+	Password secret   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Batch    duration `json:"batch"` // default 1m
+}
+
+// rule turns the config entry into an alert rule.
+func (c alertConfig) rule() (alertRule, error) {
+	r, err := parseAlertRule(c.Expr)
+	if err != nil {
+		return r, err
+	}
+	r.Name = c.Name
+	r.Notify = c.Notify
+	if c.Clear != nil {
+		r.Clear = c.Clear
+	}
+	if c.For.Duration > 0 {
+		r.For = c.For.Duration
+	}
+	return r, r.validate()
+}
+
+// duration is a time.Duration that reads from JSON strings like "30s" or "7d".
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %s", b)
+	}
+	v, err := parseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// A secret is a credential in the config file, like a token. Rather than
+// the secret itself, in plain text in a file that may end up in git, the
+// value can refer to it:
+//
+//	"token": "${GRAFANA_TOKEN}"                 // an environment variable
+//	"token": "file:/run/secrets/grafana_token"  // a file, like a Docker secret
+//
+// The file holds the secret alone; a trailing newline does not count.
+//
+// The references get resolved when the config file is loaded, and the
+// settings that change with the file, like the notifiers, pick up a
+// rotated secret with the next change of the file. The settings that are
+// read only at startup, like those of Grafana and the agents, keep the
+// secret that they started with.
+type secret string
+
+func (s *secret) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	r, err := resolveSecret(v)
+	if err != nil {
+		return err
+	}
+	*s = secret(r)
+	return nil
+}
+
+// resolveSecret returns the secret that v refers to, or v itself if it is
+// no reference.
+func resolveSecret(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, "${") && strings.HasSuffix(v, "}"):
+		name := v[2 : len(v)-1]
+		s := os.Getenv(name)
+		if s == "" {
+			return "", fmt.Errorf("secret %s: environment variable %s is not set", v, name)
+		}
+		return s, nil
+	case strings.HasPrefix(v, "file:"):
+		b, err := ioutil.ReadFile(strings.TrimPrefix(v, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %s", v, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	return v, nil
+}
+
+// envSecret returns the secret in the environment variable name, or, if
+// that is not set, the secret in the file that name+"_FILE" points to, as
+// in DIYDASHBOARD_GRAFANA_TOKEN_FILE=/run/secrets/grafana_token. The
+// result is empty if neither is set.
+func envSecret(name string) (string, error) {
+	if v := os.Getenv(name); v != "" {
+		return v, nil
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		return resolveSecret("file:" + path)
+	}
+	return "", nil
+}
+
+// Environment variables for the Grafana settings. They override the config
+// file, so that secrets need not be stored there. The token can also come
+// from a file; see envSecret.
+const (
+	envGrafanaURL   = "DIYDASHBOARD_GRAFANA_URL"
+	envGrafanaToken = "DIYDASHBOARD_GRAFANA_TOKEN"
+	envGrafanaOrgID = "DIYDASHBOARD_GRAFANA_ORG_ID"
+)
+
+// envSMTPPassword is the environment variable with the password for alert
+// emails. It overrides the config file.
+const envSMTPPassword = "DIYDASHBOARD_SMTP_PASSWORD"
+
+// fromEnv returns c with the settings from the environment applied.
+func (c grafanaConfig) fromEnv() (grafanaConfig, error) {
+	if c.Token == "" {
+		c.Token = c.APIKey
+	}
+	if v := os.Getenv(envGrafanaURL); v != "" {
+		c.URL = v
+	}
+	token, err := envSecret(envGrafanaToken)
+	if err != nil {
+		return c, fmt.Errorf("%s: %s", envGrafanaToken, err)
+	}
+	if token != "" {
+		c.Token = secret(token)
+	}
+	if v := os.Getenv(envGrafanaOrgID); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return c, fmt.Errorf("%s: %s", envGrafanaOrgID, err)
+		}
+		c.OrgID = id
+	}
+	return c, nil
+}
+
+// datasource returns the name of the datasource in Grafana.
+func (c grafanaConfig) datasource() string {
+	if c.Datasource == "" {
+		return "diydashboard"
+	}
+	return c.Datasource
+}
+
+// folder returns the title of the Grafana folder for generated dashboards.
+func (c grafanaConfig) folder() string {
+	if c.Folder == "" {
+		return "DIY Dashboard"
+	}
+	return c.Folder
+}
+
+// loadConfig reads and parses the config file. Settings that the file
+// leaves out keep their values from the built-in config; an empty path
+// returns the built-in config.
+func loadConfig(path string) (*config, error) {
+	c, err := defaultConfig()
+	if err != nil || path == "" {
+		return c, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = yaml.YAMLToJSON(b); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return c, nil
+}
+
+// configCheckInterval is how often watchConfig looks for changes.
+const configCheckInterval = 2 * time.Second
+
+// watchConfig loads the config file, passes it to apply, and then keeps
+// watching the file. Whenever the file changes, it gets loaded and applied
+// again, until g stops. If the changed file is invalid, the error gets
+// logged and the previous config stays active.
+//
+// Only the initial load and apply can fail; this is the time to tell the
+// user about a broken config.
+func watchConfig(path string, apply func(*config) error, g *group) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	c, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	if err := apply(c); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	modTime := fi.ModTime()
+	g.loop(time.Tick(configCheckInterval), func(time.Time) {
+		fi, err := os.Stat(path)
+		if err != nil || fi.ModTime().Equal(modTime) {
+			return
+		}
+		modTime = fi.ModTime()
+		c, err := loadConfig(path)
+		if err == nil {
+			err = apply(c)
+		}
+		if err != nil {
+			log.Printf("config %s not reloaded: %s", path, err)
+			return
+		}
+		log.Printf("config %s reloaded", path)
+	})
+	return nil
+}
@@ -0,0 +1,94 @@
+package dashboard
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// countInterval is the width of the bins of event counters.
+const countInterval = 10 * time.Second
+
+// Logins, failed payments, and the like are events, not values: they
+// happen at some instant, and what a panel wants to show is how many of
+// them happened per interval. App.Count records one event, and every 10
+// seconds, the count since the last bin becomes a value of the metric, so
+// a quiet period shows as 0 rather than as a gap.
+
+// counters holds the event counters of an app, by metric name. All of them
+// get binned by one ticker, which starts with the first counter.
+type counters struct {
+	reg *registry
+
+	mu     sync.RWMutex
+	byName map[string]*counter
+}
+
+// counter is the number of events of a metric in the current bin.
+type counter struct {
+	n int64 // atomic; first, for the alignment on 32-bit platforms
+	s *series
+}
+
+func newCounters(reg *registry) *counters {
+	return &counters{reg: reg, byName: map[string]*counter{}}
+}
+
+// count records one event of the counter name, creating its metric and
+// starting the binning if necessary.
+func (cs *counters) count(name string) error {
+	cs.mu.RLock()
+	c := cs.byName[name]
+	cs.mu.RUnlock()
+	if c == nil {
+		var err error
+		if c, err = cs.add(name); err != nil {
+			return err
+		}
+	}
+	atomic.AddInt64(&c.n, 1)
+	return nil
+}
+
+func (cs *counters) add(name string) (*counter, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if c := cs.byName[name]; c != nil {
+		return c, nil
+	}
+	s, err := cs.reg.getOrCreateWith(name, cs.reg.timeRange, countInterval)
+	if err != nil {
+		return nil, err
+	}
+	if unit, _ := s.meta(); unit == "" {
+		s.describe("short", "Events per 10s")
+	}
+	if len(cs.byName) == 0 {
+		cs.reg.group.Go(cs.run)
+	}
+	c := &counter{s: s}
+	cs.byName[name] = c
+	return c, nil
+}
+
+// run adds the counts of each bin to the metrics, until ctx is done.
+func (cs *counters) run(ctx context.Context) error {
+	ticks := cs.reg.clock.Tick(countInterval)
+	for {
+		select {
+		case <-ticks:
+			cs.mu.RLock()
+			list := make([]*counter, 0, len(cs.byName))
+			for _, c := range cs.byName {
+				list = append(list, c)
+			}
+			cs.mu.RUnlock()
+			for _, c := range list {
+				c.s.Add(float64(atomic.SwapInt64(&c.n, 0)))
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
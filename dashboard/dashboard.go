@@ -0,0 +1,202 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The following types are a small subset of Grafana's dashboard JSON
+// model, just enough for rows of simple panels with one metric each.
+
+type dashboardJSON struct {
+	UID           string      `json:"uid"`
+	Title         string      `json:"title"`
+	Tags          []string    `json:"tags"`
+	Timezone      string      `json:"timezone"`
+	SchemaVersion int         `json:"schemaVersion"`
+	Refresh       string      `json:"refresh"`
+	Time          timeRange   `json:"time"`
+	Panels        []panelJSON `json:"panels"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type panelJSON struct {
+	ID          int          `json:"id"`
+	Type        string       `json:"type"`
+	Title       string       `json:"title"`
+	Description string       `json:"description,omitempty"`
+	Datasource  string       `json:"datasource,omitempty"`
+	GridPos     gridPos      `json:"gridPos"`
+	FieldConfig fieldConfig  `json:"fieldConfig"`
+	Targets     []targetJSON `json:"targets,omitempty"`
+}
+
+type gridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type fieldConfig struct {
+	Defaults struct {
+		Unit string   `json:"unit,omitempty"`
+		Min  *float64 `json:"min,omitempty"`
+		Max  *float64 `json:"max,omitempty"`
+	} `json:"defaults"`
+}
+
+type targetJSON struct {
+	RefID  string `json:"refId"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+// Layout of generated dashboards: by default, two panels side by side on
+// Grafana's 24-column grid.
+const (
+	gridWidth   = 24
+	panelWidth  = 12
+	panelHeight = 8
+)
+
+// generateDashboard creates a starter dashboard with one panel for each
+// metric in the catalog of the registry. The panels are grouped in rows,
+// one row per collector (the kind of the metric), as described by
+// collectorTemplates. Preview series are left out; they are meant for
+// overview dashboards of one's own. datasource is the name of the
+// SimpleJSON datasource in Grafana.
+func generateDashboard(reg *registry, title, datasource string) dashboardJSON {
+	d := dashboardJSON{
+		UID:           "diydashboard",
+		Title:         title,
+		Tags:          []string{"diydashboard"},
+		Timezone:      "browser",
+		SchemaVersion: 36,
+		Refresh:       "5s",
+		Time:          timeRange{From: "now-5m", To: "now"},
+		Panels:        []panelJSON{},
+	}
+	rows := map[string][]catalogEntry{}
+	for _, e := range catalog(reg) {
+		if strings.HasSuffix(e.Name, previewSuffix) {
+			continue
+		}
+		rows[e.Kind] = append(rows[e.Kind], e)
+	}
+	var x, y int
+	add := func(p panelJSON) {
+		p.ID = len(d.Panels) + 1
+		d.Panels = append(d.Panels, p)
+	}
+	all := append(collectorTemplates[:len(collectorTemplates):len(collectorTemplates)], otherTemplate)
+	for _, c := range all {
+		if len(rows[c.row]) == 0 {
+			continue
+		}
+		if x > 0 {
+			x, y = 0, y+panelHeight
+		}
+		add(panelJSON{Type: "row", Title: c.row, GridPos: gridPos{X: 0, Y: y, W: gridWidth, H: 1}})
+		y++
+		for _, e := range rows[c.row] {
+			t := c.panelFor(e.Name)
+			w := t.width
+			if w == 0 {
+				w = panelWidth
+			}
+			if x+w > gridWidth {
+				x, y = 0, y+panelHeight
+			}
+			p := panelJSON{
+				Type:        e.Panel,
+				Title:       e.Name,
+				Description: e.Description,
+				Datasource:  datasource,
+				GridPos:     gridPos{X: x, Y: y, W: w, H: panelHeight},
+				Targets:     []targetJSON{{RefID: "A", Target: e.Name, Type: "timeserie"}},
+			}
+			p.FieldConfig.Defaults.Unit = e.Unit
+			p.FieldConfig.Defaults.Min, p.FieldConfig.Defaults.Max = t.min, t.max
+			add(p)
+			x += w
+		}
+	}
+	return d
+}
+
+// serveDashboard handles GET /api/dashboard, which returns a generated
+// dashboard for all metrics the app currently has. The query parameters
+// "title" and "datasource" override the defaults.
+func serveDashboard(reg *registry, datasource string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		title := r.URL.Query().Get("title")
+		if title == "" {
+			title = "DIY Dashboard"
+		}
+		ds := r.URL.Query().Get("datasource")
+		if ds == "" {
+			ds = datasource
+		}
+		writeJSON(w, http.StatusOK, generateDashboard(reg, title, ds))
+	}
+}
+
+// dashboardSyncInterval is how often syncDashboard checks for new or
+// removed metrics.
+const dashboardSyncInterval = 10 * time.Second
+
+// syncDashboard keeps a generated dashboard in Grafana in sync with the
+// metrics in the registry. It uploads the dashboard right away and again
+// whenever metrics get added or removed, so that there is always exactly
+// one panel per series. The dashboard goes into the given Grafana folder,
+// which gets created if necessary, so that the generated dashboards do not
+// clutter the General folder. Failed uploads are retried at the next check.
+func syncDashboard(g *grafanaClient, reg *registry, title, datasource, folder string) {
+	var uploaded, folderUID string
+	check := func() {
+		names := make([]string, 0)
+		for _, s := range reg.list() {
+			names = append(names, s.name)
+		}
+		current := strings.Join(names, "\n")
+		if current == uploaded {
+			return
+		}
+		if folderUID == "" {
+			uid, err := g.ensureFolder(folder)
+			if err != nil {
+				log.Printf("dashboard sync: folder %q: %s", folder, err)
+				return
+			}
+			folderUID = uid
+		}
+		msg := fmt.Sprintf("diydashboard: %d metrics", len(names))
+		if err := g.uploadDashboard(generateDashboard(reg, title, datasource), folderUID, msg); err != nil {
+			log.Println("dashboard sync:", err)
+			return
+		}
+		log.Printf("dashboard %q synced to Grafana (%d panels)", title, len(names))
+		uploaded = current
+	}
+	reg.group.Go(func(ctx context.Context) error {
+		check()
+		ticks := reg.clock.Tick(dashboardSyncInterval)
+		for {
+			select {
+			case <-ticks:
+				check()
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+}
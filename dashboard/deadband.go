@@ -0,0 +1,74 @@
+package dashboard
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultKeepAlive is how long a deadband lets a flat metric go without a
+// sample, unless the spec says otherwise.
+const defaultKeepAlive = time.Minute
+
+// deadbandSpec is what the -deadband flag describes, as in
+// "disk.used_pct.*:0.5" or "temp.*:0.2:5m": which metrics, by how much a
+// value must differ from the last stored one to be stored, and how long a
+// metric may go without a stored sample.
+type deadbandSpec struct {
+	pattern   string
+	threshold float64
+	keepAlive time.Duration
+}
+
+func parseDeadbandSpec(s string) (deadbandSpec, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return deadbandSpec{}, fmt.Errorf("deadband %q: want <metric>:<threshold>[:<keep-alive>]", s)
+	}
+	spec := deadbandSpec{pattern: parts[0], keepAlive: defaultKeepAlive}
+	threshold, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || threshold < 0 {
+		return spec, fmt.Errorf("deadband %q: invalid threshold %q", s, parts[1])
+	}
+	spec.threshold = threshold
+	if len(parts) == 3 {
+		d, err := time.ParseDuration(parts[2])
+		if err != nil || d <= 0 {
+			return spec, fmt.Errorf("deadband %q: invalid keep-alive %q", s, parts[2])
+		}
+		spec.keepAlive = d
+	}
+	return spec, nil
+}
+
+func (spec deadbandSpec) matches(name string) bool {
+	return matchPattern(spec.pattern, name)
+}
+
+// A deadband keeps the samples of a mostly flat metric, like the space in
+// use on a disk, out of the buffer unless they say something new: a value
+// that differs from the last stored one by more than the threshold. Every
+// keepAlive, a sample gets stored anyway, so that a panel can tell a flat
+// metric from a dead one.
+type deadband struct {
+	spec deadbandSpec
+
+	mu     sync.Mutex
+	stored bool // whether last is set
+	last   float64
+	since  time.Time
+}
+
+// sample reports whether the sample v at time t is to be stored.
+func (d *deadband) sample(v float64, t time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stored && math.Abs(v-d.last) <= d.spec.threshold && t.Sub(d.since) < d.spec.keepAlive {
+		return false
+	}
+	d.stored, d.last, d.since = true, v, t
+	return true
+}
@@ -0,0 +1,70 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// logExchange writes a datasource request and a summary of its response
+// to the log, for -debug-http. The request body is pretty-printed; of the
+// response, only the shape is interesting: which targets came back, with
+// how many points, over which time range.
+func logExchange(ex exchange) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s -> %d in %s\n", ex.Method, ex.Path, ex.Status, ex.Duration.Round(time.Millisecond))
+	if ex.Request != "" {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, []byte(ex.Request), "  ", "  ") == nil {
+			fmt.Fprintf(&b, "  %s\n", pretty.Bytes())
+		} else {
+			fmt.Fprintf(&b, "  %s\n", ex.Request)
+		}
+	}
+	b.WriteString(summarizeResponse(ex))
+	log.Print("debug-http: ", b.String())
+}
+
+// summarizeResponse describes a response body in a few lines.
+func summarizeResponse(ex exchange) string {
+	if ex.Status != http.StatusOK {
+		return fmt.Sprintf("  response: %s\n", strings.TrimSpace(ex.Response))
+	}
+	switch {
+	case strings.HasPrefix(ex.Path, "/query"):
+		var resp []queryResult
+		if err := json.Unmarshal([]byte(ex.Response), &resp); err != nil {
+			return fmt.Sprintf("  response: not a query response: %s\n", err)
+		}
+		if len(resp) == 0 {
+			return "  response: no targets\n"
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "  response: %d targets\n", len(resp))
+		for _, r := range resp {
+			fmt.Fprintf(&b, "    %s: %d points", r.Target, len(r.Datapoints))
+			if n := len(r.Datapoints); n > 0 {
+				from, to := msTime(r.Datapoints[0][1]), msTime(r.Datapoints[n-1][1])
+				fmt.Fprintf(&b, " from %s to %s", from.Format("15:04:05"), to.Format("15:04:05"))
+			}
+			b.WriteString("\n")
+		}
+		return b.String()
+	case strings.HasPrefix(ex.Path, "/search"):
+		var names []interface{}
+		if err := json.Unmarshal([]byte(ex.Response), &names); err != nil {
+			return fmt.Sprintf("  response: not a search response: %s\n", err)
+		}
+		return fmt.Sprintf("  response: %d metrics\n", len(names))
+	}
+	return fmt.Sprintf("  response: %d bytes\n", len(ex.Response))
+}
+
+// msTime converts a Grafana timestamp in milliseconds to a time.
+func msTime(ms float64) time.Time {
+	return time.Unix(0, int64(ms)*int64(time.Millisecond))
+}
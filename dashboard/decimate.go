@@ -0,0 +1,115 @@
+package dashboard
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// decimateSpec is what the -decimate flag describes, as in
+// "udp.accel:every:10" or "sensor.*:avg:1s": which metrics, and how to
+// thin out their samples. A pattern that ends in "*" matches all metrics
+// with that prefix.
+type decimateSpec struct {
+	pattern string
+	how     string        // "every", "avg", "min", "max", or "last"
+	n       int           // for "every": keep every nth sample
+	tick    time.Duration // for the aggregates: one value per tick
+}
+
+func parseDecimateSpec(s string) (decimateSpec, error) {
+	var spec decimateSpec
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return spec, fmt.Errorf("decimate %q: want <metric>:every:<n> or <metric>:<avg|min|max|last>:<tick>", s)
+	}
+	spec.pattern, spec.how = parts[0], parts[1]
+	switch spec.how {
+	case "every":
+		n, err := strconv.Atoi(parts[2])
+		if err != nil || n < 1 {
+			return spec, fmt.Errorf("decimate %q: invalid n %q", s, parts[2])
+		}
+		spec.n = n
+	case "avg", "min", "max", "last":
+		d, err := time.ParseDuration(parts[2])
+		if err != nil || d <= 0 {
+			return spec, fmt.Errorf("decimate %q: invalid tick %q", s, parts[2])
+		}
+		spec.tick = d
+	default:
+		return spec, fmt.Errorf("decimate %q: unknown method %q (every, avg, min, max, last)", s, spec.how)
+	}
+	return spec, nil
+}
+
+func (spec decimateSpec) matches(name string) bool {
+	return matchPattern(spec.pattern, name)
+}
+
+// matchPattern reports whether the metric name matches pattern, which is
+// either a name or a prefix followed by "*".
+func matchPattern(pattern, name string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(name, strings.TrimSuffix(pattern, "*"))
+	}
+	return name == pattern
+}
+
+// A decimator thins out the samples of a source that produces thousands
+// of points per second, before they reach the buffer. That keeps buffers
+// and query responses small, and the panel does not look any different.
+type decimator struct {
+	spec decimateSpec
+
+	mu     sync.Mutex
+	seen   int       // samples since the last one kept, for "every"
+	window time.Time // start of the current tick
+	count  int
+	agg    float64
+}
+
+// sample returns the value to store for the sample v at time t, and false
+// if nothing is to be stored. The aggregates are complete when the first
+// sample of the next tick arrives, so they lag by up to one sample.
+func (d *decimator) sample(v float64, t time.Time) (float64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.spec.how == "every" {
+		d.seen++
+		if d.seen < d.spec.n {
+			return 0, false
+		}
+		d.seen = 0
+		return v, true
+	}
+	window := t.Truncate(d.spec.tick)
+	var out float64
+	done := d.count > 0 && !window.Equal(d.window)
+	if done {
+		out = d.agg
+		if d.spec.how == "avg" {
+			out /= float64(d.count)
+		}
+		d.count = 0
+	}
+	if d.count == 0 {
+		d.window, d.agg = window, v
+	} else {
+		switch d.spec.how {
+		case "avg":
+			d.agg += v
+		case "min":
+			d.agg = math.Min(d.agg, v)
+		case "max":
+			d.agg = math.Max(d.agg, v)
+		case "last":
+			d.agg = v
+		}
+	}
+	d.count++
+	return out, done
+}
@@ -0,0 +1,112 @@
+package dashboard
+
+import (
+	"embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultFiles holds the defaults directory: the default config, the demo
+// metric definitions, and ready-made Grafana dashboards. They are compiled
+// into the binary, so that a bare binary (or the scratch container) needs
+// no files next to it to produce a working dashboard.
+//
+//go:embed defaults
+var defaultFiles embed.FS
+
+// readDefault parses the JSON file name from the defaults directory into v.
+func readDefault(name string, v interface{}) error {
+	b, err := defaultFiles.ReadFile(path.Join("defaults", name))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("built-in %s: %s", name, err)
+	}
+	return nil
+}
+
+// defaultConfig returns the built-in config, which applies if there is no
+// config file, and which a config file overrides setting by setting.
+func defaultConfig() (*config, error) {
+	var c config
+	if err := readDefault("config.json", &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// bundledDashboards lists the names of the built-in dashboards: one for
+// the app's metrics, and one for `diydashboard demo`.
+func bundledDashboards() []string {
+	entries, err := defaultFiles.ReadDir("defaults/dashboards")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	return names
+}
+
+// bundledDashboard returns the built-in dashboard name with the given
+// title and datasource. The dashboards were generated with gen-dashboard
+// from a freshly started app and demo, respectively.
+func bundledDashboard(name, title, datasource string) (dashboardJSON, error) {
+	var d dashboardJSON
+	if err := readDefault("dashboards/"+name+".json", &d); err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("no built-in dashboard %q (there are: %s)", name, strings.Join(bundledDashboards(), ", "))
+		}
+		return d, err
+	}
+	d.Title = title
+	for i := range d.Panels {
+		if d.Panels[i].Datasource != "" {
+			d.Panels[i].Datasource = datasource
+		}
+	}
+	return d, nil
+}
+
+// defaults writes the built-in files to a directory, as a starting point
+// for a config file of one's own.
+func defaults(args []string) error {
+	flags := flag.NewFlagSet("defaults", flag.ExitOnError)
+	dir := flags.String("dir", "defaults", "output directory")
+	flags.Parse(args)
+	var paths []string
+	err := fs.WalkDir(defaultFiles, "defaults", func(p string, e fs.DirEntry, err error) error {
+		if err == nil && !e.IsDir() {
+			paths = append(paths, p)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		b, err := defaultFiles.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(*dir, filepath.FromSlash(strings.TrimPrefix(p, "defaults/")))
+		if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+			return err
+		}
+		if err := writeOutput(out, b); err != nil {
+			return err
+		}
+		fmt.Println("wrote", out)
+	}
+	return nil
+}
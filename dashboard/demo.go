@@ -0,0 +1,226 @@
+package dashboard
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+// A demoGenerator produces the values of one demo metric. f receives the
+// number of seconds since the start and gets called once per second.
+type demoGenerator struct {
+	name        string
+	unit        string
+	description string
+	f           func(t float64) float64
+}
+
+// A demoDefinition is an entry of defaults/demo.json: a metric and the
+// shape of its values.
+type demoDefinition struct {
+	Name        string `json:"name"`
+	Unit        string `json:"unit"`
+	Description string `json:"description"`
+	Shape       string `json:"shape"`
+}
+
+// demoShapes create the generator functions for the shapes in the demo
+// definitions: smooth cycles, random walks, bursts, steps, seasonal
+// patterns, and office hours. The patterns were made for a 5-minute dashboard; scale
+// stretches them to other time ranges. Every call returns a function with
+// its own state.
+var demoShapes = map[string]sourceFunc{
+	"sine": func(scale float64, start time.Time) func(float64) float64 {
+		return func(t float64) float64 {
+			return 21 + 3*math.Sin(2*math.Pi*t/(300*scale)) + demoNoise(0.2)
+		}
+	},
+	// Random walk that drifts back towards its mean.
+	"walk": func(scale float64, start time.Time) func(float64) float64 {
+		requests := 200.0
+		return func(t float64) float64 {
+			requests += demoNoise(20) + (200-requests)*0.05
+			return math.Max(0, requests)
+		}
+	},
+	"spikes": func(scale float64, start time.Time) func(float64) float64 {
+		return func(t float64) float64 {
+			v := 40 + demoNoise(5)
+			if rand.Float64() < 0.03 {
+				v += 200 + 300*rand.Float64()
+			}
+			return v
+		}
+	},
+	// Bursts: mostly quiet, now and then a spike that decays.
+	"bursts": func(scale float64, start time.Time) func(float64) float64 {
+		var burst float64
+		return func(t float64) float64 {
+			if rand.Float64() < 0.02 {
+				burst = 0.1 + 0.2*rand.Float64()
+			}
+			burst *= 0.85
+			return burst
+		}
+	},
+	// Stepped: a new level every 30 seconds (at scale 1).
+	"steps": func(scale float64, start time.Time) func(float64) float64 {
+		var level, nextStep float64
+		return func(t float64) float64 {
+			if t >= nextStep {
+				level, nextStep = float64(rand.Intn(50)), t+30*scale
+			}
+			return level
+		}
+	},
+	"seasonal": func(scale float64, start time.Time) func(float64) float64 {
+		return func(t float64) float64 {
+			daily := math.Sin(2 * math.Pi * t / (60 * scale))
+			weekly := math.Sin(2 * math.Pi * t / (420 * scale))
+			return math.Max(0, 500+200*daily+100*weekly+demoNoise(30))
+		}
+	},
+	// Sawtooth: memory grows until the garbage collector frees most of it.
+	"sawtooth": func(scale float64, start time.Time) func(float64) float64 {
+		heap := 50e6
+		return func(t float64) float64 {
+			heap += 2e6 + demoNoise(1e6)
+			if heap > 200e6 {
+				heap = 50e6 + demoNoise(5e6)
+			}
+			return heap
+		}
+	},
+	"ramp": func(scale float64, start time.Time) func(float64) float64 {
+		return func(t float64) float64 {
+			return 60 + 30*math.Mod(t, 240*scale)/(240*scale)
+		}
+	},
+	"battery": func(scale float64, start time.Time) func(float64) float64 {
+		return func(t float64) float64 {
+			phase := math.Mod(t, 300*scale) / scale
+			if phase < 200 {
+				return 100 - 80*phase/200
+			}
+			return 20 + 80*(phase-200)/100
+		}
+	},
+	// Requests of an office application: busy in business hours, quiet
+	// at night and on weekends, and flat on holidays. Unlike the other
+	// shapes, it follows the calendar instead of the time range, so it
+	// makes sense in a dashboard over days, with -speed.
+	"business": func(scale float64, start time.Time) func(float64) float64 {
+		return func(t float64) float64 {
+			busy, holiday := businessHours.busy(start.Add(time.Duration(t * float64(time.Second))))
+			if holiday {
+				return 20
+			}
+			return 20 + 480*busy + demoNoise(5+45*busy)
+		}
+	},
+	// Availability with rare outages of a few seconds.
+	"flaky": func(scale float64, start time.Time) func(float64) float64 {
+		downUntil := -1.0
+		return func(t float64) float64 {
+			if t < downUntil {
+				return 0
+			}
+			if rand.Float64() < 0.01 {
+				downUntil = t + 5 + 10*rand.Float64()
+				return 0
+			}
+			return 1
+		}
+	},
+}
+
+// demoNoise returns a random value between -amount and amount.
+func demoNoise(amount float64) float64 {
+	return amount * (2*rand.Float64() - 1)
+}
+
+// demoGenerators returns the generators for the demo definitions that are
+// built into the binary, starting at start. Everything runs much faster
+// than in real life, so that a dashboard that shows the time range span
+// (in seconds) shows the whole pattern.
+func demoGenerators(span float64, start time.Time) ([]demoGenerator, error) {
+	var defs []demoDefinition
+	if err := readDefault("demo.json", &defs); err != nil {
+		return nil, err
+	}
+	scale := span / 300
+	gens := make([]demoGenerator, len(defs))
+	for i, d := range defs {
+		shape, ok := demoShapes[d.Shape]
+		if !ok {
+			return nil, fmt.Errorf("demo metric %s: unknown shape %q", d.Name, d.Shape)
+		}
+		gens[i] = demoGenerator{d.Name, d.Unit, d.Description, shape(scale, start)}
+	}
+	return gens, nil
+}
+
+// addDemoMetrics registers the demo metrics and feeds them once per second.
+// The generators start a full time range in the past and backfill it, so
+// that the first look at the dashboard shows complete graphs instead of a
+// lonely dot at the right edge.
+func addDemoMetrics(reg *registry) error {
+	start := reg.clock.Now().Add(-reg.timeRange)
+	gens, err := demoGenerators(reg.timeRange.Seconds(), start)
+	if err != nil {
+		return err
+	}
+	metrics := make([]*series, len(gens))
+	for i, g := range gens {
+		s, err := reg.getOrCreate(g.name)
+		if err != nil {
+			return err
+		}
+		metrics[i] = s.describe(g.unit, g.description)
+	}
+	for i := 0; i < int(reg.timeRange/time.Second); i++ {
+		t := start.Add(time.Duration(i) * time.Second)
+		for j, g := range gens {
+			metrics[j].backfill(g.f(float64(i)), t)
+		}
+	}
+	reg.every(time.Second, func(now time.Time) {
+		t := now.Sub(start).Seconds()
+		for i, g := range gens {
+			metrics[i].Add(g.f(t))
+		}
+	})
+	return nil
+}
+
+// demo runs the app with the demo metrics instead of the two CPU metrics.
+// It accepts the same flags as the app, so
+//
+//	diydashboard demo -sync-dashboard -grafana-url http://localhost:3000
+//
+// gives a first-time user a complete dashboard within seconds.
+func demo(args []string) error {
+	flags, err := parseFlags("demo", args)
+	if err == flag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	opts := &flags.o
+	reg, err := newRegistryFromOptions(grada.GetDashboard(), opts)
+	if err != nil {
+		return err
+	}
+	if err := addDemoMetrics(reg); err != nil {
+		return err
+	}
+	if err := setup(reg, opts); err != nil {
+		return err
+	}
+	return waitForStop(reg.group, opts)
+}
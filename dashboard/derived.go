@@ -0,0 +1,159 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// derivedConfig declares a metric whose values come from an expression
+// over other metrics (see expr), evaluated once per interval:
+//
+//	{"name": "cpu.avg", "expr": "avg(CPU1, CPU2)", "unit": "percent", "interval": "5s"}
+type derivedConfig struct {
+	Name        string   `json:"name"`
+	Expr        string   `json:"expr"`
+	Unit        string   `json:"unit"`
+	Description string   `json:"description"`
+	Interval    duration `json:"interval"` // default 1s
+}
+
+// parseDerivedFlag parses a -derive flag like "cpu.avg = avg(CPU1, CPU2)".
+func parseDerivedFlag(s string) (derivedConfig, error) {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return derivedConfig{}, fmt.Errorf("derive %q: want <metric> = <expression>", s)
+	}
+	return derivedConfig{Name: strings.TrimSpace(s[:i]), Expr: strings.TrimSpace(s[i+1:])}, nil
+}
+
+// interval returns the evaluation interval of c.
+func (c derivedConfig) interval() time.Duration {
+	if c.Interval.Duration > 0 {
+		return c.Interval.Duration
+	}
+	return defaultInterval
+}
+
+// A derivation evaluates one derived metric until stop gets closed.
+type derivation struct {
+	c    derivedConfig
+	stop chan struct{}
+}
+
+// deriver runs the derived metrics. Like the alert rules, the set of
+// derived metrics can be replaced at runtime, when the config file
+// changes.
+type deriver struct {
+	reg *registry
+
+	mu      sync.Mutex
+	running map[string]*derivation // by metric name
+}
+
+func newDeriver(reg *registry) *deriver {
+	return &deriver{reg: reg, running: map[string]*derivation{}}
+}
+
+// set replaces all derived metrics. Metrics whose definition did not
+// change keep running; metrics that are gone stop updating. If any
+// definition is invalid, the old ones stay in place. Identical
+// definitions count once, as two alert rules on the same expression
+// need only one series.
+func (d *deriver) set(configs []derivedConfig) error {
+	var unique []derivedConfig
+	var exprs []*expr
+	seen := map[string]derivedConfig{}
+	for _, c := range configs {
+		if c.Name == "" || isExpr(c.Name) {
+			return fmt.Errorf("derived metric %q: invalid name", c.Name)
+		}
+		if prev, ok := seen[c.Name]; ok {
+			if prev != c {
+				return fmt.Errorf("derived metric %q: defined twice", c.Name)
+			}
+			continue
+		}
+		seen[c.Name] = c
+		e, err := parseExpr(c.Expr)
+		if err != nil {
+			return fmt.Errorf("derived metric %q: %s", c.Name, err)
+		}
+		unique = append(unique, c)
+		exprs = append(exprs, e)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	running := map[string]*derivation{}
+	var started []*derivation
+	for i, c := range unique {
+		if old, ok := d.running[c.Name]; ok && old.c == c {
+			running[c.Name] = old
+			continue
+		}
+		r, err := d.start(c, exprs[i])
+		if err != nil {
+			for _, r := range started {
+				close(r.stop)
+			}
+			return err
+		}
+		started = append(started, r)
+		running[c.Name] = r
+	}
+	for name, old := range d.running {
+		if running[name] != old {
+			close(old.stop)
+		}
+	}
+	d.running = running
+	return nil
+}
+
+// configs returns the definitions of the derived metrics that run.
+func (d *deriver) configs() []derivedConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var configs []derivedConfig
+	for _, r := range d.running {
+		configs = append(configs, r.c)
+	}
+	return configs
+}
+
+// start creates the metric of c and evaluates e once per interval into
+// it. Intervals where e lacks a value (a metric has no samples yet, say)
+// add no sample.
+func (d *deriver) start(c derivedConfig, e *expr) (*derivation, error) {
+	if err := e.bind(d.reg); err != nil {
+		return nil, fmt.Errorf("derived metric %q: %s", c.Name, err)
+	}
+	s, err := d.reg.getOrCreateWith(c.Name, d.reg.timeRange, c.interval())
+	if err != nil {
+		return nil, fmt.Errorf("derived metric %q: %s", c.Name, err)
+	}
+	description := c.Description
+	if description == "" {
+		description = "= " + c.Expr
+	}
+	s.describe(c.Unit, description)
+	r := &derivation{c: c, stop: make(chan struct{})}
+	ticks := d.reg.clock.Tick(c.interval())
+	d.reg.group.Go(func(ctx context.Context) error {
+		for {
+			select {
+			case now := <-ticks:
+				if v, ok := e.eval(now); ok {
+					s.Add(v)
+				}
+			case <-r.stop:
+				return nil
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+	return r, nil
+}
@@ -0,0 +1,129 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// smtpConfig holds the settings for sending alert emails.
+type smtpConfig struct {
+	Addr     string // host:port of the SMTP server
+	User     string // optional; no authentication if empty
+	Password string
+	From     string
+	To       []string
+	Batch    time.Duration // collect events for this long before sending
+}
+
+// emailNotifier sends alert events by email. To avoid flooding the inbox
+// when several alerts change state at once, it collects the events for
+// cfg.Batch and then sends them all in a single message. The batches go
+// out from run.
+type emailNotifier struct {
+	cfg    smtpConfig
+	wake   chan struct{} // the first event of a batch arrived
+	closed chan struct{} // see close
+
+	mu      sync.Mutex
+	pending []alertEvent
+}
+
+func newEmailNotifier(cfg smtpConfig) (*emailNotifier, error) {
+	if cfg.Addr == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("email notifier: SMTP address, sender, and recipients are required")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return nil, fmt.Errorf("email notifier: %s", err)
+	}
+	return &emailNotifier{cfg: cfg, wake: make(chan struct{}, 1), closed: make(chan struct{})}, nil
+}
+
+// notify queues the event. The first event of a batch starts the wait
+// for the delivery of the whole batch.
+func (n *emailNotifier) notify(e alertEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.pending = append(n.pending, e)
+	if len(n.pending) == 1 {
+		select {
+		case n.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// run sends a batch cfg.Batch after its first event, until ctx is done or
+// n gets closed. Then it sends the pending events right away, so that no
+// batch gets lost on shutdown.
+func (n *emailNotifier) run(ctx context.Context) error {
+	for {
+		select {
+		case <-n.wake:
+		case <-ctx.Done():
+			n.flush()
+			return nil
+		case <-n.closed:
+			n.flush()
+			return nil
+		}
+		select {
+		case <-time.After(n.cfg.Batch):
+		case <-ctx.Done():
+		case <-n.closed:
+		}
+		n.flush()
+	}
+}
+
+// close makes run send the pending events and return, as when a new
+// config file replaces n.
+func (n *emailNotifier) close() {
+	close(n.closed)
+}
+
+// flush sends all pending events in one email.
+func (n *emailNotifier) flush() {
+	n.mu.Lock()
+	events := n.pending
+	n.pending = nil
+	n.mu.Unlock()
+	if len(events) == 0 {
+		return
+	}
+	if err := n.send(events); err != nil {
+		log.Printf("email notification (%d events) failed: %s", len(events), err)
+	}
+}
+
+func (n *emailNotifier) send(events []alertEvent) error {
+	firing := 0
+	for _, e := range events {
+		if e.State == "firing" {
+			firing++
+		}
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [diydashboard] %d alert(s) firing, %d resolved\r\n", firing, len(events)-firing)
+	fmt.Fprintf(&msg, "Date: %s\r\n", inDisplayZone(time.Now()).Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	for _, e := range events {
+		fmt.Fprintf(&msg, "%s  %-8s  %s (value %g)\r\n", e.Time.Format(time.RFC3339), e.State, e.Rule, e.Value)
+	}
+
+	var auth smtp.Auth
+	if n.cfg.User != "" {
+		host, _, _ := net.SplitHostPort(n.cfg.Addr)
+		auth = smtp.PlainAuth("", n.cfg.User, n.cfg.Password, host)
+	}
+	return smtp.SendMail(n.cfg.Addr, auth, n.cfg.From, n.cfg.To, msg.Bytes())
+}
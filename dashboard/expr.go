@@ -0,0 +1,482 @@
+package dashboard
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// An expr is a formula over the latest values of metrics, as used by
+// derived metrics and alert rules:
+//
+//	(mem.system.used - mem.process.rss) / 1024
+//	max(CPU1, CPU2, CPU3, CPU4)
+//	avg(CPU1, 5m) - avg(CPU1, 1h)
+//
+// It knows + - * / and parentheses, numbers, metric names, and these
+// functions:
+//
+//   - abs(x)
+//   - min(x, y, ...), max(x, y, ...), avg(x, y, ...), sum(x, y, ...)
+//   - min(metric, window), max, avg, and sum over the samples that the
+//     metric received during the window, like 5m
+//   - rate(metric, window): the change per second over the window, for
+//     counters
+//
+// Metric names may contain dots, underscores, and hyphens, so a minus
+// needs spaces around it: "CPU1 - CPU2" is a difference, "host-1" is a
+// name. Names with other characters go into double quotes.
+type expr struct {
+	src  string
+	root exprNode
+}
+
+// An exprNode evaluates one part of an expression at time now. ok is
+// false if a value is missing: a metric without samples yet, an empty
+// window, or a division by zero.
+type exprNode interface {
+	eval(now time.Time) (v float64, ok bool)
+}
+
+type (
+	numberNode float64
+	metricNode struct {
+		name string
+		s    *series // set by bind
+	}
+	unaryNode struct {
+		x exprNode
+	}
+	binaryNode struct {
+		op   byte
+		x, y exprNode
+	}
+	funcNode struct {
+		name string
+		args []exprNode
+	}
+	windowNode struct {
+		fn     string
+		metric string
+		d      time.Duration
+		w      *sampleWindow // set by bind
+	}
+)
+
+func (n numberNode) eval(time.Time) (float64, bool) { return float64(n), true }
+
+func (n *metricNode) eval(time.Time) (float64, bool) {
+	v, t := n.s.latest()
+	return v, !t.IsZero()
+}
+
+func (n unaryNode) eval(now time.Time) (float64, bool) {
+	v, ok := n.x.eval(now)
+	return -v, ok
+}
+
+func (n binaryNode) eval(now time.Time) (float64, bool) {
+	x, ok := n.x.eval(now)
+	if !ok {
+		return 0, false
+	}
+	y, ok := n.y.eval(now)
+	if !ok {
+		return 0, false
+	}
+	switch n.op {
+	case '+':
+		return x + y, true
+	case '-':
+		return x - y, true
+	case '*':
+		return x * y, true
+	}
+	if y == 0 {
+		return 0, false
+	}
+	return x / y, true
+}
+
+func (n funcNode) eval(now time.Time) (float64, bool) {
+	vs := make([]float64, len(n.args))
+	for i, a := range n.args {
+		v, ok := a.eval(now)
+		if !ok {
+			return 0, false
+		}
+		vs[i] = v
+	}
+	if n.name == "abs" {
+		return math.Abs(vs[0]), true
+	}
+	return reduce(n.name, vs), true
+}
+
+func (n *windowNode) eval(now time.Time) (float64, bool) {
+	samples := n.w.since(now.Add(-n.d))
+	if len(samples) == 0 {
+		return 0, false
+	}
+	if n.fn == "rate" {
+		first, last := samples[0], samples[len(samples)-1]
+		secs := last.t.Sub(first.t).Seconds()
+		if secs <= 0 {
+			return 0, false
+		}
+		return (last.v - first.v) / secs, true
+	}
+	vs := make([]float64, len(samples))
+	for i, s := range samples {
+		vs[i] = s.v
+	}
+	return reduce(n.fn, vs), true
+}
+
+// reduce applies min, max, avg, or sum to vs, which is not empty.
+func reduce(fn string, vs []float64) float64 {
+	r := vs[0]
+	for _, v := range vs[1:] {
+		switch fn {
+		case "min":
+			r = math.Min(r, v)
+		case "max":
+			r = math.Max(r, v)
+		default:
+			r += v
+		}
+	}
+	if fn == "avg" {
+		r /= float64(len(vs))
+	}
+	return r
+}
+
+// exprFuncs are the functions of expressions and their number of
+// arguments; -1 means one or more.
+var exprFuncs = map[string]int{"abs": 1, "min": -1, "max": -1, "avg": -1, "sum": -1, "rate": 2}
+
+// parseExpr parses an expression. Metric references stay unresolved
+// until bind.
+func parseExpr(s string) (*expr, error) {
+	p := &exprParser{src: s}
+	p.next()
+	root, err := p.parseSum()
+	if err == nil && p.tok.kind != tokEOF {
+		err = p.errorf("unexpected %q", p.tok.text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %s", s, err)
+	}
+	return &expr{src: s, root: root}, nil
+}
+
+// bind resolves the metric names of e, creating the metrics that do not
+// exist yet, so that e can refer to metrics that only appear later (via
+// UDP, say).
+func (e *expr) bind(reg *registry) error {
+	var err error
+	walkExpr(e.root, func(n exprNode) {
+		if err != nil {
+			return
+		}
+		switch n := n.(type) {
+		case *metricNode:
+			n.s, err = reg.getOrCreate(n.name)
+		case *windowNode:
+			n.w, err = reg.window(n.metric, n.d)
+		}
+	})
+	return err
+}
+
+// eval returns the value of e at time now. ok is false if a value that e
+// needs is missing.
+func (e *expr) eval(now time.Time) (v float64, ok bool) {
+	v, ok = e.root.eval(now)
+	return v, ok && !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func walkExpr(n exprNode, f func(exprNode)) {
+	f(n)
+	switch n := n.(type) {
+	case unaryNode:
+		walkExpr(n.x, f)
+	case binaryNode:
+		walkExpr(n.x, f)
+		walkExpr(n.y, f)
+	case funcNode:
+		for _, a := range n.args {
+			walkExpr(a, f)
+		}
+	}
+}
+
+// isExpr reports whether s is an expression rather than a plain metric
+// name.
+func isExpr(s string) bool {
+	return strings.ContainsAny(s, " ()+*/,\"")
+}
+
+const (
+	tokEOF = iota
+	tokNumber
+	tokDuration
+	tokName
+	tokOp // one of + - * / ( ) ,
+)
+
+type exprToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+// exprParser is a recursive descent parser with one token of lookahead.
+type exprParser struct {
+	src string
+	pos int
+	tok exprToken
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at %d: %s", p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+// is reports whether the current token is the operator op.
+func (p *exprParser) is(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-'
+}
+
+// next reads the next token into p.tok.
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.src) {
+		p.tok = exprToken{tokEOF, "end of expression", start}
+		return
+	}
+	c := p.src[p.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		kind := tokNumber
+		// A unit right after the number makes it a duration, like 5m.
+		for p.pos < len(p.src) && unicode.IsLetter(rune(p.src[p.pos])) {
+			p.pos++
+			kind = tokDuration
+		}
+		p.tok = exprToken{kind, p.src[start:p.pos], start}
+	case c == '"':
+		end := strings.IndexByte(p.src[p.pos+1:], '"')
+		if end < 0 {
+			p.tok = exprToken{tokOp, p.src[start:], start}
+			p.pos = len(p.src)
+			return
+		}
+		p.pos += end + 2
+		p.tok = exprToken{tokName, p.src[start+1 : p.pos-1], start}
+	case strings.IndexByte("+-*/(),", c) >= 0:
+		p.pos++
+		p.tok = exprToken{tokOp, string(c), start}
+	default:
+		for p.pos < len(p.src) && isNameRune(rune(p.src[p.pos])) {
+			p.pos++
+		}
+		if p.pos == start {
+			p.pos++
+		}
+		p.tok = exprToken{tokName, p.src[start:p.pos], start}
+	}
+}
+
+// parseSum parses terms joined by + and -.
+func (p *exprParser) parseSum() (exprNode, error) {
+	x, err := p.parseProduct()
+	for err == nil && (p.is("+") || p.is("-")) {
+		op := p.tok.text[0]
+		p.next()
+		var y exprNode
+		if y, err = p.parseProduct(); err == nil {
+			x = binaryNode{op, x, y}
+		}
+	}
+	return x, err
+}
+
+// parseProduct parses factors joined by * and /.
+func (p *exprParser) parseProduct() (exprNode, error) {
+	x, err := p.parseFactor()
+	for err == nil && (p.is("*") || p.is("/")) {
+		op := p.tok.text[0]
+		p.next()
+		var y exprNode
+		if y, err = p.parseFactor(); err == nil {
+			x = binaryNode{op, x, y}
+		}
+	}
+	return x, err
+}
+
+// parseFactor parses a number, a metric, a function call, a negation, or
+// an expression in parentheses.
+func (p *exprParser) parseFactor() (exprNode, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		v, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("at %d: invalid number %q", tok.pos+1, tok.text)
+		}
+		return numberNode(v), nil
+	case tokName:
+		p.next()
+		if p.is("(") {
+			return p.parseCall(tok)
+		}
+		return &metricNode{name: tok.text}, nil
+	case tokOp:
+		switch tok.text {
+		case "-":
+			p.next()
+			x, err := p.parseFactor()
+			return unaryNode{x}, err
+		case "(":
+			p.next()
+			x, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			if !p.is(")") {
+				return nil, p.errorf("missing )")
+			}
+			p.next()
+			return x, nil
+		}
+	case tokDuration:
+		return nil, p.errorf("duration %s outside of a window function, like avg(CPU1, %s)", tok.text, tok.text)
+	}
+	if tok.kind == tokEOF {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	return nil, p.errorf("unexpected %q", tok.text)
+}
+
+// parseCall parses the arguments of the function name, after the name.
+// A metric name and a duration make a window function.
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	arity, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, fmt.Errorf("at %d: unknown function %q", name.pos+1, name.text)
+	}
+	p.next()
+	var args []exprNode
+	for {
+		if p.tok.kind == tokDuration && len(args) == 1 {
+			d, err := parseDuration(p.tok.text)
+			if err != nil || d <= 0 {
+				return nil, p.errorf("invalid window %q", p.tok.text)
+			}
+			m, isMetric := args[0].(*metricNode)
+			if !isMetric || name.text == "abs" {
+				return nil, fmt.Errorf("at %d: %s(metric, window) needs a metric name", name.pos+1, name.text)
+			}
+			p.next()
+			if !p.is(")") {
+				return nil, p.errorf("missing )")
+			}
+			p.next()
+			return &windowNode{fn: name.text, metric: m.name, d: d}, nil
+		}
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.is(",") {
+			p.next()
+			continue
+		}
+		if !p.is(")") {
+			return nil, p.errorf("missing )")
+		}
+		p.next()
+		break
+	}
+	if name.text == "rate" {
+		return nil, fmt.Errorf("at %d: rate needs a metric and a window, like rate(go.gc_count, 1m)", name.pos+1)
+	}
+	if arity > 0 && len(args) != arity {
+		return nil, fmt.Errorf("at %d: %s takes %d argument(s)", name.pos+1, name.text, arity)
+	}
+	return funcNode{name: name.text, args: args}, nil
+}
+
+// A sampleWindow keeps the samples of a metric for a while, for the
+// window functions of expressions.
+type sampleWindow struct {
+	d       time.Duration
+	mu      sync.Mutex
+	samples []sample
+}
+
+func (w *sampleWindow) add(v float64, t time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples = append(w.samples, sample{v, t})
+	w.trim(t.Add(-w.d))
+}
+
+// since returns the samples from start on.
+func (w *sampleWindow) since(start time.Time) []sample {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.trim(start)
+	return append([]sample(nil), w.samples...)
+}
+
+// trim drops the samples before start.
+func (w *sampleWindow) trim(start time.Time) {
+	i := 0
+	for i < len(w.samples) && w.samples[i].t.Before(start) {
+		i++
+	}
+	if i > 0 {
+		w.samples = append(w.samples[:0], w.samples[i:]...)
+	}
+}
+
+// window returns the window of duration d over the samples of the metric
+// name. Expressions that use the same window share it, so that reloading
+// the config does not add observers again and again.
+func (r *registry) window(name string, d time.Duration) (*sampleWindow, error) {
+	s, err := r.getOrCreate(name)
+	if err != nil {
+		return nil, err
+	}
+	key := name + "|" + d.String()
+	r.mu.Lock()
+	w, ok := r.windows[key]
+	if !ok {
+		w = &sampleWindow{d: d}
+		r.windows[key] = w
+	}
+	r.mu.Unlock()
+	if !ok {
+		s.observe(w.add)
+	}
+	return w, nil
+}
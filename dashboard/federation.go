@@ -0,0 +1,262 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// agentConfig declares another diydashboard, an agent, whose metrics this
+// app pulls in, so that one Grafana datasource shows the metrics of all
+// machines:
+//
+//	"agents": [
+//	  {"name": "nas", "url": "http://nas.local:3001"},
+//	  {"name": "pi", "url": "http://pi.local:3004/ns/home", "token": "...", "interval": "30s", "metrics": ["temp.*"]}
+//	]
+//
+// URL is the agent's datasource, as Grafana would use it: its grada
+// server, its proxy, a namespace, or an extra server. The metrics of the
+// agent show up here prefixed with its name, like "nas.CPU1". Metrics
+// selects them by pattern (a name, or a prefix followed by "*"); without
+// patterns, all of them. Token works like the token of a namespace.
+//
+// Metrics that the agent pulled in from this app or from another agent
+// of it are left out. For that, the app must know the name that its
+// agents know it by: the host name up to the first dot, as -mdns
+// announces it, so agents of each other should be named that way, too.
+//
+// Like namespaces, agents are read only at startup.
+type agentConfig struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Token    secret   `json:"token"`
+	Interval duration `json:"interval"` // default 10s
+	Metrics  []string `json:"metrics"`
+}
+
+// defaultAgentInterval is how often the metrics of an agent get pulled.
+const defaultAgentInterval = 10 * time.Second
+
+func (c agentConfig) validate() error {
+	if c.Name == "" || isExpr(c.Name) {
+		return fmt.Errorf("agent at %q: invalid name %q", c.URL, c.Name)
+	}
+	if c.URL == "" {
+		return fmt.Errorf("agent %s: no URL", c.Name)
+	}
+	return nil
+}
+
+func (c agentConfig) interval() time.Duration {
+	if c.Interval.Duration > 0 {
+		return c.Interval.Duration
+	}
+	return defaultAgentInterval
+}
+
+// An agent pulls the samples of another app's metrics into the registry.
+// Each pull asks for the samples since the previous one, with some
+// overlap for samples that arrived late; samples that it has seen
+// already get skipped.
+type agent struct {
+	c      agentConfig
+	reg    *registry
+	client *http.Client
+	since  time.Time            // start of the next query
+	latest map[string]time.Time // of the samples pulled so far, by remote metric
+	err    error                // of the previous pull, for logging changes
+}
+
+// federate starts pulling the metrics of the agents, until the registry's
+// group stops. The first pull of each agent covers the registry's time
+// range, so the graphs start out complete.
+func federate(reg *registry, configs []agentConfig) error {
+	names := map[string]bool{}
+	for _, c := range configs {
+		if err := c.validate(); err != nil {
+			return err
+		}
+		if names[c.Name] {
+			return fmt.Errorf("agent %s: defined twice", c.Name)
+		}
+		names[c.Name] = true
+	}
+	for _, c := range configs {
+		startAgent(reg, c)
+	}
+	return nil
+}
+
+// startAgent starts pulling the metrics of the agent c, until the
+// registry's group stops.
+func startAgent(reg *registry, c agentConfig) {
+	a := newAgent(reg, c)
+	reg.group.Go(a.run)
+	log.Printf("agent %s: pulling metrics from %s every %s", c.Name, c.URL, c.interval())
+}
+
+// newAgent returns the agent c of the registry, which has pulled nothing
+// yet.
+func newAgent(reg *registry, c agentConfig) *agent {
+	reg.addPrefix(c.Name)
+	return &agent{
+		c:      c,
+		reg:    reg,
+		client: &http.Client{Timeout: 30 * time.Second},
+		since:  time.Now().Add(-reg.timeRange),
+		latest: map[string]time.Time{},
+	}
+}
+
+func (a *agent) run(ctx context.Context) error {
+	for {
+		err := a.pull(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		switch {
+		case err != nil && a.err == nil:
+			log.Printf("agent %s: %s", a.c.Name, err)
+		case err == nil && a.err != nil:
+			log.Printf("agent %s: back", a.c.Name)
+		}
+		a.err = err
+		select {
+		case <-time.After(a.c.interval()):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// pull asks the agent for its metrics and their samples since the
+// previous pull, and adds the new ones to the metrics of the registry.
+func (a *agent) pull(ctx context.Context) error {
+	var names []string
+	if err := a.post(ctx, "/search", map[string]string{"target": ""}, &names); err != nil {
+		return err
+	}
+	type target struct {
+		Target string `json:"target"`
+		Type   string `json:"type"`
+	}
+	var targets []target
+	for _, name := range names {
+		if a.pulls(name) {
+			targets = append(targets, target{name, "timeserie"})
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	now := time.Now()
+	q := map[string]interface{}{
+		"range": map[string]string{
+			"from": a.since.UTC().Format(time.RFC3339Nano),
+			"to":   now.UTC().Format(time.RFC3339Nano),
+		},
+		"maxDataPoints": rawMaxDataPoints,
+		"targets":       targets,
+	}
+	var results []queryResult
+	if err := a.post(ctx, "/query", q, &results); err != nil {
+		return err
+	}
+	for _, r := range results {
+		s, err := a.reg.getOrCreate(a.c.Name + "." + r.Target)
+		if err != nil {
+			return err
+		}
+		latest := a.latest[r.Target]
+		for _, p := range r.Datapoints {
+			t := time.Unix(0, int64(p[1])*int64(time.Millisecond))
+			if math.IsNaN(p[0]) || !t.After(latest) {
+				continue
+			}
+			latest = t
+			if s.admit() {
+				s.storeStamped(p[0], t, t)
+			}
+		}
+		a.latest[r.Target] = latest
+	}
+	a.since = now.Add(-a.c.interval())
+	return nil
+}
+
+// pulls reports whether the agent's metric name gets pulled. Metrics
+// that the agent pulled in itself, from this app or from another agent of
+// it, are left out: when two apps pull from each other, each pull would
+// otherwise add another prefix to the other's metrics, like "b.a.b.x".
+func (a *agent) pulls(name string) bool {
+	if a.reg.federated(name) {
+		return false
+	}
+	if len(a.c.Metrics) == 0 {
+		return true
+	}
+	for _, p := range a.c.Metrics {
+		if matchPattern(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// addPrefix makes name, the name of an agent or the name that the agents
+// know the app by, a prefix of federated metrics.
+func (r *registry) addPrefix(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prefixes[name] = true
+}
+
+// federated reports whether the metric name of an agent is federated: if
+// it starts with the name of one of the app's agents, or with the app's
+// own name, followed by a dot.
+func (r *registry) federated(name string) bool {
+	i := strings.IndexByte(name, '.')
+	if i < 0 {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.prefixes[name[:i]]
+}
+
+// post sends req as JSON to the agent's endpoint path and decodes the
+// response into resp.
+func (a *agent) post(ctx context.Context, path string, req, resp interface{}) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest(http.MethodPost, a.c.URL+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	if a.c.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+string(a.c.Token))
+	}
+	res, err := a.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", path, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// peer serves the datasource of reg to an agent: /search lists its
+// metrics, and /query returns the latest sample of each target.
+func peer(reg *registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search", serveSearch(reg))
+	mux.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+		var q struct {
+			Targets []struct {
+				Target string `json:"target"`
+			} `json:"targets"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		results := []queryResult{}
+		for _, t := range q.Targets {
+			s, ok := reg.get(t.Target)
+			if !ok {
+				continue
+			}
+			v, at := s.latest()
+			results = append(results, queryResult{t.Target, []datapoint{{v, float64(at.UnixNano() / 1e6)}}})
+		}
+		writeJSON(w, http.StatusOK, results)
+	})
+	return mux
+}
+
+func names(reg *registry) []string {
+	var l []string
+	for _, s := range reg.list() {
+		l = append(l, s.name)
+	}
+	return l
+}
+
+// Two apps that pull from each other must not pull back what they pulled,
+// or each pull adds another prefix.
+func TestFederationLoop(t *testing.T) {
+	dash := testDashboard(t)
+	a, b := uniqueName("peera"), uniqueName("peerb")
+	regA, regB := newRegistry(dash), newRegistry(dash)
+	// The app's own name, as setup adds it.
+	regA.addPrefix(a)
+	regB.addPrefix(b)
+	for reg, name := range map[*registry]string{regA: a + "_x", regB: b + "_y"} {
+		s, err := reg.getOrCreate(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Add(1)
+	}
+	srvA, srvB := httptest.NewServer(peer(regA)), httptest.NewServer(peer(regB))
+	defer srvA.Close()
+	defer srvB.Close()
+	pullsB := newAgent(regA, agentConfig{Name: b, URL: srvB.URL})
+	pullsA := newAgent(regB, agentConfig{Name: a, URL: srvA.URL})
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		if err := pullsB.pull(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := pullsA.pull(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := names(regA), []string{a + "_x", b + "." + b + "_y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("metrics of %s: got %q, want %q", a, got, want)
+	}
+	if got, want := names(regB), []string{a + "." + a + "_x", b + "_y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("metrics of %s: got %q, want %q", b, got, want)
+	}
+	if v, _ := regA.metrics[b+"."+b+"_y"].latest(); v != 1 {
+		t.Errorf("pulled sample: got %v, want 1", v)
+	}
+}
+
+func TestFederated(t *testing.T) {
+	reg := newRegistry(nil)
+	reg.addPrefix("nas")
+	reg.addPrefix("pi")
+	for name, want := range map[string]bool{
+		"CPU1":         false,
+		"nas":          false,
+		"nas.CPU1":     true,
+		"pi.nas.CPU1":  true,
+		"nasty.CPU1":   false,
+		"net.eth0.rx":  false,
+		"hub.pi.temp1": false,
+	} {
+		if got := reg.federated(name); got != want {
+			t.Errorf("federated(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
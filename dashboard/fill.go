@@ -0,0 +1,156 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Probes and sensors that report every few minutes, or only when a value
+// changes, leave gaps that Grafana draws as broken lines. For targets
+// that ask for it, the proxy fills the gaps of a series with points at the
+// query's interval.
+
+// A filler returns the value at time t between two points a and b, with
+// a[1] < t < b[1].
+type filler func(a, b datapoint, t float64) float64
+
+// fillers are the gap-filling modes that targets can choose from.
+var fillers = map[string]filler{
+	"linear": func(a, b datapoint, t float64) float64 {
+		return a[0] + (b[0]-a[0])*(t-a[1])/(b[1]-a[1])
+	},
+	"previous": func(a, b datapoint, t float64) float64 {
+		return a[0]
+	},
+}
+
+// fillerNames returns the names of the fillers, for messages.
+func fillerNames() string {
+	names := make([]string, 0, len(fillers))
+	for name := range fillers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// fillSpec is what the -fill flag describes, as in "probes.*:previous":
+// the gap-filling mode for the metrics that match the pattern, unless the
+// panel's target asks for another one.
+type fillSpec struct {
+	pattern string
+	mode    string
+}
+
+func parseFillSpec(s string) (fillSpec, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return fillSpec{}, fmt.Errorf("fill %q: want <metric>:<mode>", s)
+	}
+	spec := fillSpec{pattern: s[:i], mode: s[i+1:]}
+	if fillers[spec.mode] == nil {
+		return spec, fmt.Errorf("fill %q: unknown mode %q (%s)", s, spec.mode, fillerNames())
+	}
+	return spec, nil
+}
+
+// A queryFill fills the gaps of the series of a /query response.
+type queryFill struct {
+	by       map[string]filler // by target; others stay as they are
+	interval float64           // in milliseconds
+}
+
+// newQueryFill finds the gap-filling mode of each target of a /query
+// request: from the target's payload, as in {"target": "probe.temp",
+// "data": {"fill": "linear"}}, or from specs. "none" switches filling off
+// for a target. It returns nil if no target needs filling, or if the
+// request has no interval to fill with: Grafana's intervalMs, or else the
+// time range divided by maxDataPoints.
+func newQueryFill(body []byte, specs []fillSpec) (*queryFill, error) {
+	var q struct {
+		IntervalMs    float64 `json:"intervalMs"`
+		MaxDataPoints int     `json:"maxDataPoints"`
+		Range         struct {
+			From time.Time `json:"from"`
+			To   time.Time `json:"to"`
+		} `json:"range"`
+		Targets []struct {
+			Target  string          `json:"target"`
+			Data    json.RawMessage `json:"data"`
+			Payload json.RawMessage `json:"payload"`
+		} `json:"targets"`
+	}
+	if err := json.Unmarshal(body, &q); err != nil {
+		return nil, nil
+	}
+	f := &queryFill{by: map[string]filler{}, interval: q.IntervalMs}
+	if f.interval <= 0 && q.MaxDataPoints > 0 {
+		f.interval = float64(q.Range.To.Sub(q.Range.From)/time.Millisecond) / float64(q.MaxDataPoints)
+	}
+	if f.interval <= 0 {
+		return nil, nil
+	}
+	for _, t := range q.Targets {
+		mode := targetOption(t.Data, "fill")
+		if mode == "" {
+			mode = targetOption(t.Payload, "fill")
+		}
+		for _, spec := range specs {
+			if mode != "" {
+				break
+			}
+			if matchPattern(spec.pattern, t.Target) {
+				mode = spec.mode
+			}
+		}
+		if mode == "" || mode == "none" {
+			continue
+		}
+		fill := fillers[mode]
+		if fill == nil {
+			return nil, fmt.Errorf("target %s: unknown fill mode %q (%s, none)", t.Target, mode, fillerNames())
+		}
+		f.by[t.Target] = fill
+	}
+	if len(f.by) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// apply fills each gap of r that is longer than the interval with points
+// at the interval. Null values (NaN) are dropped, and the gaps they leave
+// get filled, too. Nothing is added before the first point or after the
+// last one, so a probe that died does not look alive.
+func (f *queryFill) apply(r *queryResult) {
+	fill := f.by[r.Target]
+	if fill == nil {
+		return
+	}
+	points := make([]datapoint, 0, len(r.Datapoints))
+	for _, p := range r.Datapoints {
+		if !math.IsNaN(p[0]) {
+			points = append(points, p)
+		}
+	}
+	if len(points) < 2 {
+		return
+	}
+	out := make([]datapoint, 0, len(points))
+	for i, b := range points {
+		if i > 0 {
+			a := points[i-1]
+			// Samples arrive a little late now and then; a point right
+			// before b would only add a kink.
+			for t := a[1] + f.interval; t < b[1]-f.interval/2; t += f.interval {
+				out = append(out, datapoint{fill(a, b, t), t})
+			}
+		}
+		out = append(out, b)
+	}
+	r.Datapoints = out
+}
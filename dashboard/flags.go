@@ -0,0 +1,212 @@
+package dashboard
+
+import (
+	"flag"
+	"strings"
+	"time"
+)
+
+// options holds the command line flags.
+type options struct {
+	config   string
+	dir      string
+	tz       string
+	api      string
+	readOnly bool
+	udp      string
+	stress   string
+	fleet    int
+
+	proxy        string
+	record       string
+	debugHTTP    bool
+	chaos        string
+	queryWorkers int
+	queryTimeout time.Duration
+	jsonEncoder  string
+	correctSkew  bool
+	upstream     string
+	mdns         bool
+	join         bool
+
+	scenario      string
+	speed         float64
+	retention     time.Duration
+	businessHours string
+	shards        int
+	adaptive      int
+	preview       time.Duration
+	rollups       bool
+
+	anomalies     stringList
+	anomalyWindow int
+
+	forecasts       stringList
+	forecastWindow  int
+	forecastHorizon time.Duration
+
+	slos    stringList
+	derived stringList
+
+	decimate   stringList
+	deadbands  stringList
+	rateLimits stringList
+	aggregate  stringList
+	fill       stringList
+	units      stringList
+	aliases    stringList
+	timeShift  bool
+
+	alerts        stringList
+	webhook       string
+	slack         string
+	discord       string
+	alertTemplate string
+	dashboardURL  string
+	smtp          string
+	smtpUser      string
+	mailFrom      string
+	mailTo        string
+	mailBatch     time.Duration
+
+	grafanaURL          string
+	grafanaOrgID        int
+	grafanaAnnotations  bool
+	provisionDatasource bool
+	datasourceURL       string
+	syncDashboard       bool
+	grafanaFolder       string
+	grafanaCheck        bool
+	grafanaLive         bool
+	grafanaAlerts       bool
+
+	windowsService string
+}
+
+// Options are the settings of an App, which the diydashboard command
+// takes from its command line flags. Create them with ParseOptions, or
+// with DefineFlags on a flag set of your own.
+type Options struct {
+	o options
+}
+
+// ParseOptions parses args, which exclude the program name, like the
+// command line of diydashboard. The flags are those of a flag set of
+// their own, so they do not clash with the flags of the program. An
+// unknown flag, or -h, returns an error after the usage message.
+func ParseOptions(args []string) (*Options, error) {
+	return parseFlags("diydashboard", args)
+}
+
+// DefineFlags defines the flags of the app, like -config and -api, on fs,
+// and returns the options that fs.Parse sets. This way, the flags of a
+// program and those of the app share one command line and one usage
+// message. The names must not clash.
+func DefineFlags(fs *flag.FlagSet) *Options {
+	opts := &Options{}
+	defineFlags(fs, &opts.o)
+	return opts
+}
+
+// parseFlags parses the app's flags from args, which excludes the program
+// name, with name as the name in the usage message.
+func parseFlags(name string, args []string) (*Options, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	opts := DefineFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// defineFlags defines the app's flags on fs, for o.
+func defineFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.config, "config", "", "YAML (or JSON) config file; reloaded automatically when it changes")
+	fs.BoolVar(&o.readOnly, "read-only", false, "serve only the datasource endpoints (/search, /query, /annotations) on the API server and the extra servers, and refuse everything that changes the app, like silences, source switches, and -udp")
+	fs.StringVar(&o.api, "api", "localhost:3002", "address of the API server for annotations and admin endpoints; these have no authentication, so only this machine can reach them by default; \":3002\" listens on all interfaces, as for Grafana in a Docker container; empty to disable")
+	fs.StringVar(&o.udp, "udp", "", "listen for JSON samples like {\"m\":\"temp\",\"v\":21.5} on this UDP address (e.g. :3003)")
+	fs.StringVar(&o.stress, "stress", "", "load test: create many random-walk metrics, as in \"n=500 rate=10/s\"")
+	fs.IntVar(&o.fleet, "fleet", 0, "simulate this many hosts with cpu, mem, and net metrics each, labeled host=host-01 and so on")
+	fs.StringVar(&o.proxy, "proxy", ":3004", "address of the proxy in front of the datasource server, for -record, -debug-http, -chaos, -speed, and -query-workers; Grafana's datasource must point to it")
+	fs.StringVar(&o.record, "record", "", "record all datasource requests and responses to this file, for `diydashboard replay`")
+	fs.BoolVar(&o.debugHTTP, "debug-http", false, "log every datasource request body and a summary of the response; Grafana's datasource must point to -proxy")
+	fs.IntVar(&o.queryWorkers, "query-workers", 0, "split /query requests by target and run up to this many in parallel; Grafana's datasource must point to -proxy")
+	fs.DurationVar(&o.queryTimeout, "query-timeout", 10*time.Second, "deadline for each request through -proxy; targets that miss it are left out of the response")
+	fs.StringVar(&o.jsonEncoder, "json-encoder", "fast", "encoder for the /query responses that -proxy rewrites: \"fast\" (hand-rolled) or \"std\" (encoding/json)")
+	fs.StringVar(&o.upstream, "upstream", "", "URL of another SimpleJSON datasource, like \"http://old-backend:3003\", to forward the /query targets to that are no metrics of the app, and whose metrics /search lists, too; Grafana's datasource must point to -proxy")
+	fs.BoolVar(&o.mdns, "mdns", false, "announce the app's datasource on the LAN through multicast DNS, named after the host, for -join and \"diydashboard discover\"")
+	fs.BoolVar(&o.join, "join", false, "look for other apps that run with -mdns on the LAN every minute, and pull in their metrics as agents named after their hosts")
+	fs.BoolVar(&o.correctSkew, "correct-skew", false, "shift the time ranges and timestamps of datasource queries by the measured clock skew between Grafana and the app, if it exceeds 2s; Grafana's datasource must point to -proxy")
+	fs.StringVar(&o.chaos, "chaos", "", "degrade the app on purpose, as in \"drop=5% delay=3s slow=2s\": lose samples, delay samples, slow down HTTP responses")
+	fs.StringVar(&o.scenario, "scenario", "", "play an incident from a scenario file, with lines like \"at t+2m raise CPU1 to 95 for 90s\" or \"at t+3m drop net.* to 0\"")
+	fs.Float64Var(&o.speed, "speed", 1, "time compression: let generated data advance this many times faster than the wall clock, as in 60 for an hour per minute; Grafana's datasource must point to -proxy")
+	fs.DurationVar(&o.retention, "retention", defaultTimeRange, "time range that metrics created by the app keep, in simulated time with -speed")
+	fs.StringVar(&o.businessHours, "business-hours", defaultBusinessHours, "office hours of the \"business\" demo source, in the -timezone zone, like \"Mon-Sat 8-18 holidays=2026-12-24,2026-12-25\"; quiet at other times, flat on holidays")
+	fs.DurationVar(&o.preview, "preview", 0, "give every metric a \"<metric>.preview\" series with one average per this interval, like 1m, for overview dashboards that refresh cheaply; 0 for none")
+	fs.BoolVar(&o.rollups, "rollups", false, "keep the daily minimum, maximum, and average of every metric for a week, for table panels with targets like \"rollup:yesterday\" or \"rollup:2026-10-15:CPU*\"; Grafana's datasource must point to -proxy")
+	fs.IntVar(&o.adaptive, "adaptive-buffers", 0, "resize the buffer of a metric that receives data much faster or slower than expected, up to this many points; 0 to keep the sizes")
+	fs.IntVar(&o.shards, "shards", 0, "stage the samples of every metric in this many lock-striped buffers, for sources that add thousands of values per second; 0 to add directly")
+	fs.Var(&o.anomalies, "anomaly", "add a \"<metric>.anomaly\" z-score series for this metric (repeatable)")
+	fs.IntVar(&o.anomalyWindow, "anomaly-window", 60, "number of samples for the rolling mean and standard deviation of anomaly series")
+	fs.Var(&o.forecasts, "forecast", "add a \"<metric>.forecast\" trend series; \"<metric>:<threshold>\" also adds a \"<metric>.forecast_eta\" time-to-threshold series (repeatable)")
+	fs.IntVar(&o.forecastWindow, "forecast-window", 300, "number of recent samples that the forecast trend is fitted to")
+	fs.DurationVar(&o.forecastHorizon, "forecast-horizon", time.Hour, "how far ahead forecast series look; their points are stamped that far in the future")
+	fs.Var(&o.deadbands, "deadband", "store a sample of matching metrics only if it differs from the last stored one by more than a threshold, or if the last one is older than a keep-alive interval (default 1m), like \"disk.used_pct.*:0.5\" or \"temp.*:0.2:5m\" (repeatable)")
+	fs.Var(&o.rateLimits, "rate-limit", "accept at most this many samples per second for matching metrics, like \"udp.*:50\" or \"CPU*:10:block\"; beyond that, samples get dropped (drop, the default), the latest one waits for the next slot (coalesce), or Add waits (block); \"app.rate_limited.<metric>\" counts the samples over the limit (repeatable)")
+	fs.Var(&o.decimate, "decimate", "thin out the samples of a high-frequency metric before they are stored, like \"accel:every:10\" or \"sensor.*:avg:1s\" (also min, max, last) (repeatable)")
+	fs.Var(&o.aggregate, "aggregate", "aggregate the points of matching metrics with this function when a panel asks for fewer points than there are, like \"CPU*:max\" (avg, sum, min, max, last, p95; default: grada's avg); a panel can choose with {\"agg\": \"max\"} as the target's additional JSON data; Grafana's datasource must point to -proxy (repeatable)")
+	fs.Var(&o.fill, "fill", "fill the gaps of matching metrics with points at the panel's interval when a panel queries them, like \"probes.*:previous\" (linear, previous); a panel can choose with {\"fill\": \"linear\"} as the target's additional JSON data, or switch filling off with {\"fill\": \"none\"}; Grafana's datasource must point to -proxy (repeatable)")
+	fs.Var(&o.units, "unit", "convert the values of matching metrics from their unit to this one when a panel queries them, like \"mem.*:GB\" or \"*.latency:ms\" (data sizes and rates, times, percent; metrics without a convertible unit stay as they are); a panel can choose with {\"unit\": \"MB\"} as the target's additional JSON data; Grafana's datasource must point to -proxy (repeatable)")
+	fs.Var(&o.aliases, "alias", "name the series of matching metrics in Grafana's legends with a template of their labels, like \"fleet.*:{{host}}\" or \"CPU*:core {{core}}\" ({{name}} is the metric name); a panel can choose with {\"alias\": \"...\"} as the target's additional JSON data; Grafana's datasource must point to -proxy (repeatable)")
+	fs.BoolVar(&o.timeShift, "time-shift", false, "let a panel add a metric shifted back in time, for comparisons like today vs. yesterday, with {\"timeShift\": \"24h\"} as the target's additional JSON data; the series is named \"<metric> (24h ago)\"; Grafana's datasource must point to -proxy")
+	fs.Var(&o.slos, "slo", "track an SLO on a 0/1 availability metric, like \"http.up:99.5:30d\"; adds \"<metric>.error_budget\" and \"<metric>.burn_rate\" series (repeatable)")
+	fs.Var(&o.derived, "derive", "add a metric computed from other metrics, like \"cpu.avg = avg(CPU1, CPU2)\" or \"cpu.drift = avg(CPU1, 1m) - avg(CPU1, 1h)\"; + - * / abs min max avg sum rate (repeatable)")
+	fs.Var(&o.alerts, "alert", "alert rule like \"CPU1 > 90 clear 75 for 30s\" or \"avg(CPU1, 5m) > 80\" (repeatable)")
+	fs.StringVar(&o.webhook, "webhook", "", "POST alert notifications as JSON to this URL (overrides notifiers.webhook of the config file)")
+	fs.StringVar(&o.slack, "slack", "", "Slack incoming webhook URL for alert notifications (overrides notifiers.slack of the config file)")
+	fs.StringVar(&o.discord, "discord", "", "Discord webhook URL for alert notifications (overrides notifiers.discord of the config file)")
+	fs.StringVar(&o.alertTemplate, "alert-template", "", "text/template for Slack and Discord alert messages")
+	fs.StringVar(&o.dashboardURL, "dashboard-url", "", "link to the Grafana dashboard, included in alert messages")
+	fs.StringVar(&o.smtp, "smtp", "", "SMTP server host:port for alert emails (overrides notifiers.email.smtp of the config file)")
+	fs.StringVar(&o.smtpUser, "smtp-user", "", "SMTP user name (overrides notifiers.email.user of the config file; the password is notifiers.email.password, or $DIYDASHBOARD_SMTP_PASSWORD, or the file in $DIYDASHBOARD_SMTP_PASSWORD_FILE)")
+	fs.StringVar(&o.mailFrom, "mail-from", "", "sender address of alert emails (overrides notifiers.email.from of the config file)")
+	fs.StringVar(&o.mailTo, "mail-to", "", "comma-separated recipients of alert emails (overrides notifiers.email.to of the config file)")
+	fs.DurationVar(&o.mailBatch, "mail-batch", 0, "collect alert events for this long before sending an email (default notifiers.email.batch of the config file, or 1m)")
+	fs.StringVar(&o.grafanaURL, "grafana-url", "", "base URL of Grafana's HTTP API, like http://localhost:3000 (default $DIYDASHBOARD_GRAFANA_URL; the token is read from $DIYDASHBOARD_GRAFANA_TOKEN, or from the file in $DIYDASHBOARD_GRAFANA_TOKEN_FILE)")
+	fs.IntVar(&o.grafanaOrgID, "grafana-org", 0, "Grafana organization ID (default $DIYDASHBOARD_GRAFANA_ORG_ID, or the token's organization)")
+	fs.BoolVar(&o.grafanaAnnotations, "grafana-annotations", false, "also push alert annotations to Grafana's annotations API")
+	fs.BoolVar(&o.provisionDatasource, "provision-datasource", false, "create or update the SimpleJSON datasource in Grafana at startup")
+	fs.StringVar(&o.datasourceURL, "datasource-url", "", "URL of this app as seen from Grafana, for -provision-datasource (default http://localhost:3001, or the port in $GRADA_PORT)")
+	fs.BoolVar(&o.syncDashboard, "sync-dashboard", false, "upload a generated dashboard to Grafana, and update it whenever metrics are added or removed")
+	fs.StringVar(&o.grafanaFolder, "grafana-folder", "", "Grafana folder for -sync-dashboard; created if missing, \"General\" for none (default \"DIY Dashboard\")")
+	fs.BoolVar(&o.grafanaCheck, "grafana-check", false, "check periodically that Grafana can reach the app, and record the result in the \"grafana.connected\" metric")
+	fs.BoolVar(&o.grafanaLive, "grafana-live", false, "publish every new sample to Grafana Live, in the channel \"stream/diydashboard/<metric>\"")
+	fs.BoolVar(&o.grafanaAlerts, "grafana-alerts", false, "also provision the alert rules as Grafana alert rules (needs a datasource that supports alerting)")
+	fs.StringVar(&o.dir, "dir", "", "change to this directory at startup, so that relative paths in the flags resolve against it")
+	fs.StringVar(&o.tz, "timezone", "", "time zone of timestamps in the log, API responses, and alert notifications, like \"Europe/Berlin\" or \"UTC\" (default: the system's local zone); Grafana gets UTC regardless")
+	fs.StringVar(&o.windowsService, "windows-service", "", "run as the Windows service with this name; set by `diydashboard service install`")
+}
+
+// stringList is a flag.Value that collects the values of a repeated flag,
+// as in `-alert "CPU1 > 90" -alert "CPU2 > 90"`.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// splitList splits a comma-separated flag value and drops empty entries.
+func splitList(s string) []string {
+	var l []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
@@ -0,0 +1,121 @@
+package dashboard
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fleetMetrics are the metrics of every simulated host.
+var fleetMetrics = []struct{ name, unit, description string }{
+	{"cpu", "percent", "CPU usage"},
+	{"mem", "percent", "Memory in use"},
+	{"net", "Bps", "Network traffic"},
+}
+
+// addFleetMetrics simulates n hosts named host-01, host-02, and so on.
+// Each host gets the metrics "fleet.<host>.cpu", ".mem", and ".net", and
+// the label host=<host>. The metrics of a host are correlated: they all
+// follow the load of the host. The load of all hosts follows the same
+// daily pattern (one day per time range), plus a random walk per host,
+// so some hosts are busier than others for a while.
+//
+// This is enough to practice templated dashboards: a variable "host" with
+// the query label_values(host) on the API server datasource, and a panel
+// with the target fleet.$host.cpu that repeats for each host.
+func addFleetMetrics(reg *registry, n int) error {
+	type host struct {
+		cpu, mem, net *series
+		bias, load    float64
+		memUsed       float64
+	}
+	hosts := make([]*host, n)
+	for i := range hosts {
+		name := fmt.Sprintf("host-%02d", i+1)
+		h := &host{bias: 0.2 * rand.Float64(), memUsed: 30 + 20*rand.Float64()}
+		for _, fm := range fleetMetrics {
+			s, err := reg.getOrCreate("fleet." + name + "." + fm.name)
+			if err != nil {
+				return err
+			}
+			s.describe(fm.unit, fm.description+" of "+name).label("host", name)
+			switch fm.name {
+			case "cpu":
+				h.cpu = s
+			case "mem":
+				h.mem = s
+			case "net":
+				h.net = s
+			}
+		}
+		hosts[i] = h
+	}
+
+	day := reg.timeRange.Seconds()
+	start := reg.clock.Now()
+	reg.every(time.Second, func(now time.Time) {
+		t := now.Sub(start).Seconds()
+		daily := 0.35 + 0.25*math.Sin(2*math.Pi*t/day)
+		for _, h := range hosts {
+			h.load += 0.05*(rand.Float64()-0.5) - 0.02*h.load
+			load := math.Min(1, math.Max(0.02, daily+h.bias+h.load))
+			// Memory follows the load slowly, network traffic right away.
+			h.memUsed += (30 + 60*load - h.memUsed) * 0.02
+			h.cpu.Add(100*load + 3*(rand.Float64()-0.5))
+			h.mem.Add(h.memUsed)
+			h.net.Add(math.Max(0, load*50e6*(1+0.2*(rand.Float64()-0.5))))
+		}
+	})
+	return nil
+}
+
+// labelValuesQuery matches template variable queries like "label_values(host)".
+var labelValuesQuery = regexp.MustCompile(`^label_values\(\s*(\w+)\s*\)$`)
+
+// serveSearch answers the /search requests of Grafana's SimpleJSON
+// datasource, which Grafana sends for template variable queries:
+// "label_values(host)" returns the values of the label host, sorted and
+// without duplicates. Any other target returns the names of the metrics
+// that start with it.
+func serveSearch(reg *registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Target string `json:"target"`
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+		writeJSON(w, http.StatusOK, searchSeries(reg.list(), req.Target))
+	}
+}
+
+// searchSeries answers a /search target from list.
+func searchSeries(list []*series, target string) []string {
+	result := []string{}
+	if m := labelValuesQuery.FindStringSubmatch(strings.TrimSpace(target)); m != nil {
+		seen := map[string]bool{}
+		for _, s := range list {
+			if v := s.labelValue(m[1]); v != "" && !seen[v] {
+				seen[v] = true
+				result = append(result, v)
+			}
+		}
+		sort.Strings(result)
+		return result
+	}
+	for _, s := range list {
+		if strings.HasPrefix(s.name, target) {
+			result = append(result, s.name)
+		}
+	}
+	return result
+}
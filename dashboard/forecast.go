@@ -0,0 +1,137 @@
+package dashboard
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trend fits a straight line through the most recent samples of a series
+// (ordinary least squares over time), to extrapolate where the series is
+// heading.
+type trend struct {
+	mu     sync.Mutex
+	times  []time.Time
+	values []float64
+	next   int
+	n      int
+}
+
+func newTrend(size int) *trend {
+	return &trend{times: make([]time.Time, size), values: make([]float64, size)}
+}
+
+// add adds a sample to the window of recent samples.
+func (tr *trend) add(v float64, t time.Time) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.times[tr.next], tr.values[tr.next] = t, v
+	tr.next = (tr.next + 1) % len(tr.values)
+	if tr.n < len(tr.values) {
+		tr.n++
+	}
+}
+
+// fit returns the slope (per second) and the value of the fitted line at
+// time t. ok is false if there are not enough samples for a fit.
+func (tr *trend) fit(t time.Time) (slope, value float64, ok bool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.n < 2 {
+		return 0, 0, false
+	}
+	// Use seconds relative to t as x values, to keep the numbers small.
+	var sx, sy, sxx, sxy float64
+	for i := 0; i < tr.n; i++ {
+		x := tr.times[i].Sub(t).Seconds()
+		y := tr.values[i]
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	n := float64(tr.n)
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0, 0, false
+	}
+	slope = (n*sxy - sx*sy) / d
+	value = (sy - slope*sx) / n // the intercept, which is the value at x = 0, i.e., at t
+	return slope, value, true
+}
+
+// forecastSpec is what the -forecast flag describes: a metric, and
+// optionally a threshold for the time-to-threshold series, as in
+// "disk.used_pct:95".
+type forecastSpec struct {
+	metric    string
+	threshold *float64
+}
+
+func parseForecastSpec(s string) (forecastSpec, error) {
+	var f forecastSpec
+	f.metric = s
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		t, err := strconv.ParseFloat(s[i+1:], 64)
+		if err != nil {
+			return f, fmt.Errorf("forecast %q: invalid threshold: %s", s, err)
+		}
+		f.metric, f.threshold = s[:i], &t
+	}
+	if f.metric == "" {
+		return f, fmt.Errorf("forecast %q: missing metric name", s)
+	}
+	return f, nil
+}
+
+// addForecastSeries extrapolates the trend of the last `window` samples of
+// src and creates these series:
+//
+// "<name>.forecast" receives, for every new sample, the value that the trend
+// predicts for `horizon` from now, stamped with that future time. Plotted
+// next to the actual series, on a panel whose time range reaches into the
+// future (like "now-6h to now+1h"), it shows where the series is heading.
+//
+// "<name>.forecast_eta" (only if spec has a threshold) receives the number
+// of seconds until the trend reaches the threshold — "disk full in 6 days"
+// — which suits a Singlestat panel. It is -1 if the trend does not head
+// towards the threshold.
+func addForecastSeries(reg *registry, src *series, spec forecastSpec, window int, horizon time.Duration) error {
+	if window < 2 {
+		return fmt.Errorf("forecast for %s: window must have at least 2 samples", src.name)
+	}
+	fc, err := reg.getOrCreate(src.name + ".forecast")
+	if err != nil {
+		return err
+	}
+	unit, _ := src.meta()
+	fc.describe(unit, fmt.Sprintf("Value of %s in %s, if the trend continues", src.name, horizon))
+	var eta *series
+	if spec.threshold != nil {
+		if eta, err = reg.getOrCreate(src.name + ".forecast_eta"); err != nil {
+			return err
+		}
+		eta.describe("s", fmt.Sprintf("Time until %s reaches %g, if the trend continues (-1: never)", src.name, *spec.threshold))
+	}
+	tr := newTrend(window)
+	src.observe(func(v float64, t time.Time) {
+		tr.add(v, t)
+		slope, now, ok := tr.fit(t)
+		if !ok {
+			return
+		}
+		at := t.Add(horizon)
+		fc.storeStamped(now+slope*horizon.Seconds(), at, wallTime(reg.clock, at))
+		if eta == nil {
+			return
+		}
+		secs := -1.0
+		if dist := *spec.threshold - now; slope != 0 && dist/slope >= 0 {
+			secs = dist / slope
+		}
+		eta.Add(secs)
+	})
+	return nil
+}
@@ -0,0 +1,249 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+// The golden files pin the wire format of /search, /query, /annotations,
+// and /api/dashboard for fixed inputs on a manual clock. Responses are
+// compared as JSON values, so formatting does not matter. After an
+// intended change, rewrite the files with
+//
+//	go test -run Golden ./dashboard -update
+//
+// and review the diff before committing them.
+
+var updateGolden = flag.Bool("update", false, "write the current responses to the golden files")
+
+// goldenDir holds the expected responses.
+const goldenDir = "testdata/golden"
+
+var (
+	gradaOnce sync.Once
+	gradaDash *grada.Dashboard
+	gradaErr  error
+)
+
+// testDashboard returns grada's dashboard, whose server runs in-process,
+// for the tests and benchmarks. It skips tb if grada's port is taken, as
+// by a running app.
+func testDashboard(tb testing.TB) *grada.Dashboard {
+	gradaOnce.Do(func() {
+		l, err := net.Listen("tcp", ":"+strconv.Itoa(gradaPort()))
+		if err != nil {
+			gradaErr = err
+			return
+		}
+		l.Close()
+		gradaDash = grada.GetDashboard()
+		// Give grada's server a moment to start.
+		time.Sleep(100 * time.Millisecond)
+	})
+	if gradaErr != nil {
+		tb.Skipf("port %d is taken; is the app running? %s", gradaPort(), gradaErr)
+	}
+	return gradaDash
+}
+
+var testRuns int32
+
+// uniqueName returns base with a number that differs for every call, for
+// metrics on grada's dashboard, which outlives a test run with -count.
+func uniqueName(base string) string {
+	return base + strconv.Itoa(int(atomic.AddInt32(&testRuns, 1)))
+}
+
+// A goldenCase is one request with fixed input, whose response gets
+// compared to the file goldenDir/<name>.json.
+type goldenCase struct {
+	name string
+	// run returns the response body.
+	run func() ([]byte, error)
+	// normalize removes what legitimately differs between runs, and
+	// returns the result.
+	normalize func(v interface{}) interface{}
+}
+
+// goldenCases sets up fixed metrics and annotations on a manual clock and
+// returns the requests to check.
+//
+// grada's dashboard outlives a test run with -count, and other tests
+// leave their metrics on it, too. So the metrics get a prefix of their
+// own for every run, which the responses show as "golden", and /search
+// lists only them.
+func goldenCases(t *testing.T, reg *registry, clk *manualClock) []goldenCase {
+	prefix := uniqueName("golden")
+	// The samples are 10 seconds apart, starting at the clock's time; the
+	// query below asks for 12:00:05 to 12:00:25 only. golden.c has no
+	// samples in that range.
+	start := clk.Now()
+	for _, m := range []struct {
+		name    string
+		offsets []int // seconds after start
+		values  []float64
+	}{
+		{prefix + ".a", []int{0, 10, 20}, []float64{1, 2, 3}},
+		{prefix + ".b", []int{0, 10, 30}, []float64{10, 20.5, 30}},
+		{prefix + ".c", []int{40}, []float64{-1}},
+	} {
+		gm, err := reg.dash.CreateMetricWithBufSize(m.name, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := reg.register(m.name, gm, 10)
+		for i, v := range m.values {
+			at := start.Add(time.Duration(m.offsets[i]) * time.Second)
+			s.storeStamped(v, at, at)
+		}
+	}
+	if s, ok := reg.get(prefix + ".a"); ok {
+		s.describe("percent", "A metric with three samples")
+	}
+
+	notes := newAnnotationStore()
+	notes.add(annotation{Time: clk.Now(), Title: "Deployed v1.2", Tags: []string{"deploy"}})
+	clk.Advance(time.Minute)
+	from := clk.Now()
+	clk.Advance(5 * time.Minute)
+	notes.add(annotation{Time: from, TimeEnd: clk.Now(), Title: "Maintenance", Text: "Silenced", Tags: []string{"silence", prefix + ".a"}})
+
+	// The requests name the metrics "golden", too; the responses get the
+	// prefix replaced back.
+	renamed := func(b []byte) []byte {
+		return bytes.ReplaceAll(b, []byte(`"`+prefix+`.`), []byte(`"golden.`))
+	}
+	local := func(h http.HandlerFunc, method, path, body string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				return nil, fmt.Errorf("%s %s: %d %s", method, path, rec.Code, bytes.TrimSpace(rec.Body.Bytes()))
+			}
+			return renamed(rec.Body.Bytes()), nil
+		}
+	}
+	gradaPost := func(path, body string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			body = strings.ReplaceAll(body, `"golden.`, `"`+prefix+`.`)
+			resp, err := http.Post(gradaAddr()+path, "application/json", strings.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			b, err := ioutil.ReadAll(resp.Body)
+			if err == nil && resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("POST %s: %s", path, resp.Status)
+			}
+			return renamed(b), err
+		}
+	}
+	wideRange := `"range":{"from":"2000-01-01T00:00:00Z","to":"2100-01-01T00:00:00Z"}`
+	queryRange := `"range":{"from":"2021-01-01T12:00:05Z","to":"2021-01-01T12:00:25Z"}`
+
+	return []goldenCase{
+		{
+			name: "search",
+			run:  gradaPost("/search", `{"target":""}`),
+			normalize: func(v interface{}) interface{} {
+				// Only the test's own metrics count, and their order is
+				// not part of the protocol.
+				l, _ := v.([]interface{})
+				own := []interface{}{}
+				for _, name := range l {
+					if s, ok := name.(string); ok && strings.HasPrefix(s, "golden.") {
+						own = append(own, s)
+					}
+				}
+				sort.Slice(own, func(i, j int) bool { return fmt.Sprint(own[i]) < fmt.Sprint(own[j]) })
+				return own
+			},
+		},
+		{
+			name: "query",
+			run:  gradaPost("/query", `{`+queryRange+`,"targets":[{"target":"golden.a","refId":"A","type":"timeserie"},{"target":"golden.b","refId":"B","type":"timeserie"},{"target":"golden.c","refId":"C","type":"timeserie"}],"maxDataPoints":100}`),
+		},
+		{
+			name: "annotations",
+			run:  local(notes.serveHTTP, http.MethodPost, "/annotations", `{`+wideRange+`,"annotation":{"name":"diydashboard","enable":true}}`),
+		},
+		{
+			name: "dashboard",
+			run:  local(serveDashboard(reg, "diydashboard"), http.MethodGet, "/api/dashboard", ""),
+		},
+	}
+}
+
+func TestGolden(t *testing.T) {
+	clk := newManualClock(time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC))
+	reg := newRegistry(testDashboard(t))
+	reg.clock = clk
+	for _, c := range goldenCases(t, reg, clk) {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.check(goldenDir, *updateGolden); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// check runs the case and compares the normalized response with the
+// golden file, or writes the golden file if update is true.
+func (c goldenCase) check(dir string, update bool) error {
+	body, err := c.run()
+	if err != nil {
+		return err
+	}
+	var got interface{}
+	if err := json.Unmarshal(body, &got); err != nil {
+		return fmt.Errorf("invalid JSON: %s", err)
+	}
+	if c.normalize != nil {
+		got = c.normalize(got)
+	}
+	var pretty bytes.Buffer
+	enc := json.NewEncoder(&pretty)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(got); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, c.name+".json")
+	if update {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, pretty.Bytes(), 0644)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var want interface{}
+	if err := json.Unmarshal(b, &want); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("response differs from %s; if the change is intended, run the test with -update:\n%s", path, pretty.Bytes())
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// grafanaError is an error response from Grafana's HTTP API.
+type grafanaError struct {
+	method, path string
+	status       int
+	msg          string
+}
+
+func (e *grafanaError) Error() string {
+	return fmt.Sprintf("grafana %s %s: %d %s: %s", e.method, e.path, e.status, http.StatusText(e.status), e.msg)
+}
+
+// isNotFound reports whether err is a 404 response from Grafana.
+func isNotFound(err error) bool {
+	ge, ok := err.(*grafanaError)
+	return ok && ge.status == http.StatusNotFound
+}
+
+// grafanaClient talks to Grafana's HTTP API.
+type grafanaClient struct {
+	url    string // base URL, like "http://localhost:3000"
+	token  string // service account token or API key, sent as bearer token
+	orgID  int    // 0 = the token's default organization
+	client *http.Client
+}
+
+func newGrafanaClient(baseURL, token string, orgID int) *grafanaClient {
+	return &grafanaClient{
+		url:    strings.TrimSuffix(baseURL, "/"),
+		token:  token,
+		orgID:  orgID,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// do sends a request with a JSON body (if in is not nil) and decodes the
+// JSON response into out (if out is not nil).
+func (g *grafanaClient) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	return g.send(method, path, "application/json", body, out)
+}
+
+// send sends a request with a body of the given content type and decodes
+// the JSON response into out (if out is not nil).
+func (g *grafanaClient) send(method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, g.url+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+	if g.orgID != 0 {
+		req.Header.Set("X-Grafana-Org-Id", strconv.Itoa(g.orgID))
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return &grafanaError{method: method, path: path, status: resp.StatusCode, msg: string(bytes.TrimSpace(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// grafanaAnnotation is the body of POST /api/annotations. Without a
+// dashboard ID, the annotation is an organization-wide annotation that
+// dashboards can show through the built-in "Annotations & Alerts" query.
+type grafanaAnnotation struct {
+	Time    int64    `json:"time"`
+	TimeEnd int64    `json:"timeEnd,omitempty"`
+	Tags    []string `json:"tags"`
+	Text    string   `json:"text"`
+}
+
+// postAnnotation creates an annotation in Grafana.
+func (g *grafanaClient) postAnnotation(a annotation) error {
+	ga := grafanaAnnotation{
+		Time: a.Time.UnixNano() / int64(time.Millisecond),
+		Tags: a.Tags,
+		Text: a.Title,
+	}
+	if a.Text != "" {
+		ga.Text += "\n" + a.Text
+	}
+	if !a.TimeEnd.IsZero() {
+		ga.TimeEnd = a.TimeEnd.UnixNano() / int64(time.Millisecond)
+	}
+	return g.do(http.MethodPost, "/api/annotations", ga, nil)
+}
+
+// Annotate marks the current time on all dashboards with an annotation,
+// like "Deployed v1.2" with the tag "deploy". Dashboards show these through
+// the built-in "Annotations & Alerts" query.
+func (g *grafanaClient) Annotate(text string, tags ...string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	return g.postAnnotation(annotation{Time: time.Now(), Title: text, Tags: tags})
+}
+
+// simpleJSONType is the plugin ID of the SimpleJSON datasource.
+const simpleJSONType = "grafana-simple-json-datasource"
+
+// grafanaDatasource is the subset of Grafana's datasource model that we
+// need for provisioning.
+type grafanaDatasource struct {
+	ID        int    `json:"id,omitempty"`
+	UID       string `json:"uid,omitempty"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	Access    string `json:"access"`
+	IsDefault bool   `json:"isDefault"`
+}
+
+// provisionDatasource creates a SimpleJSON datasource with the given name
+// that points to dsURL, which must be the address of this app as seen from
+// the Grafana server. If the datasource exists already, it gets updated.
+func (g *grafanaClient) provisionDatasource(name, dsURL string, isDefault bool) error {
+	ds := grafanaDatasource{
+		Name:      name,
+		Type:      simpleJSONType,
+		URL:       dsURL,
+		Access:    "proxy", // Grafana's backend, not the browser, talks to us
+		IsDefault: isDefault,
+	}
+	var existing grafanaDatasource
+	err := g.do(http.MethodGet, "/api/datasources/name/"+url.PathEscape(name), nil, &existing)
+	switch {
+	case isNotFound(err):
+		return g.do(http.MethodPost, "/api/datasources", ds, nil)
+	case err != nil:
+		return err
+	}
+	ds.ID, ds.UID = existing.ID, existing.UID
+	return g.do(http.MethodPut, fmt.Sprintf("/api/datasources/%d", existing.ID), ds, nil)
+}
+
+// dashboardUpload is the body of POST /api/dashboards/db.
+type dashboardUpload struct {
+	Dashboard dashboardJSON `json:"dashboard"`
+	FolderUID string        `json:"folderUid,omitempty"`
+	Overwrite bool          `json:"overwrite"`
+	Message   string        `json:"message,omitempty"`
+}
+
+// uploadDashboard creates the dashboard in Grafana, or replaces the
+// dashboard with the same UID. An empty folderUID puts the dashboard into
+// the General folder.
+func (g *grafanaClient) uploadDashboard(d dashboardJSON, folderUID, message string) error {
+	return g.do(http.MethodPost, "/api/dashboards/db", dashboardUpload{Dashboard: d, FolderUID: folderUID, Overwrite: true, Message: message}, nil)
+}
+
+// grafanaFolder is the subset of Grafana's folder model that we need.
+type grafanaFolder struct {
+	UID   string `json:"uid,omitempty"`
+	Title string `json:"title"`
+}
+
+// ensureFolder returns the UID of the folder with the given title, and
+// creates the folder if it does not exist. "General" is Grafana's root
+// folder, which has no UID.
+func (g *grafanaClient) ensureFolder(title string) (string, error) {
+	if title == "" || strings.EqualFold(title, "General") {
+		return "", nil
+	}
+	var folders []grafanaFolder
+	if err := g.do(http.MethodGet, "/api/folders", nil, &folders); err != nil {
+		return "", err
+	}
+	for _, f := range folders {
+		if f.Title == title {
+			return f.UID, nil
+		}
+	}
+	var created grafanaFolder
+	if err := g.do(http.MethodPost, "/api/folders", grafanaFolder{Title: title}, &created); err != nil {
+		return "", err
+	}
+	return created.UID, nil
+}
+
+// checkDatasource asks Grafana to send a request through the datasource
+// proxy to the app, the same way the "Save & Test" button does. It fails
+// if Grafana cannot reach the app under the datasource URL.
+func (g *grafanaClient) checkDatasource(name string) error {
+	var ds grafanaDatasource
+	if err := g.do(http.MethodGet, "/api/datasources/name/"+url.PathEscape(name), nil, &ds); err != nil {
+		return fmt.Errorf("cannot look up the datasource in Grafana: %s", err)
+	}
+	if err := g.do(http.MethodGet, fmt.Sprintf("/api/datasources/proxy/%d/", ds.ID), nil, nil); err != nil {
+		return fmt.Errorf("Grafana cannot reach the app at %s: %s", ds.URL, err)
+	}
+	return nil
+}
+
+// getDashboard fetches the JSON model of the dashboard with the given UID.
+func (g *grafanaClient) getDashboard(uid string) (map[string]interface{}, error) {
+	var resp struct {
+		Dashboard map[string]interface{} `json:"dashboard"`
+	}
+	if err := g.do(http.MethodGet, "/api/dashboards/uid/"+url.PathEscape(uid), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Dashboard == nil {
+		return nil, fmt.Errorf("grafana: no dashboard in the response for UID %q", uid)
+	}
+	return resp.Dashboard, nil
+}
+
+// pushLive publishes samples in InfluxDB line protocol to Grafana Live.
+// Each measurement in lines ends up in the channel
+// "stream/<streamID>/<measurement>".
+func (g *grafanaClient) pushLive(streamID string, lines []byte) error {
+	return g.send(http.MethodPost, "/api/live/push/"+url.PathEscape(streamID), "text/plain", bytes.NewReader(lines), nil)
+}
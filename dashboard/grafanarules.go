@@ -0,0 +1,194 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Alert rules that the app pushes to Grafana's unified alerting all live
+// in this rule group, so that the app can tell its own rules from the
+// rules that users created in Grafana.
+const grafanaRuleGroup = "diydashboard"
+
+// grafanaRule is the subset of Grafana's provisioned alert rule model that
+// we need. See /api/v1/provisioning/alert-rules in the Grafana docs.
+type grafanaRule struct {
+	UID          string            `json:"uid"`
+	Title        string            `json:"title"`
+	RuleGroup    string            `json:"ruleGroup"`
+	FolderUID    string            `json:"folderUID"`
+	Condition    string            `json:"condition"`
+	Data         []grafanaQuery    `json:"data"`
+	NoDataState  string            `json:"noDataState"`
+	ExecErrState string            `json:"execErrState"`
+	For          string            `json:"for"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type grafanaQuery struct {
+	RefID             string                 `json:"refId"`
+	DatasourceUID     string                 `json:"datasourceUid"`
+	RelativeTimeRange *relativeTimeRange     `json:"relativeTimeRange,omitempty"`
+	Model             map[string]interface{} `json:"model"`
+}
+
+type relativeTimeRange struct {
+	From int `json:"from"` // seconds before now
+	To   int `json:"to"`
+}
+
+// grafanaExpr is the datasource UID of Grafana's server-side expressions.
+const grafanaExpr = "__expr__"
+
+// grafanaRuleFor translates a local alert rule into a Grafana rule with
+// three steps: A queries the metric through the datasource, B reduces the
+// series to its last value, and C compares that value to the threshold.
+//
+// Grafana's threshold expression knows only "greater than" and "less
+// than", so ">=" and "<=" become ">" and "<". Clear thresholds have no
+// equivalent and are left out. Dead man's switch rules cannot be
+// translated.
+func grafanaRuleFor(r alertRule, datasourceUID, folderUID string) (grafanaRule, error) {
+	evaluator := map[string]string{">": "gt", ">=": "gt", "<": "lt", "<=": "lt"}[r.Op]
+	if evaluator == "" {
+		return grafanaRule{}, fmt.Errorf("alert rule %q: %s rules cannot be translated to Grafana rules", r.id(), r.Op)
+	}
+	expr := map[string]interface{}{"type": grafanaExpr, "uid": grafanaExpr}
+	return grafanaRule{
+		UID:       grafanaRuleUID(r),
+		Title:     r.id(),
+		RuleGroup: grafanaRuleGroup,
+		FolderUID: folderUID,
+		Condition: "C",
+		Data: []grafanaQuery{
+			{
+				RefID:             "A",
+				DatasourceUID:     datasourceUID,
+				RelativeTimeRange: &relativeTimeRange{From: 600},
+				Model:             map[string]interface{}{"refId": "A", "target": r.series(), "type": "timeserie"},
+			},
+			{
+				RefID:         "B",
+				DatasourceUID: grafanaExpr,
+				Model:         map[string]interface{}{"refId": "B", "type": "reduce", "expression": "A", "reducer": "last", "datasource": expr},
+			},
+			{
+				RefID:         "C",
+				DatasourceUID: grafanaExpr,
+				Model: map[string]interface{}{
+					"refId":      "C",
+					"type":       "threshold",
+					"expression": "B",
+					"datasource": expr,
+					"conditions": []interface{}{
+						map[string]interface{}{"evaluator": map[string]interface{}{"type": evaluator, "params": []float64{r.Threshold}}},
+					},
+				},
+			},
+		},
+		NoDataState:  "NoData",
+		ExecErrState: "Error",
+		For:          fmt.Sprintf("%ds", int(r.For/time.Second)),
+		Labels:       map[string]string{"source": "diydashboard", "metric": r.Metric},
+		Annotations:  map[string]string{"summary": r.String()},
+	}, nil
+}
+
+// grafanaRuleUID derives a stable UID from the rule, so that the same rule
+// updates the same Grafana rule across restarts. Grafana allows at most 40
+// letters, digits, dashes, and underscores.
+func grafanaRuleUID(r alertRule) string {
+	b := []byte("dd-" + r.id())
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-':
+		default:
+			b[i] = '_'
+		}
+	}
+	if len(b) > 40 {
+		b = b[:40]
+	}
+	return string(b)
+}
+
+// provisionAlertRules makes the rules in Grafana's rule group
+// "diydashboard" match the given local rules: it creates or updates a
+// Grafana rule for each local rule, and deletes the rules that have no
+// local counterpart anymore.
+func (g *grafanaClient) provisionAlertRules(rules []alertRule, datasource, folder string) error {
+	var ds grafanaDatasource
+	if err := g.do(http.MethodGet, "/api/datasources/name/"+url.PathEscape(datasource), nil, &ds); err != nil {
+		return fmt.Errorf("cannot look up the datasource in Grafana: %s", err)
+	}
+	folderUID, err := g.ensureFolder(folder)
+	if err != nil {
+		return err
+	}
+	if folderUID == "" {
+		return fmt.Errorf("Grafana alert rules need a folder other than General")
+	}
+	keep := map[string]bool{}
+	for _, r := range rules {
+		gr, err := grafanaRuleFor(r, ds.UID, folderUID)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		keep[gr.UID] = true
+		err = g.do(http.MethodPut, "/api/v1/provisioning/alert-rules/"+gr.UID, gr, nil)
+		if isNotFound(err) {
+			err = g.do(http.MethodPost, "/api/v1/provisioning/alert-rules", gr, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var existing []grafanaRule
+	if err := g.do(http.MethodGet, "/api/v1/provisioning/alert-rules", nil, &existing); err != nil {
+		return err
+	}
+	for _, gr := range existing {
+		if gr.RuleGroup != grafanaRuleGroup || gr.FolderUID != folderUID || keep[gr.UID] {
+			continue
+		}
+		if err := g.do(http.MethodDelete, "/api/v1/provisioning/alert-rules/"+gr.UID, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grafanaRuleSync returns a function that pushes a set of local alert
+// rules to Grafana in the background, until grp stops. If the rules change
+// again while a push is in progress, only the latest set gets pushed next.
+func grafanaRuleSync(g *grafanaClient, datasource, folder string, grp *group) func([]alertRule) {
+	pending := make(chan []alertRule, 1)
+	grp.Go(func(ctx context.Context) error {
+		for {
+			var rules []alertRule
+			select {
+			case rules = <-pending:
+			case <-ctx.Done():
+				return nil
+			}
+			if err := g.provisionAlertRules(rules, datasource, folder); err != nil {
+				log.Println("grafana alert rules:", err)
+				continue
+			}
+			log.Println("alert rules provisioned in Grafana")
+		}
+	})
+	return func(rules []alertRule) {
+		select {
+		case <-pending:
+		default:
+		}
+		pending <- rules
+	}
+}
@@ -0,0 +1,64 @@
+package dashboard
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Intervals of the Grafana connectivity check. After a failure, the check
+// retries quickly and then backs off, doubling the delay up to
+// healthMaxBackoff.
+const (
+	healthInterval   = time.Minute
+	healthMinBackoff = 5 * time.Second
+	healthMaxBackoff = 5 * time.Minute
+)
+
+// watchGrafana checks periodically whether Grafana can reach the app
+// through the datasource, and records the result in the series
+// "grafana.connected" (1 = ok, 0 = failed).
+//
+// "Grafana cannot connect to the app" is the most common problem when
+// setting up the dashboard, usually because the datasource URL is not
+// reachable from within the Grafana container. The check logs a hint when
+// it fails for the first time.
+func watchGrafana(g *grafanaClient, reg *registry, datasource string) error {
+	status, err := reg.getOrCreate("grafana.connected")
+	if err != nil {
+		return err
+	}
+	status.describe("bool", "Whether Grafana can reach this app through the datasource "+datasource)
+	reg.group.Go(func(ctx context.Context) error {
+		backoff := healthMinBackoff
+		ok := true
+		for {
+			wait := healthInterval
+			if err := g.checkDatasource(datasource); err == nil {
+				if !ok {
+					log.Printf("Grafana reaches the app through datasource %q again", datasource)
+				}
+				ok = true
+				status.Add(1)
+				backoff = healthMinBackoff
+			} else {
+				status.Add(0)
+				if ok {
+					log.Println("Grafana check failed:", err)
+					log.Println("Hint: if Grafana runs in Docker, the datasource URL must be reachable from inside the container (see -datasource-url)")
+				}
+				ok = false
+				wait = backoff
+				if backoff *= 2; backoff > healthMaxBackoff {
+					backoff = healthMaxBackoff
+				}
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,282 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Data from before the app, like the power readings of a year that live
+// in a spreadsheet, goes in with `diydashboard import`. The command reads
+// a CSV file with a timestamp and a value per line, and sends the points
+// to /api/import of the running app, which backfills them into a new
+// metric. The app keeps its metrics in memory only, so the import lasts
+// until the app restarts; to have the history at every start, run the
+// import from the same script or unit that starts the app.
+
+// timeLayouts are the timestamp formats of CSV files, besides Unix
+// seconds and milliseconds.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTimestamp parses a timestamp of a CSV file. Timestamps without a
+// zone are in loc.
+func parseTimestamp(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > 1e11 {
+			return time.Unix(0, n*int64(time.Millisecond)), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// readCSVPoints reads the points of a CSV file: the timestamp in the first
+// column and the value in the column col, a 1-based number or the name
+// in the header. The fields are separated by commas, or by semicolons, as
+// spreadsheets in many European locales write them; then the values may
+// have a decimal comma. Lines without a value are skipped. The points come
+// sorted by time.
+func readCSVPoints(r io.Reader, col string, loc *time.Location) ([]datapoint, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(bytes.NewReader(b))
+	firstLine := b
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		firstLine = b[:i]
+	}
+	semicolons := bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(","))
+	if semicolons {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no lines")
+	}
+	index, err := strconv.Atoi(col)
+	if err == nil {
+		index--
+	}
+	// A first line whose first field is no timestamp is the header.
+	if _, terr := parseTimestamp(records[0][0], loc); terr != nil {
+		if err != nil {
+			index = -1
+			for i, name := range records[0] {
+				if strings.TrimSpace(name) == col {
+					index = i
+				}
+			}
+		}
+		records = records[1:]
+	}
+	if index < 1 {
+		return nil, fmt.Errorf("-column %q: want the number (2 or more) or the header of the column with the values", col)
+	}
+	var points []datapoint
+	for i, rec := range records {
+		if index >= len(rec) || strings.TrimSpace(rec[index]) == "" {
+			continue
+		}
+		t, err := parseTimestamp(rec[0], loc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+		s := strings.TrimSpace(rec[index])
+		if semicolons {
+			s = strings.Replace(s, ",", ".", 1)
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value %q", i+1, rec[index])
+		}
+		points = append(points, datapoint{v, float64(t.UnixNano() / int64(time.Millisecond))})
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i][1] < points[j][1] })
+	return points, nil
+}
+
+// importRequest is the body of /api/import. The points are [value,
+// Unix milliseconds], like those of a /query response.
+type importRequest struct {
+	Metric      string      `json:"metric"`
+	Unit        string      `json:"unit,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Points      []datapoint `json:"points"`
+}
+
+// importCommand is `diydashboard import`.
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	api := fs.String("api", "localhost:3002", "address of the app's API server")
+	metric := fs.String("metric", "", "name of the metric to import into; it must not have any data yet")
+	file := fs.String("file", "", "CSV file with a timestamp and a value per line, like \"2026-03-01 12:00,412.5\"; \"-\" for stdin")
+	column := fs.String("column", "2", "column with the values: its number, or its name in the header line")
+	tz := fs.String("timezone", "Local", "time zone of the timestamps without one, like \"Europe/Berlin\"")
+	unit := fs.String("unit", "", "unit of the metric, like \"watt\", for generated dashboards")
+	fs.Parse(args)
+	if *metric == "" || *file == "" {
+		fmt.Fprintln(fs.Output(), "Usage: diydashboard import -metric <name> -file <csv file> [flags]")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		return fmt.Errorf("-timezone: %s", err)
+	}
+	in := os.Stdin
+	if *file != "-" {
+		if in, err = os.Open(*file); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+	points, err := readCSVPoints(in, *column, loc)
+	if err != nil {
+		return fmt.Errorf("%s: %s", *file, err)
+	}
+	if len(points) == 0 {
+		return fmt.Errorf("%s: no points", *file)
+	}
+	body, err := json.Marshal(importRequest{Metric: *metric, Unit: *unit, Description: "Imported from " + *file, Points: points})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Post(baseURL(*api)+"/api/import", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("is the app running? %s", err)
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST /api/import: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	first, last := time.Unix(0, int64(points[0][1])*int64(time.Millisecond)), time.Unix(0, int64(points[len(points)-1][1])*int64(time.Millisecond))
+	fmt.Printf("imported %d points into %s, from %s to %s\n", len(points), *metric, first.In(loc).Format(time.RFC3339), last.In(loc).Format(time.RFC3339))
+	return nil
+}
+
+// errHasData is the error of importPoints for a metric with data.
+var errHasData = errors.New("the metric has data already; import into a new one")
+
+// importPoints creates the metric name with a buffer for the points, from
+// the first one until now, plus the registry's time range for the samples
+// to come, and backfills the points. The points must be sorted and in the
+// past.
+func importPoints(reg *registry, name string, points []datapoint) (*series, error) {
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no points")
+	}
+	now := reg.clock.Now()
+	first := time.Unix(0, int64(points[0][1])*int64(time.Millisecond))
+	diffs := make([]float64, 0, len(points))
+	for i, p := range points {
+		if math.IsNaN(p[0]) || math.IsInf(p[0], 0) {
+			return nil, fmt.Errorf("point %d: invalid value", i)
+		}
+		if i > 0 {
+			if p[1] < points[i-1][1] {
+				return nil, fmt.Errorf("point %d: the points must be sorted by time", i)
+			}
+			diffs = append(diffs, p[1]-points[i-1][1])
+		}
+	}
+	if last := points[len(points)-1][1]; last > float64(now.UnixNano()/int64(time.Millisecond)) {
+		return nil, fmt.Errorf("the points must be in the past")
+	}
+	// The interval is the typical spacing of the points, but short enough
+	// that all points fit.
+	span := now.Sub(first)
+	interval := defaultInterval
+	if len(diffs) > 0 {
+		sort.Float64s(diffs)
+		interval = time.Duration(diffs[len(diffs)/2]) * time.Millisecond
+	}
+	if max := span / time.Duration(len(points)); interval > max {
+		interval = max
+	}
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	if s, ok := reg.get(name); ok {
+		s.mu.Lock()
+		n := s.count
+		s.mu.Unlock()
+		if n > 0 {
+			return nil, errHasData
+		}
+	}
+	s, err := reg.getOrCreateWith(name, span+reg.timeRange, interval)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range points {
+		s.backfill(p[0], time.Unix(0, int64(p[1])*int64(time.Millisecond)))
+	}
+	return s, nil
+}
+
+// serveImport handles POST /api/import, the backfilling of a new metric
+// with an importRequest.
+func serveImport(reg *registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		var req importRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.Metric == "" || isExpr(req.Metric) {
+			http.Error(w, fmt.Sprintf("invalid metric name %q", req.Metric), http.StatusBadRequest)
+			return
+		}
+		s, err := importPoints(reg, req.Metric, req.Points)
+		if err == errHasData {
+			http.Error(w, fmt.Sprintf("metric %s: %s", req.Metric, err), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("metric %s: %s", req.Metric, err), http.StatusBadRequest)
+			return
+		}
+		if req.Unit != "" || req.Description != "" {
+			s.describe(req.Unit, req.Description)
+		}
+		log.Printf("metric %s: imported %d points", req.Metric, len(req.Points))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"metric": req.Metric, "points": len(req.Points)})
+	}
+}
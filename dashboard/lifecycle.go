@@ -0,0 +1,115 @@
+package dashboard
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout is how long the HTTP servers may take to finish the
+// requests in flight when the app stops.
+const shutdownTimeout = 5 * time.Second
+
+// A group runs the background work of the app: servers, generators,
+// collectors, and periodic jobs. Like golang.org/x/sync/errgroup (but
+// without the dependency), the first error cancels the group's context,
+// so that everything else stops, too, and Wait reports that error once.
+type group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	once sync.Once
+	err  error
+}
+
+func newGroup() *group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &group{ctx: ctx, cancel: cancel}
+}
+
+// Go runs f in a goroutine. f must return when ctx is done. If f returns
+// an error, the group stops.
+func (g *group) Go(f func(ctx context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := f(g.ctx); err != nil {
+			g.stop(err)
+		}
+	}()
+}
+
+// stop cancels the group. The first error wins; nil means a regular
+// shutdown.
+func (g *group) stop(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+// Wait blocks until the group stops and all goroutines have returned, and
+// returns the error that stopped the group.
+func (g *group) Wait() error {
+	<-g.ctx.Done()
+	g.wg.Wait()
+	return g.err
+}
+
+// stopOnSignal stops the group on Ctrl-C or SIGTERM.
+func (g *group) stopOnSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	g.Go(func(ctx context.Context) error {
+		defer signal.Stop(sig)
+		select {
+		case <-sig:
+			g.stop(nil)
+		case <-ctx.Done():
+		}
+		return nil
+	})
+}
+
+// serve serves h on l until the group stops, and then lets the requests in
+// flight finish.
+func (g *group) serve(l net.Listener, h http.Handler) {
+	srv := &http.Server{Handler: h}
+	g.Go(func(ctx context.Context) error {
+		errc := make(chan error, 1)
+		go func() { errc <- srv.Serve(l) }()
+		select {
+		case err := <-errc:
+			return err
+		case <-ctx.Done():
+			sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			return srv.Shutdown(sctx)
+		}
+	})
+}
+
+// every calls f every d on the registry's clock until the group stops.
+func (r *registry) every(d time.Duration, f func(now time.Time)) {
+	r.group.loop(r.clock.Tick(d), f)
+}
+
+// loop calls f for every tick until the group stops.
+func (g *group) loop(ticks <-chan time.Time, f func(now time.Time)) {
+	g.Go(func(ctx context.Context) error {
+		for {
+			select {
+			case now := <-ticks:
+				f(now)
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Samples go to Grafana Live in the stream "diydashboard". Grafana turns
+// every measurement of a stream into a channel of its own, so each metric
+// can be found in the channel "stream/diydashboard/<metric>".
+const (
+	liveStreamID      = "diydashboard"
+	liveFlushInterval = 100 * time.Millisecond
+	liveQueueSize     = 1000
+	liveScanInterval  = time.Second
+)
+
+type liveSample struct {
+	name string
+	v    float64
+	t    time.Time
+}
+
+// publishLive pushes every new sample of every metric to Grafana Live.
+// Panels that query the channel get updated the moment a sample arrives,
+// instead of polling the SimpleJSON datasource every few seconds.
+//
+// Samples are collected for liveFlushInterval and sent in one request.
+// If Grafana cannot keep up, samples get dropped rather than slowing down
+// the metrics.
+func publishLive(g *grafanaClient, reg *registry) {
+	samples := make(chan liveSample, liveQueueSize)
+	var dropped int64
+
+	// New metrics can appear at any time, so look for them regularly.
+	watched := map[string]bool{}
+	scan := func() {
+		for _, s := range reg.list() {
+			if watched[s.name] {
+				continue
+			}
+			watched[s.name] = true
+			name := liveName(s.name)
+			s.observe(func(v float64, t time.Time) {
+				select {
+				case samples <- liveSample{name, v, t}:
+				default:
+					atomic.AddInt64(&dropped, 1)
+				}
+			})
+		}
+	}
+	scan()
+	reg.every(liveScanInterval, func(time.Time) { scan() })
+
+	reg.group.Go(func(ctx context.Context) error {
+		var buf bytes.Buffer
+		failing := false
+		tick := time.NewTicker(liveFlushInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case s := <-samples:
+				fmt.Fprintf(&buf, "%s value=%g %d\n", s.name, s.v, s.t.UnixNano())
+			case <-tick.C:
+				if n := atomic.SwapInt64(&dropped, 0); n > 0 {
+					log.Printf("grafana live: dropped %d samples", n)
+				}
+				if buf.Len() == 0 {
+					continue
+				}
+				err := g.pushLive(liveStreamID, buf.Bytes())
+				buf.Reset()
+				switch {
+				case err != nil && !failing:
+					log.Println("grafana live:", err)
+				case err == nil && failing:
+					log.Println("grafana live: publishing again")
+				}
+				failing = err != nil
+			}
+		}
+	})
+}
+
+// liveName turns a metric name into a measurement name that is valid in
+// the line protocol and in a Grafana Live channel path.
+func liveName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-', c == '.':
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
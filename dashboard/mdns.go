@@ -0,0 +1,436 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A homelab fleet finds itself: with -mdns, each app announces its
+// datasource on the LAN through multicast DNS, the way printers and media
+// servers do, and `diydashboard discover` lists the apps that answer.
+// With -join, an app looks for the others every minute and pulls in the
+// metrics of each one it finds, as if it were an agent of the config file.
+//
+// The DNS messages are the few that this takes, written and read by hand:
+// a query for the service's PTR record, and an answer with the PTR, SRV,
+// TXT, and A records of the app.
+
+const (
+	mdnsService = "_diydashboard._tcp.local."
+	mdnsTTL     = 120 // seconds
+
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsTypeANY = 255
+
+	dnsClassIN    = 1
+	dnsCacheFlush = 0x8000 // in the class of a unique record
+	dnsUnicast    = 0x8000 // in the class of a question: answer by unicast
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// joinInterval is how often -join looks for other apps.
+const joinInterval = time.Minute
+
+// mdnsName returns the name that the app announces itself with: the host
+// name up to the first dot, in a form that works as the prefix of metric
+// names, like "nas" or "pi_4".
+func mdnsName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "diydashboard"
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		host = host[:i]
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, host)
+}
+
+// advertise answers the mDNS queries for the service on the LAN with the
+// records of the app, named name, until g stops.
+func advertise(g *group, name string) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return fmt.Errorf("mdns: %s", err)
+	}
+	instance := name + "." + mdnsService
+	log.Printf("mdns: announcing %s on the LAN", strings.TrimSuffix(instance, "."))
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return conn.Close()
+	})
+	g.Go(func(ctx context.Context) error {
+		buf := make([]byte, 9000)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("mdns: %s", err)
+			}
+			msg, err := parseDNSMessage(buf[:n])
+			if err != nil || msg.response || !msg.asksFor(instance) {
+				continue
+			}
+			// A query from a port other than 5353 comes from a simple
+			// resolver like `diydashboard discover`, which waits for a
+			// unicast answer with the ID of its query; everyone else
+			// listens on the group.
+			to, id := mdnsGroup, uint16(0)
+			if from.Port != mdnsGroup.Port {
+				to, id = from, msg.id
+			}
+			if _, err := conn.WriteToUDP(mdnsAnswer(id, instance, name), to); err != nil {
+				log.Println("mdns:", err)
+			}
+		}
+	})
+	return nil
+}
+
+// mdnsAnswer returns the answer to a query with the given ID: a PTR record that points
+// from the service to the instance of the app, and, as additional
+// records, the instance's port (SRV), an empty TXT record, and the
+// host's IPv4 addresses.
+func mdnsAnswer(id uint16, instance, name string) []byte {
+	host := name + ".local."
+	var ips []net.IP
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && !n.IP.IsLoopback() && n.IP.To4() != nil {
+				ips = append(ips, n.IP.To4())
+			}
+		}
+	}
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint16(b[0:], id)
+	binary.BigEndian.PutUint16(b[2:], 0x8400)              // response, authoritative
+	binary.BigEndian.PutUint16(b[6:], 1)                   // answers
+	binary.BigEndian.PutUint16(b[10:], uint16(2+len(ips))) // additional records
+
+	b = appendDNSRecord(b, mdnsService, dnsTypePTR, dnsClassIN, appendDNSName(nil, instance))
+	srv := make([]byte, 6)
+	binary.BigEndian.PutUint16(srv[4:], uint16(gradaPort()))
+	b = appendDNSRecord(b, instance, dnsTypeSRV, dnsClassIN|dnsCacheFlush, appendDNSName(srv, host))
+	b = appendDNSRecord(b, instance, dnsTypeTXT, dnsClassIN|dnsCacheFlush, []byte{0})
+	for _, ip := range ips {
+		b = appendDNSRecord(b, host, dnsTypeA, dnsClassIN|dnsCacheFlush, ip)
+	}
+	return b
+}
+
+// A discovered app is one that answered a query for the service.
+type discovered struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// discover asks the LAN for the apps that announce themselves with -mdns,
+// and collects the answers for wait. The URL of an app is that of its
+// grada server, at the address that the answer came from.
+func discover(ctx context.Context, wait time.Duration) ([]discovered, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := make([]byte, 12)
+	binary.BigEndian.PutUint16(query[4:], 1) // questions
+	query = appendDNSName(query, mdnsService)
+	query = appendUint16(query, dnsTypePTR)
+	query = appendUint16(query, dnsClassIN|dnsUnicast)
+	if _, err := conn.WriteToUDP(query, mdnsGroup); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+	var found []discovered
+	seen := map[string]bool{}
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				return found, nil
+			}
+			return found, err
+		}
+		msg, err := parseDNSMessage(buf[:n])
+		if err != nil || !msg.response {
+			continue
+		}
+		for _, instance := range msg.instances() {
+			port, ok := msg.port(instance)
+			if !ok {
+				continue
+			}
+			d := discovered{
+				Name: strings.TrimSuffix(instance, "."+mdnsService),
+				URL:  "http://" + net.JoinHostPort(from.IP.String(), strconv.Itoa(port)),
+			}
+			if !seen[d.URL] {
+				seen[d.URL] = true
+				found = append(found, d)
+			}
+		}
+	}
+}
+
+// discoverCommand lists the apps on the LAN that announce themselves
+// with -mdns, or writes them as the agents of a config file with -json.
+func discoverCommand(args []string) error {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	wait := fs.Duration("wait", 3*time.Second, "how long to wait for answers")
+	asJSON := fs.Bool("json", false, "write the apps as the \"agents\" of a config file")
+	fs.Parse(args)
+	found, err := discover(context.Background(), *wait)
+	if err != nil {
+		return err
+	}
+	if found == nil {
+		found = []discovered{}
+	}
+	if *asJSON {
+		b, err := json.MarshalIndent(map[string][]discovered{"agents": found}, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeOutput("-", append(b, '\n'))
+	}
+	if len(found) == 0 {
+		fmt.Fprintln(os.Stderr, "no apps found; do they run with -mdns, and does the firewall let mDNS (UDP port 5353) through?")
+		return nil
+	}
+	for _, d := range found {
+		fmt.Printf("%-20s %s\n", d.Name, d.URL)
+	}
+	return nil
+}
+
+// join looks for other apps every joinInterval, and pulls in the metrics
+// of each new one as an agent, named after the app, until the registry's
+// group stops. Apps that are agents of the config file already, by name
+// or URL, and the app itself, are left out.
+func join(reg *registry, self string, agents []agentConfig) {
+	known := map[string]bool{self: true}
+	for _, c := range agents {
+		known[c.Name], known[c.URL] = true, true
+	}
+	reg.group.Go(func(ctx context.Context) error {
+		for {
+			found, err := discover(ctx, 3*time.Second)
+			if err != nil {
+				log.Println("join:", err)
+			}
+			for _, d := range found {
+				if known[d.Name] || known[d.URL] {
+					continue
+				}
+				known[d.Name], known[d.URL] = true, true
+				c := agentConfig{Name: d.Name, URL: d.URL}
+				if err := c.validate(); err != nil {
+					log.Println("join:", err)
+					continue
+				}
+				startAgent(reg, c)
+			}
+			select {
+			case <-time.After(joinInterval):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+}
+
+// dnsMessage is the part of a DNS message that mDNS needs here.
+type dnsMessage struct {
+	id        uint16
+	response  bool
+	questions []dnsQuestion
+	records   []dnsRecord // answers and additional records alike
+	raw       []byte      // for names in the record data
+}
+
+type dnsQuestion struct {
+	name  string
+	qtype uint16
+}
+
+type dnsRecord struct {
+	name   string
+	rtype  uint16
+	offset int // of the record data in raw
+	data   []byte
+}
+
+var errDNSMessage = errors.New("malformed DNS message")
+
+func parseDNSMessage(b []byte) (dnsMessage, error) {
+	if len(b) < 12 {
+		return dnsMessage{}, errDNSMessage
+	}
+	m := dnsMessage{
+		id:       binary.BigEndian.Uint16(b[0:]),
+		response: b[2]&0x80 != 0,
+		raw:      b,
+	}
+	qd := int(binary.BigEndian.Uint16(b[4:]))
+	rr := int(binary.BigEndian.Uint16(b[6:])) + int(binary.BigEndian.Uint16(b[8:])) + int(binary.BigEndian.Uint16(b[10:]))
+	off := 12
+	for i := 0; i < qd; i++ {
+		name, next, err := readDNSName(b, off)
+		if err != nil || next+4 > len(b) {
+			return m, errDNSMessage
+		}
+		m.questions = append(m.questions, dnsQuestion{name, binary.BigEndian.Uint16(b[next:])})
+		off = next + 4
+	}
+	for i := 0; i < rr; i++ {
+		name, next, err := readDNSName(b, off)
+		if err != nil || next+10 > len(b) {
+			return m, errDNSMessage
+		}
+		n := int(binary.BigEndian.Uint16(b[next+8:]))
+		if next+10+n > len(b) {
+			return m, errDNSMessage
+		}
+		m.records = append(m.records, dnsRecord{
+			name:   name,
+			rtype:  binary.BigEndian.Uint16(b[next:]),
+			offset: next + 10,
+			data:   b[next+10 : next+10+n],
+		})
+		off = next + 10 + n
+	}
+	return m, nil
+}
+
+// asksFor reports whether a query asks for the service or for instance.
+func (m dnsMessage) asksFor(instance string) bool {
+	for _, q := range m.questions {
+		switch {
+		case strings.EqualFold(q.name, mdnsService) && (q.qtype == dnsTypePTR || q.qtype == dnsTypeANY):
+			return true
+		case strings.EqualFold(q.name, instance):
+			return true
+		}
+	}
+	return false
+}
+
+// instances returns the instances of the service that the PTR records of
+// an answer point to.
+func (m dnsMessage) instances() []string {
+	var names []string
+	for _, r := range m.records {
+		if r.rtype == dnsTypePTR && strings.EqualFold(r.name, mdnsService) {
+			if name, _, err := readDNSName(m.raw, r.offset); err == nil {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// port returns the port from the SRV record of instance.
+func (m dnsMessage) port(instance string) (int, bool) {
+	for _, r := range m.records {
+		if r.rtype == dnsTypeSRV && strings.EqualFold(r.name, instance) && len(r.data) >= 6 {
+			return int(binary.BigEndian.Uint16(r.data[4:])), true
+		}
+	}
+	return 0, false
+}
+
+// readDNSName reads the name at off in the message b, following
+// compression pointers, and returns it with a trailing dot, along with
+// the offset after the name.
+func readDNSName(b []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(b) {
+			return "", 0, errDNSMessage
+		}
+		n := int(b[off])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(b) || jumps > 16 {
+				return "", 0, errDNSMessage
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+n > len(b) {
+				return "", 0, errDNSMessage
+			}
+			labels = append(labels, string(b[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+// appendDNSName appends name, like "nas._diydashboard._tcp.local.", in the
+// wire format of DNS, without compression.
+func appendDNSName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func appendDNSRecord(b []byte, name string, rtype, class uint16, data []byte) []byte {
+	b = appendDNSName(b, name)
+	b = appendUint16(b, rtype)
+	b = appendUint16(b, class)
+	b = appendUint32(b, mdnsTTL)
+	b = appendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// appendUint16 and appendUint32 append big-endian integers, as DNS has
+// them.
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
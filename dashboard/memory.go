@@ -0,0 +1,81 @@
+package dashboard
+
+import (
+	"net/http"
+	"time"
+	"unsafe"
+)
+
+// gradaPoint has the layout of a data point in grada's ring buffer: a
+// float64 and a time.Time.
+type gradaPoint struct {
+	v float64
+	t time.Time
+}
+
+// pointSize is the memory of one data point, as the article's estimate of
+// 32 bytes says.
+const pointSize = int64(unsafe.Sizeof(gradaPoint{}))
+
+// metricUsage is the memory accounting of one metric.
+type metricUsage struct {
+	Name     string  `json:"name"`
+	Capacity int     `json:"capacity"` // points the buffer holds
+	Used     int     `json:"used"`     // points in the buffer
+	Bytes    int64   `json:"bytes"`    // memory of the buffer
+	Rate     float64 `json:"rate"`     // observed samples per second; 0 if unknown
+	// Covers is the time range that a full buffer holds at the observed
+	// rate. If it is shorter than the dashboard's time range, the buffer
+	// is too small; if it is much longer, it wastes memory.
+	Covers string `json:"covers,omitempty"`
+}
+
+// usage returns the memory accounting of s. The buffer is allocated in
+// full when the metric is created, so Bytes does not depend on Used.
+func (s *series) usage() metricUsage {
+	s.mu.Lock()
+	capacity, count, first, last := s.capacity, s.buffered, s.firstTime, s.lastTime
+	s.mu.Unlock()
+	u := metricUsage{
+		Name:     s.name,
+		Capacity: capacity,
+		Used:     capacity,
+		Bytes:    int64(capacity) * pointSize,
+	}
+	if count < int64(capacity) {
+		u.Used = int(count)
+	}
+	if d := last.Sub(first); count > 1 && d > 0 {
+		u.Rate = float64(count-1) / d.Seconds()
+		u.Covers = time.Duration(float64(capacity) / u.Rate * float64(time.Second)).Round(time.Second).String()
+	}
+	return u
+}
+
+// samples returns the number of samples that s stored since it was
+// created or resized.
+func (s *series) samples() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buffered
+}
+
+// serveMetrics handles GET /api/metrics, which lists the memory that the
+// buffer of each metric takes, and the total.
+func serveMetrics(reg *registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var resp struct {
+			PointSize int64         `json:"pointSize"`
+			Bytes     int64         `json:"bytes"`
+			Metrics   []metricUsage `json:"metrics"`
+		}
+		resp.PointSize = pointSize
+		resp.Metrics = []metricUsage{}
+		for _, s := range reg.list() {
+			u := s.usage()
+			resp.Bytes += u.Bytes
+			resp.Metrics = append(resp.Metrics, u)
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
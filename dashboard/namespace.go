@@ -0,0 +1,243 @@
+package dashboard
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// namespaceConfig declares a namespace: the metrics whose names start with
+// Prefix, served as a datasource of their own, with the prefix removed.
+// One app can so back several Grafana datasources, like "home" for the
+// sensors at home and "work-probes" for the probes at work, each of which
+// sees only its own metrics:
+//
+//	"namespaces": [
+//	  {"name": "home", "token": "..."},
+//	  {"name": "work-probes", "prefix": "probes.", "addr": ":3005"}
+//	]
+//
+// A namespace is served by the datasource proxy under /ns/<name>, or on an
+// address of its own. With a token, Grafana's datasource must send it,
+// either as the password of basic auth or in an "Authorization: Bearer"
+// header.
+type namespaceConfig struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"` // default "<name>."
+	Addr   string `json:"addr"`
+	Token  secret `json:"token"`
+}
+
+// prefix returns the prefix of the metric names in the namespace.
+func (c namespaceConfig) prefix() string {
+	if c.Prefix == "" {
+		return c.Name + "."
+	}
+	return c.Prefix
+}
+
+// path returns the path under which the proxy serves the namespace.
+func (c namespaceConfig) path() string {
+	return "/ns/" + c.Name
+}
+
+func (c namespaceConfig) validate() error {
+	if c.Name == "" || strings.ContainsAny(c.Name, "/ ") {
+		return fmt.Errorf("namespace %q: the name must not be empty or contain slashes or spaces", c.Name)
+	}
+	return nil
+}
+
+// A namespace restricts a datasource to the metrics with a name prefix. It
+// adds the prefix to the targets of requests, and removes it from the
+// responses, before and after next handles them.
+type namespace struct {
+	reg    *registry
+	name   string
+	prefix string
+	token  string
+	next   http.Handler
+}
+
+func (ns *namespace) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !ns.authorized(r) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", "diydashboard "+ns.name))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/search":
+		ns.search(w, r)
+	case "/query":
+		ns.query(w, r)
+	default:
+		ns.next.ServeHTTP(w, r)
+	}
+}
+
+// authorized checks the token, if the namespace has one.
+func (ns *namespace) authorized(r *http.Request) bool {
+	return tokenAuthorized(r, ns.token)
+}
+
+// tokenAuthorized reports whether r carries token, either as the password
+// of basic auth or in an "Authorization: Bearer" header. An empty token
+// lets every request through.
+func tokenAuthorized(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	got, ok := "", false
+	if _, pw, basic := r.BasicAuth(); basic {
+		got, ok = pw, true
+	} else if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		got, ok = strings.TrimPrefix(h, "Bearer "), true
+	}
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// search answers /search from the metrics in the namespace. It needs not
+// go through grada, which knows nothing about namespaces.
+func (ns *namespace) search(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	var list []*series
+	for _, s := range ns.reg.list() {
+		if strings.HasPrefix(s.name, ns.prefix) {
+			list = append(list, s)
+		}
+	}
+	names := searchSeries(list, ns.prefix+req.Target)
+	for i, name := range names {
+		names[i] = strings.TrimPrefix(name, ns.prefix)
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+// query adds the prefix to the targets of a /query request, and removes
+// it from the series of the response.
+func (ns *namespace) query(w http.ResponseWriter, r *http.Request) {
+	var q map[string]json.RawMessage
+	var targets []map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(q["targets"], &targets); err != nil {
+		http.Error(w, "invalid query targets: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, t := range targets {
+		var name string
+		if err := json.Unmarshal(t["target"], &name); err != nil {
+			http.Error(w, "invalid query target: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		t["target"], _ = json.Marshal(ns.prefix + name)
+	}
+	q["targets"], _ = json.Marshal(targets)
+	body, err := json.Marshal(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req := r.Clone(r.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	resp := &bufferedResponse{header: http.Header{}, body: getBuffer()}
+	defer putBuffer(resp.body)
+	ns.next.ServeHTTP(resp, req)
+	resp.WriteHeader(http.StatusOK)
+	for k, v := range resp.header {
+		w.Header()[k] = v
+	}
+	if resp.status != http.StatusOK {
+		w.WriteHeader(resp.status)
+		w.Write(resp.body.Bytes())
+		return
+	}
+	w.Header().Del("Content-Length")
+	qs := newQueryStream(w)
+	err = readQueryResults(resp.body, func(r *queryResult) error {
+		r.Target = strings.TrimPrefix(r.Target, ns.prefix)
+		return qs.write(*r)
+	})
+	if err != nil {
+		log.Printf("namespace %s: /query response: %s", ns.name, err)
+		panic(http.ErrAbortHandler)
+	}
+	qs.close()
+}
+
+// A bufferedResponse collects the response of a handler, for rewriting
+// it before it goes out.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   *bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// writeTo sends the buffered response to w as it is.
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
+
+// serveNamespaces puts the namespaces in front of the datasource proxy h.
+// Namespaces with an address of their own get a server each; the others
+// are mounted on the returned handler, which replaces h on the proxy's
+// address.
+func serveNamespaces(reg *registry, configs []namespaceConfig, h http.Handler) (http.Handler, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/", h)
+	seen := map[string]bool{}
+	for _, c := range configs {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("namespace %q: declared twice", c.Name)
+		}
+		seen[c.Name] = true
+		ns := &namespace{reg: reg, name: c.Name, prefix: c.prefix(), token: string(c.Token), next: h}
+		if c.Addr == "" {
+			mux.Handle(c.path()+"/", http.StripPrefix(c.path(), ns))
+			log.Printf("namespace %s (metrics %s*) served by the datasource proxy under %s", c.Name, ns.prefix, c.path())
+			continue
+		}
+		l, err := net.Listen("tcp", c.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %s", c.Name, err)
+		}
+		log.Printf("namespace %s (metrics %s*) listening on %s", c.Name, ns.prefix, l.Addr())
+		reg.group.serve(l, ns)
+	}
+	return mux, nil
+}
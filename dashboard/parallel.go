@@ -0,0 +1,87 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// fanOut splits a /query request into one request per target and sends
+// them to the datasource server in parallel, at most cap(p.workers) at a
+// time. On refresh, Grafana sends a request for every panel at once; with
+// fanOut, a target that takes long to compute only delays itself. A
+// target that fails or misses the deadline is left out of the response,
+// so its panel shows "no data" while the others are complete.
+func (p *datasourceProxy) fanOut(ctx context.Context, header http.Header, body []byte, dst *bytes.Buffer) (int, http.Header, error) {
+	var q map[string]json.RawMessage
+	var targets []json.RawMessage
+	if err := json.Unmarshal(body, &q); err != nil {
+		return 0, nil, fmt.Errorf("invalid query: %s", err)
+	}
+	if err := json.Unmarshal(q["targets"], &targets); err != nil || len(targets) < 2 {
+		return p.forward(ctx, http.MethodPost, "/query", header, body, dst)
+	}
+
+	results := make([][]queryResult, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t json.RawMessage) {
+			defer wg.Done()
+			select {
+			case p.workers <- struct{}{}:
+				defer func() { <-p.workers }()
+			case <-ctx.Done():
+				log.Printf("query %s: %s while waiting for a worker", t, ctx.Err())
+				return
+			}
+			r, err := p.queryTarget(ctx, header, q, t)
+			if err != nil {
+				log.Printf("query %s: %s", t, err)
+				return
+			}
+			results[i] = r
+		}(i, t)
+	}
+	wg.Wait()
+
+	var merged []queryResult
+	for _, r := range results {
+		merged = append(merged, r...)
+	}
+	if err := p.encode(dst, merged); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, http.Header{"Content-Type": {"application/json"}}, nil
+}
+
+// queryTarget sends the query q with target t as its only target.
+func (p *datasourceProxy) queryTarget(ctx context.Context, header http.Header, q map[string]json.RawMessage, t json.RawMessage) ([]queryResult, error) {
+	single := make(map[string]json.RawMessage, len(q))
+	for k, v := range q {
+		single[k] = v
+	}
+	single["targets"] = append(append(json.RawMessage{'['}, t...), ']')
+	body, err := json.Marshal(single)
+	if err != nil {
+		return nil, err
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	status, _, err := p.forward(ctx, http.MethodPost, "/query", header, body, buf)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%d %s", status, http.StatusText(status))
+	}
+	var r []queryResult
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,133 @@
+package dashboard
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+// A demo needs a way to freeze the graphs at an interesting moment. While
+// a collector is paused, the samples of its metrics get dropped, whether
+// they come through Add or from a source that the app runs, so that the
+// graphs stop where they were. A one-off collection lets the next sample
+// of each metric through and pauses again.
+
+// The pause states of a series.
+const (
+	running    int32 = iota
+	paused           // drop all samples
+	pausedOnce       // let the next sample through, then drop again
+)
+
+// admit reports whether a new sample of s gets stored.
+func (s *series) admit() bool {
+	switch atomic.LoadInt32(&s.paused) {
+	case running:
+		return true
+	case pausedOnce:
+		return atomic.CompareAndSwapInt32(&s.paused, pausedOnce, paused)
+	}
+	return false
+}
+
+// pauseCollector pauses, resumes, or collects once ("pause", "resume",
+// "collect") the metrics of the collector named like a row of generated
+// dashboards, as in "CPU". It returns the number of metrics it changed.
+// Metrics that the collector adds later start out running.
+func (r *registry) pauseCollector(collector, action string) (int, error) {
+	var state int32
+	switch action {
+	case "pause":
+		state = paused
+	case "resume":
+		state = running
+	case "collect":
+		state = pausedOnce
+	default:
+		return 0, fmt.Errorf("unknown action %q (pause, resume, collect)", action)
+	}
+	n := 0
+	for _, s := range r.list() {
+		if collectorFor(s.name).row != collector {
+			continue
+		}
+		// A one-off collection leaves running metrics running.
+		if state == pausedOnce {
+			atomic.CompareAndSwapInt32(&s.paused, paused, pausedOnce)
+		} else {
+			atomic.StoreInt32(&s.paused, state)
+		}
+		n++
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("no metrics for collector %q", collector)
+	}
+	return n, nil
+}
+
+// collectorStatus describes a collector for GET /api/collectors.
+type collectorStatus struct {
+	Name    string   `json:"name"`
+	Metrics []string `json:"metrics"`
+	Paused  []string `json:"paused"` // the paused ones among Metrics
+}
+
+// collectorStatuses returns the collectors that have metrics, in the order
+// of the rows of generated dashboards.
+func collectorStatuses(reg *registry) []collectorStatus {
+	byName := map[string]*collectorStatus{}
+	for _, s := range reg.list() {
+		name := collectorFor(s.name).row
+		c := byName[name]
+		if c == nil {
+			c = &collectorStatus{Name: name, Paused: []string{}}
+			byName[name] = c
+		}
+		c.Metrics = append(c.Metrics, s.name)
+		if atomic.LoadInt32(&s.paused) != running {
+			c.Paused = append(c.Paused, s.name)
+		}
+	}
+	statuses := []collectorStatus{}
+	for _, t := range collectorTemplates {
+		if c := byName[t.row]; c != nil {
+			statuses = append(statuses, *c)
+		}
+	}
+	if c := byName[otherTemplate.row]; c != nil {
+		statuses = append(statuses, *c)
+	}
+	return statuses
+}
+
+// serveCollectors handles the admin endpoint /api/collectors. GET lists
+// the collectors with their metrics and which of them are paused. POST
+// pauses or resumes a collector, or lets it collect once while paused:
+//
+//	curl -d '{"collector": "CPU", "action": "pause"}' localhost:3002/api/collectors
+func serveCollectors(reg *registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, collectorStatuses(reg))
+		case http.MethodPost:
+			var req struct {
+				Collector string `json:"collector"`
+				Action    string `json:"action"`
+			}
+			if !readJSON(w, r, &req) {
+				return
+			}
+			n, err := reg.pauseCollector(req.Collector, req.Action)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("collector %s: %s (%d metrics)", req.Collector, req.Action, n)
+			writeJSON(w, http.StatusOK, req)
+		default:
+			http.Error(w, "use GET or POST", http.StatusMethodNotAllowed)
+		}
+	}
+}
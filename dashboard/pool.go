@@ -0,0 +1,73 @@
+package dashboard
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBuffer is the largest buffer that goes back into the pool. An
+// occasional huge response should not pin its memory forever.
+const maxPooledBuffer = 4 << 20
+
+// Dashboards that refresh every second, with a request per panel, would
+// otherwise allocate new buffers and data point slices for every request.
+// The pools keep them for reuse. poolGets and poolNews count how often the
+// pools were asked, and how often they had nothing to give, for the
+// self-metrics.
+var (
+	bufferPool = sync.Pool{New: func() interface{} {
+		atomic.AddUint64(&poolNews, 1)
+		return new(bytes.Buffer)
+	}}
+	resultPool = sync.Pool{New: func() interface{} {
+		atomic.AddUint64(&poolNews, 1)
+		return new([]queryResult)
+	}}
+	chunkPool = sync.Pool{New: func() interface{} {
+		atomic.AddUint64(&poolNews, 1)
+		b := make([]byte, 0, queryChunkSize+1024)
+		return &b
+	}}
+	poolGets, poolNews uint64
+)
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	atomic.AddUint64(&poolGets, 1)
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+// putBuffer returns b to the pool. b must not be used afterwards.
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() <= maxPooledBuffer {
+		bufferPool.Put(b)
+	}
+}
+
+// getChunk returns a byte slice for a chunk of writeQueryResults.
+func getChunk() *[]byte {
+	atomic.AddUint64(&poolGets, 1)
+	return chunkPool.Get().(*[]byte)
+}
+
+// putChunk returns c to the pool.
+func putChunk(c *[]byte) {
+	if cap(*c) <= maxPooledBuffer {
+		chunkPool.Put(c)
+	}
+}
+
+// getResults returns a slice of query results from the pool. Decoding
+// into it reuses the data point slices of earlier responses.
+func getResults() *[]queryResult {
+	atomic.AddUint64(&poolGets, 1)
+	return resultPool.Get().(*[]queryResult)
+}
+
+// putResults returns r to the pool.
+func putResults(r *[]queryResult) {
+	resultPool.Put(r)
+}
@@ -0,0 +1,80 @@
+package dashboard
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// previewSuffix ends the names of preview series.
+const previewSuffix = ".preview"
+
+// An overview dashboard with dozens of panels asks for every point of
+// every metric on each refresh. With -preview, each metric gets a
+// companion series "<name>.preview" with one average per interval, which
+// costs a fraction to query. Detail panels keep querying the metric
+// itself.
+
+// addPreviews creates a preview series for every metric, including the
+// ones that get created later.
+func addPreviews(reg *registry, interval time.Duration) error {
+	if interval < time.Second {
+		return fmt.Errorf("-preview must be at least 1s")
+	}
+	reg.eachSeries(func(s *series) {
+		if strings.HasSuffix(s.name, previewSuffix) {
+			return
+		}
+		if err := addPreviewSeries(reg, s, interval); err != nil {
+			log.Printf("no preview for %s: %s", s.name, err)
+		}
+	})
+	return nil
+}
+
+// addPreviewSeries creates the series "<name>.preview" that receives the
+// average of the samples of src in each interval, once the interval is
+// over. Intervals without samples get no value.
+func addPreviewSeries(reg *registry, src *series, interval time.Duration) error {
+	dst, err := reg.getOrCreateWith(src.name+previewSuffix, reg.timeRange, interval)
+	if err != nil {
+		return err
+	}
+	var (
+		mu        sync.Mutex
+		bucket    time.Time
+		sum       float64
+		n         int
+		described bool
+	)
+	src.observe(func(v float64, t time.Time) {
+		mu.Lock()
+		b := t.Truncate(interval)
+		avg, done := 0.0, false
+		if b.After(bucket) && n > 0 {
+			avg, done = sum/float64(n), true
+			sum, n = 0, 0
+		}
+		bucket = b
+		if !math.IsNaN(v) {
+			sum += v
+			n++
+		}
+		first := done && !described
+		described = described || done
+		mu.Unlock()
+		if first {
+			// The source usually gets its description after it was
+			// created, so the preview takes it over only now.
+			unit, description := src.meta()
+			dst.describe(unit, fmt.Sprintf("%s (averages over %s)", strings.TrimSuffix(description, "."), interval))
+		}
+		if done {
+			dst.Add(avg)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,95 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Grafana reads provisioning files at startup from its provisioning
+// directory, which is /etc/grafana/provisioning in the official image.
+const grafanaProvisioningDir = "/etc/grafana/provisioning"
+
+const datasourceProvisioningYAML = `# Written by diydashboard provision.
+apiVersion: 1
+datasources:
+  - name: %q
+    type: grafana-simple-json-datasource
+    access: proxy
+    url: %q
+    isDefault: true
+    editable: true
+`
+
+const dashboardProvisioningYAML = `# Written by diydashboard provision.
+apiVersion: 1
+providers:
+  - name: diydashboard
+    type: file
+    folder: %q
+    allowUiUpdates: true
+    options:
+      path: %q
+`
+
+// provision writes a Grafana provisioning directory with a datasource that
+// points to the app, and a generated dashboard. Mounted into the Grafana
+// container, as in
+//
+//	docker run -v $PWD/provisioning:/etc/grafana/provisioning ... grafana/grafana
+//
+// Grafana comes up fully configured, without a single click. The dashboard
+// gets generated by a running app, or with -bundled, it is one of the
+// dashboards built into the binary.
+func provision(args []string) error {
+	fs := flag.NewFlagSet("provision", flag.ExitOnError)
+	api := fs.String("api", "localhost:3002", "address of the app's API server, for generating the dashboard")
+	dir := fs.String("dir", "provisioning", "output directory")
+	name := fs.String("datasource", "diydashboard", "datasource name")
+	dsURL := fs.String("datasource-url", gradaAddr(), "URL of the app as seen from Grafana")
+	title := fs.String("title", "DIY Dashboard", "dashboard title")
+	folder := fs.String("folder", "DIY Dashboard", "Grafana folder for the dashboard; empty for General")
+	bundled := fs.String("bundled", "", "write this built-in dashboard instead of asking a running app: "+strings.Join(bundledDashboards(), " or "))
+	fs.Parse(args)
+
+	var dash []byte
+	var err error
+	if *bundled != "" {
+		var d dashboardJSON
+		if d, err = bundledDashboard(*bundled, *title, *name); err == nil {
+			dash, err = json.Marshal(d)
+		}
+	} else {
+		dash, err = apiGet(*api, "/api/dashboard?title="+url.QueryEscape(*title)+"&datasource="+url.QueryEscape(*name))
+	}
+	if err != nil {
+		return err
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, dash, "", "  "); err != nil {
+		return err
+	}
+
+	files := map[string][]byte{
+		"datasources/diydashboard.yaml": []byte(fmt.Sprintf(datasourceProvisioningYAML, *name, *dsURL)),
+		"dashboards/diydashboard.yaml":  []byte(fmt.Sprintf(dashboardProvisioningYAML, *folder, grafanaProvisioningDir+"/dashboards")),
+		"dashboards/diydashboard.json":  pretty.Bytes(),
+	}
+	for path, content := range files {
+		path = filepath.Join(*dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			return err
+		}
+		fmt.Println("wrote", path)
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The grada server on :3001 (or $GRADA_PORT) is not ours to instrument.
+// Everything that needs to see or change the traffic between Grafana and
+// the datasource (recording, debug output, chaos, time compression,
+// parallel queries) happens in a proxy in front of it. While the proxy
+// runs, Grafana's datasource URL must point to the proxy.
+
+// gradaPort returns the port of grada's server: the one in the environment
+// variable GRADA_PORT, which grada reads, too, or 3001.
+func gradaPort() int {
+	if port, err := strconv.Atoi(strings.TrimPrefix(os.Getenv("GRADA_PORT"), ":")); err == nil && port > 0 {
+		return port
+	}
+	return 3001
+}
+
+// gradaAddr returns the URL of grada's server.
+func gradaAddr() string {
+	return "http://localhost:" + strconv.Itoa(gradaPort())
+}
+
+// datasourceProxy forwards requests to the datasource server.
+type datasourceProxy struct {
+	client *http.Client
+	// observe gets every exchange after the response is sent, for
+	// -record and -debug-http.
+	observe []func(exchange)
+	speed   float64 // time compression; 0 or 1: none
+	// workers limits the number of concurrent upstream requests of
+	// /query requests that get split by target; nil: no splitting.
+	workers chan struct{}
+	timeout time.Duration // per request; 0: the client's timeout
+	encode  queryEncoder  // for the /query responses that the proxy rewrites
+	// stream lets responses that nobody observes go to the client while
+	// they arrive, instead of reading them into memory first.
+	stream    bool
+	skew      *skewDetector
+	aggregate []aggregateSpec // from -aggregate
+	fill      []fillSpec      // from -fill
+	units     []unitSpec      // from -unit
+	aliases   []aliasSpec     // from -alias
+	timeShift bool            // from -time-shift
+	reg       *registry       // for the labels and aliases of metrics
+}
+
+func (p *datasourceProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reqBuf, respBuf := getBuffer(), getBuffer()
+	defer putBuffer(reqBuf)
+	defer putBuffer(respBuf)
+	if _, err := reqBuf.ReadFrom(r.Body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body := reqBuf.Bytes()
+	ex := exchange{Time: time.Now(), Method: r.Method, Path: r.URL.RequestURI()}
+	// Only the observers need copies of the bodies.
+	observed := len(p.observe) > 0
+	if observed {
+		ex.Request = string(body)
+	}
+	// Targets with a time shift get split off into requests of their own,
+	// and each request gets prepared for the app's time.
+	var (
+		toGrafana func(r *queryResult)
+		shifted   []timeShiftGroup
+	)
+	if r.URL.Path == "/query" {
+		if p.skew != nil {
+			p.skew.observe(body, ex.Time)
+		}
+		var err error
+		if p.timeShift {
+			shifted, err = splitTimeShifts(body)
+		}
+		if shifted == nil && err == nil {
+			body, toGrafana, err = p.prepareQuery(body, ex.Time)
+		}
+		for i := 0; i < len(shifted) && err == nil; i++ {
+			shifted[i].body, shifted[i].toGrafana, err = p.prepareQuery(shifted[i].body, ex.Time)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	ctx := r.Context()
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	fanOut := p.workers != nil && r.URL.Path == "/query"
+	if p.stream && !observed && !fanOut && shifted == nil {
+		p.streamResponse(ctx, w, r, body, toGrafana)
+		return
+	}
+	var (
+		status int
+		header http.Header
+		err    error
+	)
+	switch {
+	case shifted != nil:
+		status, header, err = p.queryTimeShifted(ctx, r.Header, shifted, respBuf)
+	case fanOut:
+		status, header, err = p.fanOut(ctx, r.Header, body, respBuf)
+	default:
+		status, header, err = p.forward(ctx, r.Method, ex.Path, r.Header, body, respBuf)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	respBody := respBuf.Bytes()
+	if toGrafana != nil && status == http.StatusOK {
+		rewritten := getBuffer()
+		defer putBuffer(rewritten)
+		rewriteResponse(rewritten, respBody, toGrafana, p.encode)
+		respBody = rewritten.Bytes()
+		header.Del("Content-Length")
+	}
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(status)
+	w.Write(respBody)
+	if observed {
+		ex.Status, ex.Response, ex.Duration = status, string(respBody), time.Since(ex.Time)
+		for _, f := range p.observe {
+			f(ex)
+		}
+	}
+}
+
+// streamResponse forwards r with the given body and copies the response
+// to w while it arrives. A /query response that needs its timestamps
+// rewritten with toGrafana gets rewritten one series at a time, so the
+// proxy never holds more than one series of a response for a long time
+// range in memory.
+func (p *datasourceProxy) streamResponse(ctx context.Context, w http.ResponseWriter, r *http.Request, body []byte, toGrafana func(r *queryResult)) {
+	resp, err := p.send(ctx, r.Method, r.URL.RequestURI(), r.Header, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	if toGrafana == nil || resp.StatusCode != http.StatusOK {
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+	w.Header().Del("Content-Length")
+	w.WriteHeader(resp.StatusCode)
+	qs := newQueryStream(w)
+	err = readQueryResults(resp.Body, func(r *queryResult) error {
+		toGrafana(r)
+		return qs.write(*r)
+	})
+	if err != nil {
+		// The status line is out already; all that is left is to cut
+		// the response short, so that Grafana reports invalid JSON.
+		log.Println("proxy: streaming /query response:", err)
+		panic(http.ErrAbortHandler)
+	}
+	qs.close()
+}
+
+// prepareQuery prepares a /query request for the app. Grafana's time
+// differs from the app's with time compression, and when the clocks are
+// skewed and -correct-skew is on. Targets that want another aggregation
+// than grada's average get aggregated here, targets that want their gaps
+// filled get filled, and targets that want another unit get converted.
+// Series with an alias get renamed. It returns
+// the rewritten request, and the rewriting for the series of the
+// response, or nil if they need none.
+func (p *datasourceProxy) prepareQuery(body []byte, now time.Time) ([]byte, func(r *queryResult), error) {
+	agg, err := newQueryAggregation(body, p.aggregate)
+	if err != nil {
+		return nil, nil, err
+	}
+	fill, err := newQueryFill(body, p.fill)
+	if err != nil {
+		return nil, nil, err
+	}
+	scales, err := queryScales(body, p.units, p.reg)
+	if err != nil {
+		return nil, nil, err
+	}
+	aliases := queryAliases(body, p.aliases, p.reg)
+	shift := p.skew.offset()
+	if p.speed <= 1 && shift == 0 && agg == nil && fill == nil && scales == nil && aliases == nil {
+		return body, nil, nil
+	}
+	body = p.queryToApp(body, now, shift, agg != nil)
+	return body, func(r *queryResult) { p.resultToGrafana(r, now, shift, agg, fill, scales, aliases) }, nil
+}
+
+// queryToApp rewrites the time range of a /query request from Grafana's
+// time to the app's: shift is Grafana's clock minus the app's, and with
+// time compression, the range gets compressed around now. With raw, the
+// request asks for all points, for aggregating them in the proxy.
+func (p *datasourceProxy) queryToApp(body []byte, now time.Time, shift time.Duration, raw bool) []byte {
+	if raw {
+		body = setMaxDataPoints(body, rawMaxDataPoints)
+	}
+	if shift != 0 {
+		body = rewriteQueryRange(body, func(t time.Time) time.Time { return t.Add(-shift) })
+	}
+	if p.speed > 1 {
+		body = compressQuery(body, now, p.speed)
+	}
+	return body
+}
+
+// resultToGrafana rewrites the timestamps of a series from the app's time
+// to Grafana's, the reverse of queryToApp. It aggregates the points with
+// agg, if not nil, converts the values with the factor from scales, and
+// then fills the gaps with fill, if not nil. Filling comes after the time
+// rewriting, as the interval to fill at is Grafana's. Last, the series
+// gets the display name from aliases, if it has one.
+func (p *datasourceProxy) resultToGrafana(r *queryResult, now time.Time, shift time.Duration, agg *queryAggregation, fill *queryFill, scales map[string]float64, aliases map[string]string) {
+	if agg != nil {
+		agg.apply(r)
+	}
+	if factor, ok := scales[r.Target]; ok {
+		scaleResult(r, factor)
+	}
+	if p.speed > 1 {
+		stretchResult(r, now, p.speed)
+	}
+	shiftResult(r, shift)
+	if fill != nil {
+		fill.apply(r)
+	}
+	if name, ok := aliases[r.Target]; ok {
+		r.Target = name
+	}
+}
+
+// send sends a request to the datasource server.
+func (p *datasourceProxy) send(ctx context.Context, method, path string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, gradaAddr()+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header = header.Clone()
+	return p.client.Do(req)
+}
+
+// forward sends a request to the datasource server and writes the
+// response body to dst.
+func (p *datasourceProxy) forward(ctx context.Context, method, path string, header http.Header, body []byte, dst *bytes.Buffer) (int, http.Header, error) {
+	resp, err := p.send(ctx, method, path, header, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if _, err := dst.ReadFrom(resp.Body); err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, resp.Header, nil
+}
+
+// startProxy serves h on addr in the background, until g stops.
+func startProxy(addr string, h http.Handler, g *group) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("datasource proxy listening on %s; point Grafana's datasource to it", l.Addr())
+	g.serve(l, h)
+	return nil
+}
@@ -0,0 +1,170 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// A datapoint is a value and its timestamp in milliseconds, as in the
+// responses of grada's /query.
+type datapoint [2]float64
+
+// queryResult is one series of a /query response, with typed data points.
+// Decoding it takes no allocation per point, unlike queryResponse, which
+// keeps malformed points around for the simulator to report.
+type queryResult struct {
+	Target     string      `json:"target"`
+	Datapoints []datapoint `json:"datapoints"`
+}
+
+// queryChunkSize is the size of the chunks that a queryStream writes.
+const queryChunkSize = 32 << 10
+
+// A queryEncoder writes results to w as a /query response.
+type queryEncoder func(w io.Writer, results []queryResult) error
+
+// queryEncoders are the encoders that -json-encoder can choose from. To
+// try another JSON library, add it here from a file of its own.
+var queryEncoders = map[string]queryEncoder{
+	"fast": writeQueryResults,
+	"std": func(w io.Writer, results []queryResult) error {
+		return json.NewEncoder(w).Encode(results)
+	},
+}
+
+// writeQueryResults writes results to w as a /query response. It formats
+// the numbers by hand instead of going through reflection, so a response
+// with 100k points does not create 100k short-lived values for the garbage
+// collector, whose pauses would show up as gaps in other metrics.
+func writeQueryResults(w io.Writer, results []queryResult) error {
+	qs := newQueryStream(w)
+	for _, r := range results {
+		if err := qs.write(r); err != nil {
+			qs.close()
+			return err
+		}
+	}
+	return qs.close()
+}
+
+// A queryStream writes a /query response one series at a time, in chunks
+// of about queryChunkSize bytes. If w is an http.ResponseWriter, every
+// chunk goes out to the client right away, so a response for a long time
+// range never has to be in memory as a whole.
+type queryStream struct {
+	w     io.Writer
+	chunk *[]byte
+	b     []byte
+	n     int // series written
+}
+
+func newQueryStream(w io.Writer) *queryStream {
+	chunk := getChunk()
+	return &queryStream{w: w, chunk: chunk, b: append((*chunk)[:0], '[')}
+}
+
+func (qs *queryStream) flush() error {
+	_, err := qs.w.Write(qs.b)
+	qs.b = qs.b[:0]
+	if f, ok := qs.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return err
+}
+
+// write adds a series to the response.
+func (qs *queryStream) write(r queryResult) error {
+	if qs.n > 0 {
+		qs.b = append(qs.b, ',')
+	}
+	qs.n++
+	target, err := json.Marshal(r.Target)
+	if err != nil {
+		return err
+	}
+	b := append(qs.b, `{"target":`...)
+	b = append(b, target...)
+	b = append(b, `,"datapoints":[`...)
+	for j, p := range r.Datapoints {
+		if j > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '[')
+		b = appendJSONFloat(b, p[0])
+		b = append(b, ',')
+		b = appendJSONFloat(b, p[1])
+		b = append(b, ']')
+		if len(b) >= queryChunkSize {
+			qs.b = b
+			if err := qs.flush(); err != nil {
+				return err
+			}
+			b = qs.b
+		}
+	}
+	qs.b = append(b, "]}"...)
+	return nil
+}
+
+// close ends the response and writes what is left. The stream must not
+// be used afterwards.
+func (qs *queryStream) close() error {
+	qs.b = append(qs.b, ']')
+	err := qs.flush()
+	*qs.chunk = qs.b
+	putChunk(qs.chunk)
+	return err
+}
+
+// readQueryResults decodes a /query response from r one series at a time
+// and passes each one to f. The series passed to f is reused for the next
+// one, so f must not keep it.
+func readQueryResults(r io.Reader, f func(r *queryResult) error) error {
+	dec := json.NewDecoder(r)
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('[') {
+		return fmt.Errorf("not a query response: starts with %v", t)
+	}
+	var qr queryResult
+	for dec.More() {
+		qr.Target, qr.Datapoints = "", qr.Datapoints[:0]
+		if err := dec.Decode(&qr); err != nil {
+			return err
+		}
+		if err := f(&qr); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// appendJSONFloat formats v like encoding/json does. JSON has no NaN or
+// infinity, so these become null.
+func appendJSONFloat(b []byte, v float64) []byte {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return append(b, "null"...)
+	}
+	// Timestamps are whole milliseconds, and integers format much faster.
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.AppendInt(b, int64(v), 10)
+	}
+	format := byte('f')
+	if abs := math.Abs(v); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, v, format, -1, 64)
+	if format == 'e' {
+		// Like encoding/json, turn 1e-07 into 1e-7.
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
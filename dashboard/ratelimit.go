@@ -0,0 +1,135 @@
+package dashboard
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimitSpec is what the -rate-limit flag describes, as in
+// "udp.*:50:drop": which metrics, how many samples per second they accept
+// at most, and what happens to the samples beyond that.
+type rateLimitSpec struct {
+	pattern string
+	rate    float64 // samples per second
+	// mode is "drop" (the sample is lost), "coalesce" (the latest sample
+	// waits for the next free slot, replacing the one that waited
+	// before), or "block" (Add waits for the next free slot).
+	mode string
+}
+
+func parseRateLimitSpec(s string) (rateLimitSpec, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return rateLimitSpec{}, fmt.Errorf("rate limit %q: want <metric>:<samples per second>[:drop|coalesce|block]", s)
+	}
+	spec := rateLimitSpec{pattern: parts[0], mode: "drop"}
+	rate, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || rate <= 0 {
+		return spec, fmt.Errorf("rate limit %q: invalid rate %q", s, parts[1])
+	}
+	spec.rate = rate
+	if len(parts) == 3 {
+		spec.mode = parts[2]
+	}
+	switch spec.mode {
+	case "drop", "coalesce", "block":
+	default:
+		return spec, fmt.Errorf("rate limit %q: unknown mode %q (drop, coalesce, block)", s, spec.mode)
+	}
+	return spec, nil
+}
+
+func (spec rateLimitSpec) matches(name string) bool {
+	return matchPattern(spec.pattern, name)
+}
+
+// A rateLimiter keeps a producer that runs wild, like a loop that calls
+// Add without ever waiting, from flooding the buffer of its metric and
+// the CPU of the app. It is a token bucket that holds up to a second's
+// worth of samples, so short bursts go through.
+type rateLimiter struct {
+	spec rateLimitSpec
+	// limited counts the samples over the limit since the self-metrics
+	// last looked; see selfMetrics.addRateLimited.
+	limited uint64
+
+	mu         sync.Mutex
+	tokens     float64
+	last       time.Time
+	pending    float64 // the sample that waits, for "coalesce"
+	hasPending bool
+}
+
+func newRateLimiter(spec rateLimitSpec) *rateLimiter {
+	return &rateLimiter{spec: spec, tokens: spec.burst(), last: time.Now()}
+}
+
+// burst is the number of samples that may arrive at once.
+func (spec rateLimitSpec) burst() float64 {
+	if spec.rate < 1 {
+		return 1
+	}
+	return spec.rate
+}
+
+// refill adds the tokens that accrued since the last call.
+func (l *rateLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.spec.rate
+	if b := l.spec.burst(); l.tokens > b {
+		l.tokens = b
+	}
+	l.last = now
+}
+
+// wait returns the time until the bucket holds a token.
+func (l *rateLimiter) wait() time.Duration {
+	return time.Duration((1 - l.tokens) / l.spec.rate * float64(time.Second))
+}
+
+// sample passes v on to pass if the limit allows it, and otherwise drops
+// it, holds it back, or waits, depending on the mode. Held back samples
+// get passed on from a timer.
+func (l *rateLimiter) sample(v float64, pass func(v float64)) {
+	l.mu.Lock()
+	l.refill(time.Now())
+	if l.tokens >= 1 && !l.hasPending {
+		l.tokens--
+		l.mu.Unlock()
+		pass(v)
+		return
+	}
+	atomic.AddUint64(&l.limited, 1)
+	switch l.spec.mode {
+	case "coalesce":
+		if !l.hasPending {
+			time.AfterFunc(l.wait(), func() { l.flush(pass) })
+		}
+		l.pending, l.hasPending = v, true
+		l.mu.Unlock()
+	case "block":
+		// The token is taken now, so that the producers that wait get
+		// one slot each.
+		l.tokens--
+		d := time.Duration(-l.tokens / l.spec.rate * float64(time.Second))
+		l.mu.Unlock()
+		time.Sleep(d)
+		pass(v)
+	default:
+		l.mu.Unlock()
+	}
+}
+
+// flush passes on the sample that waits.
+func (l *rateLimiter) flush(pass func(v float64)) {
+	l.mu.Lock()
+	l.refill(time.Now())
+	l.tokens--
+	v := l.pending
+	l.hasPending = false
+	l.mu.Unlock()
+	pass(v)
+}
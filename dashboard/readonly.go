@@ -0,0 +1,26 @@
+package dashboard
+
+import "net/http"
+
+// readOnlyPaths are the endpoints that remain with -read-only: those of
+// the SimpleJSON datasource, which only read.
+var readOnlyPaths = map[string]bool{
+	"/":            true,
+	"/search":      true,
+	"/query":       true,
+	"/annotations": true,
+}
+
+// readOnly is the middleware of the API server with -read-only. It
+// refuses everything but datasource requests, so that an app exposed
+// beyond a trusted network cannot be told to silence alerts or swap the
+// sources of metrics, and does not give away more than Grafana shows.
+func readOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !readOnlyPaths[r.URL.Path] {
+			http.Error(w, "not available in read-only mode", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,189 @@
+package dashboard
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// exchange is one datasource request and its response, as recorded by
+// -record. A recording is a file with one exchange per line.
+type exchange struct {
+	Time     time.Time     `json:"time"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Request  string        `json:"request"`
+	Status   int           `json:"status"`
+	Response string        `json:"response"`
+	Duration time.Duration `json:"duration"`
+}
+
+// newRecorder returns a function that appends exchanges to the file at
+// path. With a recording, a "panel shows no data" report can be replayed
+// offline against a new build.
+func newRecorder(path string) (func(exchange), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	enc := json.NewEncoder(f)
+	return func(ex exchange) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(ex); err != nil {
+			log.Println("record:", err)
+		}
+	}, nil
+}
+
+// shiftRange moves the time range of a recorded /query request by d, so
+// that a request for "the last 5 minutes" asks for the last 5 minutes
+// again at replay time.
+func shiftRange(body string, d time.Duration) string {
+	var q map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &q); err != nil {
+		return body
+	}
+	r, ok := q["range"].(map[string]interface{})
+	if !ok {
+		return body
+	}
+	for _, k := range []string{"from", "to"} {
+		s, _ := r[k].(string)
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			continue
+		}
+		r[k] = t.Add(d).Format(time.RFC3339Nano)
+	}
+	b, err := json.Marshal(q)
+	if err != nil {
+		return body
+	}
+	return string(b)
+}
+
+// replay sends the requests of a recording to a running app and compares
+// the responses with the recorded ones.
+func replay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	addr := fs.String("url", ":"+strconv.Itoa(gradaPort()), "address of the app's datasource server")
+	shift := fs.Bool("shift", true, "move the time ranges of the requests to the present")
+	verbose := fs.Bool("v", false, "print every response")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: diydashboard replay [flags] <recording>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	url := baseURL(*addr)
+	var first time.Time
+	start := time.Now()
+	var n, differ int
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		var ex exchange
+		if err := json.Unmarshal(sc.Bytes(), &ex); err != nil {
+			return fmt.Errorf("%s: line %d: %s", fs.Arg(0), n+1, err)
+		}
+		n++
+		if first.IsZero() {
+			first = ex.Time
+		}
+		body := ex.Request
+		if *shift {
+			// Keep the requests' distances in time to each other.
+			body = shiftRange(body, start.Sub(first))
+		}
+		req, err := http.NewRequest(ex.Method, url+ex.Path, bytes.NewReader([]byte(body)))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		t := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		got, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		diff := compareResponses(ex, resp.StatusCode, got)
+		if diff != "" {
+			differ++
+		}
+		fmt.Printf("%s %s: %d in %s (recorded: %d in %s) %s\n", ex.Method, ex.Path, resp.StatusCode, time.Since(t).Round(time.Microsecond), ex.Status, ex.Duration.Round(time.Microsecond), diff)
+		if *verbose {
+			fmt.Printf("  request:  %s\n  response: %s\n", body, bytes.TrimSpace(got))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	fmt.Printf("%d requests replayed, %d with different responses\n", n, differ)
+	return nil
+}
+
+// compareResponses returns a short description of how a replayed response
+// differs from the recorded one, or "" if it does not. The values differ
+// anyway, so for /query responses it only compares which series have data
+// points and which have none.
+func compareResponses(ex exchange, status int, got []byte) string {
+	if status != ex.Status {
+		return "status differs"
+	}
+	var old, cur []queryResult
+	if json.Unmarshal([]byte(ex.Response), &old) != nil || json.Unmarshal(got, &cur) != nil {
+		if string(bytes.TrimSpace(got)) != string(bytes.TrimSpace([]byte(ex.Response))) {
+			return "response differs"
+		}
+		return ""
+	}
+	count := func(l []queryResult) map[string]int {
+		m := map[string]int{}
+		for _, r := range l {
+			m[r.Target] = len(r.Datapoints)
+		}
+		return m
+	}
+	o, n := count(old), count(cur)
+	var diff string
+	for t, c := range o {
+		nc, ok := n[t]
+		switch {
+		case !ok:
+			diff += fmt.Sprintf("[%s: missing] ", t)
+		case (c == 0) != (nc == 0):
+			diff += fmt.Sprintf("[%s: %d -> %d points] ", t, c, nc)
+		}
+	}
+	for t := range n {
+		if _, ok := o[t]; !ok {
+			diff += fmt.Sprintf("[%s: new] ", t)
+		}
+	}
+	return diff
+}
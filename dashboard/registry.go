@@ -0,0 +1,374 @@
+package dashboard
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+// Metrics that are created on the fly (for example, because a sensor sent
+// a value for a name we have not seen yet) get the same retention as the
+// CPU demo metrics: five minutes at one value per second.
+const (
+	defaultTimeRange = 5 * time.Minute
+	defaultInterval  = time.Second
+)
+
+// series wraps a grada Metric. grada's Metric is write-only, so series
+// remembers the most recent sample and passes every new sample on to its
+// observers (alert rules, for example).
+type series struct {
+	name string
+	reg  *registry
+	buf  atomic.Value // a *shardedBuffer if the registry shards new series
+	// feeder is a *feeder while a source that the app runs feeds the
+	// series instead of the callers of Add.
+	feeder atomic.Value
+	dec    *decimator   // nil: keep all samples
+	band   *deadband    // nil: store every change
+	limit  *rateLimiter // nil: no limit
+	paused int32        // running, paused, or pausedOnce; see admit
+
+	mu sync.Mutex
+	// The grada Metric and the number of points in its buffer change
+	// when the buffer gets resized.
+	*grada.Metric
+	capacity    int
+	unit        string // a Grafana unit ID, like "percent" or "bytes"
+	description string
+	labels      map[string]string
+	alias       string // a template for the display name; see renderAlias
+	last        float64
+	lastTime    time.Time
+	firstTime   time.Time              // of the first sample in the buffer
+	count       int64                  // samples stored so far
+	buffered    int64                  // samples stored since the buffer was created or resized
+	recent      [catalogSamples]sample // the last samples, in a ring indexed by count
+	observers   []func(v float64, t time.Time)
+}
+
+func newSeries(name string, m *grada.Metric, capacity int, reg *registry) *series {
+	s := &series{Metric: m, name: name, capacity: capacity, reg: reg}
+	if reg.shards > 0 {
+		s.buf.Store(newShardedBuffer(reg.shards))
+	}
+	for _, spec := range reg.decimate {
+		if spec.matches(name) {
+			s.dec = &decimator{spec: spec}
+			break
+		}
+	}
+	for _, spec := range reg.deadbands {
+		if spec.matches(name) {
+			s.band = &deadband{spec: spec}
+			break
+		}
+	}
+	for _, spec := range reg.rateLimits {
+		if spec.matches(name) {
+			s.limit = newRateLimiter(spec)
+			break
+		}
+	}
+	return s
+}
+
+// Add adds a value to the underlying grada Metric and notifies the observers.
+// A running scenario may replace the value, and in chaos mode, the value
+// may arrive late or not at all. While a feeder runs for s, Add does
+// nothing.
+func (s *series) Add(v float64) {
+	if f, _ := s.feeder.Load().(*feeder); f != nil {
+		return
+	}
+	s.feed(v)
+}
+
+// feed is Add for the feeder of s. While the collector of s is paused,
+// the sample gets dropped. Samples beyond the rate limit of s, if it has
+// one, get dropped, held back, or make feed wait.
+func (s *series) feed(v float64) {
+	if !s.admit() {
+		return
+	}
+	if s.limit != nil {
+		s.limit.sample(v, s.pass)
+		return
+	}
+	s.pass(v)
+}
+
+// pass is feed after the rate limit.
+func (s *series) pass(v float64) {
+	if sc, _ := s.reg.scenario.Load().(*scenario); sc != nil {
+		var ok bool
+		if v, ok = sc.apply(s.name, v, s.reg.clock.Now()); !ok {
+			return
+		}
+	}
+	if c, _ := s.reg.chaos.Load().(*chaos); c != nil {
+		c.sample(func() { s.add(v) })
+		return
+	}
+	s.add(v)
+}
+
+func (s *series) add(v float64) {
+	t := s.reg.clock.Now()
+	if s.dec != nil {
+		var ok bool
+		if v, ok = s.dec.sample(v, t); !ok {
+			return
+		}
+	}
+	if s.band != nil && !s.band.sample(v, t) {
+		return
+	}
+	if b, _ := s.buf.Load().(*shardedBuffer); b != nil {
+		b.add(v, t)
+		return
+	}
+	s.store(v, t)
+}
+
+// store passes a sample on to grada and the observers. Sharded series
+// store their samples in the registry's flusher.
+func (s *series) store(v float64, t time.Time) {
+	s.storeStamped(v, t, time.Time{})
+}
+
+// storeStamped is store with the timestamp that grada gets: wall, or the
+// time of the call if wall is zero. Samples pulled from an agent keep the
+// time they were taken.
+func (s *series) storeStamped(v float64, t, wall time.Time) {
+	s.mu.Lock()
+	if wall.IsZero() {
+		s.Metric.Add(v)
+	} else {
+		s.Metric.AddWithTime(v, wall)
+	}
+	if s.buffered == 0 {
+		s.firstTime = t
+	}
+	s.recent[s.count%catalogSamples] = sample{v, t}
+	s.count++
+	s.buffered++
+	s.last, s.lastTime = v, t
+	observers := s.observers
+	s.mu.Unlock()
+	for _, o := range observers {
+		o(v, t)
+	}
+}
+
+// backfill stores a sample from the past, taken at t in the registry's
+// time, directly in grada's buffer, with the matching wall clock time as
+// its timestamp. Scenarios, chaos, decimation, and the observers skip
+// backfilled samples: alert rules and derived series start with the live
+// ones. Samples must be backfilled in order, before the live ones.
+func (s *series) backfill(v float64, t time.Time) {
+	wall := wallTime(s.reg.clock, t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Metric.AddWithTime(v, wall)
+	if s.buffered == 0 {
+		s.firstTime = t
+	}
+	s.recent[s.count%catalogSamples] = sample{v, t}
+	s.count++
+	s.buffered++
+	s.last, s.lastTime = v, t
+}
+
+// latest returns the most recent value and its timestamp. The timestamp is
+// zero if the series has not received any value yet.
+func (s *series) latest() (float64, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last, s.lastTime
+}
+
+// describe sets the unit and the description of the series. Both end up
+// in generated Grafana dashboards. unit is a Grafana unit ID like
+// "percent", "bytes", "ms", or "s".
+func (s *series) describe(unit, description string) *series {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unit, s.description = unit, description
+	return s
+}
+
+// meta returns the unit and the description of the series.
+func (s *series) meta() (unit, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unit, s.description
+}
+
+// label attaches a label like host=host-01 to the series. grada's
+// datasource protocol has no labels, so they only serve the template
+// variable queries on the API server's /search.
+func (s *series) label(key, value string) *series {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.labels == nil {
+		s.labels = map[string]string{}
+	}
+	s.labels[key] = value
+	return s
+}
+
+// labelValue returns the value of the label key, or "" if the series has
+// no such label.
+func (s *series) labelValue(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.labels[key]
+}
+
+// setAlias sets the template for the display name of the series in
+// /query responses.
+func (s *series) setAlias(template string) *series {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alias = template
+	return s
+}
+
+// aliasTemplate returns the alias template of the series, or "".
+func (s *series) aliasTemplate() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.alias
+}
+
+// observe registers a function that gets called for every new sample.
+// Observers run synchronously in Add and therefore must not block.
+func (s *series) observe(o func(v float64, t time.Time)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observers = append(s.observers[:len(s.observers):len(s.observers)], o)
+}
+
+// registry keeps track of the metrics this app has created. grada's
+// Dashboard does not allow looking up a Metric by name, so anything that
+// receives data for a metric by name goes through the registry.
+//
+// The registry also holds the clock for everything that deals with time,
+// the time range of new metrics, and the scenario (a *scenario) and chaos
+// settings (a *chaos), if any, that apply to every series. With shards
+// greater than 0, new series stage their samples in a shardedBuffer. New
+// series that match a decimate spec keep only some of their samples,
+// those that match a deadband spec only the samples that differ from the
+// last one, and those that match a rate limit spec accept only so many
+// per second.
+type registry struct {
+	dash       *grada.Dashboard
+	clock      clock
+	timeRange  time.Duration
+	shards     int
+	decimate   []decimateSpec
+	deadbands  []deadbandSpec
+	rateLimits []rateLimitSpec
+	scenario   atomic.Value
+	chaos      atomic.Value
+	mu         sync.Mutex
+	metrics    map[string]*series
+	created    []func(s *series)        // called for every new series; see eachSeries
+	windows    map[string]*sampleWindow // for expressions; see window
+	prefixes   map[string]bool          // of federated metrics; see federated
+	group      *group                   // runs the background work
+}
+
+func newRegistry(dash *grada.Dashboard) *registry {
+	return &registry{
+		dash:      dash,
+		clock:     realClock{},
+		timeRange: defaultTimeRange,
+		metrics:   map[string]*series{},
+		windows:   map[string]*sampleWindow{},
+		prefixes:  map[string]bool{},
+		group:     newGroup(),
+	}
+}
+
+// register remembers a metric that was created directly on the dashboard
+// with a buffer of capacity points.
+func (r *registry) register(name string, m *grada.Metric, capacity int) *series {
+	r.mu.Lock()
+	s := newSeries(name, m, capacity, r)
+	r.metrics[name] = s
+	created := r.created
+	r.mu.Unlock()
+	for _, f := range created {
+		f(s)
+	}
+	return s
+}
+
+// eachSeries calls f for every series that exists, and from then on for
+// every new series, right after it is created.
+func (r *registry) eachSeries(f func(s *series)) {
+	r.mu.Lock()
+	r.created = append(r.created[:len(r.created):len(r.created)], f)
+	existing := make([]*series, 0, len(r.metrics))
+	for _, s := range r.metrics {
+		existing = append(existing, s)
+	}
+	r.mu.Unlock()
+	for _, s := range existing {
+		f(s)
+	}
+}
+
+// get returns the metric with the given name, if it exists.
+func (r *registry) get(name string) (*series, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.metrics[name]
+	return s, ok
+}
+
+// list returns all series, ordered by name.
+func (r *registry) list() []*series {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l := make([]*series, 0, len(r.metrics))
+	for _, s := range r.metrics {
+		l = append(l, s)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].name < l[j].name })
+	return l
+}
+
+// getOrCreate returns the metric with the given name, creating it with the
+// registry's time range at one value per second if it does not exist yet.
+func (r *registry) getOrCreate(name string) (*series, error) {
+	return r.getOrCreateWith(name, r.timeRange, defaultInterval)
+}
+
+// getOrCreateWith is like getOrCreate, but a new metric gets a buffer for
+// timeRange at one value per interval.
+func (r *registry) getOrCreateWith(name string, timeRange, interval time.Duration) (*series, error) {
+	r.mu.Lock()
+	if s, ok := r.metrics[name]; ok {
+		r.mu.Unlock()
+		return s, nil
+	}
+	m, err := r.dash.CreateMetric(name, timeRange, interval)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	s := newSeries(name, m, int(timeRange/interval), r)
+	r.metrics[name] = s
+	created := r.created
+	r.mu.Unlock()
+	for _, f := range created {
+		f(s)
+	}
+	return s, nil
+}
@@ -0,0 +1,273 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rollupDays is the number of days that rollups keep, today included.
+const rollupDays = 8
+
+// rollupPrefix starts the /query targets that ask for rollups.
+const rollupPrefix = "rollup:"
+
+// The buffers of the metrics cover minutes, not days, so a panel cannot
+// ask for "yesterday's peak" of a metric. With -rollups, the app keeps the
+// minimum, maximum, and average of every metric per day, for a week, and
+// the proxy answers targets like "rollup:yesterday" with a table: one row
+// per metric. A table panel with that target sits next to the live graphs
+// as a summary. The days begin at midnight in the -timezone zone.
+
+// dayStats summarizes the stored samples of a metric on one day.
+type dayStats struct {
+	start, end time.Time // the day, from midnight to midnight
+	min, max   float64
+	sum        float64
+	n          int64
+}
+
+// metricRollup holds the days of a metric, oldest first.
+type metricRollup struct {
+	mu   sync.Mutex
+	days []dayStats
+}
+
+func (m *metricRollup) add(v float64, t time.Time) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n := len(m.days); n == 0 || !t.Before(m.days[n-1].end) {
+		start := midnight(t)
+		m.days = append(m.days, dayStats{start: start, end: start.AddDate(0, 0, 1), min: v, max: v})
+		if len(m.days) > rollupDays {
+			m.days = append(m.days[:0], m.days[len(m.days)-rollupDays:]...)
+		}
+	}
+	// A sample from before midnight that arrives late counts for the
+	// new day.
+	d := &m.days[len(m.days)-1]
+	d.min, d.max = math.Min(d.min, v), math.Max(d.max, v)
+	d.sum += v
+	d.n++
+}
+
+// day returns the stats of the day that starts at start, if there are any.
+func (m *metricRollup) day(start time.Time) (dayStats, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.days {
+		if d.start.Equal(start) {
+			return d, true
+		}
+	}
+	return dayStats{}, false
+}
+
+// midnight returns the start of the day of t in displayZone.
+func midnight(t time.Time) time.Time {
+	y, m, d := t.In(displayZone).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, displayZone)
+}
+
+// rollups collects the daily stats of every metric.
+type rollups struct {
+	reg *registry
+
+	mu      sync.Mutex
+	metrics map[string]*metricRollup
+}
+
+// addRollups starts collecting the daily stats of every metric, including
+// the ones that get created later.
+func addRollups(reg *registry) *rollups {
+	ru := &rollups{reg: reg, metrics: map[string]*metricRollup{}}
+	reg.eachSeries(func(s *series) {
+		m := &metricRollup{}
+		ru.mu.Lock()
+		ru.metrics[s.name] = m
+		ru.mu.Unlock()
+		s.observe(m.add)
+	})
+	return ru
+}
+
+// parseTarget parses a target like "rollup:yesterday",
+// "rollup:today:CPU*", or "rollup:2026-10-15:disk.*" into the start of the
+// day and the metric pattern, which is "*" if the target has none.
+func (ru *rollups) parseTarget(target string) (time.Time, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(target, rollupPrefix), ":", 2)
+	pattern := "*"
+	if len(parts) == 2 && parts[1] != "" {
+		pattern = parts[1]
+	}
+	today := midnight(ru.reg.clock.Now())
+	switch parts[0] {
+	case "today":
+		return today, pattern, nil
+	case "yesterday", "":
+		return today.AddDate(0, 0, -1), pattern, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", parts[0], displayZone)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("target %q: want rollup:<today|yesterday|YYYY-MM-DD>[:<metric>]", target)
+	}
+	return day, pattern, nil
+}
+
+// tableColumn and tableResult are a table in a /query response of the
+// SimpleJSON datasource.
+type tableColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type tableResult struct {
+	Type    string          `json:"type"` // always "table"
+	Columns []tableColumn   `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// table returns the rollups of the day that starts at day, of the metrics
+// that match pattern, sorted by name. Metrics without samples on that day
+// have no row.
+func (ru *rollups) table(day time.Time, pattern string) tableResult {
+	t := tableResult{
+		Type: "table",
+		Columns: []tableColumn{
+			{"Metric", "string"}, {"Min", "number"}, {"Max", "number"}, {"Avg", "number"}, {"Samples", "number"},
+		},
+		Rows: [][]interface{}{},
+	}
+	ru.mu.Lock()
+	names := make([]string, 0, len(ru.metrics))
+	for name := range ru.metrics {
+		if matchPattern(pattern, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	metrics := make([]*metricRollup, len(names))
+	for i, name := range names {
+		metrics[i] = ru.metrics[name]
+	}
+	ru.mu.Unlock()
+	for i, m := range metrics {
+		if d, ok := m.day(day); ok {
+			t.Rows = append(t.Rows, []interface{}{names[i], d.min, d.max, d.sum / float64(d.n), d.n})
+		}
+	}
+	return t
+}
+
+// handler returns a handler that answers the rollup targets of /query
+// requests, and passes the other targets on to next. The tables follow
+// the series of next. /search lists the rollup targets of today and
+// yesterday, too.
+func (ru *rollups) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search":
+			ru.search(w, r, next)
+		case "/query":
+			ru.query(w, r, next)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (ru *rollups) search(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := serveBuffered(next, r, body)
+	defer putBuffer(resp.body)
+	var names []string
+	if resp.status != http.StatusOK || json.Unmarshal(resp.body.Bytes(), &names) != nil {
+		resp.writeTo(w)
+		return
+	}
+	var req struct {
+		Target string `json:"target"`
+	}
+	json.Unmarshal(body, &req)
+	for _, name := range []string{rollupPrefix + "yesterday", rollupPrefix + "today"} {
+		if strings.HasPrefix(name, req.Target) {
+			names = append(names, name)
+		}
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+func (ru *rollups) query(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var q map[string]json.RawMessage
+	var targets []json.RawMessage
+	if json.Unmarshal(body, &q) != nil || json.Unmarshal(q["targets"], &targets) != nil {
+		next.ServeHTTP(w, withBody(r, body))
+		return
+	}
+	var rest []json.RawMessage
+	var tables []tableResult
+	for _, raw := range targets {
+		var t struct {
+			Target string `json:"target"`
+		}
+		json.Unmarshal(raw, &t)
+		if !strings.HasPrefix(t.Target, rollupPrefix) {
+			rest = append(rest, raw)
+			continue
+		}
+		day, pattern, err := ru.parseTarget(t.Target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tables = append(tables, ru.table(day, pattern))
+	}
+	if len(tables) == 0 {
+		next.ServeHTTP(w, withBody(r, body))
+		return
+	}
+
+	// The tables do not fit queryResult, so the response of next gets
+	// merged as raw JSON.
+	results := []json.RawMessage{}
+	if len(rest) > 0 {
+		restBody, err := withTargets(q, rest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp := serveBuffered(next, r, restBody)
+		defer putBuffer(resp.body)
+		if resp.status != http.StatusOK {
+			resp.writeTo(w)
+			return
+		}
+		if err := json.Unmarshal(resp.body.Bytes(), &results); err != nil {
+			http.Error(w, "invalid /query response: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	for _, t := range tables {
+		b, _ := json.Marshal(t)
+		results = append(results, b)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
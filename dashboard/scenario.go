@@ -0,0 +1,176 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A scenario scripts an incident, for repeatable incident-response
+// exercises. It overrides what the generators produce:
+//
+//	# CPU spike, then the network goes away
+//	at t+2m raise CPU1 to 95 for 90s
+//	at t+3m drop net.* to 0
+//	at t+5m stop sensor for 2m
+//
+// "raise", "drop", and "set" replace the values of a metric with a fixed
+// value, "stop" swallows its samples, as if the collector had died. The
+// metric is a name, or a prefix followed by "*" for all metrics that
+// start with it.
+// Without "for", the change lasts until the end. Statements are separated
+// by newlines or semicolons; "#" starts a comment. t is the start of the
+// scenario.
+type scenario struct {
+	start time.Time
+	all   []scenarioEvent // by time
+}
+
+type scenarioEvent struct {
+	stmt   string
+	at     time.Duration
+	dur    time.Duration // 0: until the end
+	verb   string
+	metric string // a pattern; see matchPattern
+	value  float64
+}
+
+func (e scenarioEvent) active(elapsed time.Duration) bool {
+	return elapsed >= e.at && (e.dur == 0 || elapsed < e.at+e.dur)
+}
+
+// parseScenario parses a scenario script.
+func parseScenario(src string) (*scenario, error) {
+	sc := &scenario{}
+	for _, line := range strings.Split(src, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		for _, stmt := range strings.Split(line, ";") {
+			stmt = strings.TrimSpace(stmt)
+			if stmt == "" {
+				continue
+			}
+			e, err := parseScenarioEvent(stmt)
+			if err != nil {
+				return nil, err
+			}
+			sc.all = append(sc.all, e)
+		}
+	}
+	sort.SliceStable(sc.all, func(i, j int) bool { return sc.all[i].at < sc.all[j].at })
+	return sc, nil
+}
+
+// parseScenarioEvent parses a statement like "at t+2m raise CPU1 to 95 for 90s".
+func parseScenarioEvent(stmt string) (scenarioEvent, error) {
+	e := scenarioEvent{stmt: stmt}
+	f := strings.Fields(stmt)
+	if len(f) < 4 || f[0] != "at" || !strings.HasPrefix(f[1], "t+") {
+		return e, fmt.Errorf("scenario: %q: expected \"at t+<duration> <action> <metric> ...\"", stmt)
+	}
+	at, err := parseDuration(f[1][2:])
+	if err != nil {
+		return e, fmt.Errorf("scenario: %q: %s", stmt, err)
+	}
+	e.at, e.verb, e.metric = at, f[2], f[3]
+	rest := f[4:]
+	switch e.verb {
+	case "raise", "drop", "set":
+		if len(rest) < 2 || rest[0] != "to" {
+			return e, fmt.Errorf("scenario: %q: expected \"%s <metric> to <value>\"", stmt, e.verb)
+		}
+		if e.value, err = strconv.ParseFloat(rest[1], 64); err != nil {
+			return e, fmt.Errorf("scenario: %q: invalid value %q", stmt, rest[1])
+		}
+		rest = rest[2:]
+	case "stop":
+	default:
+		return e, fmt.Errorf("scenario: %q: unknown action %q (raise, drop, set, stop)", stmt, e.verb)
+	}
+	if len(rest) > 0 {
+		if len(rest) != 2 || rest[0] != "for" {
+			return e, fmt.Errorf("scenario: %q: unexpected %q", stmt, strings.Join(rest, " "))
+		}
+		if e.dur, err = parseDuration(rest[1]); err != nil {
+			return e, fmt.Errorf("scenario: %q: %s", stmt, err)
+		}
+	}
+	return e, nil
+}
+
+// apply returns the value that metric should get instead of v at time t,
+// and false if the sample should be swallowed. The latest active event
+// for the metric wins.
+func (sc *scenario) apply(metric string, v float64, t time.Time) (float64, bool) {
+	elapsed := t.Sub(sc.start)
+	var current *scenarioEvent
+	for i, e := range sc.all {
+		if e.active(elapsed) && matchPattern(e.metric, metric) && (current == nil || e.at >= current.at) {
+			current = &sc.all[i]
+		}
+	}
+	switch {
+	case current == nil:
+		return v, true
+	case current.verb == "stop":
+		return 0, false
+	}
+	return current.value, true
+}
+
+// runScenario starts sc on reg's clock. From then on, every series asks
+// the scenario for its values. The scenario logs and annotates each event
+// as it starts, so that the exercise can be reviewed on the dashboard. An
+// event that matches no metric when it starts gets a warning, as it does
+// nothing.
+func runScenario(reg *registry, sc *scenario, notes *annotationStore) {
+	sc.start = reg.clock.Now()
+	reg.scenario.Store(sc)
+	log.Printf("scenario started with %d events", len(sc.all))
+	ticks := reg.clock.Tick(time.Second)
+	reg.group.Go(func(ctx context.Context) error {
+		next := 0
+		for next < len(sc.all) {
+			var t time.Time
+			select {
+			case t = <-ticks:
+			case <-ctx.Done():
+				return nil
+			}
+			for ; next < len(sc.all) && t.Sub(sc.start) >= sc.all[next].at; next++ {
+				e := sc.all[next]
+				log.Println("scenario:", e.stmt)
+				if !matchesAny(reg, e.metric) {
+					log.Printf("scenario: %q matches no metric", e.metric)
+				}
+				notes.add(annotation{Time: t, Title: "Scenario: " + e.stmt, Tags: []string{"scenario", e.metric}})
+			}
+		}
+		return nil
+	})
+}
+
+// matchesAny reports whether pattern matches a metric of reg.
+func matchesAny(reg *registry, pattern string) bool {
+	for _, s := range reg.list() {
+		if matchPattern(pattern, s.name) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadScenario reads a scenario script from a file.
+func loadScenario(path string) (*scenario, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseScenario(string(b))
+}
@@ -0,0 +1,178 @@
+package dashboard
+
+import (
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// selfMetricsInterval is how often the app samples its own runtime
+// statistics. runtime.ReadMemStats stops the world briefly, so not too
+// often.
+const selfMetricsInterval = 5 * time.Second
+
+// selfMetrics records the app's own statistics in metrics that start with
+// "app.", so that performance problems of the backend show up on the very
+// dashboard it serves:
+//
+//   - app.heap: bytes on the heap
+//   - app.alloc_rate: bytes allocated per second
+//   - app.allocs: allocations per second
+//   - app.gc: garbage collections per minute
+//   - app.gc_pause: the longest GC pause in the interval
+//   - app.pool_reuse: share of buffer requests that the pools served
+//     with a buffer they had
+//   - app.latency.<endpoint>: mean response time of an HTTP endpoint
+//   - app.rate_limited.<metric>: samples per second over the rate limit
+//     of a metric, once it has been exceeded
+//
+// While the datasource proxy runs, app.clock_skew shows the clock skew
+// between Grafana and the app (see skewDetector).
+type selfMetrics struct {
+	reg *registry
+
+	mu        sync.Mutex
+	latencies map[string]*latencyStats // by endpoint
+}
+
+type latencyStats struct {
+	count int
+	total time.Duration
+}
+
+// addSelfMetrics registers the self-metrics and samples them every
+// selfMetricsInterval.
+func addSelfMetrics(reg *registry) (*selfMetrics, error) {
+	names := []struct{ name, unit, description string }{
+		{"app.heap", "bytes", "Bytes on the heap"},
+		{"app.alloc_rate", "Bps", "Bytes allocated per second"},
+		{"app.allocs", "short", "Allocations per second"},
+		{"app.gc", "short", "Garbage collections per minute"},
+		{"app.gc_pause", "ms", "Longest garbage collection pause"},
+		{"app.pool_reuse", "percentunit", "Share of buffer requests served from the pools"},
+	}
+	metrics := make([]*series, len(names))
+	for i, n := range names {
+		s, err := reg.getOrCreate(n.name)
+		if err != nil {
+			return nil, err
+		}
+		metrics[i] = s.describe(n.unit, n.description)
+	}
+	heap, allocRate, allocs, gc, gcPause, poolReuse := metrics[0], metrics[1], metrics[2], metrics[3], metrics[4], metrics[5]
+
+	sm := &selfMetrics{reg: reg, latencies: map[string]*latencyStats{}}
+	var prev runtime.MemStats
+	runtime.ReadMemStats(&prev)
+	prevGets, prevNews := atomic.LoadUint64(&poolGets), atomic.LoadUint64(&poolNews)
+	prevTime := time.Now()
+	reg.group.loop(time.Tick(selfMetricsInterval), func(now time.Time) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		secs := now.Sub(prevTime).Seconds()
+		heap.Add(float64(m.HeapAlloc))
+		allocRate.Add(float64(m.TotalAlloc-prev.TotalAlloc) / secs)
+		allocs.Add(float64(m.Mallocs-prev.Mallocs) / secs)
+		gc.Add(float64(m.NumGC-prev.NumGC) / secs * 60)
+		gcPause.Add(float64(maxPause(&m, prev.NumGC)) / 1e6)
+		gets, news := atomic.LoadUint64(&poolGets), atomic.LoadUint64(&poolNews)
+		if gets > prevGets {
+			poolReuse.Add(1 - float64(news-prevNews)/float64(gets-prevGets))
+		}
+		prev, prevGets, prevNews, prevTime = m, gets, news, now
+		sm.addLatencies()
+		sm.addRateLimited(secs)
+	})
+	return sm, nil
+}
+
+// maxPause returns the longest GC pause since the GC cycle number since.
+// MemStats keeps the last 256 pauses.
+func maxPause(m *runtime.MemStats, since uint32) time.Duration {
+	var max uint64
+	for n := since + 1; n <= m.NumGC && m.NumGC-n < uint32(len(m.PauseNs)); n++ {
+		if p := m.PauseNs[(n+255)%256]; p > max {
+			max = p
+		}
+	}
+	return time.Duration(max)
+}
+
+// observe records the response time of one request.
+func (sm *selfMetrics) observe(endpoint string, d time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	l := sm.latencies[endpoint]
+	if l == nil {
+		l = &latencyStats{}
+		sm.latencies[endpoint] = l
+	}
+	l.count++
+	l.total += d
+}
+
+// addLatencies adds the mean response time of every endpoint that had
+// requests since the last call.
+func (sm *selfMetrics) addLatencies() {
+	sm.mu.Lock()
+	latencies := sm.latencies
+	sm.latencies = map[string]*latencyStats{}
+	sm.mu.Unlock()
+	for endpoint, l := range latencies {
+		s, err := sm.reg.getOrCreate("app.latency." + endpoint)
+		if err != nil {
+			continue
+		}
+		s.describe("ms", "Mean response time of "+endpoint)
+		s.Add(float64(l.total) / float64(l.count) / 1e6)
+	}
+}
+
+// addRateLimited adds the rate of the samples over the limit of every
+// metric with a rate limit that has been exceeded since the app started,
+// over the last secs seconds.
+func (sm *selfMetrics) addRateLimited(secs float64) {
+	for _, s := range sm.reg.list() {
+		if s.limit == nil {
+			continue
+		}
+		n := atomic.SwapUint64(&s.limit.limited, 0)
+		name := "app.rate_limited." + s.name
+		r, ok := sm.reg.get(name)
+		if !ok {
+			if n == 0 {
+				continue
+			}
+			var err error
+			if r, err = sm.reg.getOrCreate(name); err != nil {
+				continue
+			}
+			r.describe("short", "Samples per second over the rate limit of "+s.name)
+		}
+		r.Add(float64(n) / secs)
+	}
+}
+
+// handler measures the response times of h. endpoint names the endpoint
+// of a request; it must return a small set of names, as each one becomes
+// a metric.
+func (sm *selfMetrics) handler(endpoint func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			h.ServeHTTP(w, r)
+			sm.observe(endpoint(r), time.Since(start))
+		})
+	}
+}
+
+// endpointName turns a path like "/api/metrics" into "api.metrics".
+func endpointName(path string) string {
+	if path = strings.Trim(path, "/"); path == "" {
+		return "root"
+	}
+	return strings.Replace(path, "/", ".", -1)
+}
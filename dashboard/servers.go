@@ -0,0 +1,192 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// serverConfig declares an extra server: a complete datasource on an
+// address of its own, so that one app can serve, say, a public Grafana
+// with a few metrics and an internal one with everything and the admin
+// endpoints:
+//
+//	"servers": [
+//	  {"name": "public", "addr": ":4001", "metrics": ["CPU*", "mem.*"]},
+//	  {"name": "internal", "addr": "10.0.0.5:4002", "admin": true, "token": "..."}
+//	]
+//
+// A server with metric patterns (a name, or a prefix followed by "*") is
+// isolated: its /search lists only the matching metrics, and its /query
+// answers only for them. Without patterns, it shares all metrics of the
+// app. Annotations are served either way; the API endpoints, like
+// /api/metrics and /api/silence, only with Admin. Token works like the
+// token of a namespace.
+type serverConfig struct {
+	Name    string   `json:"name"`
+	Addr    string   `json:"addr"`
+	Metrics []string `json:"metrics"`
+	Admin   bool     `json:"admin"`
+	Token   secret   `json:"token"`
+}
+
+func (c serverConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("server at %q: no name", c.Addr)
+	}
+	if c.Addr == "" {
+		return fmt.Errorf("server %s: no address", c.Name)
+	}
+	return nil
+}
+
+// A dashboardServer is the handler of an extra server. Datasource
+// requests go to datasource, which forwards them to grada; everything
+// else goes to api, if the server has admin endpoints.
+type dashboardServer struct {
+	reg        *registry
+	name       string
+	patterns   []string // empty: all metrics
+	token      string
+	datasource http.Handler
+	api        http.Handler
+	admin      bool
+}
+
+func (s *dashboardServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !tokenAuthorized(r, s.token) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", "diydashboard "+s.name))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/":
+		w.WriteHeader(http.StatusOK)
+	case "/search":
+		s.search(w, r)
+	case "/query":
+		s.query(w, r)
+	case "/annotations":
+		s.api.ServeHTTP(w, r)
+	default:
+		if !s.admin {
+			http.NotFound(w, r)
+			return
+		}
+		s.api.ServeHTTP(w, r)
+	}
+}
+
+// serves reports whether the server serves the metric name.
+func (s *dashboardServer) serves(name string) bool {
+	if len(s.patterns) == 0 {
+		return true
+	}
+	for _, p := range s.patterns {
+		if matchPattern(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// search answers /search from the metrics that the server serves.
+func (s *dashboardServer) search(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	var list []*series
+	for _, m := range s.reg.list() {
+		if s.serves(m.name) {
+			list = append(list, m)
+		}
+	}
+	writeJSON(w, http.StatusOK, searchSeries(list, req.Target))
+}
+
+// query drops the targets that the server does not serve from a /query
+// request, and forwards the rest.
+func (s *dashboardServer) query(w http.ResponseWriter, r *http.Request) {
+	if len(s.patterns) == 0 {
+		s.datasource.ServeHTTP(w, r)
+		return
+	}
+	var q map[string]json.RawMessage
+	var targets []map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(q["targets"], &targets); err != nil {
+		http.Error(w, "invalid query targets: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	kept := targets[:0]
+	for _, t := range targets {
+		var name string
+		json.Unmarshal(t["target"], &name)
+		if s.serves(name) {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == 0 {
+		writeJSON(w, http.StatusOK, []queryResult{})
+		return
+	}
+	q["targets"], _ = json.Marshal(kept)
+	body, err := json.Marshal(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req := r.Clone(r.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	s.datasource.ServeHTTP(w, req)
+}
+
+// serveServers starts the extra servers. datasource forwards datasource
+// requests to grada; api is the handler of the API server.
+func serveServers(reg *registry, configs []serverConfig, datasource, api http.Handler) error {
+	seen := map[string]bool{}
+	for _, c := range configs {
+		if err := c.validate(); err != nil {
+			return err
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("server %q: declared twice", c.Name)
+		}
+		seen[c.Name] = true
+		l, err := net.Listen("tcp", c.Addr)
+		if err != nil {
+			return fmt.Errorf("server %s: %s", c.Name, err)
+		}
+		s := &dashboardServer{
+			reg:        reg,
+			name:       c.Name,
+			patterns:   c.Metrics,
+			token:      string(c.Token),
+			datasource: datasource,
+			api:        api,
+			admin:      c.Admin,
+		}
+		metrics, endpoints := "all metrics", "datasource only"
+		if len(c.Metrics) > 0 {
+			metrics = strings.Join(c.Metrics, ", ")
+		}
+		if c.Admin {
+			endpoints = "datasource and API"
+		}
+		log.Printf("server %s (%s; %s) listening on %s", c.Name, metrics, endpoints, l.Addr())
+		reg.group.serve(l, s)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package dashboard
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// systemdUnitDir is where `service install` puts the unit file on Linux.
+const systemdUnitDir = "/etc/systemd/system"
+
+// runWindowsService runs the app under the Windows service manager until g
+// stops, and tells the service manager when it has stopped. It is nil on
+// other systems.
+var runWindowsService func(name string, g *group) error
+
+// waitForStop blocks until the group stops, either on Ctrl-C or SIGTERM,
+// on a stop request from the Windows service manager (with
+// -windows-service), or because some background work failed.
+func waitForStop(g *group, opts *options) error {
+	if opts.windowsService == "" {
+		g.stopOnSignal()
+		return g.Wait()
+	}
+	if runWindowsService == nil {
+		g.stop(fmt.Errorf("-windows-service works only on Windows"))
+		return g.Wait()
+	}
+	if err := runWindowsService(opts.windowsService, g); err != nil {
+		g.stop(fmt.Errorf("-windows-service: %s", err))
+	}
+	return g.Wait()
+}
+
+// A serviceSpec describes the service that `service install` sets up.
+type serviceSpec struct {
+	name string
+	// exe is the absolute path of the binary.
+	exe string
+	// args are the app's flags.
+	args []string
+	// dir is the working directory, against which relative paths in args
+	// resolve.
+	dir string
+	// user is the Linux user that the service runs as; empty for root.
+	user string
+}
+
+// service installs or uninstalls the app as a systemd unit or a Windows
+// service, so that it starts at boot and restarts when it fails:
+//
+//	sudo diydashboard service install -config /etc/diydashboard.json -- -udp :3003
+//	sudo diydashboard service uninstall
+func service(args []string) error {
+	fs := flag.NewFlagSet("service", flag.ExitOnError)
+	name := fs.String("name", "diydashboard", "name of the service")
+	configFile := fs.String("config", "", "config file for the service, passed to the app as -config")
+	user := fs.String("user", "", "run the service as this user (Linux only; default root)")
+	printUnit := fs.Bool("print", false, "print the systemd unit instead of installing it (Linux only)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: diydashboard service install [flags] [-- app flags]")
+		fmt.Fprintln(fs.Output(), "       diydashboard service uninstall [-name name]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	switch runtime.GOOS {
+	case "linux", "windows":
+	default:
+		return fmt.Errorf("service: %s is not supported; services work with systemd on Linux and on Windows", runtime.GOOS)
+	}
+
+	switch action {
+	case "install":
+		spec, err := newServiceSpec(*name, *configFile, *user, fs.Args())
+		if err != nil {
+			return err
+		}
+		if runtime.GOOS == "windows" {
+			return installWindowsService(spec)
+		}
+		if *printUnit {
+			_, err := os.Stdout.Write(systemdUnit(spec))
+			return err
+		}
+		return installSystemdUnit(spec)
+	case "uninstall":
+		if runtime.GOOS == "windows" {
+			return uninstallWindowsService(*name)
+		}
+		return uninstallSystemdUnit(*name)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+// newServiceSpec collects what the service needs to run the app like the
+// current command line would, but from any working directory.
+func newServiceSpec(name, configFile, user string, args []string) (serviceSpec, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return serviceSpec{}, err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return serviceSpec{}, err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return serviceSpec{}, err
+	}
+	if configFile != "" {
+		if configFile, err = filepath.Abs(configFile); err != nil {
+			return serviceSpec{}, err
+		}
+		// A missing or broken config file would only show up in the
+		// service's log.
+		if _, err := loadConfig(configFile); err != nil {
+			return serviceSpec{}, err
+		}
+		args = append([]string{"-config", configFile}, args...)
+	}
+	return serviceSpec{name: name, exe: exe, args: args, dir: dir, user: user}, nil
+}
+
+// systemdUnit returns the unit file for spec. systemd stops the app with
+// SIGTERM, which lets the servers finish the requests in flight.
+func systemdUnit(spec serviceSpec) []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "[Unit]")
+	fmt.Fprintln(&b, "Description=DIY Dashboard")
+	fmt.Fprintln(&b, "Wants=network-online.target")
+	fmt.Fprintln(&b, "After=network-online.target")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "[Service]")
+	fmt.Fprintln(&b, "ExecStart="+systemdCommandLine(append([]string{spec.exe}, spec.args...)))
+	fmt.Fprintln(&b, "WorkingDirectory="+systemdQuote(spec.dir))
+	if spec.user != "" {
+		fmt.Fprintln(&b, "User="+spec.user)
+	}
+	fmt.Fprintln(&b, "Restart=on-failure")
+	fmt.Fprintln(&b, "RestartSec=5")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "[Install]")
+	fmt.Fprintln(&b, "WantedBy=multi-user.target")
+	return b.Bytes()
+}
+
+// systemdCommandLine quotes args for ExecStart=.
+func systemdCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = systemdQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// systemdQuote quotes s for a unit file. systemd expands specifiers like
+// %h in command lines, so a literal % must be doubled.
+func systemdQuote(s string) string {
+	s = strings.Replace(s, "%", "%%", -1)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\$;") {
+		return s
+	}
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "$", "$$", -1)
+	return `"` + s + `"`
+}
+
+func installSystemdUnit(spec serviceSpec) error {
+	path := filepath.Join(systemdUnitDir, spec.name+".service")
+	if err := ioutil.WriteFile(path, systemdUnit(spec), 0644); err != nil {
+		return fmt.Errorf("%s (run service install as root, or use -print and install the unit yourself)", err)
+	}
+	fmt.Fprintln(os.Stderr, "wrote", path)
+	if err := runTool("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	if err := runTool("systemctl", "enable", "--now", spec.name); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "service %s is running; see its log with `journalctl -u %s`\n", spec.name, spec.name)
+	return nil
+}
+
+func uninstallSystemdUnit(name string) error {
+	path := filepath.Join(systemdUnitDir, name+".service")
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("service %s is not installed: %s", name, err)
+	}
+	if err := runTool("systemctl", "disable", "--now", name); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "removed", path)
+	return runTool("systemctl", "daemon-reload")
+}
+
+// installWindowsService registers the app with the service manager. The
+// app runs with -windows-service, so that it answers the service
+// manager's start and stop requests. Services start in the system
+// directory, so the working directory of the install command is passed on
+// via -dir.
+func installWindowsService(spec serviceSpec) error {
+	if spec.user != "" {
+		return fmt.Errorf("-user works only on Linux; change the service's account in services.msc")
+	}
+	args := append([]string{spec.exe, "-windows-service", spec.name, "-dir", spec.dir}, spec.args...)
+	err := runTool("sc.exe", "create", spec.name,
+		"binPath=", windowsCommandLine(args),
+		"start=", "auto",
+		"DisplayName=", "DIY Dashboard")
+	if err != nil {
+		return fmt.Errorf("%s (run service install from an administrator prompt)", err)
+	}
+	// Restart after 5 seconds when the app fails.
+	if err := runTool("sc.exe", "failure", spec.name, "reset=", "86400", "actions=", "restart/5000"); err != nil {
+		return err
+	}
+	if err := runTool("sc.exe", "start", spec.name); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "service %s is running\n", spec.name)
+	return nil
+}
+
+func uninstallWindowsService(name string) error {
+	// Stopping fails if the service is not running, which is fine.
+	runTool("sc.exe", "stop", name)
+	return runTool("sc.exe", "delete", name)
+}
+
+// windowsCommandLine quotes args like the Windows C runtime expects them.
+func windowsCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a != "" && !strings.ContainsAny(a, " \t\"") {
+			quoted[i] = a
+			continue
+		}
+		var b strings.Builder
+		b.WriteByte('"')
+		slashes := 0
+		for _, c := range a {
+			switch c {
+			case '\\':
+				slashes++
+				continue
+			case '"':
+				// Backslashes before a quote must be escaped, too.
+				b.WriteString(strings.Repeat(`\`, 2*slashes+1))
+			default:
+				b.WriteString(strings.Repeat(`\`, slashes))
+			}
+			slashes = 0
+			b.WriteRune(c)
+		}
+		b.WriteString(strings.Repeat(`\`, 2*slashes))
+		b.WriteByte('"')
+		quoted[i] = b.String()
+	}
+	return strings.Join(quoted, " ")
+}
+
+// runTool runs a system tool like systemctl and passes its output through.
+func runTool(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package dashboard
+
+import (
+	"log"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// The service manager API of advapi32.dll, for the app to run as a Windows
+// service without golang.org/x/sys.
+var (
+	advapi32                          = syscall.NewLazyDLL("advapi32.dll")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+)
+
+const (
+	serviceWin32OwnProcess = 0x10
+
+	serviceStopped     = 1
+	serviceStopPending = 3
+	serviceRunning     = 4
+
+	serviceAcceptStop     = 1
+	serviceAcceptShutdown = 4
+
+	serviceControlStop     = 1
+	serviceControlShutdown = 5
+
+	errorServiceSpecificError = 1066
+)
+
+// serviceStatus is SERVICE_STATUS.
+type serviceStatus struct {
+	serviceType             uint32
+	currentState            uint32
+	controlsAccepted        uint32
+	win32ExitCode           uint32
+	serviceSpecificExitCode uint32
+	checkPoint              uint32
+	waitHint                uint32
+}
+
+// serviceTableEntry is SERVICE_TABLE_ENTRYW.
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+func init() {
+	runWindowsService = runAsWindowsService
+}
+
+// runAsWindowsService hands the calling thread to the service manager,
+// which calls back serviceMain. It returns when the service has stopped.
+// As a service has no console, the log goes to <name>.log in the working
+// directory.
+func runAsWindowsService(name string, g *group) error {
+	f, err := os.OpenFile(name+".log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	setLogOutput(f)
+
+	namep, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	var handle uintptr
+	setStatus := func(state, accepts uint32, failed bool) {
+		st := serviceStatus{
+			serviceType:      serviceWin32OwnProcess,
+			currentState:     state,
+			controlsAccepted: accepts,
+		}
+		if failed {
+			// Lets the recovery actions of `sc failure` restart the app.
+			st.win32ExitCode = errorServiceSpecificError
+			st.serviceSpecificExitCode = 1
+		}
+		procSetServiceStatus.Call(handle, uintptr(unsafe.Pointer(&st)))
+	}
+
+	handler := syscall.NewCallback(func(control, eventType, eventData, context uintptr) uintptr {
+		switch control {
+		case serviceControlStop, serviceControlShutdown:
+			setStatus(serviceStopPending, 0, false)
+			log.Println("stop requested by the service manager")
+			g.stop(nil)
+		}
+		return 0
+	})
+	serviceMain := syscall.NewCallback(func(argc, argv uintptr) uintptr {
+		handle, _, _ = procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(namep)), handler, 0)
+		setStatus(serviceRunning, serviceAcceptStop|serviceAcceptShutdown, false)
+		err := g.Wait()
+		if err != nil {
+			log.Println(err)
+		}
+		setStatus(serviceStopped, 0, err != nil)
+		return 0
+	})
+
+	table := []serviceTableEntry{{name: namep, proc: serviceMain}, {}}
+	if r, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0]))); r == 0 {
+		return err
+	}
+	return nil
+}
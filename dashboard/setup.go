@@ -0,0 +1,594 @@
+package dashboard
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+// setup starts everything beyond the two demo CPU metrics, as requested
+// by the command line flags and the config file.
+func setup(reg *registry, opts *options) error {
+	// Some settings in the config file are only read at startup. Without
+	// a config file, the built-in config applies.
+	cfg, err := loadConfig(opts.config)
+	if err != nil {
+		return err
+	}
+	grafana, err := newGrafanaFromOptions(opts, cfg.Grafana)
+	if err != nil {
+		return err
+	}
+	folder := cfg.Grafana.folder()
+	if opts.grafanaFolder != "" {
+		folder = opts.grafanaFolder
+	}
+
+	// Let Grafana know about us, so that nobody needs to click through
+	// the "Add data source" dialog.
+	if opts.provisionDatasource {
+		if grafana == nil {
+			return fmt.Errorf("-provision-datasource needs a Grafana URL (-grafana-url or the config file)")
+		}
+		name, dsURL := cfg.Grafana.datasource(), cfg.Grafana.DatasourceURL
+		if opts.datasourceURL != "" {
+			dsURL = opts.datasourceURL
+		}
+		if dsURL == "" {
+			dsURL = gradaAddr()
+		}
+		if err := grafana.provisionDatasource(name, dsURL, true); err != nil {
+			log.Println("datasource not provisioned:", err)
+		} else {
+			log.Printf("datasource %q provisioned in Grafana, pointing to %s", name, dsURL)
+		}
+	}
+
+	// Self-metrics show what the app itself costs.
+	self, err := addSelfMetrics(reg)
+	if err != nil {
+		return err
+	}
+
+	// Chaos mode shows how panels and alerts cope with a degraded app.
+	c := &chaos{}
+	if opts.chaos != "" {
+		if c, err = parseChaosSpec(opts.chaos); err != nil {
+			return err
+		}
+		reg.chaos.Store(c)
+		log.Println("chaos:", c)
+	}
+
+	// The datasource proxy sits between Grafana and grada's server. For
+	// debugging, it records the requests, so they can be replayed. It also
+	// serves the namespaces, and forwards the datasource requests of the
+	// extra servers; both are read only at startup.
+	var datasource http.Handler
+	if opts.record != "" || opts.debugHTTP || opts.chaos != "" || opts.speed != 1 || opts.queryWorkers > 0 || opts.correctSkew || len(opts.aggregate) > 0 || len(opts.fill) > 0 || len(opts.units) > 0 || len(opts.aliases) > 0 || opts.timeShift || opts.upstream != "" || opts.rollups || len(cfg.Namespaces) > 0 || len(cfg.Servers) > 0 {
+		p := &datasourceProxy{client: &http.Client{Timeout: 30 * time.Second}, speed: opts.speed, timeout: opts.queryTimeout, timeShift: opts.timeShift, reg: reg}
+		if p.encode = queryEncoders[opts.jsonEncoder]; p.encode == nil {
+			return fmt.Errorf("-json-encoder: unknown encoder %q", opts.jsonEncoder)
+		}
+		// Streaming rewrites responses with the fast encoder only.
+		p.stream = opts.jsonEncoder == "fast"
+		if opts.queryWorkers > 0 {
+			p.workers = make(chan struct{}, opts.queryWorkers)
+		}
+		if p.skew, err = newSkewDetector(reg, opts.correctSkew); err != nil {
+			return err
+		}
+		for _, a := range opts.aggregate {
+			spec, err := parseAggregateSpec(a)
+			if err != nil {
+				return err
+			}
+			p.aggregate = append(p.aggregate, spec)
+		}
+		for _, f := range opts.fill {
+			spec, err := parseFillSpec(f)
+			if err != nil {
+				return err
+			}
+			p.fill = append(p.fill, spec)
+		}
+		for _, u := range opts.units {
+			spec, err := parseUnitSpec(u)
+			if err != nil {
+				return err
+			}
+			p.units = append(p.units, spec)
+		}
+		for _, a := range opts.aliases {
+			spec, err := parseAliasSpec(a)
+			if err != nil {
+				return err
+			}
+			p.aliases = append(p.aliases, spec)
+		}
+		if opts.record != "" {
+			record, err := newRecorder(opts.record)
+			if err != nil {
+				return err
+			}
+			p.observe = append(p.observe, record)
+			log.Println("recording datasource requests to", opts.record)
+		}
+		if opts.debugHTTP {
+			p.observe = append(p.observe, logExchange)
+		}
+		h := self.handler(func(r *http.Request) string {
+			switch r.URL.Path {
+			case "/", "/search", "/query", "/annotations":
+				return "proxy." + endpointName(r.URL.Path)
+			}
+			return "proxy.other"
+		})(p)
+		h = c.handler(h)
+		if opts.upstream != "" {
+			if h, err = newPassthrough(reg, opts.upstream, opts.queryTimeout, h); err != nil {
+				return err
+			}
+			log.Println("forwarding the targets that are no metrics of the app to", opts.upstream)
+		}
+		// Rollup targets must not go upstream.
+		if opts.rollups {
+			h = addRollups(reg).handler(h)
+		}
+		datasource = h
+		if len(cfg.Namespaces) > 0 {
+			if h, err = serveNamespaces(reg, cfg.Namespaces, h); err != nil {
+				return err
+			}
+		}
+		if err := startProxy(opts.proxy, h, reg.group); err != nil {
+			return err
+		}
+	}
+
+	// Previews come first, so that the metrics created below get theirs
+	// right away.
+	if opts.preview != 0 {
+		if err := addPreviews(reg, opts.preview); err != nil {
+			return err
+		}
+	}
+
+	// Load testing: lots of metrics with cheap generators.
+	if opts.stress != "" {
+		spec, err := parseStressSpec(opts.stress)
+		if err != nil {
+			return err
+		}
+		if err := addStressMetrics(reg, spec); err != nil {
+			return err
+		}
+	}
+
+	// Fleet simulation: many hosts with the same metrics, for templated dashboards.
+	if opts.fleet > 0 {
+		if err := addFleetMetrics(reg, opts.fleet); err != nil {
+			return err
+		}
+	}
+
+	// Anomaly series show how unusual each new value is, compared to the recent past.
+	for _, name := range opts.anomalies {
+		s, err := reg.getOrCreate(name)
+		if err != nil {
+			return err
+		}
+		if _, err := addAnomalySeries(reg, s, opts.anomalyWindow); err != nil {
+			return err
+		}
+	}
+
+	// Forecast series extrapolate the recent trend of a metric.
+	for _, f := range opts.forecasts {
+		spec, err := parseForecastSpec(f)
+		if err != nil {
+			return err
+		}
+		s, err := reg.getOrCreate(spec.metric)
+		if err != nil {
+			return err
+		}
+		if err := addForecastSeries(reg, s, spec, opts.forecastWindow, opts.forecastHorizon); err != nil {
+			return err
+		}
+	}
+
+	// SLOs turn an availability metric into error budget and burn rate series.
+	for _, sl := range opts.slos {
+		spec, err := parseSLOSpec(sl)
+		if err != nil {
+			return err
+		}
+		s, err := reg.getOrCreate(spec.metric)
+		if err != nil {
+			return err
+		}
+		if err := addSLOSeries(reg, s, spec); err != nil {
+			return err
+		}
+	}
+
+	// Derived metrics compute their values from other metrics, with an
+	// expression like "avg(CPU1, CPU2)".
+	derived := newDeriver(reg)
+	var flagDerived []derivedConfig
+	for _, d := range opts.derived {
+		c, err := parseDerivedFlag(d)
+		if err != nil {
+			return err
+		}
+		flagDerived = append(flagDerived, c)
+	}
+	if err := derived.set(flagDerived); err != nil {
+		return err
+	}
+
+	// The API server serves annotations and the admin endpoints.
+	api := newAPIServer()
+	api.use(self.handler(api.endpoint))
+	api.use(c.handler)
+	if opts.readOnly {
+		api.use(readOnly)
+		log.Println("read-only mode: the API server answers datasource requests only")
+	}
+	notes := newAnnotationStore()
+	api.handle("/annotations", notes.serveHTTP)
+	api.handle("/api/dashboard", serveDashboard(reg, cfg.Grafana.datasource()))
+	api.handle("/search", serveSearch(reg))
+	api.handle("/api/metrics", serveMetrics(reg))
+	api.handle("/api/catalog", serveCatalog(reg))
+	api.handle("/api/source", serveSource(reg))
+	api.handle("/api/import", serveImport(reg))
+	api.handle("/api/collectors", serveCollectors(reg))
+	api.handle("/ui", serveUI)
+
+	// A scenario script plays an incident for training.
+	if opts.scenario != "" {
+		sc, err := loadScenario(opts.scenario)
+		if err != nil {
+			return err
+		}
+		runScenario(reg, sc, notes)
+	}
+
+	// Alert rules watch the metrics and notify the outside world when they
+	// fire or resolve. Silences mute the notifications for a while.
+	silences := newSilencer(reg, notes)
+	api.handle("/api/silence", silences.serveSilence)
+	api.handle("/api/silences", silences.serveSilences)
+	al, err := newAlerterFromOptions(reg, silences, notes, grafana, opts, cfg.Notifiers)
+	if err != nil {
+		return err
+	}
+	setRules := al.set
+	if opts.grafanaAlerts {
+		if grafana == nil {
+			return fmt.Errorf("-grafana-alerts needs a Grafana URL (-grafana-url or the config file)")
+		}
+		// The rules also become Grafana alert rules, so that they show up
+		// in Grafana's alerting UI and follow its notification policies.
+		push := grafanaRuleSync(grafana, cfg.Grafana.datasource(), folder, reg.group)
+		setRules = func(rules []alertRule) error {
+			if err := al.set(rules); err != nil {
+				return err
+			}
+			push(rules)
+			return nil
+		}
+	}
+	var flagRules []alertRule
+	for _, a := range opts.alerts {
+		rule, err := parseAlertRule(a)
+		if err != nil {
+			return err
+		}
+		flagRules = append(flagRules, rule)
+	}
+	if err := setRules(flagRules); err != nil {
+		return err
+	}
+
+	// The config file adds more derived metrics and alert rules, and the
+	// notifiers. When the file changes, all of them get replaced.
+	if opts.config != "" {
+		err := watchConfig(opts.config, func(c *config) error {
+			if err := derived.set(append(append([]derivedConfig(nil), flagDerived...), c.Derived...)); err != nil {
+				return err
+			}
+			rules := append([]alertRule(nil), flagRules...)
+			for _, ac := range c.Alerts {
+				rule, err := ac.rule()
+				if err != nil {
+					return err
+				}
+				rules = append(rules, rule)
+			}
+			notifiers, err := newNotifiers(opts, c.Notifiers, reg.group)
+			if err != nil {
+				return err
+			}
+			prev := al.setNotifiers(notifiers)
+			if err := setRules(rules); err != nil {
+				closeNotifiers(al.setNotifiers(prev))
+				return err
+			}
+			closeNotifiers(prev)
+			return nil
+		}, reg.group)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Sensors on the local network can send their readings via UDP.
+	if opts.udp != "" {
+		if opts.readOnly {
+			return fmt.Errorf("-udp takes samples from anyone who can reach it, which -read-only rules out")
+		}
+		if err := serveUDP(opts.udp, reg); err != nil {
+			return err
+		}
+	}
+
+	if opts.grafanaCheck {
+		if grafana == nil {
+			return fmt.Errorf("-grafana-check needs a Grafana URL (-grafana-url or the config file)")
+		}
+		if err := watchGrafana(grafana, reg, cfg.Grafana.datasource()); err != nil {
+			return err
+		}
+	}
+
+	// Streaming panels get each sample the moment it arrives.
+	if opts.grafanaLive {
+		if grafana == nil {
+			return fmt.Errorf("-grafana-live needs a Grafana URL (-grafana-url or the config file)")
+		}
+		publishLive(grafana, reg)
+	}
+
+	// Keep a generated dashboard in Grafana up to date. This comes last, so
+	// that the first upload already includes all metrics created above.
+	if opts.syncDashboard {
+		if grafana == nil {
+			return fmt.Errorf("-sync-dashboard needs a Grafana URL (-grafana-url or the config file)")
+		}
+		syncDashboard(grafana, reg, "DIY Dashboard", cfg.Grafana.datasource(), folder)
+	}
+
+	// Extra servers get the datasource and, if they ask for it, the API.
+	if len(cfg.Servers) > 0 {
+		if err := serveServers(reg, cfg.Servers, datasource, api.handler()); err != nil {
+			return err
+		}
+	}
+
+	// Agents are other apps whose metrics this one pulls in. With -mdns,
+	// the app tells the LAN about itself; with -join, it finds the others
+	// that do, and makes them agents, too. The agents know the app by its
+	// host name; metrics with that prefix came from here.
+	reg.addPrefix(mdnsName())
+	if len(cfg.Agents) > 0 {
+		if err := federate(reg, cfg.Agents); err != nil {
+			return err
+		}
+	}
+	if opts.mdns {
+		if err := advertise(reg.group, mdnsName()); err != nil {
+			return err
+		}
+	}
+	if opts.join {
+		join(reg, mdnsName(), cfg.Agents)
+	}
+
+	if opts.api != "" {
+		return api.listen(opts.api, reg.group)
+	}
+	return nil
+}
+
+// newRegistryFromOptions creates the registry with the clock and the time
+// range that the command line flags ask for. With -speed, the clock runs
+// faster than the wall clock, so that the generators produce a day's worth
+// of data in minutes.
+func newRegistryFromOptions(dash *grada.Dashboard, opts *options) (*registry, error) {
+	if opts.dir != "" {
+		if err := os.Chdir(opts.dir); err != nil {
+			return nil, fmt.Errorf("-dir: %s", err)
+		}
+	}
+	if opts.tz != "" {
+		if err := setTimezone(opts.tz); err != nil {
+			return nil, err
+		}
+	}
+	if opts.businessHours != defaultBusinessHours {
+		c, err := parseCalendar(opts.businessHours)
+		if err != nil {
+			return nil, err
+		}
+		businessHours = c
+	}
+	reg := newRegistry(dash)
+	if opts.speed <= 0 {
+		return nil, fmt.Errorf("-speed must be positive")
+	}
+	if opts.retention <= 0 {
+		return nil, fmt.Errorf("-retention must be positive")
+	}
+	reg.timeRange = opts.retention
+	if opts.shards < 0 {
+		return nil, fmt.Errorf("-shards must not be negative")
+	}
+	if opts.shards > 0 {
+		reg.shards = opts.shards
+		reg.flush(flushInterval)
+	}
+	for _, d := range opts.decimate {
+		spec, err := parseDecimateSpec(d)
+		if err != nil {
+			return nil, err
+		}
+		reg.decimate = append(reg.decimate, spec)
+	}
+	for _, d := range opts.deadbands {
+		spec, err := parseDeadbandSpec(d)
+		if err != nil {
+			return nil, err
+		}
+		reg.deadbands = append(reg.deadbands, spec)
+	}
+	for _, l := range opts.rateLimits {
+		spec, err := parseRateLimitSpec(l)
+		if err != nil {
+			return nil, err
+		}
+		reg.rateLimits = append(reg.rateLimits, spec)
+	}
+	if opts.speed != 1 {
+		reg.clock = newScaledClock(opts.speed)
+		log.Printf("time runs %gx faster; %s of data take %s", opts.speed, opts.retention, time.Duration(float64(opts.retention)/opts.speed).Round(time.Second))
+	}
+	// Adaptive buffers check the rates on the registry's clock, so the
+	// clock must be set first.
+	if opts.adaptive < 0 {
+		return nil, fmt.Errorf("-adaptive-buffers must not be negative")
+	}
+	if opts.adaptive > 0 {
+		reg.adaptBuffers(opts.adaptive)
+	}
+	return reg, nil
+}
+
+// newAlerterFromOptions creates an alerter with the notifiers of the
+// config file and the command line flags.
+func newAlerterFromOptions(reg *registry, silences *silencer, notes *annotationStore, grafana *grafanaClient, opts *options, c notifiersConfig) (*alerter, error) {
+	al := newAlerter(reg, silences, notes)
+	if opts.grafanaAnnotations {
+		if grafana == nil {
+			return nil, fmt.Errorf("-grafana-annotations needs a Grafana URL (-grafana-url or the config file)")
+		}
+		al.grafana = grafana
+	}
+	notifiers, err := newNotifiers(opts, c, reg.group)
+	if err != nil {
+		return nil, err
+	}
+	al.setNotifiers(notifiers)
+	return al, nil
+}
+
+// newNotifiers creates the notifiers that the config file and the command
+// line flags configure, with the flags taking precedence. Alert rules
+// refer to the notifiers as "webhook", "slack", "discord", and "email".
+// Their background work runs in g, until g stops or closeNotifiers.
+func newNotifiers(opts *options, c notifiersConfig, g *group) (map[string]notifier, error) {
+	if opts.webhook != "" {
+		c.Webhook = secret(opts.webhook)
+	}
+	if opts.slack != "" {
+		c.Slack = secret(opts.slack)
+	}
+	if opts.discord != "" {
+		c.Discord = secret(opts.discord)
+	}
+	notifiers := map[string]notifier{}
+	if c.Webhook != "" {
+		notifiers["webhook"] = newWebhookNotifier(string(c.Webhook))
+	}
+	if c.Slack != "" {
+		n, err := newSlackNotifier(string(c.Slack), opts.alertTemplate, opts.dashboardURL)
+		if err != nil {
+			return nil, err
+		}
+		notifiers["slack"] = n
+	}
+	if c.Discord != "" {
+		n, err := newDiscordNotifier(string(c.Discord), opts.alertTemplate, opts.dashboardURL)
+		if err != nil {
+			return nil, err
+		}
+		notifiers["discord"] = n
+	}
+	mail, err := c.Email.withOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if mail.Addr != "" || mail.From != "" || len(mail.To) > 0 {
+		n, err := newEmailNotifier(mail)
+		if err != nil {
+			return nil, err
+		}
+		g.Go(n.run)
+		notifiers["email"] = n
+	}
+	return notifiers, nil
+}
+
+// withOptions returns the SMTP settings of c, with the environment and
+// the command line flags taking precedence.
+func (c emailConfig) withOptions(opts *options) (smtpConfig, error) {
+	password, err := envSecret(envSMTPPassword)
+	if err != nil {
+		return smtpConfig{}, fmt.Errorf("%s: %s", envSMTPPassword, err)
+	}
+	if password != "" {
+		c.Password = secret(password)
+	}
+	if opts.smtp != "" {
+		c.SMTP = opts.smtp
+	}
+	if opts.smtpUser != "" {
+		c.User = opts.smtpUser
+	}
+	if opts.mailFrom != "" {
+		c.From = opts.mailFrom
+	}
+	if opts.mailTo != "" {
+		c.To = splitList(opts.mailTo)
+	}
+	if opts.mailBatch > 0 {
+		c.Batch.Duration = opts.mailBatch
+	}
+	if c.Batch.Duration <= 0 {
+		c.Batch.Duration = time.Minute
+	}
+	return smtpConfig{
+		Addr:     c.SMTP,
+		User:     c.User,
+		Password: string(c.Password),
+		From:     c.From,
+		To:       c.To,
+		Batch:    c.Batch.Duration,
+	}, nil
+}
+
+// newGrafanaFromOptions returns a client for Grafana's HTTP API, or nil if
+// no Grafana URL is configured. Flags take precedence over environment
+// variables, which take precedence over the config file.
+func newGrafanaFromOptions(opts *options, c grafanaConfig) (*grafanaClient, error) {
+	c, err := c.fromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if opts.grafanaURL != "" {
+		c.URL = opts.grafanaURL
+	}
+	if opts.grafanaOrgID != 0 {
+		c.OrgID = opts.grafanaOrgID
+	}
+	if c.URL == "" {
+		return nil, nil
+	}
+	return newGrafanaClient(c.URL, string(c.Token), c.OrgID), nil
+}
@@ -0,0 +1,85 @@
+package dashboard
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// flushInterval is how often the staged samples of sharded series move on
+// to grada.
+const flushInterval = 50 * time.Millisecond
+
+// A sample is a value and the time it was added.
+type sample struct {
+	v float64
+	t time.Time
+}
+
+// shardedBuffer stages the samples of a high-frequency series. Every Add
+// appends to one of several shards, each with its own lock, so writers
+// rarely wait for each other, and never for a /query that reads the grada
+// Metric. A single writer, the registry's flusher, moves the staged
+// samples on to grada in time order.
+//
+// grada stamps each sample when it arrives, so the timestamps in Grafana
+// are off by up to flushInterval. At kHz rates, a panel cannot show the
+// difference.
+type shardedBuffer struct {
+	next   uint32
+	shards []bufferShard
+}
+
+type bufferShard struct {
+	mu      sync.Mutex
+	samples []sample
+	_       [32]byte // keeps the locks of neighboring shards on separate cache lines
+}
+
+func newShardedBuffer(n int) *shardedBuffer {
+	return &shardedBuffer{shards: make([]bufferShard, n)}
+}
+
+// add stages a sample. The shards take turns, so concurrent writers
+// spread over all of them.
+func (b *shardedBuffer) add(v float64, t time.Time) {
+	sh := &b.shards[atomic.AddUint32(&b.next, 1)%uint32(len(b.shards))]
+	sh.mu.Lock()
+	sh.samples = append(sh.samples, sample{v, t})
+	sh.mu.Unlock()
+}
+
+// drain removes all staged samples and appends them to dst, ordered by
+// time.
+func (b *shardedBuffer) drain(dst []sample) []sample {
+	n := len(dst)
+	for i := range b.shards {
+		sh := &b.shards[i]
+		sh.mu.Lock()
+		dst = append(dst, sh.samples...)
+		sh.samples = sh.samples[:0]
+		sh.mu.Unlock()
+	}
+	staged := dst[n:]
+	sort.Slice(staged, func(i, j int) bool { return staged[i].t.Before(staged[j].t) })
+	return dst
+}
+
+// flush moves the staged samples of all sharded series on to grada every
+// interval, until the registry's group stops.
+func (r *registry) flush(interval time.Duration) {
+	var staged []sample
+	r.group.loop(time.Tick(interval), func(time.Time) {
+		for _, s := range r.list() {
+			b, _ := s.buf.Load().(*shardedBuffer)
+			if b == nil {
+				continue
+			}
+			staged = b.drain(staged[:0])
+			for _, smp := range staged {
+				s.store(smp.v, smp.t)
+			}
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package dashboard
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// silence mutes the notifications of an alert rule, or of all rules on a
+// metric, until it expires. Alerts still change state while silenced; only
+// the notifiers stay quiet.
+type silence struct {
+	ID     int       `json:"id"`
+	Rule   string    `json:"rule,omitempty"`   // rule name or id
+	Metric string    `json:"metric,omitempty"` // all rules on this metric
+	Reason string    `json:"reason"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+func (s silence) matches(rule alertRule) bool {
+	return (s.Rule != "" && s.Rule == rule.id()) || (s.Metric != "" && s.Metric == rule.Metric)
+}
+
+// silencer keeps the list of silences. Each new silence is also recorded
+// as a region annotation, so that maintenance windows show up on the graphs.
+// Silences start and end in the time of the registry's clock, like the
+// alert events that they get compared with.
+type silencer struct {
+	reg   *registry
+	notes *annotationStore
+
+	mu       sync.Mutex
+	nextID   int
+	silences []silence
+}
+
+func newSilencer(reg *registry, notes *annotationStore) *silencer {
+	return &silencer{reg: reg, notes: notes, nextID: 1}
+}
+
+// add creates a silence that lasts for d, starting now.
+func (s *silencer) add(rule, metric, reason string, d time.Duration) (silence, error) {
+	if (rule == "") == (metric == "") {
+		return silence{}, fmt.Errorf("a silence needs either a rule or a metric")
+	}
+	if d <= 0 {
+		return silence{}, fmt.Errorf("a silence needs a positive duration")
+	}
+	s.mu.Lock()
+	now := s.reg.clock.Now()
+	sil := silence{ID: s.nextID, Rule: rule, Metric: metric, Reason: reason, Start: now, End: now.Add(d)}
+	s.nextID++
+	s.silences = append(s.silences, sil)
+	s.mu.Unlock()
+
+	s.notes.add(annotation{
+		Time:    sil.Start,
+		TimeEnd: sil.End,
+		Title:   "Silenced: " + rule + metric,
+		Text:    reason,
+		Tags:    []string{"silence"},
+	})
+	return sil, nil
+}
+
+// active returns the silences that have not expired yet at time t, and
+// drops the expired ones.
+func (s *silencer) active(t time.Time) []silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := s.silences[:0]
+	for _, sil := range s.silences {
+		if sil.End.After(t) {
+			active = append(active, sil)
+		}
+	}
+	s.silences = active
+	return append([]silence(nil), active...)
+}
+
+// silenced reports whether notifications for rule are muted at time t.
+func (s *silencer) silenced(rule alertRule, t time.Time) bool {
+	for _, sil := range s.active(t) {
+		if sil.matches(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// silenceRequest is the body of POST /api/silence.
+type silenceRequest struct {
+	Rule     string   `json:"rule"`
+	Metric   string   `json:"metric"`
+	Duration duration `json:"duration"`
+	Reason   string   `json:"reason"`
+}
+
+// serveSilence handles POST /api/silence, which creates a silence.
+func (s *silencer) serveSilence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var req silenceRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	sil, err := s.add(req.Rule, req.Metric, req.Reason, req.Duration.Duration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, sil)
+}
+
+// serveSilences handles GET /api/silences, which lists the active silences.
+func (s *silencer) serveSilences(w http.ResponseWriter, r *http.Request) {
+	active := s.active(s.reg.clock.Now())
+	for i := range active {
+		active[i].Start, active[i].End = inDisplayZone(active[i].Start), inDisplayZone(active[i].End)
+	}
+	writeJSON(w, http.StatusOK, active)
+}
@@ -0,0 +1,260 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The following types are the parts of the SimpleJSON protocol that
+// Grafana sends to /query and expects back.
+
+type queryRequest struct {
+	PanelID       int           `json:"panelId"`
+	Range         queryRange    `json:"range"`
+	Interval      string        `json:"interval"`
+	IntervalMs    int64         `json:"intervalMs"`
+	Targets       []queryTarget `json:"targets"`
+	Format        string        `json:"format"`
+	MaxDataPoints int           `json:"maxDataPoints"`
+}
+
+type queryRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	Raw  struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"raw"`
+}
+
+type queryTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"`
+}
+
+type queryResponse struct {
+	Target     string      `json:"target"`
+	Datapoints [][]float64 `json:"datapoints"`
+}
+
+// simulator sends the same kind of requests as a Grafana dashboard to the
+// datasource server and checks the responses.
+type simulator struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	problems  []string
+	warnings  map[string]int
+}
+
+func (sim *simulator) post(path string, in, out interface{}) (time.Duration, error) {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := sim.client.Post(sim.url+path, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	elapsed := time.Since(start)
+	if err != nil {
+		return elapsed, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return elapsed, fmt.Errorf("POST %s: %s: %s", path, resp.Status, bytes.TrimSpace(body))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return elapsed, fmt.Errorf("POST %s: invalid response: %s", path, err)
+	}
+	return elapsed, nil
+}
+
+func (sim *simulator) problem(format string, args ...interface{}) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.problems = append(sim.problems, fmt.Sprintf(format, args...))
+}
+
+func (sim *simulator) warn(msg string) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.warnings[msg]++
+}
+
+// newQuery creates a request for the given targets over the last r, the
+// way a panel with the given width in data points asks for it.
+func newQuery(targets []string, r time.Duration, maxDataPoints int) queryRequest {
+	now := time.Now().UTC()
+	interval := r / time.Duration(maxDataPoints)
+	if interval < time.Second {
+		interval = time.Second
+	}
+	interval = interval.Round(time.Second)
+	q := queryRequest{
+		PanelID:       1,
+		Interval:      interval.String(),
+		IntervalMs:    int64(interval / time.Millisecond),
+		Format:        "json",
+		MaxDataPoints: maxDataPoints,
+	}
+	q.Range.From, q.Range.To = now.Add(-r), now
+	q.Range.Raw.From, q.Range.Raw.To = "now-"+r.String(), "now"
+	for i, t := range targets {
+		q.Targets = append(q.Targets, queryTarget{Target: t, RefID: string(rune('A' + i)), Type: "timeserie"})
+	}
+	return q
+}
+
+// query sends q and validates the response.
+func (sim *simulator) query(q queryRequest) {
+	var resp []queryResponse
+	elapsed, err := sim.post("/query", q, &resp)
+	if err != nil {
+		sim.problem("%s", err)
+		return
+	}
+	sim.mu.Lock()
+	sim.latencies = append(sim.latencies, elapsed)
+	sim.mu.Unlock()
+
+	got := map[string]queryResponse{}
+	for _, r := range resp {
+		got[r.Target] = r
+	}
+	// Allow for one interval of slack at the start, and for clock
+	// differences at the end.
+	from := q.Range.From.Add(-time.Duration(q.IntervalMs)*time.Millisecond).UnixNano() / 1e6
+	to := q.Range.To.Add(time.Second).UnixNano() / 1e6
+	for _, t := range q.Targets {
+		r, ok := got[t.Target]
+		if !ok {
+			sim.problem("query %s: no series in the response", t.Target)
+			continue
+		}
+		last := math.Inf(-1)
+		for _, p := range r.Datapoints {
+			if len(p) != 2 {
+				sim.problem("query %s: data point %v is not [value, timestamp]", t.Target, p)
+				break
+			}
+			ts := p[1]
+			if ts < float64(from) || ts > float64(to) {
+				sim.problem("query %s (%s): timestamp %s outside the requested range", t.Target, q.Range.Raw.From, time.Unix(0, int64(ts)*1e6).Format(time.RFC3339))
+				break
+			}
+			if ts < last {
+				sim.problem("query %s: timestamps not in ascending order", t.Target)
+				break
+			}
+			last = ts
+		}
+		if len(r.Datapoints) > q.MaxDataPoints {
+			sim.warn(fmt.Sprintf("responses with more data points than maxDataPoints (%d); Grafana has to thin them out", q.MaxDataPoints))
+		}
+	}
+}
+
+// simulate plays the role of a Grafana dashboard: it asks the app's
+// datasource server for the available metrics, then sends /query requests
+// with random targets, time ranges, and panel widths, and checks every
+// response. It prints the latencies and everything that looks wrong, so
+// that changes to the data path can be verified without Grafana.
+func simulate(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	addr := fs.String("url", ":"+strconv.Itoa(gradaPort()), "address of the app's datasource server")
+	n := fs.Int("n", 200, "number of /query requests")
+	concurrency := fs.Int("c", 4, "number of requests in flight, like panels loading in parallel")
+	ranges := fs.String("ranges", "1m,5m,15m", "comma-separated time ranges to ask for")
+	maxPoints := fs.Int("max-points", 500, "maxDataPoints, the panel width in pixels")
+	fs.Parse(args)
+
+	var rs []time.Duration
+	for _, s := range splitList(*ranges) {
+		d, err := parseDuration(s)
+		if err != nil {
+			return err
+		}
+		rs = append(rs, d)
+	}
+	if len(rs) == 0 || *n < 1 || *concurrency < 1 || *maxPoints < 1 {
+		return fmt.Errorf("simulate: -n, -c, -max-points, and -ranges must not be empty or zero")
+	}
+
+	sim := &simulator{url: baseURL(*addr), client: &http.Client{Timeout: 10 * time.Second}, warnings: map[string]int{}}
+	var targets []string
+	if _, err := sim.post("/search", map[string]string{"target": ""}, &targets); err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("/search: the app has no metrics")
+	}
+	fmt.Printf("/search: %d metrics\n", len(targets))
+
+	queries := make(chan queryRequest)
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range queries {
+				sim.query(q)
+			}
+		}()
+	}
+	start := time.Now()
+	for i := 0; i < *n; i++ {
+		k := 1 + rand.Intn(3)
+		if k > len(targets) {
+			k = len(targets)
+		}
+		var ts []string
+		for _, j := range rand.Perm(len(targets))[:k] {
+			ts = append(ts, targets[j])
+		}
+		queries <- newQuery(ts, rs[rand.Intn(len(rs))], *maxPoints)
+	}
+	close(queries)
+	wg.Wait()
+	sim.report(time.Since(start))
+	if len(sim.problems) > 0 {
+		return fmt.Errorf("simulate: %d problems", len(sim.problems))
+	}
+	return nil
+}
+
+// report prints the latency distribution, the problems, and the warnings.
+func (sim *simulator) report(total time.Duration) {
+	l := sim.latencies
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	fmt.Printf("/query: %d responses, %d problems, %.0f requests/s\n", len(l), len(sim.problems), float64(len(l))/total.Seconds())
+	if len(l) > 0 {
+		pct := func(p float64) time.Duration { return l[int(p*float64(len(l)-1))] }
+		fmt.Printf("latency: min %s, p50 %s, p90 %s, p99 %s, max %s\n", l[0], pct(0.5), pct(0.9), pct(0.99), l[len(l)-1])
+	}
+	for i, p := range sim.problems {
+		if i == 10 {
+			fmt.Printf("... and %d more problems\n", len(sim.problems)-i)
+			break
+		}
+		fmt.Println("problem:", p)
+	}
+	for w, count := range sim.warnings {
+		fmt.Printf("warning: %d %s\n", count, w)
+	}
+}
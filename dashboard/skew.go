@@ -0,0 +1,101 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// skewThreshold is the clock skew between Grafana and the app that gets
+// reported, and corrected with -correct-skew. Below it, the skew does not
+// visibly shift the panels.
+const skewThreshold = 2 * time.Second
+
+// skewSmoothing weights a new measurement in the running skew estimate.
+const skewSmoothing = 0.2
+
+// A skewDetector estimates the clock skew between Grafana and the app from
+// the /query requests that end "now": the end of their range is Grafana's
+// clock at the time of the request. A Docker VM whose clock drifts (as it
+// often does on macOS after the host slept) shifts the data on the panels,
+// or hides the latest points beyond the right edge, without any error.
+type skewDetector struct {
+	metric  *series // app.clock_skew, in seconds
+	correct bool
+
+	mu       sync.Mutex
+	skew     time.Duration // Grafana's clock minus the app's
+	measured bool
+	warned   bool
+}
+
+func newSkewDetector(reg *registry, correct bool) (*skewDetector, error) {
+	s, err := reg.getOrCreate("app.clock_skew")
+	if err != nil {
+		return nil, err
+	}
+	s.describe("s", "Clock skew between Grafana and the app (positive: Grafana is ahead)")
+	return &skewDetector{metric: s, correct: correct}, nil
+}
+
+// observe measures the skew from a /query request body that arrived at now.
+func (d *skewDetector) observe(body []byte, now time.Time) {
+	var q struct {
+		Range struct {
+			To  time.Time `json:"to"`
+			Raw struct {
+				To interface{} `json:"to"`
+			} `json:"raw"`
+		} `json:"range"`
+	}
+	if err := json.Unmarshal(body, &q); err != nil || q.Range.Raw.To != "now" || q.Range.To.IsZero() {
+		return
+	}
+	sample := q.Range.To.Sub(now)
+
+	d.mu.Lock()
+	if d.measured {
+		d.skew += time.Duration(skewSmoothing * float64(sample-d.skew))
+	} else {
+		d.skew, d.measured = sample, true
+	}
+	skew := d.skew
+	skewed := skew > skewThreshold || skew < -skewThreshold
+	warn := skewed != d.warned
+	d.warned = skewed
+	d.mu.Unlock()
+
+	d.metric.Add(skew.Seconds())
+	switch {
+	case warn && skewed && d.correct:
+		log.Printf("clock skew: Grafana's clock is %s off the app's; correcting the time ranges and timestamps", skew.Round(time.Millisecond))
+	case warn && skewed:
+		log.Printf("clock skew: Grafana's clock is %s off the app's, which shifts the data on the panels; sync the clocks (e.g. restart the Docker VM) or use -correct-skew", skew.Round(time.Millisecond))
+	case warn:
+		log.Println("clock skew: Grafana's clock and the app's are in sync again")
+	}
+}
+
+// offset returns the skew to correct: the estimate, if -correct-skew is
+// on and the skew is beyond skewThreshold, and zero otherwise. A nil
+// detector corrects nothing.
+func (d *skewDetector) offset() time.Duration {
+	if d == nil || !d.correct {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.warned {
+		return 0
+	}
+	return d.skew
+}
+
+// shiftResult moves the timestamps of one series of a /query response by d.
+func shiftResult(r *queryResult, d time.Duration) {
+	ms := float64(d / time.Millisecond)
+	for i := range r.Datapoints {
+		r.Datapoints[i][1] += ms
+	}
+}
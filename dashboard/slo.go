@@ -0,0 +1,148 @@
+package dashboard
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sloSpec describes a service level objective on a boolean availability
+// metric: "<metric>:<target percent>:<window>", as in "http.up:99.5:30d".
+// A sample counts as available if it is non-zero.
+type sloSpec struct {
+	metric string
+	target float64 // fraction, e.g. 0.995
+	window time.Duration
+}
+
+func parseSLOSpec(s string) (sloSpec, error) {
+	var spec sloSpec
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return spec, fmt.Errorf("slo %q: want <metric>:<target percent>:<window>", s)
+	}
+	spec.metric = parts[0]
+	pct, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || pct <= 0 || pct >= 100 {
+		return spec, fmt.Errorf("slo %q: target must be a percentage between 0 and 100", s)
+	}
+	spec.target = pct / 100
+	if spec.window, err = parseDuration(parts[2]); err != nil {
+		return spec, fmt.Errorf("slo %q: %s", s, err)
+	}
+	return spec, nil
+}
+
+// parseDuration is time.ParseDuration plus a "d" unit for days, because
+// SLO windows are usually given in days.
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// availability counts good and total samples in time buckets covering a
+// sliding window. With one-minute buckets, a 30-day window needs about
+// 43,000 buckets, rather than millions of raw samples.
+type availability struct {
+	mu     sync.Mutex
+	bucket time.Duration
+	ids    []int64 // bucket number (time / bucket) of each slot
+	good   []int
+	total  []int
+}
+
+func newAvailability(window, bucket time.Duration) *availability {
+	n := int(window / bucket)
+	if n < 1 {
+		n = 1
+	}
+	return &availability{
+		bucket: bucket,
+		ids:    make([]int64, n),
+		good:   make([]int, n),
+		total:  make([]int, n),
+	}
+}
+
+func (a *availability) add(ok bool, t time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	id := t.UnixNano() / int64(a.bucket)
+	i := int(id % int64(len(a.ids)))
+	if a.ids[i] != id {
+		a.ids[i], a.good[i], a.total[i] = id, 0, 0
+	}
+	a.total[i]++
+	if ok {
+		a.good[i]++
+	}
+}
+
+// ratio returns the fraction of good samples within the period before t,
+// and false if there are no samples in that period.
+func (a *availability) ratio(t time.Time, period time.Duration) (float64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := t.UnixNano() / int64(a.bucket)
+	oldest := now - int64(period/a.bucket)
+	var good, total int
+	for i, id := range a.ids {
+		if id > oldest && id <= now {
+			good += a.good[i]
+			total += a.total[i]
+		}
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return float64(good) / float64(total), true
+}
+
+// Bucket size of the SLO window, and the period over which the burn rate
+// is computed.
+const (
+	sloBucket         = time.Minute
+	sloBurnRatePeriod = time.Hour
+)
+
+// addSLOSeries tracks the availability of src and creates two series:
+//
+// "<name>.error_budget" is the fraction of the error budget that is left
+// over the SLO window: 1 means no errors so far, 0 means the budget is
+// used up, and negative values mean the SLO is violated.
+//
+// "<name>.burn_rate" is how fast the budget was spent during the last hour,
+// relative to the sustainable rate. A burn rate of 1 uses up the budget
+// exactly at the end of the window; 10 uses it up ten times faster.
+func addSLOSeries(reg *registry, src *series, spec sloSpec) error {
+	budget, err := reg.getOrCreate(src.name + ".error_budget")
+	if err != nil {
+		return err
+	}
+	burn, err := reg.getOrCreate(src.name + ".burn_rate")
+	if err != nil {
+		return err
+	}
+	budget.describe("percentunit", fmt.Sprintf("Error budget left for %s over %s (SLO %g%%)", src.name, spec.window, spec.target*100))
+	burn.describe("none", fmt.Sprintf("Error budget burn rate of %s during the last %s (1 = sustainable)", src.name, sloBurnRatePeriod))
+	allowed := 1 - spec.target
+	avail := newAvailability(spec.window, sloBucket)
+	src.observe(func(v float64, t time.Time) {
+		avail.add(v != 0, t)
+		if r, ok := avail.ratio(t, spec.window); ok {
+			budget.Add(1 - (1-r)/allowed)
+		}
+		if r, ok := avail.ratio(t, sloBurnRatePeriod); ok {
+			burn.Add((1 - r) / allowed)
+		}
+	})
+	return nil
+}
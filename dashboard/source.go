@@ -0,0 +1,145 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/appliedgo/diydashboard/collectors"
+)
+
+// A sourceFunc creates the generator of a metric's values. The generator
+// gets called once per second with the number of seconds since start, in
+// the registry's time. scale stretches patterns made for a 5-minute
+// dashboard to the registry's time range.
+type sourceFunc func(scale float64, start time.Time) func(t float64) float64
+
+// pushSource is the source name for a metric that gets its values from
+// outside, through Add: from the code that created it, or via UDP.
+const pushSource = "push"
+
+// sources are the generators that can take over a metric at runtime
+// through POST /api/source: the demo shapes, and the collectors that add
+// themselves here.
+var sources = map[string]sourceFunc{}
+
+func init() {
+	for name, f := range demoShapes {
+		sources[name] = f
+	}
+	// "cpu" is the load of all CPU cores together, where it can be read.
+	if _, err := collectors.CPUCores(); err == nil {
+		sources["cpu"] = func(float64, time.Time) func(float64) float64 {
+			load := collectors.NewCPULoadFunc(collectors.AllCores, 0)
+			return func(float64) float64 { return load() }
+		}
+	}
+}
+
+// A feeder runs a source for one series. While a series has a feeder,
+// the values that arrive through Add get dropped, so the generator that
+// fed the series before (like the CPU simulation) falls silent without
+// knowing about it.
+type feeder struct {
+	source string
+	stop   chan struct{}
+}
+
+// source returns the name of the source that feeds s.
+func (s *series) source() string {
+	if f, _ := s.feeder.Load().(*feeder); f != nil {
+		return f.source
+	}
+	return pushSource
+}
+
+// setSource lets the source name feed s from now on, stopping the
+// previous feeder. The buffer of s stays as it is, so the graph shows the
+// history of the old source followed by the new one.
+func (r *registry) setSource(s *series, name string) error {
+	f := &feeder{source: name, stop: make(chan struct{})}
+	if name == pushSource {
+		f = nil
+	} else {
+		src, ok := sources[name]
+		if !ok {
+			return fmt.Errorf("unknown source %q", name)
+		}
+		start := r.clock.Now()
+		gen := src(r.timeRange.Seconds()/300, start)
+		ticks := r.clock.Tick(time.Second)
+		r.group.Go(func(ctx context.Context) error {
+			for {
+				select {
+				case now := <-ticks:
+					s.feed(gen(now.Sub(start).Seconds()))
+				case <-f.stop:
+					return nil
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		})
+	}
+	s.mu.Lock()
+	old, _ := s.feeder.Load().(*feeder)
+	s.feeder.Store(f)
+	s.mu.Unlock()
+	if old != nil {
+		close(old.stop)
+	}
+	return nil
+}
+
+// serveSource handles the admin endpoint /api/source. GET lists the
+// sources and which one feeds each metric. POST switches the source of a
+// metric while the app runs:
+//
+//	curl -d '{"metric": "CPU1", "source": "walk"}' localhost:3002/api/source
+//
+// Source "push" gives the metric back to whatever called Add before.
+func serveSource(reg *registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			var resp struct {
+				Sources []string          `json:"sources"`
+				Metrics map[string]string `json:"metrics"`
+			}
+			resp.Sources = append(resp.Sources, pushSource)
+			for name := range sources {
+				resp.Sources = append(resp.Sources, name)
+			}
+			sort.Strings(resp.Sources[1:])
+			resp.Metrics = map[string]string{}
+			for _, s := range reg.list() {
+				resp.Metrics[s.name] = s.source()
+			}
+			writeJSON(w, http.StatusOK, resp)
+		case http.MethodPost:
+			var req struct {
+				Metric string `json:"metric"`
+				Source string `json:"source"`
+			}
+			if !readJSON(w, r, &req) {
+				return
+			}
+			s, ok := reg.get(req.Metric)
+			if !ok {
+				http.Error(w, fmt.Sprintf("unknown metric %q", req.Metric), http.StatusNotFound)
+				return
+			}
+			if err := reg.setSource(s, req.Source); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("metric %s: source switched to %s", s.name, req.Source)
+			writeJSON(w, http.StatusOK, req)
+		default:
+			http.Error(w, "use GET or POST", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// scaledClock runs speed times faster than the wall clock, starting at the
+// time it was created. At speed 60, a simulated hour passes in a minute.
+type scaledClock struct {
+	start time.Time
+	speed float64
+}
+
+func newScaledClock(speed float64) scaledClock {
+	return scaledClock{start: time.Now(), speed: speed}
+}
+
+func (c scaledClock) Now() time.Time {
+	return c.start.Add(time.Duration(float64(time.Since(c.start)) * c.speed))
+}
+
+func (c scaledClock) Tick(d time.Duration) <-chan time.Time {
+	wall := time.Duration(float64(d) / c.speed)
+	if wall <= 0 {
+		wall = 1
+	}
+	ticks := make(chan time.Time, 1)
+	go func() {
+		for range time.Tick(wall) {
+			select {
+			case ticks <- c.Now():
+			default:
+			}
+		}
+	}()
+	return ticks
+}
+
+// wallTime converts t from the time of clock c to the wall clock. It is the
+// inverse of scaledClock.Now for times in the past, and the identity for
+// all other clocks.
+func wallTime(c clock, t time.Time) time.Time {
+	sc, ok := c.(scaledClock)
+	if !ok {
+		return t
+	}
+	return time.Now().Add(-time.Duration(float64(sc.Now().Sub(t)) / sc.speed))
+}
+
+// In time-compression mode, grada still stamps the samples with the wall
+// clock. The datasource proxy stretches the time axis for Grafana: a sample
+// that was added one minute ago appears speed minutes ago. So at speed 60,
+// the last 24 minutes of samples fill Grafana's "Last 24 hours".
+
+// compressQuery rewrites the time range of a /query request from Grafana's
+// stretched time to the wall clock. now is the time of the request.
+func compressQuery(body []byte, now time.Time, speed float64) []byte {
+	return rewriteQueryRange(body, func(t time.Time) time.Time {
+		return now.Add(-time.Duration(float64(now.Sub(t)) / speed))
+	})
+}
+
+// rewriteQueryRange rewrites the time range of a /query request with f.
+// If body is not a /query request, it is returned as it is.
+func rewriteQueryRange(body []byte, f func(t time.Time) time.Time) []byte {
+	var q map[string]interface{}
+	if err := json.Unmarshal(body, &q); err != nil {
+		return body
+	}
+	r, ok := q["range"].(map[string]interface{})
+	if !ok {
+		return body
+	}
+	for _, k := range []string{"from", "to"} {
+		s, _ := r[k].(string)
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			continue
+		}
+		r[k] = f(t).UTC().Format(time.RFC3339Nano)
+	}
+	b, err := json.Marshal(q)
+	if err != nil {
+		return body
+	}
+	return b
+}
+
+// stretchResult rewrites the timestamps of one series of a /query
+// response from the wall clock to Grafana's stretched time.
+func stretchResult(r *queryResult, now time.Time, speed float64) {
+	nowMs := float64(now.UnixNano() / 1e6)
+	for i := range r.Datapoints {
+		p := &r.Datapoints[i]
+		p[1] = nowMs - (nowMs-p[1])*speed
+	}
+}
+
+// rewriteResponse rewrites every series of a /query response with f, like
+// stretchResult, and writes the result to dst with encode. If body is not
+// a /query response, it is copied as it is.
+func rewriteResponse(dst *bytes.Buffer, body []byte, f func(r *queryResult), encode queryEncoder) {
+	results := getResults()
+	defer putResults(results)
+	if err := json.Unmarshal(body, results); err != nil {
+		dst.Write(body)
+		return
+	}
+	for i := range *results {
+		f(&(*results)[i])
+	}
+	dst.Grow(len(body))
+	if err := encode(dst, *results); err != nil {
+		dst.Reset()
+		dst.Write(body)
+	}
+}
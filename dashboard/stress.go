@@ -0,0 +1,109 @@
+package dashboard
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stressSpec is what the -stress flag describes, as in "n=500 rate=10/s":
+// the number of metrics, and the number of samples per second that each
+// metric receives.
+type stressSpec struct {
+	n    int
+	rate float64
+}
+
+func parseStressSpec(s string) (stressSpec, error) {
+	spec := stressSpec{n: 100, rate: 1}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return spec, fmt.Errorf("stress %q: expected key=value, got %q", s, f)
+		}
+		switch kv[0] {
+		case "n":
+			n, err := strconv.Atoi(kv[1])
+			if err != nil || n < 1 {
+				return spec, fmt.Errorf("stress %q: invalid number of metrics %q", s, kv[1])
+			}
+			spec.n = n
+		case "rate":
+			r, err := parseRate(kv[1])
+			if err != nil {
+				return spec, fmt.Errorf("stress %q: %s", s, err)
+			}
+			spec.rate = r
+		default:
+			return spec, fmt.Errorf("stress %q: unknown key %q", s, kv[0])
+		}
+	}
+	return spec, nil
+}
+
+// parseRate parses a rate like "10/s", "30/m", or "10" (per second) and
+// returns it per second.
+func parseRate(s string) (float64, error) {
+	per := time.Second
+	if i := strings.Index(s, "/"); i >= 0 {
+		switch s[i+1:] {
+		case "s":
+		case "m":
+			per = time.Minute
+		case "h":
+			per = time.Hour
+		default:
+			return 0, fmt.Errorf("invalid rate %q: unit must be s, m, or h", s)
+		}
+		s = s[:i]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return v / per.Seconds(), nil
+}
+
+// addStressMetrics creates spec.n metrics named "stress.0000" and so on,
+// and feeds each of them spec.rate random-walk samples per second. This
+// shows what memory, query latency, and Grafana itself do at scale, before
+// going that way in production.
+//
+// Every metric keeps the registry's time range, so the buffers grow with
+// the rate: at 10 samples per second, each metric stores 3000 points.
+func addStressMetrics(reg *registry, spec stressSpec) error {
+	interval := time.Duration(float64(time.Second) / spec.rate)
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	metrics := make([]*series, spec.n)
+	values := make([]float64, spec.n)
+	for i := range metrics {
+		s, err := reg.getOrCreateWith(fmt.Sprintf("stress.%04d", i), reg.timeRange, interval)
+		if err != nil {
+			return err
+		}
+		metrics[i] = s.describe("none", "Random walk for load testing")
+		values[i] = 100 * rand.Float64()
+	}
+
+	var after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	points := int64(reg.timeRange/interval) * int64(spec.n)
+	log.Printf("stress: %d metrics at %g samples/s, %d points in total; expected %d MB at %d bytes per point, heap grew by %d MB",
+		spec.n, spec.rate, points, points*pointSize>>20, pointSize, (int64(after.HeapAlloc)-int64(before.HeapAlloc))>>20)
+
+	reg.every(interval, func(time.Time) {
+		for i, s := range metrics {
+			values[i] += rand.Float64() - 0.5
+			s.Add(values[i])
+		}
+	})
+	return nil
+}
@@ -0,0 +1,201 @@
+package dashboard
+
+import "strings"
+
+// A panelTemplate describes how a generated dashboard shows one kind of
+// series. Empty fields fall back to a time series panel with the unit of
+// the series.
+type panelTemplate struct {
+	suffix    string // series names this template applies to; "" = all
+	prefix    string // and the start of those names; "" = any
+	panelType string // Grafana panel plugin ID, like "timeseries" or "gauge"
+	unit      string // used if the series has no unit of its own
+	min, max  *float64
+	width     int
+}
+
+// A collectorTemplate is a dashboard row for the series of one collector.
+// A series belongs to the first collector that has a matching name prefix.
+// Within the row, the first panel template with a matching suffix and
+// prefix wins.
+type collectorTemplate struct {
+	row      string
+	prefixes []string
+	panels   []panelTemplate
+}
+
+func bound(v float64) *float64 { return &v }
+
+// derivedPanels apply to the series that the app derives from other series
+// (anomaly scores, forecasts, SLOs), no matter which collector the source
+// series comes from.
+var derivedPanels = []panelTemplate{
+	{suffix: ".anomaly", panelType: "timeseries"},
+	{suffix: ".forecast_eta", panelType: "stat", width: 6},
+	{suffix: ".error_budget", panelType: "gauge", min: bound(0), max: bound(1), width: 6},
+	{suffix: ".burn_rate", panelType: "stat", width: 6},
+}
+
+// collectorTemplates are the rows of a generated starter dashboard, in the
+// order they appear. Rows without any series are left out, so the
+// dashboard only shows what the app actually collects.
+var collectorTemplates = []collectorTemplate{
+	{
+		row:      "CPU",
+		prefixes: []string{"CPU", "cpu."},
+		panels:   []panelTemplate{{unit: "percent", min: bound(0), max: bound(100)}},
+	},
+	{
+		row:      "Memory",
+		prefixes: []string{"mem.", "swap."},
+		panels: []panelTemplate{
+			{suffix: ".used_pct", panelType: "gauge", unit: "percent", min: bound(0), max: bound(100), width: 6},
+			{unit: "mbytes", min: bound(0)},
+		},
+	},
+	{
+		row:      "Disk",
+		prefixes: []string{"disk."},
+		panels: []panelTemplate{
+			{suffix: ".used_pct", panelType: "gauge", unit: "percent", min: bound(0), max: bound(100), width: 6},
+			{prefix: "disk.used_pct.", panelType: "gauge", unit: "percent", min: bound(0), max: bound(100), width: 6},
+			{prefix: "disk.inodes_used_pct.", panelType: "gauge", unit: "percent", min: bound(0), max: bound(100), width: 6},
+			{prefix: "disk.io.", unit: "iops", min: bound(0)},
+			{unit: "bytes"},
+		},
+	},
+	{
+		row:      "Network",
+		prefixes: []string{"net.", "tcp."},
+		panels: []panelTemplate{
+			{prefix: "tcp.", unit: "short", min: bound(0)},
+			{unit: "Bps", min: bound(0)},
+		},
+	},
+	{
+		row:      "Temperature",
+		prefixes: []string{"temp."},
+		panels:   []panelTemplate{{unit: "celsius"}},
+	},
+	{
+		row:      "Battery",
+		prefixes: []string{"battery."},
+		panels: []panelTemplate{
+			{suffix: ".pct", panelType: "gauge", unit: "percent", min: bound(0), max: bound(100), width: 6},
+			{unit: "watt"},
+		},
+	},
+	{
+		row:      "System",
+		prefixes: []string{"system."},
+		panels:   []panelTemplate{{unit: "short", min: bound(0)}},
+	},
+	{
+		row:      "HTTP probes",
+		prefixes: []string{"http."},
+		panels: []panelTemplate{
+			{suffix: ".status", panelType: "stat", unit: "none", width: 6},
+			{suffix: ".up", panelType: "stat", unit: "bool", width: 6},
+			{unit: "ms"},
+		},
+	},
+	{
+		row:      "Docker",
+		prefixes: []string{"docker."},
+		panels: []panelTemplate{
+			{suffix: ".cpu_pct", unit: "percent", min: bound(0)},
+			{suffix: ".mem_mb", unit: "mbytes", min: bound(0)},
+		},
+	},
+	{
+		row:      "Processes",
+		prefixes: []string{"proc."},
+		panels: []panelTemplate{
+			{suffix: ".cpu_pct", unit: "percent", min: bound(0)},
+			{suffix: ".rss_mb", unit: "mbytes", min: bound(0)},
+		},
+	},
+	{
+		row:      "Directories",
+		prefixes: []string{"dir."},
+		panels: []panelTemplate{
+			{suffix: ".walk_errors", unit: "short", min: bound(0)},
+			{unit: "mbytes", min: bound(0)},
+		},
+	},
+	{
+		row:      "Logs",
+		prefixes: []string{"log."},
+		panels:   []panelTemplate{{unit: "cps", min: bound(0)}},
+	},
+	{
+		row:      "DNS",
+		prefixes: []string{"dns."},
+		panels: []panelTemplate{
+			{suffix: ".error", unit: "bool", min: bound(0), max: bound(1)},
+			{unit: "ms"},
+		},
+	},
+	{
+		row:      "Ping",
+		prefixes: []string{"ping."},
+		panels: []panelTemplate{
+			{suffix: ".loss", unit: "percent", min: bound(0), max: bound(100)},
+			{unit: "ms"},
+		},
+	},
+	{
+		row:      "Fleet",
+		prefixes: []string{"fleet."},
+		panels: []panelTemplate{
+			{suffix: ".net", unit: "Bps"},
+			{unit: "percent", min: bound(0), max: bound(100)},
+		},
+	},
+	{
+		row:      "Demo",
+		prefixes: []string{"demo."},
+		panels: []panelTemplate{
+			{suffix: ".used_pct", panelType: "gauge", min: bound(0), max: bound(100), width: 6},
+			{suffix: ".up", panelType: "stat", width: 6},
+			{},
+		},
+	},
+	{
+		row:      "App",
+		prefixes: []string{"app.", "go.", "process."},
+		panels:   []panelTemplate{{}},
+	},
+	{
+		row:      "Status",
+		prefixes: []string{"alert.", "grafana."},
+		panels:   []panelTemplate{{panelType: "stat", width: 6}},
+	},
+}
+
+// otherTemplate is the row for all series that no collector claims.
+var otherTemplate = collectorTemplate{row: "Other"}
+
+// collectorFor returns the template of the collector that name belongs to.
+func collectorFor(name string) collectorTemplate {
+	for _, c := range collectorTemplates {
+		for _, p := range c.prefixes {
+			if strings.HasPrefix(name, p) {
+				return c
+			}
+		}
+	}
+	return otherTemplate
+}
+
+// panelFor returns the panel template for a series of collector c.
+func (c collectorTemplate) panelFor(name string) panelTemplate {
+	for _, l := range [][]panelTemplate{derivedPanels, c.panels} {
+		for _, p := range l {
+			if strings.HasSuffix(name, p.suffix) && strings.HasPrefix(name, p.prefix) {
+				return p
+			}
+		}
+	}
+	return panelTemplate{}
+}
@@ -0,0 +1,159 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Comparing today with yesterday takes the same metric twice on one
+// panel, once shifted by a day. Grafana's own time shift applies to whole
+// panels. With {"timeShift": "24h"} as a target's additional JSON data,
+// the proxy queries that target for the time range a day earlier, moves
+// its points a day forward, and names the series "CPU1 (24h ago)".
+
+// A timeShiftGroup is the part of a /query request whose targets share
+// a time shift. Each group goes to the datasource server as a request of
+// its own.
+type timeShiftGroup struct {
+	shift time.Duration
+	label string // the shift as the target wrote it, like "24h"
+	body  []byte // the request with the group's targets, for the shifted range
+	// toGrafana rewrites the series of the group's response, as in
+	// resultToGrafana; nil if they need no rewriting.
+	toGrafana func(r *queryResult)
+}
+
+// splitTimeShifts splits a /query request into groups of targets with the
+// same time shift, from the targets' payloads, as in {"target": "CPU1",
+// "data": {"timeShift": "24h"}}. Targets without a time shift come first,
+// in a group with shift 0. It returns nil if no target has a time shift.
+func splitTimeShifts(body []byte) ([]timeShiftGroup, error) {
+	var q map[string]json.RawMessage
+	var targets []json.RawMessage
+	if err := json.Unmarshal(body, &q); err != nil {
+		return nil, nil
+	}
+	if err := json.Unmarshal(q["targets"], &targets); err != nil {
+		return nil, nil
+	}
+	groups := []timeShiftGroup{{}}
+	members := map[time.Duration][]json.RawMessage{}
+	for _, raw := range targets {
+		var t struct {
+			Target  string          `json:"target"`
+			Data    json.RawMessage `json:"data"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		json.Unmarshal(raw, &t)
+		label := targetOption(t.Data, "timeShift")
+		if label == "" {
+			label = targetOption(t.Payload, "timeShift")
+		}
+		var shift time.Duration
+		if label != "" {
+			var err error
+			if shift, err = parseDuration(label); err != nil || shift < 0 {
+				return nil, fmt.Errorf("target %s: bad timeShift %q, want a duration like \"24h\" or \"7d\"", t.Target, label)
+			}
+		}
+		if _, ok := members[shift]; !ok && shift != 0 {
+			groups = append(groups, timeShiftGroup{shift: shift, label: label})
+		}
+		members[shift] = append(members[shift], raw)
+	}
+	if len(groups) == 1 {
+		return nil, nil
+	}
+	if len(members[0]) == 0 {
+		groups = groups[1:]
+	}
+	for i := range groups {
+		g := &groups[i]
+		part := make(map[string]json.RawMessage, len(q))
+		for k, v := range q {
+			part[k] = v
+		}
+		part["targets"], _ = json.Marshal(members[g.shift])
+		b, err := json.Marshal(part)
+		if err != nil {
+			return nil, err
+		}
+		if g.shift != 0 {
+			b = rewriteQueryRange(b, func(t time.Time) time.Time { return t.Add(-g.shift) })
+		}
+		g.body = b
+	}
+	return groups, nil
+}
+
+// queryTimeShifted sends the groups of a /query request to the datasource
+// server in parallel, and writes the merged response to dst. The series
+// of a shifted group move forward by the shift, after toGrafana, and get
+// the shift appended to their names. If a group fails, the response is
+// that of the failed group.
+func (p *datasourceProxy) queryTimeShifted(ctx context.Context, header http.Header, groups []timeShiftGroup, dst *bytes.Buffer) (int, http.Header, error) {
+	type response struct {
+		status  int
+		header  http.Header
+		body    *bytes.Buffer
+		err     error
+		results []queryResult
+	}
+	responses := make([]response, len(groups))
+	var wg sync.WaitGroup
+	for i, g := range groups {
+		wg.Add(1)
+		go func(r *response, g timeShiftGroup) {
+			defer wg.Done()
+			r.body = getBuffer()
+			if p.workers != nil {
+				r.status, r.header, r.err = p.fanOut(ctx, header, g.body, r.body)
+			} else {
+				r.status, r.header, r.err = p.forward(ctx, http.MethodPost, "/query", header, g.body, r.body)
+			}
+			if r.err != nil || r.status != http.StatusOK {
+				return
+			}
+			if r.err = json.Unmarshal(r.body.Bytes(), &r.results); r.err != nil {
+				return
+			}
+			for i := range r.results {
+				res := &r.results[i]
+				if g.toGrafana != nil {
+					g.toGrafana(res)
+				}
+				if g.shift != 0 {
+					shiftResult(res, g.shift)
+					res.Target += " (" + g.label + " ago)"
+				}
+			}
+		}(&responses[i], g)
+	}
+	wg.Wait()
+	defer func() {
+		for _, r := range responses {
+			putBuffer(r.body)
+		}
+	}()
+
+	var merged []queryResult
+	for _, r := range responses {
+		if r.err != nil {
+			return 0, nil, r.err
+		}
+		if r.status != http.StatusOK {
+			dst.Write(r.body.Bytes())
+			return r.status, r.header, nil
+		}
+		merged = append(merged, r.results...)
+	}
+	if err := p.encode(dst, merged); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, http.Header{"Content-Type": {"application/json"}}, nil
+}
@@ -0,0 +1,63 @@
+package dashboard
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	// The scratch container has no zoneinfo files, so the zone database
+	// comes with the binary.
+	_ "time/tzdata"
+)
+
+// displayZone is the time zone of the timestamps that the app shows to
+// people: the log, the JSON responses of the API server, and alert
+// notifications. Timestamps in memory stay as they are, and Grafana gets
+// Unix milliseconds, which it shows in the browser's zone (or the
+// dashboard's, if set). Set -timezone to the zone of the Grafana
+// dashboards, so that exported timestamps and log lines match the panels.
+var displayZone = time.Local
+
+// setTimezone sets displayZone to the IANA zone name, like "Europe/Berlin",
+// "UTC", or "Local", and switches the log to that zone.
+func setTimezone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("-timezone: %s", err)
+	}
+	displayZone = loc
+	setLogOutput(log.Writer())
+	return nil
+}
+
+// inDisplayZone returns t for showing it to people.
+func inDisplayZone(t time.Time) time.Time {
+	return t.In(displayZone)
+}
+
+// setLogOutput sends the log to w, with timestamps in displayZone. The
+// standard logger can only use the local zone or UTC, so the timestamps
+// come from a writer in between.
+func setLogOutput(w io.Writer) {
+	if z, ok := w.(zonedLogWriter); ok {
+		w = z.out
+	}
+	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime | log.Lmicroseconds | log.LUTC))
+	log.SetOutput(zonedLogWriter{w})
+}
+
+// zonedLogWriter prefixes every log line with the time in displayZone, in
+// the format of the standard logger.
+type zonedLogWriter struct {
+	out io.Writer
+}
+
+func (z zonedLogWriter) Write(p []byte) (int, error) {
+	b := make([]byte, 0, len("2006/01/02 15:04:05 ")+len(p))
+	b = time.Now().In(displayZone).AppendFormat(b, "2006/01/02 15:04:05 ")
+	if _, err := z.out.Write(append(b, p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,61 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+)
+
+// maxDatagramSize is plenty for a `{"m":"temp","v":21.5}` message. Larger
+// datagrams are truncated and then fail to parse.
+const maxDatagramSize = 512
+
+// udpSample is the wire format of a single sensor reading. The field names
+// are deliberately short, to keep the firmware side (think ESP8266) tiny.
+type udpSample struct {
+	M string   `json:"m"`
+	V *float64 `json:"v"`
+}
+
+// serveUDP listens for JSON datagrams on addr and adds each received value
+// to the metric named in the datagram. Unknown metrics are created on the fly.
+//
+// There is no acknowledgement and no retry; a lost datagram simply is a
+// missing data point.
+func serveUDP(addr string, reg *registry) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	log.Println("Listening for UDP samples on", conn.LocalAddr())
+	reg.group.Go(func(ctx context.Context) error {
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				log.Println("udp:", err)
+				continue
+			}
+			var s udpSample
+			if err := json.Unmarshal(buf[:n], &s); err != nil || s.M == "" || s.V == nil {
+				log.Printf("udp: ignoring malformed datagram from %s", from)
+				continue
+			}
+			m, err := reg.getOrCreate(s.M)
+			if err != nil {
+				log.Printf("udp: metric %s: %s", s.M, err)
+				continue
+			}
+			m.Add(*s.V)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,23 @@
+package dashboard
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// uiPage is the app's one web page, for the things that are quicker done
+// with a click than with curl, like pausing collectors during a demo. It
+// calls the admin endpoints of the API server.
+//
+//go:embed ui.html
+var uiPage []byte
+
+// serveUI handles GET /ui.
+func serveUI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GET only", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiPage)
+}
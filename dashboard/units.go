@@ -0,0 +1,141 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A panel that shows the memory of the host (in mbytes) next to the size
+// of a cache that a service reports in bytes needs math in Grafana to line
+// them up. For targets that ask for a unit, the proxy converts the values
+// of a series from the unit of its metric (see series.describe) instead.
+
+// A unitScale is the size of a unit in the base unit of its kind, like
+// 1024 bytes for "KB".
+type unitScale struct {
+	kind string
+	size float64
+}
+
+// unitScales are the units that targets can convert between: Grafana's
+// unit IDs, and the short names that people write. Like Grafana's "bytes",
+// data sizes count in powers of 1024; bit rates count in powers of 1000,
+// like network speeds.
+var unitScales = map[string]unitScale{
+	"bits": {"data", 1.0 / 8}, "bytes": {"data", 1},
+	"kbytes": {"data", 1 << 10}, "mbytes": {"data", 1 << 20}, "gbytes": {"data", 1 << 30}, "tbytes": {"data", 1 << 40},
+	"B": {"data", 1}, "KB": {"data", 1 << 10}, "MB": {"data", 1 << 20}, "GB": {"data", 1 << 30}, "TB": {"data", 1 << 40},
+
+	"Bps": {"data rate", 1}, "KBs": {"data rate", 1 << 10}, "MBs": {"data rate", 1 << 20}, "GBs": {"data rate", 1 << 30},
+	"bps": {"data rate", 1.0 / 8}, "Kbits": {"data rate", 1e3 / 8}, "Mbits": {"data rate", 1e6 / 8}, "Gbits": {"data rate", 1e9 / 8},
+
+	"ns": {"time", 1e-9}, "µs": {"time", 1e-6}, "us": {"time", 1e-6}, "ms": {"time", 1e-3},
+	"s": {"time", 1}, "m": {"time", 60}, "h": {"time", 3600}, "d": {"time", 86400},
+
+	"percent": {"ratio", 0.01}, "percentunit": {"ratio", 1},
+}
+
+// unitNames returns the names of the units, for messages.
+func unitNames() string {
+	names := make([]string, 0, len(unitScales))
+	for name := range unitScales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// unitSpec is what the -unit flag describes, as in "mem.*:GB": the unit to
+// convert the metrics that match the pattern to, unless the panel's target
+// asks for another one.
+type unitSpec struct {
+	pattern string
+	unit    string
+}
+
+func parseUnitSpec(s string) (unitSpec, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return unitSpec{}, fmt.Errorf("unit %q: want <metric>:<unit>", s)
+	}
+	spec := unitSpec{pattern: s[:i], unit: s[i+1:]}
+	if _, ok := unitScales[spec.unit]; !ok {
+		return spec, fmt.Errorf("unit %q: unknown unit %q (%s)", s, spec.unit, unitNames())
+	}
+	return spec, nil
+}
+
+// queryScales finds the factor that converts the values of each target of
+// a /query request to the unit that the target asks for: in its payload,
+// as in {"target": "mem.used", "data": {"unit": "GB"}}, or in specs. A
+// target that asks for a unit that its metric cannot be converted to is
+// an error; a pattern of specs that matches such a metric, like "mem.*"
+// matching mem.used_pct, is not. It returns nil if no values need
+// converting.
+func queryScales(body []byte, specs []unitSpec, reg *registry) (map[string]float64, error) {
+	var q struct {
+		Targets []struct {
+			Target  string          `json:"target"`
+			Data    json.RawMessage `json:"data"`
+			Payload json.RawMessage `json:"payload"`
+		} `json:"targets"`
+	}
+	if err := json.Unmarshal(body, &q); err != nil {
+		return nil, nil
+	}
+	var scales map[string]float64
+	for _, t := range q.Targets {
+		unit := targetOption(t.Data, "unit")
+		if unit == "" {
+			unit = targetOption(t.Payload, "unit")
+		}
+		explicit := unit != ""
+		for _, spec := range specs {
+			if unit != "" {
+				break
+			}
+			if matchPattern(spec.pattern, t.Target) {
+				unit = spec.unit
+			}
+		}
+		if unit == "" {
+			continue
+		}
+		to, ok := unitScales[unit]
+		if !ok {
+			return nil, fmt.Errorf("target %s: unknown unit %q (%s)", t.Target, unit, unitNames())
+		}
+		var have string
+		if s, ok := reg.get(t.Target); ok {
+			have, _ = s.meta()
+		}
+		from, ok := unitScales[have]
+		if !ok || from.kind != to.kind {
+			if !explicit {
+				continue
+			}
+			if have == "" {
+				return nil, fmt.Errorf("target %s: cannot convert to %s, the metric has no unit", t.Target, unit)
+			}
+			return nil, fmt.Errorf("target %s: cannot convert %s to %s", t.Target, have, unit)
+		}
+		if from.size == to.size {
+			continue
+		}
+		if scales == nil {
+			scales = map[string]float64{}
+		}
+		scales[t.Target] = from.size / to.size
+	}
+	return scales, nil
+}
+
+// scaleResult multiplies the values of one series of a /query response by
+// factor. Null values (NaN) stay null.
+func scaleResult(r *queryResult, factor float64) {
+	for i := range r.Datapoints {
+		r.Datapoints[i][0] *= factor
+	}
+}
@@ -53,7 +53,7 @@ Let's start by writing the test code. The reason for doing this first is that wh
 
 ## Using grada for collecting time series data
 
-The small piece of code that follows demonstrates how to create two custom metrics and two data feeds. The data is the current CPU load of two CPU cores, captured every second. I was not able to find a package that can read CPU load on at least the three major OSes (Linux, macOS, and Windows), and so I created a fake CPU load generator instead. The point is to see some nice graphs on the screen, and you can replace that data generator with some useful, real data source later.
+The small piece of code that follows demonstrates how to create custom metrics and data feeds. The data is the current load of each CPU core, captured every second. I was not able to find a package that can read CPU load on at least the three major OSes (Linux, macOS, and Windows) without pulling in a pile of dependencies, and so the repository brings its own: the package `collectors` reads /proc/stat on Linux, asks the Mach kernel on macOS, and calls NtQuerySystemInformation on Windows. Where none of this works (in a container on a Mac, say), or with `-fake`, a fake CPU load generator steps in. The point is to see some nice graphs on the screen, and you can replace that data generator with some useful, real data source later.
 
 So let's start!
 */
@@ -62,13 +62,28 @@ So let's start!
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"math"
 	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	// This is the grada package. (It has no dependencies other than stdlib.)
 	"github.com/christophberger/grada"
+
+	// The real CPU load, read from the operating system.
+	"github.com/appliedgo/diydashboard/collectors"
+
+	// Everything beyond the basics (alerts, annotations, Grafana
+	// provisioning, ...) lives in a package of its own, so that other
+	// services can embed it, too.
+	"github.com/appliedgo/diydashboard/dashboard"
 )
 
 // ## The data generator
@@ -96,14 +111,14 @@ func newFakeDataFunc(max int, volatility float64, responseTime int) func() float
 }
 
 /*
-## Create and run two test metrics
+## Create and run the CPU metrics
 
 In main(), we do just a few steps:
 
-* Create two `Metric` objects. A `Metric` is basically a ring buffer large enough to store timestamped data for the time range that Grafana asks for. Each `Metric` object has a name, in order to identify itself. Later, you will see these names appearing in Grafana when connecting a panel to a metric.
-* Create two data sources. Each data source delivers a number between 0 and (about) 100, at a rate of one number per second.
+* Create one `Metric` object per CPU core. A `Metric` is basically a ring buffer large enough to store timestamped data for the time range that Grafana asks for. Each `Metric` object has a name, in order to identify itself. Later, you will see these names appearing in Grafana when connecting a panel to a metric.
+* Create one data source per core. Each data source delivers a number between 0 and 100, at a rate of one number per second.
 * Define a function that polls a data source and adds the result to a metric.
-* Run that function in two goroutines, one goroutine per metric.
+* Run that function in one goroutine per metric.
 
 This handful of steps is enough to get our time series data flowing.
 
@@ -113,54 +128,378 @@ Here are the details:
 //
 func main() {
 
+	// Subcommands like `diydashboard gen-dashboard` do their job and exit.
+	if len(os.Args) > 1 {
+		if ok, err := dashboard.RunCommand(os.Args[1], os.Args[2:]); ok {
+			if err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+	}
+
 	// Here we set up the dashboard. This automatically starts the HTTP server in
 	// the background that will answer the requests from the Grafana dashboard.
 	dash := grada.GetDashboard()
 
-	// Then, we create two Metrics with target names "CPU1" and "CPU2", respectively.
-
-	// We want to save enough data for a 5-minute time range, at an incoming data
-	// rate of one value per second.
-	CPU1metric, err := dash.CreateMetric("CPU1", 5*time.Minute, time.Second)
+	// The flags of the app, like -config and -api, share the command line
+	// with `-fake` and the flags of the collectors below, so `-h` lists
+	// them all.
+	opts := dashboard.DefineFlags(flag.CommandLine)
+	fake := flag.Bool("fake", false, "simulate the load of two CPU cores instead of reading the real CPU load")
+	memInterval := flag.Duration("mem-interval", 5*time.Second, "how often to sample the memory usage of the app and the system, and the swap space")
+	diskInterval := flag.Duration("disk-interval", 30*time.Second, "how often to sample the space in use on each filesystem")
+	inodeInterval := flag.Duration("inode-interval", time.Minute, "how often to sample the inodes in use on each filesystem")
+	selfStats := flag.Bool("selfstats", false, "collect the goroutines, heap, garbage collections, and GC pauses of the Go runtime, and the open file descriptors of the app, every 5 seconds")
+	gcStress := flag.Int("gc-stress", 0, "allocate this many MB of garbage per second, to see the garbage collector at work with -selfstats")
+	netInterval := flag.Duration("net-interval", 5*time.Second, "how often to sample the traffic of each network interface")
+	diskIOInterval := flag.Duration("disk-io-interval", 5*time.Second, "how often to sample the I/O operations and bytes of each block device (Linux only)")
+	diskIODevices := flag.String("disk-io-devices", "", "comma-separated block devices to collect the I/O of, like \"sda,nvme*\" (default all disks but loop and ram devices, without partitions)")
+	tcpInterval := flag.Duration("tcp-interval", 5*time.Second, "how often to count the TCP connections by state")
+	tcpPort := flag.Int("tcp-port", 0, "count only the TCP connections with this local port, like 8080 for a web server (default all)")
+	tempInterval := flag.Duration("temp-interval", 5*time.Second, "how often to read the temperature sensors (Linux only)")
+	tempFilter := flag.String("temp-filter", "", "regular expression for the names of the temperature metrics to collect, like \"coretemp|nvme\" (default all)")
+	batteryInterval := flag.Duration("battery-interval", 10*time.Second, "how often to read the battery charge and charge rate (Linux and macOS)")
+	procInterval := flag.Duration("proc-interval", 10*time.Second, "how often to count the processes running on the host")
+	var watchProcesses []string
+	flag.Func("watch-process", "collect the CPU load and memory of the process with this name or PID, like \"nginx\", as \"proc.nginx.cpu_pct\" and \"proc.nginx.rss_mb\" (Linux only; repeatable)", func(s string) error {
+		watchProcesses = append(watchProcesses, s)
+		return nil
+	})
+	tailPath := flag.String("tail", "", "log file to count the new lines of, per second, following it across rotation like \"tail -F\", like \"/var/log/app.log\"")
+	tailMatch := flag.String("match", "", "regular expression for the lines of -tail to count, like \"ERROR\" (default all lines)")
+	tailInterval := flag.Duration("tail-interval", 5*time.Second, "how often to turn the lines of -tail into a rate")
+	var watchDirs []string
+	flag.Func("watch-dir", "record the total size of the files in this directory and below, like \"/home/me/Downloads\", as \"dir.home_me_Downloads.size_mb\" (repeatable)", func(s string) error {
+		watchDirs = append(watchDirs, s)
+		return nil
+	})
+	watchDirInterval := flag.Duration("watch-dir-interval", 5*time.Minute, "how often to add up the sizes of the files of -watch-dir")
+	watchInterval := flag.Duration("watch-process-interval", 5*time.Second, "how often to read the CPU load and memory of the processes of -watch-process")
+	pingHosts := flag.String("ping", "", "comma-separated hosts to measure the round trip time to, like \"8.8.8.8,example.com\" (ICMP, or TCP connect to port 443 or 80 without the privileges for ICMP)")
+	pingInterval := flag.Duration("ping-interval", 10*time.Second, "how often to ping the hosts of -ping, and how long to wait for an answer")
+	httpURLs := flag.String("http", "", "comma-separated URLs to send GET requests to, for their response time and whether they are up (2xx), like \"https://example.com/health\"")
+	httpInterval := flag.Duration("http-interval", 30*time.Second, "how often to probe the URLs of -http")
+	httpTimeout := flag.Duration("http-timeout", 5*time.Second, "how long to wait for the response of a URL of -http before it counts as down")
+	dnsHosts := flag.String("dns", "", "comma-separated hostnames to resolve, for the time it takes and whether the resolver answers with an error, like \"example.com,nas.lan\"")
+	dnsServer := flag.String("dns-server", "", "DNS server to ask for the hostnames of -dns, like \"192.168.1.1\" or \"1.1.1.1:53\" (default the system's resolver)")
+	dnsInterval := flag.Duration("dns-interval", 30*time.Second, "how often to resolve the hostnames of -dns")
+	docker := flag.Bool("docker", false, "collect the CPU load and memory of the running Docker containers, through the Docker Engine API")
+	dockerSocket := flag.String("docker-socket", collectors.DefaultDockerSocket(), "socket of the Docker Engine API, like \"/run/user/1000/docker.sock\" for rootless Docker")
+	dnsTimeout := flag.Duration("dns-timeout", 2*time.Second, "how long to wait for the resolver to answer for a hostname of -dns")
+	ifaces := flag.String("ifaces", "", "comma-separated network interfaces to collect the traffic of, like \"eth0,wlan*\" (default all but loopback)")
+	diskExclude := flag.String("disk-exclude", strings.Join(collectors.DefaultDiskExclude, ","), "comma-separated filesystem types to leave out (on Windows: removable, fixed, remote, cdrom, ramdisk)")
+
+	// The app lets data sources find (or create) a metric by its name.
+	// Optional features are switched on through command line flags.
+	flag.Parse()
+	app, err := dashboard.New(dash, opts)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	// The same as above, but this time, we specify the buffer size directly.\
-	// 5 mins = 300 seconds = 300 data points needed
-	CPU2metric, err := dash.CreateMetricWithBufSize("CPU2", 300)
-	if err != nil {
-		log.Fatalln(err)
+	// Now we need a data stream per CPU core. `collectors.NewCPULoadFunc()`
+	// waits for a second and returns the load of a core during that second.
+	// If the app cannot read the CPU load, or with `-fake`,
+	// `newFakeDataFunc()` simulates two cores instead.
+	var cpuStats []func() float64
+	cores, err := collectors.CPUCores()
+	simulated := *fake
+	if err != nil && !*fake {
+		log.Printf("cannot read the CPU load (%s); simulating it instead", err)
+		simulated = true
+	}
+	if simulated {
+		cpuStats = []func() float64{
+			newFakeDataFunc(100, 0.2, 1000),
+			newFakeDataFunc(100, 0.1, 1000),
+		}
+	} else {
+		for i := 0; i < cores; i++ {
+			cpuStats = append(cpuStats, collectors.NewCPULoadFunc(i, time.Second))
+		}
 	}
 
-	// Now we need some simulated data streams. `newFakeDataFunc()` delivers exactly this.
-	//
-	CPU1stats := newFakeDataFunc(100, 0.2, 1000)
-	CPU2stats := newFakeDataFunc(100, 0.1, 1000)
-
-	// In order to poll two data streams at the same time, we need to spawn
-	// one goroutine per data stream. This function will become the body of
-	// those goroutines.\
-	// To keep things simple, this code intentionally lacks any sort of
-	// goroutine cancellation mechanism. The function simply runs until the
-	// user hits Ctrl-C.\
+	// In order to poll several data streams at the same time, we need to spawn
+	// one goroutine per data stream. This function spawns them.\
+	// `app.Go()` ties each goroutine to the app, so that when the user hits
+	// Ctrl-C, the app waits for them to finish before it exits. A data
+	// function cannot be interrupted, though, and some wait a minute before
+	// they return; so each call runs in a goroutine of its own, and the loop
+	// returns as soon as the app stops, without waiting for the value.\
 	// The loop rate is automatically limited by dataFunc() that returns only
 	// if a new value is available.
-	trading := func(metric *grada.Metric, dataFunc func() float64) {
-		for {
-			metric.Add(dataFunc())
+	trading := func(metric *dashboard.Metric, dataFunc func() float64) {
+		app.Go(func(ctx context.Context) error {
+			values := make(chan float64, 1)
+			for {
+				go func() { values <- dataFunc() }()
+				select {
+				case v := <-values:
+					metric.Add(v)
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		})
+	}
+
+	// For each core, we create a Metric with the target name "CPU1",
+	// "CPU2", and so on. We want to save enough data for a 5-minute time
+	// range, at an incoming data rate of one value per second.\
+	// (`dash.CreateMetricWithBufSize(name, 300)` does the same: 5 mins = 300
+	// seconds = 300 data points needed.)\
+	// Then we spawn the goroutines. We add the metrics to the app first, so
+	// that other parts of the app (like alert rules) can see the data.
+	for i, stats := range cpuStats {
+		name := fmt.Sprintf("CPU%d", i+1)
+		metric, err := dash.CreateMetric(name, 5*time.Minute, time.Second)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		description := fmt.Sprintf("Load of CPU core %d", i+1)
+		if simulated {
+			description += " (simulated)"
 		}
+		// The label lets Grafana's legend say "core 1" instead of "CPU1"
+		// with `-alias "CPU*:core {{core}}"`.
+		m := app.Register(name, metric, 300).Describe("percent", description).Label("core", strconv.Itoa(i+1))
+		trading(m, stats)
+	}
+
+	// The other collectors work the same way, just with other data
+	// functions and at their own pace. Each one comes with the names,
+	// units, and descriptions of its metrics.
+	collect := func(metrics []collectors.Metric, interval time.Duration) {
+		for _, m := range metrics {
+			metric, err := dash.CreateMetric(m.Name, 5*time.Minute, interval)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			trading(app.Register(m.Name, metric, int(5*time.Minute/interval)).Describe(m.Unit, m.Description), m.Func)
+		}
+	}
+	if *memInterval <= 0 || *diskInterval <= 0 || *inodeInterval <= 0 || *diskIOInterval <= 0 || *netInterval <= 0 || *tcpInterval <= 0 || *tempInterval <= 0 || *batteryInterval <= 0 || *procInterval <= 0 || *watchInterval <= 0 || *tailInterval <= 0 || *watchDirInterval <= 0 || *pingInterval <= 0 || *httpInterval <= 0 || *httpTimeout <= 0 || *dnsInterval <= 0 || *dnsTimeout <= 0 {
+		log.Fatalln("-mem-interval, -disk-interval, -inode-interval, -disk-io-interval, -net-interval, -tcp-interval, -temp-interval, -battery-interval, -proc-interval, -watch-process-interval, -tail-interval, -watch-dir-interval, -ping-interval, -http-interval, -http-timeout, -dns-interval, and -dns-timeout must be positive")
 	}
 
-	// Let's spawn the two goroutines now.
-	go trading(CPU1metric, CPU1stats)
-	go trading(CPU2metric, CPU2stats)
+	// Where the system memory cannot be read, we still get the memory of
+	// the app itself.
+	memStats, err := collectors.MemoryMetrics(*memInterval)
+	if err != nil {
+		log.Printf("%s; collecting only the memory of the app", err)
+	}
+	collect(memStats, *memInterval)
+
+	// Swap is memory, too, and goes at the same pace. Without swap space,
+	// there is only the percentage, which stays at 0.
+	swapStats, err := collectors.SwapMetrics(*memInterval)
+	if err != nil {
+		log.Println(err)
+	}
+	collect(swapStats, *memInterval)
 
-	// A quick and dirty way of waiting for Ctrl-C. An empty `select{}` always blocks.
-	//
-	// Hit Ctrl-C to stop the app.
+	// One metric per mounted filesystem. The list is made once, at
+	// startup; a drive that gets removed later just stops updating.
+	diskStats, err := collectors.DiskMetrics(*diskInterval, strings.Split(*diskExclude, ","))
+	if err != nil {
+		log.Println(err)
+	}
+	collect(diskStats, *diskInterval)
+	inodeStats, err := collectors.InodeMetrics(*inodeInterval, strings.Split(*diskExclude, ","))
+	if err != nil {
+		log.Println(err)
+	}
+	collect(inodeStats, *inodeInterval)
 
-	select {}
+	// Four metrics per block device, for the operations and bytes read
+	// and written per second.
+	var deviceList []string
+	if *diskIODevices != "" {
+		deviceList = strings.Split(*diskIODevices, ",")
+	}
+	diskIOStats, err := collectors.DiskIOMetrics(*diskIOInterval, deviceList)
+	if err != nil {
+		log.Println(err)
+	}
+	collect(diskIOStats, *diskIOInterval)
+
+	// Two metrics per network interface, for the bytes received and sent
+	// per second.
+	var ifaceList []string
+	if *ifaces != "" {
+		ifaceList = strings.Split(*ifaces, ",")
+	}
+	netStats, err := collectors.NetworkMetrics(*netInterval, ifaceList)
+	if err != nil {
+		log.Println(err)
+	}
+	collect(netStats, *netInterval)
+
+	// One metric per TCP state, like tcp.established and tcp.time_wait,
+	// for all connections or those of one local port.
+	tcpStats, err := collectors.TCPMetrics(*tcpInterval, *tcpPort)
+	if err != nil {
+		log.Println(err)
+	}
+	collect(tcpStats, *tcpInterval)
+
+	// One metric per temperature sensor. Boards with dozens of sensors
+	// call for -temp-filter.
+	var filter *regexp.Regexp
+	if *tempFilter != "" {
+		if filter, err = regexp.Compile(*tempFilter); err != nil {
+			log.Fatalln("-temp-filter:", err)
+		}
+	}
+	tempStats, err := collectors.TemperatureMetrics(*tempInterval, filter)
+	if err != nil {
+		log.Println(err)
+	}
+	collect(tempStats, *tempInterval)
+
+	// A laptop gets its battery charge and charge rate; other machines
+	// get nothing.
+	batteryStats, err := collectors.BatteryMetrics(*batteryInterval)
+	if err != nil {
+		log.Println(err)
+	}
+	collect(batteryStats, *batteryInterval)
+
+	// The simplest real data source of all: how many processes run on
+	// the host.
+	procStats, err := collectors.ProcessMetrics(*procInterval)
+	if err != nil {
+		log.Println(err)
+	}
+	collect(procStats, *procInterval)
+
+	// A metric pair for each process to watch. A process that is not
+	// running yet gets its metrics when it starts.
+	for _, target := range watchProcesses {
+		procWatch, err := collectors.WatchProcess(target, *watchInterval)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		collect(procWatch, *watchInterval)
+	}
+
+	// A log file that gets more lines than usual, or more errors, means
+	// that something is up.
+	if *tailPath != "" {
+		var match *regexp.Regexp
+		if *tailMatch != "" {
+			if match, err = regexp.Compile(*tailMatch); err != nil {
+				log.Fatalln("-match:", err)
+			}
+		}
+		collect([]collectors.Metric{collectors.TailMetric(*tailPath, match, *tailInterval)}, *tailInterval)
+	}
+
+	// Probes measure something on the outside, like the round trip time to
+	// another host, and can take a while to do so. Unlike the collectors
+	// above, they run in the app's group of background work, so they stop
+	// when the app stops. A probe that fails, because the host did not
+	// answer in time, adds no value: a gap in the graph says more than a
+	// made-up number.
+	probe := func(probes []collectors.Probe, interval time.Duration) {
+		for _, p := range probes {
+			p := p
+			// Slow probes keep 100 points, or their graphs would be a
+			// few dots.
+			keep := 5 * time.Minute
+			if keep < 100*interval {
+				keep = 100 * interval
+			}
+			metric, err := dash.CreateMetric(p.Name, keep, interval)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			m := app.Register(p.Name, metric, int(keep/interval)).Describe(p.Unit, p.Description)
+			app.Go(func(ctx context.Context) error {
+				tick := time.NewTicker(interval)
+				defer tick.Stop()
+				for {
+					if v, err := p.Func(ctx); err == nil {
+						m.Add(v)
+					}
+					select {
+					case <-tick.C:
+					case <-ctx.Done():
+						return nil
+					}
+				}
+			})
+		}
+	}
+	if *pingHosts != "" {
+		pingProbes, tcp := collectors.PingProbes(strings.Split(*pingHosts, ","), *pingInterval)
+		if tcp {
+			log.Println("cannot open an ICMP socket; timing TCP connections to port 443 or 80 instead")
+		}
+		probe(pingProbes, *pingInterval)
+	}
+	if *httpURLs != "" {
+		httpProbes, err := collectors.HTTPProbes(strings.Split(*httpURLs, ","), *httpInterval, *httpTimeout)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		probe(httpProbes, *httpInterval)
+	}
+	if *dnsHosts != "" {
+		probe(collectors.DNSProbes(strings.Split(*dnsHosts, ","), *dnsServer, *dnsInterval, *dnsTimeout), *dnsInterval)
+	}
+	probe(collectors.DirSizeProbes(watchDirs, *watchDirInterval), *watchDirInterval)
+
+	// Docker containers come and go while the app runs, so their metrics
+	// cannot be set up front like those above. Instead, the collector
+	// asks for a pair of metrics whenever it sees a new container.
+	if *docker {
+		d, err := collectors.NewDocker(*dockerSocket)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		containerMetric := func(name, unit, description string) func(float64) {
+			m, err := app.Metric(name)
+			if err != nil {
+				log.Println(err)
+				return func(float64) {}
+			}
+			return m.Describe(unit, description).Add
+		}
+		app.Go(func(ctx context.Context) error {
+			d.Watch(ctx, func(name string) (cpu, mem func(float64)) {
+				return containerMetric("docker."+name+".cpu_pct", "percent", "CPU load of container "+name+", in percent of one core"),
+					containerMetric("docker."+name+".mem_mb", "mbytes", "Memory in use by container "+name)
+			})
+			return nil
+		})
+	}
+
+	// And a look at the Go runtime itself, for when this code moves into
+	// a real service.
+	if *selfStats {
+		collect(collectors.RuntimeMetrics(5*time.Second), 5*time.Second)
+		fdStats, err := collectors.FileDescriptorMetrics(5 * time.Second)
+		if err != nil {
+			log.Println(err)
+		}
+		collect(fdStats, 5*time.Second)
+	}
+	if *gcStress > 0 {
+		app.Go(func(ctx context.Context) error {
+			collectors.MakeGarbage(ctx, *gcStress)
+			return nil
+		})
+	}
+
+	// Everything else (alerts, additional data sources, ...) depends on the
+	// command line flags. `Run()` blocks until we hit Ctrl-C, and then shuts
+	// down the servers and background jobs of the app cleanly.
+	if err := app.Run(); err != nil {
+		log.Fatalln(err)
+	}
 }
 
 /*
@@ -175,7 +514,56 @@ The `Metric` type stores exactly the amount of data points that can occur for th
 
 For example, if your code delivers new data every 5 seconds, and if the maximum time range to monitor is 5 minutes, only the most recent 60 data points are stored (5min * 60s/min / 5s).
 
-Second, all data points are stored in memory. Each data point is a `struct` containing a `float64` and a `time.Time` value. This struct consumes 32 bytes. There is no persistant storage behind a `Metric` object; so if you plan to monitor large time ranges and/or high-frequency data sources, verify if the required buffer still fits into main memory.
+Second, all data points are stored in memory. Each data point is a `struct` containing a `float64` and a `time.Time` value. This struct consumes 32 bytes. There is no persistant storage behind a `Metric` object; so if you plan to monitor large time ranges and/or high-frequency data sources, verify if the required buffer still fits into main memory. While the app runs, `curl localhost:3002/api/metrics` lists the buffer of each metric: how many points it holds, how many are in use, how many bytes it takes, and what time range it covers at the rate the metric actually receives data. To see what the metrics are about, `curl localhost:3002/api/catalog` lists each one with its kind (the collector it comes from), unit, labels, description, the panel type a generated dashboard uses for it, and its last few values. Timestamps in these responses, in the log, and in alert notifications use the system's local time zone; `-timezone Europe/Berlin` (or any other zone name) switches them to the zone your Grafana dashboards show, so that they match the panels. Grafana itself always receives UTC.
+
+If the panels look shifted, or the latest points never show up, the clocks may disagree. This happens with Docker on macOS, whose VM clock tends to drift after the Mac slept. While the datasource proxy runs, the app compares the end of each "until now" query with its own clock: the metric `app.clock_skew` shows the difference, and beyond two seconds, a warning goes to the log. `-correct-skew` goes one step further and shifts the queries and the returned timestamps by the measured skew.
+
+A metric's data source can change while the app runs. `curl -d '{"metric": "CPU1", "source": "walk"}' localhost:3002/api/source` lets a random walk feed CPU1 instead of the trading goroutine, whose values get dropped from then on. The buffer stays as it is, so the graph continues right where the old source stopped. `"source": "cpu"` feeds it the load of all cores together, and `"source": "push"` hands the metric back to the goroutine, and `GET /api/source` lists the available sources and which one feeds each metric.
+
+In a demo, the interesting moment passes quickly: the CPU spike scrolls off to the left while you are still explaining it. Open `http://localhost:3002/ui` in a browser, and a small page lists the collectors (CPU, Memory, Network, and so on, like the rows of a generated dashboard) with a button to pause each one. While a collector is paused, the samples of its metrics get dropped, and the graphs freeze where they were. "Collect once" lets one more sample of each metric through, to move on step by step, and "Resume" lets the data flow again. The page uses the admin endpoint `/api/collectors`, so the same works with `curl -d '{"collector": "CPU", "action": "pause"}' localhost:3002/api/collectors`. The collectors keep running while paused; only their samples go nowhere.
+
+To find out before going to production, run the app with `-stress "n=500 rate=10/s"`. This creates 500 additional metrics with ten values per second each, logs how much memory they take, and lets you watch how Grafana copes with that many series. Meanwhile, the app records its own heap size, allocation rate, garbage collection pauses, and response times in metrics that start with `app.`, right next to the load it is under.
+
+
+## More metrics of the machine
+
+Besides the CPU load, main() collects a few more metrics of the machine, most of them less often than once per second, so their buffers hold fewer points for the same time range (see the first caveat). Every 5 seconds (or as often as `-mem-interval` says), the app records how much RAM it occupies itself (`mem.process.rss`) and how much memory the whole system uses and has left (`mem.system.used`, `mem.system.free`, and `mem.system.used_pct`). The values are in MB rather than bytes, so the axis labels stay short. On systems where the app cannot read the system memory, it shows only its own.
+
+A machine that runs out of memory starts to swap, so the swap space comes along at the same pace: `swap.used_pct` is the share of the swap space in use, and `swap.in_kbps` and `swap.out_kbps` tell how many KB per second move between RAM and disk. The system counts the pages swapped in and out since it booted, so, as with the network metrics below, the collector reports the difference between two readings. On a machine without any swap space, only `swap.used_pct` shows up, as a flat 0. If you want to add more host metrics of your own, `collectors.SwapMetrics()` is a good template: read a few numbers, return a `Metric` with a name, a unit, and a data function, and `collect()` in `main()` does the rest.
+
+The disk metrics go even slower. Every 30 seconds (`-disk-interval`), the app records how full each mounted filesystem is, in `disk.used_pct.root`, `disk.used_pct.home`, and so on; the mount point becomes part of the name, with slashes and other special characters replaced by underscores. Filesystems that live in memory or belong to the kernel (`tmpfs`, `proc`, `overlay`, and the like) are left out; `-disk-exclude` changes the list. Pull out a USB stick, and its metric just stops updating until the stick is back.
+
+A disk can also fill up with plenty of bytes to spare. Each file takes an inode, and a filesystem has a fixed number of them, so a build server with millions of small files in its caches runs out of inodes first, and every write fails with "no space left on device" while `df` shows half the disk free. Once a minute (`-inode-interval`), the app records the share of the inodes in use on each filesystem, in `disk.inodes_used_pct.root` and so on, for the same filesystems as the space in use. Filesystems that do not count inodes, like btrfs, which makes them as it goes, get no inode metric, and neither do Windows drives.
+
+How full a disk is tells only half the story; how busy it is tells the other half. On Linux, the kernel counts the operations and sectors that each block device has read and written since boot, in /proc/diskstats, one line per device. Every 5 seconds (`-disk-io-interval`), the collector turns these counters into rates: `disk.io.sda.read_ops` and `disk.io.sda.write_ops` are the operations per second, `disk.io.sda.read_bps` and `disk.io.sda.write_bps` the bytes per second. Loop devices, RAM disks, and partitions are left out, unless you list them in `-disk-io-devices "sda,sda1,loop*"`, which also selects the devices in general. (The I/O of a partition counts toward its disk, too.) A device that disappears stops producing points altogether, rather than repeating its last rate.
+
+The network metrics count bytes: `net.eth0.rx_bps` and `net.eth0.tx_bps` are the bytes per second that the interface eth0 received and sent in the last 5 seconds (`-net-interval`). The operating system only keeps running totals, so the collector subtracts the previous total from the current one. When a total goes backwards, because the counter wrapped around or the interface was recreated, the collector skips one reading rather than drawing a huge negative spike. Every interface except loopback gets its two metrics. On a machine with dozens of container interfaces, pick the ones that matter with `-ifaces "eth0,wlan*"`.
+
+Bytes per second say how busy the network is, but not how healthy the connections are. Every 5 seconds (`-tcp-interval`), the app counts the TCP connections by state, one metric per state: `tcp.listen`, `tcp.established`, `tcp.time_wait`, `tcp.close_wait`, and the rest of the TCP state machine. A pile of `time_wait` connections means lots of short-lived connections, perhaps a client that does not reuse them; a growing number of `close_wait` connections means the app does not close the connections that the other side has closed already, a leak. States without any connections count 0 rather than dropping out, so the legend in Grafana stays put. `-tcp-port 8080` counts only the connections with local port 8080, those of a web server, say. On Linux, the collector reads the kernel's tables /proc/net/tcp and /proc/net/tcp6, where each connection is a line with the addresses and the state in hex; elsewhere, it asks `netstat -an`.
+
+On a homelab box, temperatures are what you want to keep an eye on. Linux lists the sensors of the hardware monitoring chips under /sys/class/hwmon, one file per sensor, with the temperature in thousandths of a degree. Every 5 seconds (`-temp-interval`), the app turns each sensor into a metric, named after the chip and the sensor's label, like `temp.coretemp.Core_0` or `temp.nvme.Composite`. Cheap boards have sensors that fail every now and then; a failed reading leaves a gap instead of a stale value. Some boards also have dozens of sensors, most of them useless; `-temp-filter "coretemp|nvme"` keeps only the metrics whose names match the regular expression.
+
+On a laptop, the battery joins in. Every 10 seconds (`-battery-interval`), `battery.pct` records the charge, and `battery.watts` the power that flows into the battery: positive while charging, negative while running on battery, so a graph shows at a glance whether the laptop drains or charges, and how fast. Linux has the numbers in /sys/class/power_supply/BAT0 and its siblings; on macOS, the collector asks `pmset -g batt` for the charge and `ioreg` for the battery's current and voltage. On a desktop, a server, or in a container, there is no battery, and the collector notices that at startup and adds no metrics at all, rather than a flat line at 0.
+
+If all of this looks like a lot of syscalls, here is a data source that needs hardly any: `system.process_count`, the number of processes on the host, every 10 seconds (`-proc-interval`). On Linux, every process has a directory in /proc named after its process ID, so counting the processes means counting the directory names that are numbers. The collector does not open those directories, so a process that exits in the middle of the count cannot trip it up. Windows has `EnumProcesses`, and everywhere else, the collector asks `ps`.
+
+The number of processes says little about any one of them, though. `-watch-process nginx` follows the process named nginx, and records its CPU load in percent of one core (`proc.nginx.cpu_pct`) and its resident memory in MB (`proc.nginx.rss_mb`) every 5 seconds (`-watch-process-interval`); repeat the flag for more processes, or give a PID instead of a name. On Linux, /proc/<pid>/stat has the CPU time that the process has used since it started, in ticks of 1/100 second, so the load is the difference between two readings, divided by the time in between. If the process restarts, it comes back under a new PID; the collector notices that the old PID is gone (or belongs to some other process now) and looks up the name again, so the graph shows a short gap instead of a line that stays flat forever. If several processes share the name, like the master and the workers of nginx, the collector watches the one that started first.
+
+Log files are data sources, too. `-tail /var/log/app.log` counts the lines that the app appends to the file, and every 5 seconds (`-tail-interval`), it turns the count into lines per second, in `log.app_log.lines_per_s`; with `-match ERROR`, only the lines that match the regular expression count. A sudden wave of log lines, or of errors, shows up in the graph long before somebody reads the log. The collector follows the file the way `tail -F` does. It starts at the end, and at each sample, it reads what was added since. Then it checks whether the path still leads to the same file: logrotate renames the file and has the service create a new one, so a different file at the path means the old one has been rotated away, and the collector reads the rest of the old file and moves on to the new one. A file that got shorter was truncated, and gets read from the start. If the file does not exist yet, as with a service that creates its log only on the first request, the collector waits for it.
+
+How fast does the downloads folder grow, or the backup directory? `-watch-dir /home/me/Downloads` adds up the sizes of all files in the directory and below every 5 minutes (`-watch-dir-interval`), and records the total in MB, in `dir.home_me_Downloads.size_mb`; repeat the flag for more directories. A big tree can take minutes to walk, so the walks run like the probes further down, in the app's group of background work: they do not hold up the other collectors, and Ctrl-C stops a walk in the middle instead of waiting for it. The walk does not follow symbolic links, so a link back up the tree cannot send it in circles. Directories that it may not read are skipped and counted in `dir.home_me_Downloads.walk_errors`, so that a size that drops because of a permission problem does not pass for a cleanup.
+
+So far, every metric has been about this machine. With `-ping "8.8.8.8,example.com"`, the app also measures how far away other hosts are: every 10 seconds (`-ping-interval`), it sends each host an ICMP echo request, like `ping` does, and records the round trip time in milliseconds, in `ping.8_8_8_8_ms` and `ping.example_com_ms`. Raw ICMP sockets need root, though. Linux lets ordinary users send pings through a datagram socket, if their group is in net.ipv4.ping_group_range, and so does macOS; if the app cannot open either kind of socket, it says so at startup and times how long it takes to open a TCP connection to port 443 of the host, or port 80, instead. That is a bit slower than a ping, but it moves up and down with the network all the same. A host that does not answer within the interval gets no point at all, rather than some huge number that would squash the rest of the graph. Like the collectors above, the probes run in the app's group of background work (see `app.Go()` below), and a probe that waits for an answer does not hold up Ctrl-C.
+
+Pings tell whether a host is there; whether your website works is another question. `-http "https://example.com,https://example.com/health"` sends a GET request to each URL every 30 seconds (`-http-interval`) and records two metrics per URL, named after its host and path: `http.example_com_health.ms` is the time until the whole response is in, and `http.example_com_health.up` is 1 while the URL works and 0 while it does not. "Works" means a 2xx status. A URL that redirects counts as down, since the probe does not follow redirects: if http:// redirects to https://, probe the https:// URL. So does a URL whose TLS certificate does not check out, one that answers with an error, and one that takes longer than 5 seconds (`-http-timeout`). A URL that is down gets no response time at all, so the .ms graph shows only how fast the site is while it works, and the .up graph shows when it does not. All probes share one HTTP client, which keeps connections open between requests like a browser does, so after the first request the times leave out the TCP and TLS handshakes.
+
+When a website feels slow, the culprit is often not the site but the name lookup in front of it. `-dns "example.com,nas.lan"` resolves each hostname every 30 seconds (`-dns-interval`) and records how long that takes, in `dns.example_com.ms`, next to `dns.example_com.error`, which is 1 while the resolver answers with an error and 0 while it finds addresses. Errors and timeouts are different kinds of trouble: NXDOMAIN (no such name) or SERVFAIL means the resolver works but the name does not, while a resolver that does not answer at all within 2 seconds (`-dns-timeout`) leaves a gap in both metrics. The lookups go to the system's resolver, which may answer from a cache; to time a particular DNS server, like the Pi-hole on the LAN or the router, name it with `-dns-server 192.168.1.1`. Each lookup runs with a deadline, so a resolver that hangs cannot hold up the probe.
+
+Grafana runs in a Docker container next door, so why not graph the neighbors? With `-docker`, the app asks the Docker Engine API which containers are running, and for each one, it reads the stream of statistics that `docker stats` shows: `docker.grafana.cpu_pct` is the CPU load of the container named grafana, in percent of one core (so a container that keeps two cores busy shows 200), and `docker.grafana.mem_mb` the memory it uses, without the page cache that the kernel can drop. Containers are different from everything so far: they come and go while the app runs. So the collector looks for new containers every 5 seconds and asks `main()` for a pair of metrics whenever it sees one for the first time; a container that stops simply goes quiet, and when it comes back, it picks up its old metrics. The API listens on the socket /var/run/docker.sock, which takes membership in the docker group to open. Rootless Docker has its socket elsewhere, like /run/user/1000/docker.sock; the app picks it up from `$DOCKER_HOST`, or name it with `-docker-socket`.
+
+Once this code lives in a real service, the Go runtime is worth a look, too. With `-selfstats`, the app records the number of goroutines (`go.goroutines`), the heap in use (`go.heap_alloc_mb`), and the garbage collections (`go.gc_count`) every 5 seconds. The runtime counts garbage collections since the start, and a line that only ever goes up says little, so `go.gc_count` is the number of collections in each 5-second interval. A goroutine leak shows up as a staircase, a memory leak as a heap that never comes back down. The same goes for file descriptors: `process.open_fds` counts the files and sockets that the app has open (on Windows, all of its handles), and `process.max_fds` is the limit, beyond which every `open` and every new connection fails with "too many open files". Set a threshold in Grafana at 80% of the limit, and a forgotten `resp.Body.Close()` shows up long before it takes the service down. On Linux, the collector counts the entries of /proc/self/fd, which includes the descriptor that it reads the directory with, so it leaves that one out and closes it right away; counting the descriptors does not leak them.
+
+`go.gc_pause_ms` shows how long the garbage collector stopped the app. The runtime keeps a histogram of all pauses since the start (`/gc/pauses:seconds` in the package runtime/metrics), so the collector compares it with the one from 5 seconds ago: the buckets that grew hold the new pauses, and the longest of them becomes the value. Each pause counts only once, and without a garbage collection in the interval, the value is 0. The app itself produces little garbage, so to see the panel move, add `-gc-stress 200` to allocate 200 MB of garbage per second.
 
 
 ## How to get and run the code
@@ -191,10 +579,77 @@ Step 2: `cd` to the source code directory.
 
 Step 3. Run the binary.
 
-    go run diydashboard.go
+    go run .
 
 Now the server is up and running, and the data sources start generating data. In the next step, we install Grafana.
 
+Optional: If you have microcontrollers (an ESP8266 or ESP32, say) that should report sensor values to the dashboard, start the app with a UDP address:
+
+    go run . -udp :3003
+
+Each datagram is a tiny JSON object like `{"m":"temp","v":21.5}`. The app creates a metric named after `m` when it sees the name for the first time. If a sensor sends hundreds of values per second, `-decimate "accel:avg:1s"` stores one average per second instead (or the `min`, `max`, or `last` value; `accel:every:10` keeps every tenth sample).
+
+Decimating tames a sensor that is fast on purpose. A producer that is fast by mistake, like a loop that calls `Add()` without ever waiting for new data, calls for a hard limit. `-rate-limit "udp.*:50"` lets each matching metric accept 50 samples per second, with bursts of up to a second's worth, and drops the rest. `-rate-limit "udp.*:50:coalesce"` keeps the latest of the samples over the limit instead and stores it as soon as the limit allows, so the graph never lags behind by more than one sample. And `-rate-limit "CPU*:10:block"` pushes back on the producer: `Add()` waits until the sample fits, which slows the runaway loop down instead of letting it eat the CPU. (Blocking suits a goroutine of its own, like the ones in `main()`. It does not suit the UDP server, which would then stall every other metric that arrives over UDP.) Either way, the moment a metric exceeds its limit, `app.rate_limited.<metric>` starts counting the samples per second over the limit, so a misbehaving producer shows up on the dashboard rather than going unnoticed.
+
+The opposite of a runaway producer is a metric that hardly ever changes. The space in use on a disk moves by a fraction of a percent per hour, yet the collector stores it every 30 seconds, and a room temperature does much the same. `-deadband "disk.used_pct.*:0.5"` stores a sample of the matching metrics only if it differs from the last stored one by more than 0.5, plus one sample per minute no matter what, so a panel can still tell a flat line from a collector that died. (`-deadband "temp.*:0.2:5m"` sets the keep-alive interval to 5 minutes.) Most samples of a flat metric never reach its buffer, and with `-adaptive-buffers 3600`, the buffer shrinks to match. Between two stored samples, Grafana draws a straight line, which suits slow signals; to draw steps instead, add `-fill "disk.used_pct.*:previous"`.
+
+A related question comes up at query time. A panel asks for about as many points as it is wide in pixels, and if a metric has more points in the time range, grada averages neighboring points. Averages hide spikes. With `-aggregate "CPU*:max"`, the datasource proxy fetches all points of the matching metrics and keeps the maximum of each group instead (or `min`, `sum`, `last`, `p95`, or `avg`). A single panel can choose for itself: put `{"agg": "max"}` into the target's "Additional JSON Data" in the query editor.
+
+The opposite problem comes with sparse data. A probe that reports every five minutes, or a sensor that sends a value only when it changes, leaves gaps wider than Grafana's interval, and Grafana draws them as broken lines. `-fill "probes.*:previous"` makes the proxy fill the gaps of the matching metrics with points at the panel's interval: `previous` repeats the last value, which suits states and counters, while `linear` draws a straight line to the next value, which suits temperatures and the like. Nothing gets added after the last point, so a probe that stopped reporting still shows as a gap at the end. Again, a panel can choose for itself with `{"fill": "linear"}`, or `{"fill": "none"}` to see the raw points.
+
+Mixed sources bring mixed units. The memory collector reports in megabytes, while a service that embeds the dashboard may report the size of its cache in bytes, and a panel that shows both needs one of them converted. Every metric that declares its unit can be converted by the proxy: `-unit "mem.*:GB"` turns the megabytes of the memory metrics into gigabytes, and a panel can ask for itself with `{"unit": "MB"}`. The proxy knows data sizes (`bytes`, `KB`, `MB`, and so on, in powers of 1024, like Grafana), data rates (`Bps`, `KBs`, but also bits per second, as in `Mbits`), times (`ns` up to `d`), and percentages (`percent` and `percentunit`, the fraction between 0 and 1). A `-unit` pattern skips the metrics it cannot convert, like `mem.system.used_pct` in the example, but a panel that asks for megabytes of a percentage gets an error.
+
+Legends are the last thing the proxy can help with. Grafana names each line after its target, and "fleet.host-03.cpu" is a mouthful. Metrics can carry labels, like `host=host-03` for the simulated fleet or `core=1` for the CPU metrics, and `-alias "fleet.*:{{host}}"` names the lines after them. `{{name}}` stands for the metric name, and a label that a metric does not have stays in the legend as `{{label}}`, so that typos are easy to spot. A panel can bring its own template with `{"alias": "core {{core}}"}`, and code that embeds the dashboard can set one per metric with `metric.Label("core", "1").Alias("core {{core}}")`.
+
+Well, almost the last. "Is this busier than yesterday?" needs yesterday's line on today's panel. Grafana can shift the time range of a whole panel, but not of a single query. Start the app with `-time-shift`, add the metric to the panel a second time, and give that target `{"timeShift": "24h"}` (or `"7d"` for last week). The proxy queries the second target for the time range a day earlier, moves its points a day forward, and names the line "CPU1 (24h ago)". Aggregation, gap filling, and aliases apply to the shifted line as to any other.
+
+The app can also watch the metrics by itself and send a notification when a value crosses a threshold for some time:
+
+    go run . -alert "CPU1 > 90 for 30s" -webhook https://example.com/hook
+
+Add `clear` to give the alert some hysteresis: `-alert "CPU1 > 90 clear 75 for 30s"` resolves only after CPU1 has dropped below 75, so a value hovering around 90 does not send a notification every few seconds.
+
+Alert rules can also live in a config file, given by `-config diydashboard.yaml`. The app reloads the file whenever it changes, so you can tune thresholds without restarting:
+
+```yaml
+alerts:
+  - name: cpu-hot
+    expr: CPU1 > 90
+    clear: 75
+    for: 30s
+    notify: [slack]
+```
+
+(JSON is valid YAML, so a config file in JSON works, too. The examples below show the settings in JSON's notation, which fits on one line.)
+
+To mute an alert during maintenance, create a silence through the API server that the app starts on localhost:3002:
+
+    curl -d '{"rule":"cpu-hot","duration":"2h","reason":"kernel update"}' localhost:3002/api/silence
+
+`GET /api/silences` lists the active silences. If you add `http://<host>:3002` as a second SimpleJSON datasource in Grafana and use it for annotations, silences show up as regions on the graphs, and alerts that fire or resolve show up as markers. (Alternatively, `-grafana-annotations` pushes the alert markers straight into Grafana's own annotations API.)
+
+The API server has no authentication, and anyone who reaches it can silence alerts, switch sources, or import data, so it listens on localhost only. Grafana in a Docker container is not localhost, though: it reaches the host as `host.docker.internal`, and for that, the API server must listen on all interfaces, with `-api :3002`. Then keep port 3002 closed in the firewall of the host, or see `-read-only` and the servers with tokens below.
+
+A rule like `-alert "temp absent for 5m"` is a dead man's switch: it fires when the metric "temp" receives no data for five minutes, which is what happens when a sensor or a collector dies quietly.
+
+A single spike above 90% is rarely worth a message; five minutes above 80% usually is. The left side of a rule can be an expression instead of a metric name: `-alert "avg(CPU1, 5m) > 80"` checks the average over the last five minutes. Expressions know `+ - * /`, parentheses, and the functions `abs`, `min`, `max`, `avg`, and `sum`, either over several values, as in `max(CPU1, CPU2)`, or over a metric and a time window, as in `max(CPU1, 10m)`. `rate(go.gc_count, 1m)` turns a counter into a change per second. Since metric names may contain hyphens, a minus needs spaces around it. The same expressions define derived metrics, which are computed from others every second and show up in Grafana like any other metric: `-derive "cpu.avg = avg(CPU1, CPU2)"`, or, in the config file, `"derived": [{"name": "cpu.avg", "expr": "avg(CPU1, CPU2)", "unit": "percent", "interval": "5s"}]`. An alert rule on an expression evaluates it into a derived metric of its own, `alert.<rule>.value`, so you can see in Grafana how close the expression is to the threshold.
+
+Every alert rule also gets a metric named like `alert.CPU1_gt_90` that is 0 while everything is ok, 1 while the threshold is crossed but not yet for long enough, and 2 while the alert fires. Whenever the alert fires or resolves, the app POSTs a small JSON document to the webhook URL. Use `-slack` or `-discord` with an incoming webhook URL to get a chat message instead, or `-smtp` (plus `-mail-from` and `-mail-to`) to get an email. The webhook URLs and the email settings can also go into the config file, where they change without a restart, like the rules do:
+
+```yaml
+notifiers:
+  slack: https://hooks.slack.com/services/T000/B000/XXXX
+  discord: https://discord.com/api/webhooks/000/XXXX
+  email:
+    smtp: mail.example.com:587
+    user: alerts
+    password: ${SMTP_PASSWORD}
+    from: alerts@example.com
+    to: [ops@example.com]
+```
+
+The flags override the file. A rule with `notify: [slack]` sends only to Slack; a rule without `notify` sends to every notifier.
+
 
 ## Install and run Grafana
 
@@ -243,6 +698,8 @@ CONTAINER ID        IMAGE               COMMAND             CREATED
 
 If everything is ok so far, we can head over to step 2.
 
+(By the way, if you would rather skip all the clicking in the next sections: with the Go app running, `go run . provision -datasource-url <URL>` writes a `provisioning` directory with a datasource and a dashboard. Add `-v $PWD/provisioning:/etc/grafana/provisioning` to the `docker run` command above, and Grafana starts fully configured. See below for which `<URL>` to use. The app need not even run: `provision -bundled diydashboard` writes the dashboard that is built into the binary, along with a default config and the demo metrics, via `go:embed`. `go run . defaults` writes these built-in files to a directory, as a starting point for your own config.)
+
 ### Step 2: There is no step 2.
 
 Ok then... let's move on to configuring Grafana.
@@ -268,6 +725,8 @@ After successful login, we arrive at the Home Dashboard.
 
 The first thing to set up is our custom data source. For this, click on "Add Data Source".
 
+(Shortcut: create an API key in Grafana, then restart the Go app with `DIYDASHBOARD_GRAFANA_TOKEN=<key> go run . -grafana-url http://localhost:3000 -provision-datasource -datasource-url <URL>`, where `<URL>` is the URL described below. The app then creates the data source through Grafana's HTTP API, and you can skip this section.)
+
 On the screen that opens, fill in the following fields:
 
 * Name: Choose a name you like.
@@ -349,6 +808,8 @@ So when you now insert the URL `http://diydashboard:3001` and click Add (or Save
 
 Now we can go ahead and create a dashboard.
 
+(Shortcut: while the Go app is running, `go run . gen-dashboard -o dashboard.json` writes a complete dashboard with one panel per metric, grouped into rows by collector (CPU, disk, probes, and so on). Import this file through Grafana's "Import dashboard" dialog, and you are done. But clicking through the steps once is a good way to learn how Grafana works.)
+
 For this, click on "Create your first dashboard". The screen will change to:
 
 ![New Dashboard](Grafana06_ChangeTimeRange.png)
@@ -377,7 +838,7 @@ Ensure that our Go app is still running, then click on "select metric".
 
 ![Select Metric](Grafana11_SelectMetric.png)
 
-In the dropdown that opens, you should see the two data sources "CPU1" and "CPU2" that we created in the Go app. Grafana queries our app for all available metrics and presents them here.
+In the dropdown that opens, you should see the data sources "CPU1", "CPU2", and so on, one per CPU core, that we created in the Go app. Grafana queries our app for all available metrics and presents them here.
 
 Select "CPU1", and the graph area should immediately show some data, as far as the Go app has already generated it after starting.
 
@@ -387,7 +848,7 @@ A dashboard can contain many panels, so you will want to give each panel a name.
 
 ![Change Title](Grafana13_ChangeTitle.png)
 
-If you want, you can have the panel show more than one metric. Our app generates two metrics, so let's add "CPU2" to our panel.
+If you want, you can have the panel show more than one metric. Our app generates a metric per core, so let's add "CPU2" to our panel.
 
 ![CPU2 Selected](Grafana14_AddMetricCPU2.png)
 
@@ -397,6 +858,81 @@ Click the close button in the top right corner to exit edit mode. If everything
 
 Congrats! Your personal dashboard is up and running. You can now edit the panel again and play around with the look and feel, or you can add other panels like a single value (the "Singlestat" panel), a bar graph, or a plain list.
 
+If a panel stays empty, run the app with `-debug-http` and point the datasource URL to `http://localhost:3004` instead. The app then logs every request that Grafana sends, and which metrics with how many points went back.
+
+A few CPU curves are not much to play with. Run `go run . demo` instead, and the app serves ten example metrics with all sorts of shapes: cycles, random walks, spikes, steps, and seasons. Add `-sync-dashboard -grafana-url http://localhost:3000` to get a matching dashboard right away. The graphs need not fill up slowly, either: at startup, the demo metrics get a plausible history that covers the whole time range, so the first look at a panel shows a complete graph.
+
+To practice dashboards with template variables, run the app with `-fleet 10`. It simulates ten hosts, each with the metrics `fleet.host-01.cpu`, `.mem`, and `.net`, which rise and fall together with the load of the host. Add the API server (`http://localhost:3002`) as a second SimpleJSON datasource, create a dashboard variable `host` with the query `label_values(host)` on it, and let a panel with the target `fleet.$host.cpu` repeat for each host.
+
+For screenshots or a class, a day's worth of data is nicer than five minutes. `go run . demo -speed 60 -retention 24h` lets time run 60 times faster, so the demo metrics start with a day of history, and Grafana's "Last 24 hours" view moves by an hour each minute. In this mode, Grafana must query the app through the proxy on port 3004, which stretches the time axis.
+
+Over several days, one demo metric comes into its own: `demo.office_requests` follows a calendar instead of the dashboard's time range. It is busy on weekdays from 9 to 5, picks up and winds down over an hour around opening and closing time, dips a little over lunch, and stays quiet at night and on weekends. `-business-hours "Mon-Sat 8-18 holidays=2026-12-24,2026-12-25"` changes the office hours; on holidays, the line stays flat. With `-speed 3600 -retention 168h`, a week passes in under three minutes, a good start for a capacity-planning demo.
+
+Once you have tuned a dashboard by hand, keep it safe: `go run . pull-dashboard -grafana-url http://localhost:3000 <uid>` downloads the dashboard into `<uid>.json`, ready to be committed to git next to your code. (The UID is the part of the dashboard's URL after `/d/`.) Grafana needs a service account token for this; pass it in the environment variable `DIYDASHBOARD_GRAFANA_TOKEN`.
+
+A new dashboard starts with empty graphs, but the data of the past may well exist somewhere, in a spreadsheet, say, with a row per meter reading. Export it as CSV, with the timestamp in the first column, and while the app is running, `go run . import -metric power -file history.csv` loads it into a new metric `power`. Grafana shows the history right away, and with a larger time range, you see the whole of it. Timestamps can be Unix seconds or milliseconds, or dates like `2026-03-01 12:00` in the local zone (`-timezone` says otherwise); a header line is fine, and `-column "kWh"` picks the column of the values by its name. Files with semicolons and decimal commas, as spreadsheets in much of Europe write them, work, too. The app sizes the buffer of the metric to fit the history plus the usual retention, so live values can follow. It keeps everything in memory, though, so the import is gone when the app restarts; run it again from the script that starts the app. Only a metric without data takes history: grada keeps the points of a metric in the order they arrive, so an import into a metric with data fails.
+
+Everything beyond the CPU metrics lives in the package `github.com/appliedgo/diydashboard/dashboard`, so your own services can embed the dashboard instead of copying `main()`: `dashboard.ParseOptions(os.Args[1:])` reads the flags of diydashboard, like `-config` and `-api`, from the command line, `dashboard.New(grada.GetDashboard(), opts)` returns an `App` with these options, `app.Metric("requests")` returns a metric to `Add()` values to, and `app.Run()` switches on whatever the command line flags ask for and runs until Ctrl-C or SIGTERM. All the background work of the app (servers, generators, collectors) runs in one group: on a signal, or when one part fails, everything stops, the HTTP servers finish the requests in flight, and `Run()` returns the error if there was one. `app.Go()` adds your own background work to that group. A service with flags of its own calls `dashboard.DefineFlags(flag.CommandLine)` before `flag.Parse()` instead, the way `main()` does, so that `-h` lists both kinds of flags; the names must not clash. An unknown flag is an error that `ParseOptions` returns, rather than a reason to exit.
+
+Derived metrics work from code, too. Say the server in the basement runs hot every summer, and you want to know whether that is the server or just the summer. The service already records the server's temperature; the outside temperature has to come from somewhere else, here a function `outsideTemp()` that asks the weather service of your choice. `app.Derive()` combines the two into a third metric:
+
+    opts, err := dashboard.ParseOptions(os.Args[1:])
+    if err != nil {
+    	log.Fatalln(err)
+    }
+    app, err := dashboard.New(grada.GetDashboard(), opts)
+    if err != nil {
+    	log.Fatalln(err)
+    }
+    outside, err := app.Metric("weather.outside")
+    if err != nil {
+    	log.Fatalln(err)
+    }
+    app.Go(func(ctx context.Context) error {
+    	for {
+    		if t, err := outsideTemp(); err == nil {
+    			outside.Add(t)
+    		}
+    		select {
+    		case <-time.After(10 * time.Minute):
+    		case <-ctx.Done():
+    			return nil
+    		}
+    	}
+    })
+    excess, err := app.Derive("server.excess_temp", "server.temp - weather.outside")
+    if err != nil {
+    	log.Fatalln(err)
+    }
+    excess.Describe("celsius", "Server temperature above the outside temperature")
+    log.Fatalln(app.Run())
+
+Every second, `server.excess_temp` gets the latest server temperature minus the latest outside temperature, so the slow weather metric and the fast server metric need not line up. A flat line through the summer means the server is fine and the basement is hot; a rising line means it is time to clean the fans. This app can do the same without any code: `-derive "server.excess_temp = temp.coretemp.Package_id_0 - weather.outside"` takes the server temperature from the temperature sensors, and a thermometer on an ESP32 that sends `{"m":"weather.outside","v":21.5}` to `-udp` stands in for the weather service.
+
+Some things a service wants to record are not values but events: a user logged in, a payment failed. `app.Count("logins")` records one such event, and every 10 seconds, the number of events since the last time becomes a value of the metric `logins`, with a 0 for 10 seconds without any. So the login handler just calls `app.Count("logins")`, with no timestamps and no rates to keep track of, and the panel shows the logins per 10 seconds. The first call creates the metric; the calls after that only increment a counter, so they are cheap enough for every request.
+
+Durations are the other thing that services measure all the time. `defer latency.StartTimer().Stop()` at the top of a handler times the handler: `StartTimer()` notes the time, and `Stop()` adds the time since then to the metric `latency`, in milliseconds. Every request becomes a value of its own, so the metric holds the distribution of the latencies rather than an average. Grafana's histogram panel shows that distribution directly, and a time series panel with `{"agg": "p95"}` as the target's data (see `-aggregate` above) shows the 95th percentile over time. A busy handler adds many values per second, more than the buffer of a metric with one value per second can hold for long, so add `-adaptive-buffers` to let the buffer grow.
+
+To keep the dashboard running on a home-lab box without Docker, install it as a service: `sudo diydashboard service install -config /etc/diydashboard.json` writes a systemd unit, enables it, and starts it, so that the app comes up at boot and restarts when it fails. App flags go after `--`, as in `service install -- -udp :3003`; relative paths resolve against the directory where you ran the install. On Windows, the same command (from an administrator prompt) registers a Windows service, which logs to `diydashboard.log` in that directory. `service uninstall` removes the service again, and `-print` shows the systemd unit without installing it.
+
+One app can also back several Grafana datasources, each with a metric name space of its own. Declare namespaces in the config file, as in `"namespaces": [{"name": "home", "token": "..."}, {"name": "work-probes", "prefix": "probes.", "addr": ":3005"}]`. A namespace holds the metrics whose names start with its prefix (by default, the name and a dot), and serves them with the prefix removed: the datasource proxy serves "home" under `http://localhost:3004/ns/home`, where `home.temp` shows up as `temp`, and "work-probes" gets port 3005 to itself. A datasource for one namespace cannot see or query the metrics of another. With a token, the Grafana datasource must send it, either as the basic auth password or as a custom header `Authorization: Bearer <token>`.
+
+Namespaces rename metrics; servers do not. To expose the same app twice, say a public Grafana that may see the CPU load and nothing else, and an internal one that sees everything and may create metrics and silence alerts, declare servers: `"servers": [{"name": "public", "addr": ":4001", "metrics": ["CPU*"]}, {"name": "internal", "addr": ":4002", "admin": true, "token": "..."}]`. Each server is a complete SimpleJSON datasource on its own port, with annotations. A server with `metrics` patterns only lists and answers for the matching metrics; one without shares all of them. The API endpoints (`/api/metrics`, `/api/silence`, and the rest) are there only with `"admin": true`.
+
+Servers split one app into several datasources; agents do the opposite. With a diydashboard on every machine of the homelab, one of them can pull in the metrics of the others, so that a single Grafana datasource shows them all: `"agents": [{"name": "nas", "url": "http://nas.local:3001"}, {"name": "pi", "url": "http://pi.local:3001", "metrics": ["temp.*"]}]`. Every 10 seconds (or the agent's `"interval"`), the app asks each agent for its metrics and their new samples, like Grafana would, and adds them to metrics of its own, prefixed with the agent's name: `nas.CPU1`, `pi.temp.cpu_thermal.temp1`. The samples keep the time they were taken, and the first pull fetches the whole time range, so the graphs start out complete. Alert rules, derived metrics, and generated dashboards treat the pulled metrics like any other. The URL can point to anything that Grafana could use as the agent's datasource, including a namespace with a `"token"`. When an agent goes down, its metrics stop updating, and the log says so once, not every 10 seconds.
+
+All those tokens need not sit in the config file in plain text, where they end up in git along with the rest. Any `"token"` (and Grafana's `"apiKey"`), the webhook URLs of the `notifiers`, and the SMTP password in `notifiers.email.password` can refer to the secret instead: `"token": "${NAS_TOKEN}"` reads the environment variable `NAS_TOKEN`, and `"token": "file:/run/secrets/nas_token"` reads the file, like the secrets that Docker and Kubernetes mount into a container. A trailing newline in the file does not count. If the variable is not set or the file cannot be read, the config file counts as invalid, and the error message names the reference but never the secret. The secrets from the environment work the same way: instead of `DIYDASHBOARD_GRAFANA_TOKEN` or `DIYDASHBOARD_SMTP_PASSWORD`, set `DIYDASHBOARD_GRAFANA_TOKEN_FILE` or `DIYDASHBOARD_SMTP_PASSWORD_FILE` to the path of a file with the secret. The notifiers change with the config file, so a rotated webhook URL or SMTP password takes effect with the next change of the file; Grafana's settings, the namespaces, the servers, and the agents are read only at startup and need a restart.
+
+Typing the URL of every machine into the config file gets old once the homelab grows. Start each app with `-mdns`, and it announces its datasource on the LAN through multicast DNS, the way printers and media servers announce themselves, as `<hostname>._diydashboard._tcp.local`. `diydashboard discover` lists the apps that answer, with their URLs, and `diydashboard discover -json` writes them as the `"agents"` of a config file, ready to paste. Or skip the config file altogether: with `-join`, the app looks for the others every minute and pulls in the metrics of each new one as an agent named after its host, so a new Raspberry Pi shows up in Grafana as `pi.CPU1` and so on a minute after it boots. The app leaves itself out, and the agents of the config file, too. Apps that find each other pull from each other, but not back what they pulled: metrics whose name starts with the app's own host name, or with the name of one of its agents, get skipped, so `pi.nas.CPU1` never turns into `nas.pi.nas.CPU1`. Multicast DNS does not cross routers, and some firewalls block it (UDP port 5353); the config file works everywhere.
+
+Agents copy the metrics of another instance; sometimes it is enough to ask it. Say Grafana's dashboards still read from an older SimpleJSON backend, and you want to move them over to this app one metric at a time. Start the app with `-upstream http://old-backend:3003` and point Grafana's datasource to the proxy (`-proxy`) instead of the old backend. For every /query request, the proxy answers the targets that are metrics of the app, forwards the others to the old backend, and merges the two responses into one; /search lists the metrics of both, so the metric picker offers the old names, too. A panel cannot tell where its series came from, so each metric can move whenever it is ready, and once no panel asks the old backend for anything, it can go. If the old backend is down or slow (`-query-timeout`), its panels show "no data" while the others stay complete. The series from the old backend come as they are; aggregating, converting units, and the like work on the app's own metrics only.
+
+Big overview dashboards have a cost: fifty panels that each fetch every point of a metric, every five seconds. With `-preview 1m`, every metric gets a companion series with one average per minute, named like `CPU1.preview`, and that includes the metrics created later on. Point the panels of an overview dashboard to the previews, and keep the full-resolution metrics for the detail panels. Generated dashboards leave the previews out.
+
+The other way around, a summary panel wants less than a graph: how high did the CPU load go yesterday, and what was the average? The buffers hold minutes, not days, so with `-rollups`, the app keeps the minimum, maximum, and average of every metric per day, for a week, and the proxy answers the target `rollup:yesterday` with a table, one row per metric. Put a table panel with that target next to the live graphs, and pick "Table" as the format of the query. `rollup:today` shows the day so far, `rollup:2026-10-15` a day of the past week, and `rollup:yesterday:CPU*` only the metrics that match. The days begin at midnight in the `-timezone` zone, and with `-speed`, they pass as fast as the simulated time.
+
+If the app is reachable from beyond your own network, start it with `-read-only`. The API server then answers only what a Grafana datasource asks for (`/search`, `/query`, and `/annotations`) and refuses the rest with 403 Forbidden: nobody can silence your alerts, switch the sources of metrics, or browse the catalog. `-udp` is refused at startup, as it would take samples from anyone.
+
 And, of course, you can go ahead and connect any time series data to the dashboard. How about network activity? Disk usage? The number of emails in your inbox? The temperature history of Death Valley? Or any other data you can think of (and find or write a Go library for).
 
 **Happy coding!**
@@ -1,8 +1,9 @@
 module github.com/appliedgo/diydashboard
 
-go 1.13
+go 1.16
 
 require (
 	github.com/christophberger/grada v0.0.0-20171107123403-5b073dc6bb99
-	github.com/google/go-cmp v0.5.6 // indirect
+	github.com/google/go-cmp v0.5.9 // indirect
+	sigs.k8s.io/yaml v1.4.0
 )